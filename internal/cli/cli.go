@@ -1,9 +1,17 @@
 package cli
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"os"
+	"os/signal"
 	"strconv"
 	"strings"
 	"text/tabwriter"
@@ -14,6 +22,7 @@ import (
 // CLI manages the command-line interface
 type CLI struct {
 	args []string
+	yes  bool // -y/--yes: answer yes to every confirmation
 }
 
 // NewCLI creates a new CLI instance
@@ -23,6 +32,21 @@ func NewCLI(args []string) *CLI {
 
 // Run executes the CLI based on arguments
 func (c *CLI) Run() int {
+	// -n/--dry-run and -y/--yes come before the command and apply to all
+	// of them
+flags:
+	for len(c.args) > 1 {
+		switch c.args[1] {
+		case "-n", "--dry-run":
+			partition.DryRun = true
+		case "-y", "--yes":
+			c.yes = true
+		default:
+			break flags
+		}
+		c.args = append(c.args[:1:1], c.args[2:]...)
+	}
+
 	if len(c.args) < 2 {
 		c.printUsage()
 		return 1
@@ -30,6 +54,11 @@ func (c *CLI) Run() int {
 
 	command := c.args[1]
 
+	if partition.DryRun && noDryRunCommands[command] {
+		fmt.Fprintf(os.Stderr, "Error: %s does not support -n/--dry-run\n", command)
+		return 1
+	}
+
 	switch command {
 	case "list":
 		return c.listCommand()
@@ -41,10 +70,18 @@ func (c *CLI) Run() int {
 		return c.formatCommand()
 	case "resize":
 		return c.resizeCommand()
+	case "wipe":
+		return c.wipeCommand()
 	case "copy":
 		return c.copyCommand()
+	case "clone-disk":
+		return c.cloneDiskCommand()
 	case "info":
 		return c.infoCommand()
+	case "health":
+		return c.healthCommand()
+	case "find-uuid":
+		return c.findUUIDCommand()
 	case "align":
 		return c.alignCommand()
 	case "attr-list":
@@ -53,6 +90,38 @@ func (c *CLI) Run() int {
 		return c.attrSetCommand()
 	case "attr-unset":
 		return c.attrUnsetCommand()
+	case "label":
+		return c.labelCommand()
+	case "fstab":
+		return c.fstabCommand()
+	case "settype":
+		return c.setTypeCommand()
+	case "batch":
+		return c.batchCommand()
+	case "backup":
+		return c.backupCommand()
+	case "restore":
+		return c.restoreCommand()
+	case "prepare":
+		return c.prepareCommand()
+	case "attach-image":
+		return c.attachImageCommand()
+	case "detach-image":
+		return c.detachImageCommand()
+	case "filesystems":
+		return c.filesystemsCommand()
+	case "grow-to-fs":
+		return c.growToFSCommand()
+	case "show":
+		return c.showCommand()
+	case "create-pool":
+		return c.createPoolCommand()
+	case "apply":
+		return c.applyCommand()
+	case "completion":
+		return c.completionCommand()
+	case "__complete":
+		return c.completeCommand()
 	case "help", "-h", "--help":
 		c.printUsage()
 		return 0
@@ -63,90 +132,388 @@ func (c *CLI) Run() int {
 	}
 }
 
+// noDryRunCommands are the commands that change disks without going
+// through the operations that honor partition.DryRun. They refuse to run
+// in dry-run mode rather than make changes.
+var noDryRunCommands = map[string]bool{
+	"attr-set":     true,
+	"attr-unset":   true,
+	"restore":      true,
+	"prepare":      true,
+	"attach-image": true,
+	"detach-image": true,
+	"grow-to-fs":   true,
+	"create-pool":  true,
+}
+
+// reportSuccess prints the message for a completed operation, or in
+// dry-run mode a note that nothing was changed
+func reportSuccess(message string) {
+	if partition.DryRun {
+		fmt.Println("Dry run: no changes were made")
+		return
+	}
+	fmt.Println(message)
+}
+
+// errNoTerminal is returned by confirm when there is nobody to ask
+var errNoTerminal = errors.New("stdin is not a terminal, so the confirmation can't be asked for; pass -y (or the command's -f) to confirm in advance")
+
+// stdinIsTerminal reports whether stdin is a terminal a confirmation can
+// be typed on, rather than a pipe, a file or /dev/null
+func stdinIsTerminal() bool {
+	info, err := os.Stdin.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// confirm asks prompt and reports whether the reply was answer, such as
+// "yes" or the name of the device at stake. It doesn't ask, and reports
+// true, when skip (usually a command's -f) or the global -y is set or in
+// dry-run mode. Without a terminal on stdin it returns errNoTerminal
+// rather than wait for a reply that will never come.
+func (c *CLI) confirm(skip bool, prompt, answer string) (bool, error) {
+	if skip || c.yes || partition.DryRun {
+		return true, nil
+	}
+	if !stdinIsTerminal() {
+		return false, errNoTerminal
+	}
+
+	fmt.Print(prompt)
+	var reply string
+	fmt.Scanln(&reply)
+	return reply == answer, nil
+}
+
+// confirmCommand is confirm for commands. It reports whether to go ahead
+// and, if not, the exit status: 0 after printing cancelled when the reply
+// was something else, 1 after printing the error when there was nobody to
+// ask.
+func (c *CLI) confirmCommand(skip bool, prompt, answer, cancelled string) (int, bool) {
+	ok, err := c.confirm(skip, prompt, answer)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1, false
+	}
+	if !ok {
+		fmt.Println(cancelled)
+		return 0, false
+	}
+	return 0, true
+}
+
 // printUsage prints CLI usage information
 func (c *CLI) printUsage() {
 	fmt.Println("PGPart - Partition Manager for FreeBSD/GhostBSD")
 	fmt.Println("\nUsage:")
-	fmt.Println("  pgpart [command] [options]")
+	fmt.Println("  pgpart [-n] [-y] [command] [options]")
 	fmt.Println("\nCommands:")
-	fmt.Println("  list                    List all disks and partitions")
-	fmt.Println("  create <disk> <size> <fstype>")
+	fmt.Println("  list [-o table|csv|json]")
+	fmt.Println("                          List all disks and partitions")
+	fmt.Println("  create [-i index] [-label label] [-a alignment] <disk> <size> <fstype>")
 	fmt.Println("                          Create a new partition")
 	fmt.Println("  delete <disk> <index>   Delete a partition")
-	fmt.Println("  format <partition> <fstype>")
+	fmt.Println("  format [-L label] [-b blocksize] [-m reserved%] <partition> <fstype>")
 	fmt.Println("                          Format a partition")
-	fmt.Println("  resize <disk> <index> <size>")
+	fmt.Println("  resize [-allow-mounted] <disk> <index> <size>")
 	fmt.Println("                          Resize a partition")
-	fmt.Println("  copy <source> <dest>    Copy partition data")
-	fmt.Println("  info <disk>             Show detailed disk information")
-	fmt.Println("  align <disk|partition>  Check partition alignment")
+	fmt.Println("  wipe [-f] [-passes n] [-method m] <partition|disk>")
+	fmt.Println("                          Overwrite a partition or disk so its data is unrecoverable")
+	fmt.Println("  copy [-verify] [-chunk size] [-workers n] [-offset bytes] <source> <dest>")
+	fmt.Println("                          Copy partition data, optionally verifying it")
+	fmt.Println("  clone-disk [-f] <source> <dest>")
+	fmt.Println("                          Copy a whole disk, partition table included, onto another")
+	fmt.Println("  info [-json] <disk>     Show detailed disk information")
+	fmt.Println("  health [-json]          Summarize SMART health of all disks")
+	fmt.Println("  find-uuid <uuid>        Print the partition with a GPT partition GUID")
+	fmt.Println("  align [-fix [-apply] [-f]] <disk|partition>")
+	fmt.Println("                          Check partition alignment and show how to fix it")
 	fmt.Println("  attr-list <partition>   List GPT attributes")
 	fmt.Println("  attr-set <partition> <attribute>")
 	fmt.Println("                          Set a GPT attribute")
 	fmt.Println("  attr-unset <partition> <attribute>")
 	fmt.Println("                          Unset a GPT attribute")
+	fmt.Println("  label <partition> <newlabel>")
+	fmt.Println("                          Change the GPT label of a partition")
+	fmt.Println("  fstab [-raw] <partition> [mountpoint]")
+	fmt.Println("                          Print the /etc/fstab entry of a partition")
+	fmt.Println("  settype <partition> <type>")
+	fmt.Println("                          Change the type of a partition in place")
+	fmt.Println("  batch [--dry-run] [-k] [-timeout d] <file|->")
+	fmt.Println("                          Run queued operations from a file or stdin")
+	fmt.Println("  backup <disk> <file>    Save a disk's partition table to a file")
+	fmt.Println("  restore [-f] <disk> <file>")
+	fmt.Println("                          Restore a partition table saved by backup")
+	fmt.Println("  prepare [-export-pools] <disk>")
+	fmt.Println("                          Turn off swap and unmount everything on a disk")
+	fmt.Println("  attach-image [-S sectorsize] <file>")
+	fmt.Println("                          Attach a disk image as an md device")
+	fmt.Println("  detach-image <md>       Detach an md device")
+	fmt.Println("  filesystems [-json]     List the filesystems pgpart can format")
+	fmt.Println("  show <disk>             Draw a disk's partition layout as text")
+	fmt.Println("  grow-to-fs <disk> <index>")
+	fmt.Println("                          Grow a partition entry to the filesystem inside it")
+	fmt.Println("  create-pool [-f] [-type layout] <pool> <partition>...")
+	fmt.Println("                          Create a ZFS pool (stripe, mirror, raidz, raidz2)")
+	fmt.Println("  apply [-f] <disk> <layout-file>")
+	fmt.Println("                          Partition and format an empty disk from a JSON or TOML layout")
+	fmt.Println("  completion <bash|zsh|fish>")
+	fmt.Println("                          Print a shell completion script")
 	fmt.Println("  help                    Show this help message")
 	fmt.Println("\nOptions:")
 	fmt.Println("  -gui                    Launch graphical interface (default if no command)")
+	fmt.Println("  -n, --dry-run           Print the commands create, delete, format, resize,")
+	fmt.Println("                          wipe, copy, clone-disk, label, settype, batch and apply would")
+	fmt.Println("                          run without running them")
+	fmt.Println("  -y, --yes               Answer yes to every confirmation, like each command's -f;")
+	fmt.Println("                          without it, commands that must confirm fail when stdin is")
+	fmt.Println("                          not a terminal")
 	fmt.Println("\nExamples:")
 	fmt.Println("  pgpart list")
+	fmt.Println("  pgpart list -o csv > disks.csv")
 	fmt.Println("  pgpart create ada0 10G ufs")
+	fmt.Println("  pgpart -n create ada0 10G ufs")
+	fmt.Println("  pgpart -y delete ada0 3")
 	fmt.Println("  pgpart delete ada0 3")
 	fmt.Println("  pgpart format ada0p3 ext4")
+	fmt.Println("  pgpart format -L data -m 1 ada0p3 ufs")
 	fmt.Println("  pgpart resize ada0 2 20G")
+	fmt.Println("  pgpart wipe -passes 3 -method random ada1p2")
 	fmt.Println("  pgpart copy ada0p1 ada0p2")
+	fmt.Println("  pgpart copy -verify -workers 8 ada0p1 ada1p1")
+	fmt.Println("  pgpart clone-disk ada0 ada1")
 	fmt.Println("  pgpart info ada0")
+	fmt.Println("  pgpart health")
+	fmt.Println("  pgpart find-uuid 5f3c0004-8d2e-11ee-b9d1-0242ac120006")
 	fmt.Println("  pgpart align ada0")
+	fmt.Println("  pgpart align -fix ada0")
 	fmt.Println("  pgpart attr-list ada0p1")
 	fmt.Println("  pgpart attr-set ada0p1 bootme")
 	fmt.Println("  pgpart attr-unset ada0p1 bootme")
+	fmt.Println("  pgpart label ada0p3 data0")
+	fmt.Println("  pgpart fstab ada1p1 /data >> /etc/fstab")
+	fmt.Println("  pgpart settype ada1p2 linux-data")
+	fmt.Println("  cat ops.txt | pgpart batch -")
+	fmt.Println("  pgpart backup ada0 ada0.gpt")
+	fmt.Println("  pgpart restore -f ada0 ada0.gpt")
+	fmt.Println("  pgpart prepare ada1")
+	fmt.Println("  pgpart attach-image -S 4096 disk.img")
+	fmt.Println("  pgpart detach-image md0")
+	fmt.Println("  pgpart filesystems")
+	fmt.Println("  pgpart show ada0")
+	fmt.Println("  pgpart grow-to-fs ada0 3")
+	fmt.Println("  pgpart create-pool -type mirror tank ada1p1 ada2p1")
+	fmt.Println("  pgpart apply ada2 layout.toml")
+	fmt.Println("  source <(pgpart completion bash)")
 	fmt.Println("\nNote: Most operations require root privileges")
 }
 
 // listCommand lists all disks and partitions
 func (c *CLI) listCommand() int {
+	fs := flag.NewFlagSet("list", flag.ExitOnError)
+	var output string
+	fs.StringVar(&output, "o", "table", "Output format: table, csv or json")
+	fs.StringVar(&output, "output", "table", "Output format: table, csv or json")
+	jsonOutput := fs.Bool("json", false, "Print the disks and partitions as JSON (same as -o json)")
+	if err := fs.Parse(c.args[2:]); err != nil {
+		fmt.Fprintf(os.Stderr, "Error parsing arguments: %v\n", err)
+		return 1
+	}
+	if *jsonOutput {
+		output = "json"
+	}
+	if output != "table" && output != "csv" && output != "json" {
+		fmt.Fprintf(os.Stderr, "Error: unknown output format %q (use table, csv or json)\n", output)
+		return 1
+	}
+
 	disks, err := partition.GetDisks()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error detecting disks: %v\n", err)
 		return 1
 	}
 
+	switch output {
+	case "json":
+		err = writeListJSON(os.Stdout, disks)
+	case "csv":
+		err = writeListCSV(os.Stdout, disks)
+	default:
+		err = writeListTable(os.Stdout, disks)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing disk list: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// listRow holds what the list command prints about one partition, along
+// with its disk. A disk without partitions has a row with only the disk
+// fields set. Sizes are in bytes; Used and Free are only known for mounted
+// filesystems df can report on.
+type listRow struct {
+	Disk       string
+	Model      string
+	DiskSize   uint64
+	Scheme     string
+	Partition  string
+	Size       uint64
+	Type       string
+	FileSystem string
+	Label      string
+	MountPoint string
+	Used       uint64
+	Free       uint64
+	HasUsage   bool
+}
+
+// listRows returns the rows of a disk: one per partition, or a single row
+// for the disk alone if it has none
+func listRows(disk partition.Disk) []listRow {
+	diskRow := listRow{
+		Disk:     disk.Name,
+		Model:    disk.Model,
+		DiskSize: disk.Size,
+		Scheme:   disk.Scheme,
+	}
+	if len(disk.Partitions) == 0 {
+		return []listRow{diskRow}
+	}
+
+	rows := make([]listRow, 0, len(disk.Partitions))
+	for _, part := range disk.Partitions {
+		row := diskRow
+		row.Partition = part.Name
+		row.Size = part.Size * 512
+		row.Type = part.Type
+		row.FileSystem = part.FileSystem
+		row.Label = part.Label
+		row.MountPoint = part.MountPoint
+		row.Used, row.Free, row.HasUsage = partitionUsage(part.MountPoint)
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// partitionUsage returns the used and free space of a mounted filesystem,
+// and false when it isn't mounted or df can't report it
+func partitionUsage(mountPoint string) (used, free uint64, ok bool) {
+	if mountPoint == "" {
+		return 0, 0, false
+	}
+	used, total, err := partition.GetUsage(mountPoint)
+	if err != nil || total == 0 {
+		return 0, 0, false
+	}
+	if total > used {
+		free = total - used
+	}
+	return used, free, true
+}
+
+// writeListJSON writes the disks and their partitions as JSON
+func writeListJSON(w io.Writer, disks []partition.Disk) error {
+	if disks == nil {
+		disks = []partition.Disk{}
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(disks)
+}
+
+// listCSVHeader is the header row of list -o csv. Scripts read columns by
+// name, so new columns go at the end.
+var listCSVHeader = []string{
+	"disk", "model", "disk_size_bytes", "scheme", "partition", "size_bytes",
+	"type", "filesystem", "label", "mount_point", "used_bytes", "free_bytes",
+}
+
+// writeListCSV writes one CSV row per partition, repeating the disk on
+// each, with sizes in bytes. Fields that don't apply are left empty.
+func writeListCSV(w io.Writer, disks []partition.Disk) error {
+	out := csv.NewWriter(w)
+	if err := out.Write(listCSVHeader); err != nil {
+		return err
+	}
+
+	optional := func(n uint64, ok bool) string {
+		if !ok {
+			return ""
+		}
+		return strconv.FormatUint(n, 10)
+	}
+
+	for _, disk := range disks {
+		for _, row := range listRows(disk) {
+			record := []string{
+				row.Disk, row.Model, strconv.FormatUint(row.DiskSize, 10), row.Scheme,
+				row.Partition, optional(row.Size, row.Partition != ""),
+				row.Type, row.FileSystem, row.Label, row.MountPoint,
+				optional(row.Used, row.HasUsage), optional(row.Free, row.HasUsage),
+			}
+			if err := out.Write(record); err != nil {
+				return err
+			}
+		}
+	}
+
+	out.Flush()
+	return out.Error()
+}
+
+// writeListTable writes the disks as aligned text, each followed by a
+// table of its partitions and any layout warnings
+func writeListTable(w io.Writer, disks []partition.Disk) error {
 	if len(disks) == 0 {
-		fmt.Println("No disks found")
-		return 0
+		_, err := fmt.Fprintln(w, "No disks found")
+		return err
 	}
 
-	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
-	fmt.Fprintln(w, "DISK\tSIZE\tSCHEME\tPARTITIONS")
-	fmt.Fprintln(w, "----\t----\t------\t----------")
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "DISK\tSIZE\tSCHEME\tPARTITIONS")
+	fmt.Fprintln(tw, "----\t----\t------\t----------")
+
+	dash := func(s string) string {
+		if s == "" {
+			return "-"
+		}
+		return s
+	}
 
 	for _, disk := range disks {
-		sizeGB := float64(disk.Size) / (1024 * 1024 * 1024)
-		fmt.Fprintf(w, "%s\t%.2f GB\t%s\t%d\n", disk.Name, sizeGB, disk.Scheme, len(disk.Partitions))
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\n", disk.Name, partition.FormatBytes(disk.Size), disk.Scheme, len(disk.Partitions))
 
 		if len(disk.Partitions) > 0 {
-			fmt.Fprintln(w, "\nPARTITION\tSIZE\tTYPE\tFILESYSTEM\tMOUNT")
-			fmt.Fprintln(w, "---------\t----\t----\t----------\t-----")
-			for _, part := range disk.Partitions {
-				partSizeGB := float64(part.Size) / (1024 * 1024 * 1024)
-				mount := part.MountPoint
-				if mount == "" {
-					mount = "-"
+			fmt.Fprintln(tw, "\nPARTITION\tSIZE\tTYPE\tFILESYSTEM\tLABEL\tMOUNT\tUSED\tFREE")
+			fmt.Fprintln(tw, "---------\t----\t----\t----------\t-----\t-----\t----\t----")
+			for _, row := range listRows(disk) {
+				used, free := "-", "-"
+				if row.HasUsage {
+					used, free = partition.FormatBytes(row.Used), partition.FormatBytes(row.Free)
 				}
-				fmt.Fprintf(w, "%s\t%.2f GB\t%s\t%s\t%s\n",
-					part.Name, partSizeGB, part.Type, part.FileSystem, mount)
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+					row.Partition, partition.FormatBytes(row.Size), row.Type, row.FileSystem,
+					dash(row.Label), dash(row.MountPoint), used, free)
 			}
-			fmt.Fprintln(w, "")
+			for _, problem := range partition.ValidateDiskLayout(&disk) {
+				fmt.Fprintf(tw, "  warning: %s\n", problem)
+			}
+			fmt.Fprintln(tw, "")
+		} else if disk.LayoutProblem != "" {
+			fmt.Fprintf(tw, "  warning: %s\n\n", disk.NoPartitionsReason())
 		}
 	}
-	w.Flush()
 
-	return 0
+	return tw.Flush()
 }
 
 // createCommand creates a new partition
 func (c *CLI) createCommand() int {
 	fs := flag.NewFlagSet("create", flag.ExitOnError)
+	index := fs.Int("i", 0, "Partition index (default: first free index)")
+	label := fs.String("label", "", "GPT label for the new partition")
+	alignStr := fs.String("a", "", "Align the partition to this boundary, e.g. 1M, or \"auto\" for the disk's optimum (default: gpart's)")
 	if err := fs.Parse(c.args[2:]); err != nil {
 		fmt.Fprintf(os.Stderr, "Error parsing arguments: %v\n", err)
 		return 1
@@ -154,8 +521,10 @@ func (c *CLI) createCommand() int {
 
 	args := fs.Args()
 	if len(args) < 3 {
-		fmt.Fprintln(os.Stderr, "Usage: pgpart create <disk> <size> <fstype>")
+		fmt.Fprintln(os.Stderr, "Usage: pgpart create [-i index] [-label label] [-a alignment] <disk> <size> <fstype>")
 		fmt.Fprintln(os.Stderr, "Example: pgpart create ada0 10G ufs")
+		fmt.Fprintln(os.Stderr, "Use a size of \"rest\" to fill the largest free region, e.g. pgpart create ada0 rest ufs")
+		fmt.Fprintln(os.Stderr, "The type may also be a raw type GUID, e.g. fe3a2a5d-4f32-41a7-b725-accc3285a309")
 		return 1
 	}
 
@@ -163,21 +532,55 @@ func (c *CLI) createCommand() int {
 	sizeStr := args[1]
 	fstype := args[2]
 
-	// Parse size (supports G, M suffixes)
-	size, err := parseSize(sizeStr)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Invalid size: %v\n", err)
+	if !normalizeDeviceArgs(&disk) {
 		return 1
 	}
 
+	// Parse size (supports G, M suffixes); "rest" fills the largest free
+	// region, which CreatePartitionAt asks for with a size of 0
+	var size uint64
+	if sizeStr != "rest" {
+		var err error
+		size, err = partition.ParseSize(sizeStr)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid size: %v\n", err)
+			return 1
+		}
+	}
+
+	if *label != "" {
+		if err := partition.ValidateGPTLabel(*label); err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid label: %v\n", err)
+			return 1
+		}
+	}
+
+	// Without -a gpart places the partition itself; "auto" asks
+	// CreateAlignedPartitionAt for the disk's optimal alignment with 0
+	var alignment uint64
+	if *alignStr != "" && *alignStr != "auto" {
+		var err error
+		alignment, err = partition.ParseSize(*alignStr)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid alignment: %v\n", err)
+			return 1
+		}
+	}
+
 	fmt.Printf("Creating partition on %s: size=%s, filesystem=%s\n", disk, sizeStr, fstype)
 
-	if err := partition.CreatePartition(disk, size, fstype); err != nil {
+	var err error
+	if *alignStr != "" {
+		err = partition.CreateAlignedPartitionAt(disk, size, fstype, *index, *label, alignment)
+	} else {
+		err = partition.CreatePartitionAt(disk, size, fstype, *index, *label)
+	}
+	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error creating partition: %v\n", err)
 		return 1
 	}
 
-	fmt.Println("Partition created successfully")
+	reportSuccess("Partition created successfully")
 	return 0
 }
 
@@ -185,6 +588,8 @@ func (c *CLI) createCommand() int {
 func (c *CLI) deleteCommand() int {
 	fs := flag.NewFlagSet("delete", flag.ExitOnError)
 	force := fs.Bool("f", false, "Force deletion without confirmation")
+	allowRequired := fs.Bool("allow-required", false, "Allow deleting a partition with the GPT required attribute")
+	allowMounted := fs.Bool("allow-mounted", false, "Allow deleting a mounted partition")
 	if err := fs.Parse(c.args[2:]); err != nil {
 		fmt.Fprintf(os.Stderr, "Error parsing arguments: %v\n", err)
 		return 1
@@ -192,39 +597,82 @@ func (c *CLI) deleteCommand() int {
 
 	args := fs.Args()
 	if len(args) < 2 {
-		fmt.Fprintln(os.Stderr, "Usage: pgpart delete [-f] <disk> <index>")
+		fmt.Fprintln(os.Stderr, "Usage: pgpart delete [-f] [-allow-required] [-allow-mounted] <disk> <index>")
 		fmt.Fprintln(os.Stderr, "Example: pgpart delete ada0 3")
+		fmt.Fprintln(os.Stderr, "BSD label partitions are given by slice and letter, e.g. pgpart delete ada0 1a for ada0s1a")
 		return 1
 	}
 
 	disk := args[0]
 	index := args[1]
 
-	if !*force {
-		fmt.Printf("Delete partition %s%s? This cannot be undone! (yes/no): ", disk, index)
-		var confirm string
-		fmt.Scanln(&confirm)
-		if confirm != "yes" {
-			fmt.Println("Deletion cancelled")
-			return 0
+	if !normalizeDeviceArgs(&disk) {
+		return 1
+	}
+
+	partName := disk + "p" + index
+	if part, err := partition.LookupPartition(disk, index); err == nil {
+		partName = part.Name
+		if !confirmRequiredPartition(part.Name, "delete", *allowRequired) {
+			return 1
 		}
 	}
 
-	fmt.Printf("Deleting partition %s%s\n", disk, index)
+	prompt := fmt.Sprintf("Delete partition %s? This cannot be undone! (yes/no): ", partName)
+	if code, ok := c.confirmCommand(*force, prompt, "yes", "Deletion cancelled"); !ok {
+		return code
+	}
+
+	fmt.Printf("Deleting partition %s\n", partName)
 
-	if err := partition.DeletePartition(disk, index); err != nil {
+	if err := partition.DeletePartition(disk, index, *allowMounted); err != nil {
+		err = partition.ExplainBusyError(partName, err)
 		fmt.Fprintf(os.Stderr, "Error deleting partition: %v\n", err)
 		return 1
 	}
 
-	fmt.Println("Partition deleted successfully")
+	reportSuccess("Partition deleted successfully")
 	return 0
 }
 
 // formatCommand formats a partition
+// confirmRequiredPartition guards partitions with the GPT required
+// attribute. It warns about them and, unless allowed is set, asks for the
+// partition name to be typed; neither -f nor -y skips this. It reports
+// whether the operation may go ahead.
+func confirmRequiredPartition(partName, verb string, allowed bool) bool {
+	warning := partition.PlatformRequiredWarning(partName, verb)
+	if warning == "" {
+		return true
+	}
+
+	fmt.Fprintf(os.Stderr, "Warning: %s\n", warning)
+	if allowed {
+		return true
+	}
+	if !stdinIsTerminal() {
+		fmt.Fprintf(os.Stderr, "Not confirmed: stdin is not a terminal; pass -allow-required to %s it without asking\n", verb)
+		return false
+	}
+
+	fmt.Printf("Type %s to %s it anyway: ", partName, verb)
+	var typed string
+	fmt.Scanln(&typed)
+	if typed != partName {
+		fmt.Fprintf(os.Stderr, "Not confirmed; pass -allow-required to %s it without asking\n", verb)
+		return false
+	}
+	return true
+}
+
 func (c *CLI) formatCommand() int {
 	fs := flag.NewFlagSet("format", flag.ExitOnError)
 	force := fs.Bool("f", false, "Force format without confirmation")
+	allowRequired := fs.Bool("allow-required", false, "Allow formatting a partition with the GPT required attribute")
+	allowMounted := fs.Bool("allow-mounted", false, "Allow formatting a mounted partition")
+	volumeLabel := fs.String("L", "", "Volume label of the new filesystem")
+	blockSizeStr := fs.String("b", "", "Block or cluster size, e.g. 4K (default: the tool's)")
+	reserved := fs.Int("m", -1, "Percentage of blocks reserved for root on UFS and ext2/3/4 (default: the tool's)")
 	if err := fs.Parse(c.args[2:]); err != nil {
 		fmt.Fprintf(os.Stderr, "Error parsing arguments: %v\n", err)
 		return 1
@@ -232,39 +680,108 @@ func (c *CLI) formatCommand() int {
 
 	args := fs.Args()
 	if len(args) < 2 {
-		fmt.Fprintln(os.Stderr, "Usage: pgpart format [-f] <partition> <fstype>")
+		fmt.Fprintln(os.Stderr, "Usage: pgpart format [-f] [-allow-required] [-allow-mounted] [-L label] [-b blocksize] [-m reserved%] <partition> <fstype>")
 		fmt.Fprintln(os.Stderr, "Example: pgpart format ada0p3 ext4")
-		fmt.Fprintln(os.Stderr, "Supported filesystems: ufs, fat32, ext2, ext3, ext4, ntfs")
+		fmt.Fprintln(os.Stderr, "Example: pgpart format -L data -b 4K -m 1 ada0p3 ext4")
+		fmt.Fprintf(os.Stderr, "Supported filesystems: %s\n", strings.ToLower(strings.Join(partition.FormatterNames(), ", ")))
 		return 1
 	}
 
 	partName := args[0]
 	fstype := args[1]
 
-	if !*force {
-		fmt.Printf("Format partition %s as %s? This will destroy all data! (yes/no): ", partName, fstype)
-		var confirm string
-		fmt.Scanln(&confirm)
-		if confirm != "yes" {
-			fmt.Println("Format cancelled")
-			return 0
+	if !normalizeDeviceArgs(&partName) {
+		return 1
+	}
+
+	opts := partition.FormatOptions{Label: *volumeLabel}
+	if *blockSizeStr != "" {
+		size, err := partition.ParseSize(*blockSizeStr)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid block size: %v\n", err)
+			return 1
 		}
+		opts.BlockSize = size
+	}
+	if *reserved >= 0 {
+		opts.ReservedPercent = reserved
+	}
+	if err := partition.CheckFormatOptions(fstype, opts); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	if !confirmRequiredPartition(partName, "format", *allowRequired) {
+		return 1
+	}
+
+	prompt := fmt.Sprintf("Format partition %s as %s? This will destroy all data! (yes/no): ", partName, fstype)
+	if code, ok := c.confirmCommand(*force, prompt, "yes", "Format cancelled"); !ok {
+		return code
 	}
 
 	fmt.Printf("Formatting %s as %s\n", partName, fstype)
 
-	if err := partition.FormatPartition(partName, fstype); err != nil {
+	progress := partition.NewTextProgress(os.Stdout)
+	err := partition.FormatPartitionWithLog(partName, fstype, opts, *allowMounted, progress, nil)
+	progress.Done()
+	if err != nil {
+		err = partition.ExplainBusyError(partName, err)
 		fmt.Fprintf(os.Stderr, "Error formatting partition: %v\n", err)
 		return 1
 	}
 
-	fmt.Println("Partition formatted successfully")
+	reportSuccess("Partition formatted successfully")
+	return 0
+}
+
+// wipeCommand securely erases a partition or a whole disk
+func (c *CLI) wipeCommand() int {
+	fs := flag.NewFlagSet("wipe", flag.ExitOnError)
+	force := fs.Bool("f", false, "Wipe without asking for the device name")
+	passes := fs.Int("passes", 1, "Number of overwrite passes")
+	method := fs.String("method", partition.WipeAuto, "Wipe method: "+strings.Join(partition.WipeMethods, ", "))
+	if err := fs.Parse(c.args[2:]); err != nil {
+		fmt.Fprintf(os.Stderr, "Error parsing arguments: %v\n", err)
+		return 1
+	}
+
+	args := fs.Args()
+	if len(args) < 1 {
+		fmt.Fprintln(os.Stderr, "Usage: pgpart wipe [-f] [-passes n] [-method auto|zero|random|ata] <partition|disk>")
+		fmt.Fprintln(os.Stderr, "Example: pgpart wipe -passes 3 -method random ada1p2")
+		return 1
+	}
+
+	target := args[0]
+
+	if !normalizeDeviceArgs(&target) {
+		return 1
+	}
+
+	prompt := fmt.Sprintf("Every byte of %s will be overwritten and can't be recovered. Type %s to wipe it: ", target, target)
+	if code, ok := c.confirmCommand(*force, prompt, target, "Wipe cancelled"); !ok {
+		return code
+	}
+
+	fmt.Printf("Wiping %s (%s, %d pass(es))\n", target, *method, *passes)
+
+	progress := partition.NewTextProgress(os.Stdout)
+	err := partition.SecureWipeWithLog(target, *passes, *method, progress, nil)
+	progress.Done()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error wiping %s: %v\n", target, err)
+		return 1
+	}
+
+	reportSuccess(fmt.Sprintf("%s wiped successfully", target))
 	return 0
 }
 
 // resizeCommand resizes a partition
 func (c *CLI) resizeCommand() int {
 	fs := flag.NewFlagSet("resize", flag.ExitOnError)
+	allowMounted := fs.Bool("allow-mounted", false, "Resize the entry of a mounted partition that can't be resized online, leaving its filesystem as it is")
 	if err := fs.Parse(c.args[2:]); err != nil {
 		fmt.Fprintf(os.Stderr, "Error parsing arguments: %v\n", err)
 		return 1
@@ -272,35 +789,78 @@ func (c *CLI) resizeCommand() int {
 
 	args := fs.Args()
 	if len(args) < 3 {
-		fmt.Fprintln(os.Stderr, "Usage: pgpart resize <disk> <index> <size>")
+		fmt.Fprintln(os.Stderr, "Usage: pgpart resize [-allow-mounted] <disk> <index> <size>")
 		fmt.Fprintln(os.Stderr, "Example: pgpart resize ada0 2 20G")
 		return 1
 	}
 
 	disk := args[0]
 	index := args[1]
+
+	if !normalizeDeviceArgs(&disk) {
+		return 1
+	}
 	sizeStr := args[2]
 
-	size, err := parseSize(sizeStr)
+	size, err := partition.ParseSize(sizeStr)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Invalid size: %v\n", err)
 		return 1
 	}
 
-	fmt.Printf("Resizing partition %s%s to %s\n", disk, index, sizeStr)
+	part, err := partition.LookupPartition(disk, index)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	fmt.Printf("Resizing partition %s to %s\n", part.Name, sizeStr)
+
+	// Mounted filesystems are resized online; otherwise the filesystem is
+	// shrunk before the partition or grown after it
+	if part.MountPoint != "" {
+		if ok, reason := partition.CanResizeOnline(part, size > part.Size*512); !ok {
+			if !*allowMounted {
+				fmt.Fprintf(os.Stderr, "Error: %s is mounted at %s and can't be resized online: %s\n", part.Name, part.MountPoint, reason)
+				fmt.Fprintln(os.Stderr, "Unmount it first, or use -allow-mounted to resize the partition entry alone")
+				return 1
+			}
+			if err := partition.ResizePartition(disk, index, size, true); err != nil {
+				fmt.Fprintf(os.Stderr, "Error resizing partition: %v\n", err)
+				return 1
+			}
+			reportSuccess(fmt.Sprintf("Partition resized; the filesystem mounted at %s was left as it is", part.MountPoint))
+			return 0
+		}
+		if err := partition.PerformOnlineResize(disk, index, size, part); err != nil {
+			fmt.Fprintf(os.Stderr, "Error resizing partition: %v\n", err)
+			return 1
+		}
+		reportSuccess("Partition and filesystem resized online successfully")
+		return 0
+	}
 
-	if err := partition.ResizePartition(disk, index, size); err != nil {
+	fsResized, err := partition.ResizeWithFilesystem(disk, index, size, part)
+	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error resizing partition: %v\n", err)
 		return 1
 	}
 
-	fmt.Println("Partition resized successfully")
+	if fsResized {
+		reportSuccess("Partition and filesystem resized successfully")
+	} else {
+		reportSuccess("Partition resized successfully")
+	}
 	return 0
 }
 
 // copyCommand copies a partition
 func (c *CLI) copyCommand() int {
 	fs := flag.NewFlagSet("copy", flag.ExitOnError)
+	verify := fs.Bool("verify", false, "Compare the copy with the source afterwards")
+	chunkStr := fs.String("chunk", "", "Chunk size for -verify, e.g. 1M (default: 4M)")
+	workers := fs.Int("workers", partition.DefaultVerifyWorkers, "Chunks compared in parallel by -verify")
+	offsetStr := fs.String("offset", "", "Resume an interrupted copy at this byte offset, e.g. 512M")
 	if err := fs.Parse(c.args[2:]); err != nil {
 		fmt.Fprintf(os.Stderr, "Error parsing arguments: %v\n", err)
 		return 1
@@ -308,32 +868,126 @@ func (c *CLI) copyCommand() int {
 
 	args := fs.Args()
 	if len(args) < 2 {
-		fmt.Fprintln(os.Stderr, "Usage: pgpart copy <source> <dest>")
-		fmt.Fprintln(os.Stderr, "Example: pgpart copy ada0p1 ada0p2")
+		fmt.Fprintln(os.Stderr, "Usage: pgpart copy [-verify] [-chunk size] [-workers n] [-offset bytes] <source> <dest>")
+		fmt.Fprintln(os.Stderr, "Example: pgpart copy -verify ada0p1 ada0p2")
 		return 1
 	}
 
 	source := args[0]
 	dest := args[1]
 
-	fmt.Printf("Copying %s to %s\n", source, dest)
+	if !normalizeDeviceArgs(&source, &dest) {
+		return 1
+	}
+
+	opts := partition.VerifyOptions{Workers: *workers}
+	if *chunkStr != "" {
+		size, err := partition.ParseSize(*chunkStr)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid chunk size: %v\n", err)
+			return 1
+		}
+		opts.ChunkSize = int64(size)
+	}
+	if *workers < 1 {
+		fmt.Fprintln(os.Stderr, "Invalid worker count: it must be at least 1")
+		return 1
+	}
+
+	var offset uint64
+	if *offsetStr != "" {
+		var err error
+		if offset, err = partition.ParseSize(*offsetStr); err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid offset: %v\n", err)
+			return 1
+		}
+	}
+
+	if offset > 0 {
+		fmt.Printf("Resuming the copy of %s to %s at %s\n", source, dest, partition.FormatBytes(offset))
+	} else {
+		fmt.Printf("Copying %s to %s\n", source, dest)
+	}
 
+	copyProgress := partition.NewTextProgress(os.Stdout)
 	progressCallback := func(progress float64) {
 		fmt.Printf("\rProgress: %.1f%%", progress)
 	}
 
-	if err := partition.CopyPartition(source, dest, progressCallback); err != nil {
-		fmt.Fprintf(os.Stderr, "\nError copying partition: %v\n", err)
+	// Ctrl-C stops dd cleanly, so the copy can be resumed where it stopped
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	err := partition.CopyPartitionContext(ctx, source, dest, offset, copyProgress, nil)
+	copyProgress.Done()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error copying partition: %v\n", err)
+		var stopped *partition.CopyInterruptedError
+		if errors.As(err, &stopped) {
+			fmt.Fprintf(os.Stderr, "Resume with: pgpart copy -offset %d %s %s\n", stopped.Offset, source, dest)
+		}
+		return 1
+	}
+
+	reportSuccess("Partition copied successfully")
+
+	if *verify && !partition.DryRun {
+		fmt.Printf("Verifying %s against %s\n", dest, source)
+		if err := partition.VerifyPartitionCopyWithOptions(source, dest, opts, progressCallback); err != nil {
+			fmt.Fprintf(os.Stderr, "\nError verifying copy: %v\n", err)
+			return 1
+		}
+		fmt.Println("\nCopy verified: the partitions match")
+	}
+	return 0
+}
+
+// cloneDiskCommand copies a whole disk onto another
+func (c *CLI) cloneDiskCommand() int {
+	fs := flag.NewFlagSet("clone-disk", flag.ExitOnError)
+	force := fs.Bool("f", false, "Clone without asking for the destination's name")
+	if err := fs.Parse(c.args[2:]); err != nil {
+		fmt.Fprintf(os.Stderr, "Error parsing arguments: %v\n", err)
+		return 1
+	}
+
+	args := fs.Args()
+	if len(args) < 2 {
+		fmt.Fprintln(os.Stderr, "Usage: pgpart clone-disk [-f] <source> <dest>")
+		fmt.Fprintln(os.Stderr, "Example: pgpart clone-disk ada0 ada1")
+		return 1
+	}
+
+	source := args[0]
+	dest := args[1]
+
+	if !normalizeDeviceArgs(&source, &dest) {
+		return 1
+	}
+
+	prompt := fmt.Sprintf("Everything on %s will be replaced by a copy of %s. Type %s to clone onto it: ", dest, source, dest)
+	if code, ok := c.confirmCommand(*force, prompt, dest, "Clone cancelled"); !ok {
+		return code
+	}
+
+	fmt.Printf("Cloning %s to %s\n", source, dest)
+
+	progress := partition.NewTextProgress(os.Stdout)
+	err := partition.CloneDisk(source, dest, progress)
+	progress.Done()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error cloning disk: %v\n", err)
 		return 1
 	}
 
-	fmt.Println("\nPartition copied successfully")
+	reportSuccess(fmt.Sprintf("%s cloned to %s", source, dest))
 	return 0
 }
 
 // infoCommand shows detailed disk information
 func (c *CLI) infoCommand() int {
 	fs := flag.NewFlagSet("info", flag.ExitOnError)
+	jsonOutput := fs.Bool("json", false, "Print the information as JSON")
 	if err := fs.Parse(c.args[2:]); err != nil {
 		fmt.Fprintf(os.Stderr, "Error parsing arguments: %v\n", err)
 		return 1
@@ -341,19 +995,33 @@ func (c *CLI) infoCommand() int {
 
 	args := fs.Args()
 	if len(args) < 1 {
-		fmt.Fprintln(os.Stderr, "Usage: pgpart info <disk>")
+		fmt.Fprintln(os.Stderr, "Usage: pgpart info [-json] <disk>")
 		fmt.Fprintln(os.Stderr, "Example: pgpart info ada0")
 		return 1
 	}
 
 	diskName := args[0]
 
+	if !normalizeDeviceArgs(&diskName) {
+		return 1
+	}
+
 	info, err := partition.GetDetailedDiskInfo(diskName)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error getting disk info: %v\n", err)
 		return 1
 	}
 
+	if *jsonOutput {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(partition.NewDiskInfoReport(info)); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing disk info: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+
 	fmt.Printf("Disk Information: %s\n", diskName)
 	fmt.Printf("==================%s\n", repeatChar('=', len(diskName)))
 	fmt.Printf("Model:        %s\n", info.Model)
@@ -385,43 +1053,491 @@ func (c *CLI) infoCommand() int {
 	return 0
 }
 
-// parseSize parses size strings like "10G", "512M", "1024"
-func parseSize(sizeStr string) (uint64, error) {
-	if len(sizeStr) == 0 {
-		return 0, fmt.Errorf("empty size string")
+// healthCommand prints a SMART health summary of every disk and fails if
+// any of them failed its self-assessment or has a failing attribute
+func (c *CLI) healthCommand() int {
+	fs := flag.NewFlagSet("health", flag.ExitOnError)
+	jsonOutput := fs.Bool("json", false, "Print the summary as JSON")
+	if err := fs.Parse(c.args[2:]); err != nil {
+		fmt.Fprintf(os.Stderr, "Error parsing arguments: %v\n", err)
+		return 1
+	}
+
+	disks, err := partition.GetDisks()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error detecting disks: %v\n", err)
+		return 1
+	}
+
+	results := partition.CheckDisksHealth(disks)
+
+	exitCode := 0
+	for _, health := range results {
+		if health.Failed() {
+			exitCode = 1
+		}
 	}
 
-	// Check for suffix
-	suffix := sizeStr[len(sizeStr)-1]
-	var multiplier uint64 = 1
+	if *jsonOutput {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(results); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing health summary: %v\n", err)
+			return 1
+		}
+		return exitCode
+	}
 
-	numStr := sizeStr
-	switch suffix {
-	case 'G', 'g':
-		multiplier = 1024 * 1024 * 1024
-		numStr = sizeStr[:len(sizeStr)-1]
-	case 'M', 'm':
-		multiplier = 1024 * 1024
-		numStr = sizeStr[:len(sizeStr)-1]
-	case 'K', 'k':
-		multiplier = 1024
-		numStr = sizeStr[:len(sizeStr)-1]
+	if len(results) == 0 {
+		fmt.Println("No disks found")
+		return 0
 	}
 
-	// Parse number
-	num, err := strconv.ParseFloat(numStr, 64)
-	if err != nil {
-		return 0, fmt.Errorf("invalid number: %s", numStr)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "DISK\tSMART\tTEMP\tPOWER-ON HOURS\tFAILING\tWARNING")
+	fmt.Fprintln(w, "----\t-----\t----\t--------------\t-------\t-------")
+	for _, health := range results {
+		if health.Error != "" {
+			fmt.Fprintf(w, "%s\t%s\t-\t-\t-\t-\n", health.Disk, health.SMARTStatus)
+			continue
+		}
+		temperature := "-"
+		if health.Temperature > 0 {
+			temperature = fmt.Sprintf("%d°C", health.Temperature)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\t%d\n", health.Disk, health.SMARTStatus,
+			temperature, health.PowerOnHours, health.FailingAttributes, health.WarningAttributes)
 	}
+	w.Flush()
 
-	if num <= 0 {
-		return 0, fmt.Errorf("size must be positive")
+	for _, health := range results {
+		if health.Error != "" {
+			fmt.Fprintf(os.Stderr, "warning: %s: %s\n", health.Disk, health.Error)
+		}
 	}
 
-	return uint64(num * float64(multiplier)), nil
+	return exitCode
 }
 
-// repeatChar repeats a character n times
+// findUUIDCommand prints the name of the partition with a GPT partition
+// GUID, so scripts can find a partition whatever its disk is called now
+func (c *CLI) findUUIDCommand() int {
+	if len(c.args) < 3 {
+		fmt.Fprintln(os.Stderr, "Usage: pgpart find-uuid <uuid>")
+		fmt.Fprintln(os.Stderr, "Example: pgpart find-uuid 5f3c0004-8d2e-11ee-b9d1-0242ac120006")
+		return 1
+	}
+
+	part, err := partition.FindPartitionByUUID(c.args[2])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	fmt.Println(part.Name)
+	return 0
+}
+
+// normalizeDeviceArgs rewrites disk and partition arguments such as
+// /dev/ada0 to the bare names the partition package expects, printing an
+// error for the first one that isn't a valid device name
+func normalizeDeviceArgs(names ...*string) bool {
+	for _, name := range names {
+		normalized, err := partition.NormalizeDeviceName(*name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return false
+		}
+		*name = normalized
+	}
+	return true
+}
+
+// backupCommand saves a disk's partition table to a file
+func (c *CLI) backupCommand() int {
+	if len(c.args) < 4 {
+		fmt.Fprintln(os.Stderr, "Usage: pgpart backup <disk> <file>")
+		fmt.Fprintln(os.Stderr, "Example: pgpart backup ada0 ada0.gpt")
+		return 1
+	}
+
+	disk := c.args[2]
+	file := c.args[3]
+
+	if !normalizeDeviceArgs(&disk) {
+		return 1
+	}
+
+	backup, err := partition.BackupPartitionTable(disk)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error backing up partition table: %v\n", err)
+		return 1
+	}
+
+	if err := os.WriteFile(file, backup, 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing backup: %v\n", err)
+		return 1
+	}
+
+	fmt.Printf("Partition table of %s saved to %s\n", disk, file)
+	return 0
+}
+
+// restoreCommand restores a partition table saved by backupCommand
+func (c *CLI) restoreCommand() int {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	force := fs.Bool("f", false, "Replace the partitions the disk already has")
+	if err := fs.Parse(c.args[2:]); err != nil {
+		fmt.Fprintf(os.Stderr, "Error parsing arguments: %v\n", err)
+		return 1
+	}
+
+	args := fs.Args()
+	if len(args) < 2 {
+		fmt.Fprintln(os.Stderr, "Usage: pgpart restore [-f] <disk> <file>")
+		fmt.Fprintln(os.Stderr, "Example: pgpart restore -f ada0 ada0.gpt")
+		return 1
+	}
+
+	disk := args[0]
+	file := args[1]
+
+	if !normalizeDeviceArgs(&disk) {
+		return 1
+	}
+
+	backup, err := os.ReadFile(file)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading backup: %v\n", err)
+		return 1
+	}
+
+	if err := partition.RestorePartitionTable(disk, backup, *force); err != nil {
+		fmt.Fprintf(os.Stderr, "Error restoring partition table: %v\n", err)
+		return 1
+	}
+
+	fmt.Printf("Partition table of %s restored from %s\n", disk, file)
+	return 0
+}
+
+// prepareCommand releases everything on a disk so it can be modified
+func (c *CLI) prepareCommand() int {
+	fs := flag.NewFlagSet("prepare", flag.ExitOnError)
+	exportPools := fs.Bool("export-pools", false, "Also export ZFS pools lying wholly on the disk")
+	if err := fs.Parse(c.args[2:]); err != nil {
+		fmt.Fprintf(os.Stderr, "Error parsing arguments: %v\n", err)
+		return 1
+	}
+
+	args := fs.Args()
+	if len(args) < 1 {
+		fmt.Fprintln(os.Stderr, "Usage: pgpart prepare [-export-pools] <disk>")
+		fmt.Fprintln(os.Stderr, "Example: pgpart prepare ada1")
+		return 1
+	}
+
+	disk := args[0]
+	if !normalizeDeviceArgs(&disk) {
+		return 1
+	}
+
+	result, err := partition.PrepareDisk(disk, *exportPools)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error preparing disk: %v\n", err)
+		return 1
+	}
+
+	fmt.Println(result.Summary())
+	if !result.Ready() {
+		return 1
+	}
+	return 0
+}
+
+// attachImageCommand attaches a disk image file as an md device
+func (c *CLI) attachImageCommand() int {
+	fs := flag.NewFlagSet("attach-image", flag.ExitOnError)
+	sectorSizeStr := fs.String("S", "", "Logical sector size, e.g. 512 or 4096 (default: 512)")
+	if err := fs.Parse(c.args[2:]); err != nil {
+		fmt.Fprintf(os.Stderr, "Error parsing arguments: %v\n", err)
+		return 1
+	}
+
+	args := fs.Args()
+	if len(args) < 1 {
+		fmt.Fprintln(os.Stderr, "Usage: pgpart attach-image [-S sectorsize] <file>")
+		fmt.Fprintln(os.Stderr, "Example: pgpart attach-image -S 4096 disk.img")
+		return 1
+	}
+
+	var sectorSize uint64
+	if *sectorSizeStr != "" {
+		size, err := partition.ParseSize(*sectorSizeStr)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid sector size: %v\n", err)
+			return 1
+		}
+		sectorSize = size
+	}
+
+	mdName, err := partition.AttachImage(args[0], sectorSize)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error attaching image: %v\n", err)
+		return 1
+	}
+
+	if sectorSize == 0 {
+		sectorSize = 512
+	}
+	fmt.Printf("Attached %s as %s (%d-byte sectors)\n", args[0], mdName, sectorSize)
+	return 0
+}
+
+// detachImageCommand detaches an md device
+func (c *CLI) detachImageCommand() int {
+	if len(c.args) < 3 {
+		fmt.Fprintln(os.Stderr, "Usage: pgpart detach-image <md>")
+		fmt.Fprintln(os.Stderr, "Example: pgpart detach-image md0")
+		return 1
+	}
+
+	mdName := c.args[2]
+	if !normalizeDeviceArgs(&mdName) {
+		return 1
+	}
+
+	if err := partition.DetachImage(mdName); err != nil {
+		fmt.Fprintf(os.Stderr, "Error detaching image: %v\n", err)
+		return 1
+	}
+
+	fmt.Printf("Detached %s\n", mdName)
+	return 0
+}
+
+// filesystemsCommand lists the filesystems pgpart can format and whether
+// their tools are installed
+func (c *CLI) filesystemsCommand() int {
+	fs := flag.NewFlagSet("filesystems", flag.ExitOnError)
+	jsonOutput := fs.Bool("json", false, "Print the filesystems as JSON")
+	if err := fs.Parse(c.args[2:]); err != nil {
+		fmt.Fprintf(os.Stderr, "Error parsing arguments: %v\n", err)
+		return 1
+	}
+
+	supports := partition.SupportedFilesystems()
+
+	if *jsonOutput {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(supports); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing filesystem list: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "FILESYSTEM\tTOOL\tAVAILABLE\tINSTALL")
+	fmt.Fprintln(w, "----------\t----\t---------\t-------")
+	for _, support := range supports {
+		available := "yes"
+		install := "-"
+		if !support.Available {
+			available = "no"
+			install = "part of the FreeBSD base system"
+			if support.InstallHint != "" {
+				install = support.InstallHint
+			}
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", support.Name, support.Tool, available, install)
+	}
+	w.Flush()
+
+	return 0
+}
+
+// showCommand prints the text rendering of a disk's layout
+func (c *CLI) showCommand() int {
+	if len(c.args) < 3 {
+		fmt.Fprintln(os.Stderr, "Usage: pgpart show <disk>")
+		fmt.Fprintln(os.Stderr, "Example: pgpart show ada0")
+		return 1
+	}
+
+	name := c.args[2]
+	if !normalizeDeviceArgs(&name) {
+		return 1
+	}
+
+	disks, err := partition.GetDisks()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error detecting disks: %v\n", err)
+		return 1
+	}
+
+	for _, disk := range disks {
+		if disk.Name == name {
+			fmt.Print(partition.RenderLayoutASCII(disk))
+			return 0
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "Disk %s not found\n", name)
+	return 1
+}
+
+// growToFSCommand repairs a partition entry smaller than its filesystem
+func (c *CLI) growToFSCommand() int {
+	if len(c.args) < 4 {
+		fmt.Fprintln(os.Stderr, "Usage: pgpart grow-to-fs <disk> <index>")
+		fmt.Fprintln(os.Stderr, "Example: pgpart grow-to-fs ada0 3")
+		fmt.Fprintln(os.Stderr, "Grows the partition entry to cover the whole filesystem inside it, e.g. after a botched resize.")
+		return 1
+	}
+
+	disk := c.args[2]
+	index := c.args[3]
+
+	if !normalizeDeviceArgs(&disk) {
+		return 1
+	}
+
+	if err := partition.GrowPartitionToFilesystem(disk, index); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	fmt.Printf("Partition %s on %s now covers its filesystem\n", index, disk)
+	return 0
+}
+
+func (c *CLI) createPoolCommand() int {
+	fs := flag.NewFlagSet("create-pool", flag.ExitOnError)
+	force := fs.Bool("f", false, "Create the pool without confirmation")
+	layout := fs.String("type", "stripe", "Pool layout: "+strings.Join(partition.ZFSPoolLayouts, ", "))
+	if err := fs.Parse(c.args[2:]); err != nil {
+		fmt.Fprintf(os.Stderr, "Error parsing arguments: %v\n", err)
+		return 1
+	}
+
+	args := fs.Args()
+	if len(args) < 2 {
+		fmt.Fprintln(os.Stderr, "Usage: pgpart create-pool [-f] [-type layout] <pool> <partition>...")
+		fmt.Fprintln(os.Stderr, "Example: pgpart create-pool -type mirror tank ada1p1 ada2p1")
+		fmt.Fprintf(os.Stderr, "Layouts: %s\n", strings.Join(partition.ZFSPoolLayouts, ", "))
+		return 1
+	}
+
+	poolName := args[0]
+	partNames := args[1:]
+	for i := range partNames {
+		if !normalizeDeviceArgs(&partNames[i]) {
+			return 1
+		}
+	}
+
+	prompt := fmt.Sprintf("Create %s pool %s from %s? This will destroy all data on them! (yes/no): ",
+		*layout, poolName, strings.Join(partNames, ", "))
+	if code, ok := c.confirmCommand(*force, prompt, "yes", "Pool creation cancelled"); !ok {
+		return code
+	}
+
+	if err := partition.CreateZFSPool(poolName, partNames, *layout); err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating pool: %v\n", err)
+		return 1
+	}
+
+	fmt.Printf("ZFS pool %s created\n", poolName)
+	return 0
+}
+
+// applyCommand partitions and formats an empty disk from a layout file
+func (c *CLI) applyCommand() int {
+	fs := flag.NewFlagSet("apply", flag.ExitOnError)
+	force := fs.Bool("f", false, "Apply the layout without confirmation")
+	if err := fs.Parse(c.args[2:]); err != nil {
+		fmt.Fprintf(os.Stderr, "Error parsing arguments: %v\n", err)
+		return 1
+	}
+
+	args := fs.Args()
+	if len(args) < 2 {
+		fmt.Fprintln(os.Stderr, "Usage: pgpart apply [-f] <disk> <layout-file>")
+		fmt.Fprintln(os.Stderr, "Example: pgpart apply ada2 layout.toml")
+		fmt.Fprintln(os.Stderr, "The layout lists each partition's size (e.g. 512M, 25%, or rest for the last one),")
+		fmt.Fprintln(os.Stderr, "type, and optionally its label and the filesystem to format it with")
+		return 1
+	}
+
+	diskName := args[0]
+	if !normalizeDeviceArgs(&diskName) {
+		return 1
+	}
+
+	layout, err := partition.LoadDiskLayout(args[1])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading layout: %v\n", err)
+		return 1
+	}
+
+	disks, err := partition.GetDisks()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error detecting disks: %v\n", err)
+		return 1
+	}
+	var disk *partition.Disk
+	for i := range disks {
+		if disks[i].Name == diskName {
+			disk = &disks[i]
+		}
+	}
+	if disk == nil {
+		fmt.Fprintf(os.Stderr, "Disk %s not found\n", diskName)
+		return 1
+	}
+
+	// Check the whole layout before asking, so nothing is started that
+	// can't be finished
+	plan, err := partition.PlanDiskLayout(disk, layout)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	dash := func(s string) string {
+		if s == "" {
+			return "-"
+		}
+		return s
+	}
+	fmt.Printf("Layout for %s (%s, %s):\n", diskName, partition.FormatBytes(disk.Size), layout.SchemeName())
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "#\tSIZE\tTYPE\tLABEL\tFORMAT")
+	fmt.Fprintln(w, "-\t----\t----\t-----\t------")
+	for i, p := range layout.Partitions {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n", i+1, partition.FormatBytes(plan.Entries[i].Bytes), p.Type,
+			dash(p.Label), dash(p.Format))
+	}
+	w.Flush()
+	fmt.Printf("Unused: %s\n", partition.FormatBytes(plan.Remaining))
+
+	prompt := fmt.Sprintf("Apply this layout to %s? (yes/no): ", diskName)
+	if code, ok := c.confirmCommand(*force, prompt, "yes", "Layout not applied"); !ok {
+		return code
+	}
+
+	if err := partition.ApplyLayout(diskName, layout); err != nil {
+		fmt.Fprintf(os.Stderr, "Error applying layout: %v\n", err)
+		return 1
+	}
+
+	reportSuccess(fmt.Sprintf("Layout applied to %s", diskName))
+	return 0
+}
+
+// repeatChar repeats a character n times
 func repeatChar(char rune, n int) string {
 	result := make([]rune, n)
 	for i := range result {
@@ -433,6 +1549,9 @@ func repeatChar(char rune, n int) string {
 // alignCommand checks partition alignment
 func (c *CLI) alignCommand() int {
 	fs := flag.NewFlagSet("align", flag.ExitOnError)
+	fix := fs.Bool("fix", false, "Show how to realign misaligned partitions")
+	apply := fs.Bool("apply", false, "With -fix, realign misaligned partitions that hold no filesystem")
+	force := fs.Bool("f", false, "Realign without confirmation")
 	if err := fs.Parse(c.args[2:]); err != nil {
 		fmt.Fprintf(os.Stderr, "Error parsing arguments: %v\n", err)
 		return 1
@@ -440,69 +1559,145 @@ func (c *CLI) alignCommand() int {
 
 	args := fs.Args()
 	if len(args) < 1 {
-		fmt.Fprintln(os.Stderr, "Usage: pgpart align <disk|partition>")
+		fmt.Fprintln(os.Stderr, "Usage: pgpart align [-fix [-apply] [-f]] <disk|partition>")
 		fmt.Fprintln(os.Stderr, "Examples:")
 		fmt.Fprintln(os.Stderr, "  pgpart align ada0        # Check all partitions on ada0")
 		fmt.Fprintln(os.Stderr, "  pgpart align ada0p1      # Check specific partition")
+		fmt.Fprintln(os.Stderr, "  pgpart align -fix ada0   # Also show how to realign misaligned partitions")
+		return 1
+	}
+	if *apply && !*fix {
+		fmt.Fprintln(os.Stderr, "Error: -apply is only valid with -fix")
 		return 1
 	}
 
 	target := args[0]
 
+	if !normalizeDeviceArgs(&target) {
+		return 1
+	}
+
 	// Check if target is a partition or disk
-	if strings.Contains(target, "p") || strings.Contains(target, "s") {
-		// Single partition
+	diskName := target
+	var results []partition.AlignmentInfo
+	if disk, _, err := partition.ParsePartitionName(target); err == nil {
+		diskName = disk
 		info, err := partition.CheckPartitionAlignment(target)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error checking alignment: %v\n", err)
 			return 1
 		}
-
-		fmt.Println(partition.FormatAlignmentInfo(info))
-		if !info.IsAligned {
+		results = append(results, *info)
+	} else {
+		results, err = partition.CheckDiskAlignment(target)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error checking disk alignment: %v\n", err)
 			return 1
 		}
-		return 0
-	}
-
-	// Entire disk
-	results, err := partition.CheckDiskAlignment(target)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error checking disk alignment: %v\n", err)
-		return 1
-	}
-
-	if len(results) == 0 {
-		fmt.Printf("No partitions found on %s\n", target)
-		return 0
+		if len(results) == 0 {
+			fmt.Printf("No partitions found on %s\n", target)
+			return 0
+		}
 	}
 
 	fmt.Printf("Alignment Status for %s\n", target)
-	fmt.Printf("===================%s\n", repeatChar('=', len(target)))
+	fmt.Printf("===================%s\n\n", repeatChar('=', len(target)))
 
-	aligned := 0
-	misaligned := 0
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PARTITION\tSTART\tSTATUS\tALIGNMENT\tRECOMMENDATION")
+	var misalignedParts []string
 	for _, info := range results {
-		fmt.Println()
-		fmt.Println(partition.FormatAlignmentInfo(&info))
-		if info.IsAligned {
-			aligned++
-		} else {
-			misaligned++
+		status := "aligned"
+		if !info.IsAligned {
+			status = "MISALIGNED"
+			misalignedParts = append(misalignedParts, info.Partition)
 		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", info.Partition,
+			partition.FormatBytes(info.StartOffset*info.SectorSize), status, info.AlignmentType, info.Recommendation)
 	}
+	w.Flush()
 
 	fmt.Println()
-	fmt.Printf("Summary: %d aligned, %d misaligned\n", aligned, misaligned)
+	if len(results) == 1 {
+		fmt.Printf("Summary: %d aligned, %d misaligned\n", len(results)-len(misalignedParts), len(misalignedParts))
+	} else if aligned, misaligned, err := partition.GetAlignmentSummary(diskName); err == nil {
+		fmt.Printf("Summary: %d aligned, %d misaligned\n", aligned, misaligned)
+	}
 
-	if misaligned > 0 {
+	if len(misalignedParts) == 0 {
+		return 0
+	}
+	if !*fix {
 		fmt.Println("\nRecommendation: Consider recreating misaligned partitions for better performance")
+		fmt.Printf("Run pgpart align -fix %s to see how\n", target)
 		return 1
 	}
 
+	remaining := 0
+	for _, partName := range misalignedParts {
+		if !c.fixAlignment(partName, *apply, *force) {
+			remaining++
+		}
+	}
+	if remaining > 0 {
+		return 1
+	}
 	return 0
 }
 
+// fixAlignment shows how to realign a partition and, with apply, realigns
+// it if it holds no filesystem. It returns true if the partition was
+// realigned.
+func (c *CLI) fixAlignment(partName string, apply, force bool) bool {
+	plan, err := partition.PlanRealignment(partName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "\n%s: %v\n", partName, err)
+		return false
+	}
+	if plan == nil {
+		return true
+	}
+
+	fmt.Printf("\n%s: move the start from %d to %d bytes (%s alignment), shrinking it from %s to %s\n",
+		partName, plan.OldStart, plan.NewStart, partition.FormatBytes(plan.Alignment),
+		partition.FormatBytes(plan.OldSize), partition.FormatBytes(plan.NewSize))
+
+	if plan.HasData() {
+		fmt.Printf("  %s holds %s, which moving the start would cut off.\n", partName, plan.DataDescription())
+		fmt.Println("  Back it up, then run:")
+	} else if !apply {
+		fmt.Println("  It holds no filesystem; run with -apply to realign it, or run:")
+	}
+	if plan.HasData() || !apply {
+		for _, line := range plan.Commands() {
+			fmt.Printf("    %s\n", line)
+		}
+		if plan.HasData() && plan.UnknownData {
+			fmt.Println("  and restore the backup.")
+		} else if plan.HasData() {
+			fmt.Println("  and recreate the filesystem and restore the backup.")
+		}
+		return false
+	}
+
+	ok, err := c.confirm(force, fmt.Sprintf("Recreate %s at its aligned start? (yes/no): ", partName), "yes")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return false
+	}
+	if !ok {
+		fmt.Println("Skipped")
+		return false
+	}
+
+	if err := partition.RealignPartition(partName); err != nil {
+		fmt.Fprintf(os.Stderr, "Error realigning %s: %v\n", partName, err)
+		return false
+	}
+	reportSuccess(fmt.Sprintf("%s realigned", partName))
+	return true
+}
+
 // attrListCommand lists GPT attributes for a partition
 func (c *CLI) attrListCommand() int {
 	fs := flag.NewFlagSet("attr-list", flag.ExitOnError)
@@ -522,6 +1717,10 @@ func (c *CLI) attrListCommand() int {
 
 	partName := args[0]
 
+	if !normalizeDeviceArgs(&partName) {
+		return 1
+	}
+
 	// Validate partition supports attributes
 	if err := partition.ValidatePartitionForAttributes(partName); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
@@ -571,6 +1770,10 @@ func (c *CLI) attrSetCommand() int {
 	partName := args[0]
 	attribute := args[1]
 
+	if !normalizeDeviceArgs(&partName) {
+		return 1
+	}
+
 	// Validate partition supports attributes
 	if err := partition.ValidatePartitionForAttributes(partName); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
@@ -619,6 +1822,10 @@ func (c *CLI) attrUnsetCommand() int {
 	partName := args[0]
 	attribute := args[1]
 
+	if !normalizeDeviceArgs(&partName) {
+		return 1
+	}
+
 	// Validate partition supports attributes
 	if err := partition.ValidatePartitionForAttributes(partName); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
@@ -642,3 +1849,635 @@ func (c *CLI) attrUnsetCommand() int {
 
 	return 0
 }
+
+// labelCommand changes the GPT label of a partition
+func (c *CLI) labelCommand() int {
+	fs := flag.NewFlagSet("label", flag.ExitOnError)
+	if err := fs.Parse(c.args[2:]); err != nil {
+		fmt.Fprintf(os.Stderr, "Error parsing arguments: %v\n", err)
+		return 1
+	}
+
+	args := fs.Args()
+	if len(args) < 2 {
+		fmt.Fprintln(os.Stderr, "Usage: pgpart label <partition> <newlabel>")
+		fmt.Fprintln(os.Stderr, "Example: pgpart label ada0p3 data0")
+		return 1
+	}
+
+	partName := args[0]
+	label := args[1]
+
+	if !normalizeDeviceArgs(&partName) {
+		return 1
+	}
+
+	if err := partition.SetPartitionLabel(partName, label); err != nil {
+		fmt.Fprintf(os.Stderr, "Error setting label: %v\n", err)
+		return 1
+	}
+
+	reportSuccess(fmt.Sprintf("%s is now labeled %s (/dev/gpt/%s)", partName, label, label))
+	return 0
+}
+
+// fstabCommand prints the /etc/fstab entry of a partition
+func (c *CLI) fstabCommand() int {
+	fs := flag.NewFlagSet("fstab", flag.ExitOnError)
+	raw := fs.Bool("raw", false, "Refer to the partition by its name instead of its label or GUID")
+	if err := fs.Parse(c.args[2:]); err != nil {
+		fmt.Fprintf(os.Stderr, "Error parsing arguments: %v\n", err)
+		return 1
+	}
+
+	args := fs.Args()
+	if len(args) < 1 {
+		fmt.Fprintln(os.Stderr, "Usage: pgpart fstab [-raw] <partition> [mountpoint]")
+		fmt.Fprintln(os.Stderr, "Example: pgpart fstab ada1p1 /data >> /etc/fstab")
+		return 1
+	}
+
+	partName := args[0]
+	if !normalizeDeviceArgs(&partName) {
+		return 1
+	}
+
+	disk, index, err := partition.ParsePartitionName(partName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	part, err := partition.LookupPartition(disk, index)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	// Without a mount point given, use where it is mounted now
+	mountPoint := part.MountPoint
+	if len(args) > 1 {
+		mountPoint = args[1]
+	}
+
+	if *raw {
+		partition.SetPreferLabels(false)
+	}
+	entry, err := partition.FstabEntry(part, mountPoint)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	fmt.Println(entry)
+	return 0
+}
+
+// setTypeCommand changes the type of a partition in place
+func (c *CLI) setTypeCommand() int {
+	fs := flag.NewFlagSet("settype", flag.ExitOnError)
+	if err := fs.Parse(c.args[2:]); err != nil {
+		fmt.Fprintf(os.Stderr, "Error parsing arguments: %v\n", err)
+		return 1
+	}
+
+	args := fs.Args()
+	if len(args) < 2 {
+		fmt.Fprintln(os.Stderr, "Usage: pgpart settype <partition> <type>")
+		fmt.Fprintln(os.Stderr, "Example: pgpart settype ada1p2 linux-data")
+		fmt.Fprintf(os.Stderr, "Known types: %s\n", strings.Join(partition.PartitionTypeAliases(), ", "))
+		fmt.Fprintln(os.Stderr, "The type may also be a raw type GUID, e.g. fe3a2a5d-4f32-41a7-b725-accc3285a309")
+		return 1
+	}
+
+	partName := args[0]
+	newType := args[1]
+
+	if !normalizeDeviceArgs(&partName) {
+		return 1
+	}
+
+	if err := partition.ChangePartitionType(partName, newType); err != nil {
+		fmt.Fprintf(os.Stderr, "Error changing type: %v\n", err)
+		return 1
+	}
+
+	reportSuccess(fmt.Sprintf("%s now has type %s", partName, newType))
+	return 0
+}
+
+// batchResult is the machine-readable summary printed by the batch command
+type batchResult struct {
+	DryRun     bool                   `json:"dry_run"`
+	Completed  int                    `json:"completed"`
+	Failed     int                    `json:"failed"`
+	Warnings   int                    `json:"warnings"`
+	Operations []batchOperationResult `json:"operations"`
+}
+
+type batchOperationResult struct {
+	ID          int    `json:"id"`
+	Type        string `json:"type"`
+	Description string `json:"description"`
+	Status      string `json:"status"`
+	Error       string `json:"error,omitempty"`
+	Warning     string `json:"warning,omitempty"`
+}
+
+// batchCommand runs a queue of operations read from a file or stdin.
+// Progress goes to stderr and a JSON summary to stdout.
+func (c *CLI) batchCommand() int {
+	fs := flag.NewFlagSet("batch", flag.ExitOnError)
+	dryRun := fs.Bool("dry-run", false, "Show the operations without executing them")
+	keepGoing := fs.Bool("k", false, "Keep going after a failed operation")
+	timeout := fs.Duration("timeout", 0, "Stop and fail operations running longer than this, e.g. 30m (0 means no limit)")
+	if err := fs.Parse(c.args[2:]); err != nil {
+		fmt.Fprintf(os.Stderr, "Error parsing arguments: %v\n", err)
+		return 1
+	}
+
+	args := fs.Args()
+	if len(args) < 1 {
+		fmt.Fprintln(os.Stderr, "Usage: pgpart batch [--dry-run] [-k] [-timeout d] <file|->")
+		fmt.Fprintln(os.Stderr, "Example: cat ops.txt | pgpart batch -")
+		fmt.Fprintln(os.Stderr, "Each line is one operation:")
+		fmt.Fprintln(os.Stderr, "  create <disk> <size> <fstype>")
+		fmt.Fprintln(os.Stderr, "  delete <partition>")
+		fmt.Fprintln(os.Stderr, "  format <partition> <fstype>")
+		fmt.Fprintln(os.Stderr, "  resize <partition> <size>")
+		fmt.Fprintln(os.Stderr, "  copy <source> <dest>")
+		fmt.Fprintln(os.Stderr, "A saved batch queue in JSON format is also accepted.")
+		return 1
+	}
+
+	var data []byte
+	var err error
+	if args[0] == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(args[0])
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading operations: %v\n", err)
+		return 1
+	}
+
+	queue, err := parseBatchInput(data)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error parsing operations: %v\n", err)
+		return 1
+	}
+
+	if queue.Count() == 0 {
+		fmt.Fprintln(os.Stderr, "No operations to execute")
+		return 1
+	}
+
+	// The commands of a dry run go to stderr with the progress, keeping
+	// stdout for the JSON summary
+	if *dryRun {
+		partition.DryRun = true
+	}
+	if partition.DryRun {
+		partition.DryRunOutput = os.Stderr
+		fmt.Fprintf(os.Stderr, "Dry run: %d operation(s) would be executed\n", queue.Count())
+	}
+
+	progress := partition.ProgressFunc(func(done, total uint64, desc string) {
+		fmt.Fprintf(os.Stderr, "[%d/%d] %s\n", done+1, total, desc)
+	})
+
+	exitCode := 0
+	queue.SetDefaultTimeout(*timeout)
+	if err := queue.ExecuteAll(!*keepGoing, progress); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		exitCode = 1
+	}
+	if queue.GetFailedCount() > 0 {
+		exitCode = 1
+	}
+
+	result := batchResult{
+		DryRun:    partition.DryRun,
+		Completed: queue.GetCompletedCount(),
+		Failed:    queue.GetFailedCount(),
+		Warnings:  queue.GetWarningCount(),
+	}
+	for _, op := range queue.GetOperations() {
+		result.Operations = append(result.Operations, batchOperationResult{
+			ID:          op.ID,
+			Type:        op.Type.String(),
+			Description: op.Description,
+			Status:      op.Status,
+			Error:       op.Error,
+			Warning:     op.Warning,
+		})
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(result); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing result: %v\n", err)
+		return 1
+	}
+
+	return exitCode
+}
+
+// parseBatchInput builds a queue from either the JSON queue format or the
+// line-based operation format
+func parseBatchInput(data []byte) (*partition.BatchQueue, error) {
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		return partition.DecodeBatchQueue(trimmed)
+	}
+
+	queue := partition.NewBatchQueue()
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		op, err := parseBatchLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNum, err)
+		}
+		queue.AddOperation(op)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return queue, nil
+}
+
+// parseBatchLine parses one operation such as "format ada0p1 ufs"
+func parseBatchLine(line string) (*partition.BatchOperation, error) {
+	fields := strings.Fields(line)
+	verb := strings.ToLower(fields[0])
+	args := fields[1:]
+
+	// "resize -fs <partition> <size>" resizes the filesystem too
+	withFilesystem := false
+	if verb == "resize" && len(args) > 0 && args[0] == "-fs" {
+		withFilesystem = true
+		args = args[1:]
+	}
+
+	want := map[string]int{"create": 3, "delete": 1, "format": 2, "resize": 2, "copy": 2}
+	n, ok := want[verb]
+	if !ok {
+		return nil, fmt.Errorf("unknown operation: %s", fields[0])
+	}
+	if len(args) != n {
+		return nil, fmt.Errorf("%s takes %d argument(s), got %d", verb, n, len(args))
+	}
+
+	// The first argument names a disk or partition, and copy's second too
+	devices := 1
+	if verb == "copy" {
+		devices = 2
+	}
+	for i := 0; i < devices; i++ {
+		name, err := partition.NormalizeDeviceName(args[i])
+		if err != nil {
+			return nil, err
+		}
+		args[i] = name
+	}
+
+	switch verb {
+	case "create":
+		size, err := partition.ParseSize(args[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid size: %v", err)
+		}
+		return &partition.BatchOperation{
+			Type:           partition.OpCreate,
+			Disk:           args[0],
+			Size:           size,
+			FilesystemType: args[2],
+			Description:    fmt.Sprintf("Create %s %s partition on %s", args[1], args[2], args[0]),
+		}, nil
+
+	case "delete":
+		disk, index, err := partition.ParsePartitionName(args[0])
+		if err != nil {
+			return nil, err
+		}
+		return &partition.BatchOperation{
+			Type:        partition.OpDelete,
+			Disk:        disk,
+			Index:       index,
+			Description: fmt.Sprintf("Delete partition %s", args[0]),
+		}, nil
+
+	case "format":
+		return &partition.BatchOperation{
+			Type:           partition.OpFormat,
+			Partition:      args[0],
+			FilesystemType: args[1],
+			Description:    fmt.Sprintf("Format %s as %s", args[0], args[1]),
+		}, nil
+
+	case "resize":
+		disk, index, err := partition.ParsePartitionName(args[0])
+		if err != nil {
+			return nil, err
+		}
+		size, err := partition.ParseSize(args[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid size: %v", err)
+		}
+		description := fmt.Sprintf("Resize %s to %s", args[0], args[1])
+		if withFilesystem {
+			description += " with its filesystem"
+		}
+		return &partition.BatchOperation{
+			Type:         partition.OpResize,
+			Disk:         disk,
+			Index:        index,
+			Size:         size,
+			OnlineResize: withFilesystem,
+			Description:  description,
+		}, nil
+
+	default: // copy
+		return &partition.BatchOperation{
+			Type:        partition.OpCopy,
+			SourcePart:  args[0],
+			DestPart:    args[1],
+			Description: fmt.Sprintf("Copy %s to %s", args[0], args[1]),
+		}, nil
+	}
+}
+
+// completionCommands are the commands shell completion offers, in the
+// order of the usage message. __complete is left out on purpose.
+var completionCommands = []string{
+	"list", "create", "delete", "format", "resize", "wipe", "copy",
+	"clone-disk", "info", "health", "find-uuid", "align", "attr-list", "attr-set", "attr-unset",
+	"label", "fstab", "settype", "batch", "backup", "restore", "prepare",
+	"attach-image", "detach-image", "filesystems", "show", "grow-to-fs",
+	"create-pool", "apply", "completion", "help",
+}
+
+// completionArgs says what each positional argument of a command is, for
+// __complete. Arguments past the end of a list, empty kinds and commands
+// that aren't listed get no candidates, so the shell completes file names
+// instead. The last kind of a command in repeatedCompletionArgs applies to
+// every further argument.
+var completionArgs = map[string][]string{
+	"create":       {"disk", "", "fstype"},
+	"delete":       {"disk"},
+	"format":       {"partition", "filesystem"},
+	"resize":       {"disk"},
+	"wipe":         {"device"},
+	"copy":         {"partition", "partition"},
+	"clone-disk":   {"disk", "disk"},
+	"info":         {"disk"},
+	"align":        {"device"},
+	"attr-list":    {"partition"},
+	"attr-set":     {"partition", "attribute"},
+	"attr-unset":   {"partition", "attribute"},
+	"label":        {"partition"},
+	"fstab":        {"partition"},
+	"settype":      {"partition", "type"},
+	"backup":       {"disk"},
+	"restore":      {"disk"},
+	"prepare":      {"disk"},
+	"detach-image": {"disk"},
+	"show":         {"disk"},
+	"grow-to-fs":   {"disk"},
+	"create-pool":  {"", "partition"},
+	"apply":        {"disk"},
+	"completion":   {"shell"},
+}
+
+var repeatedCompletionArgs = map[string]bool{
+	"create-pool": true,
+}
+
+// completionValueFlags are the flags that take a separate value, which
+// __complete must not count as a positional argument. The kind of their
+// value is given where it can be completed.
+var completionValueFlags = map[string]string{
+	"-i":       "",
+	"-label":   "",
+	"-a":       "",
+	"-L":       "",
+	"-b":       "",
+	"-m":       "",
+	"-passes":  "",
+	"-method":  "wipe-method",
+	"-chunk":   "",
+	"-workers": "",
+	"-offset":  "",
+	"-timeout": "",
+	"-S":       "",
+	"-type":    "pool-layout",
+	"-o":       "list-format",
+	"-output":  "list-format",
+	"--output": "list-format",
+}
+
+// completionCommand prints a completion script for bash, zsh or fish. The
+// scripts complete command names themselves and ask pgpart __complete for
+// the arguments, so disk names are always current.
+func (c *CLI) completionCommand() int {
+	if len(c.args) < 3 {
+		fmt.Fprintln(os.Stderr, "Usage: pgpart completion <bash|zsh|fish>")
+		fmt.Fprintln(os.Stderr, "Example: source <(pgpart completion bash)")
+		return 1
+	}
+
+	var script string
+	switch c.args[2] {
+	case "bash":
+		script = bashCompletion
+	case "zsh":
+		script = zshCompletion
+	case "fish":
+		script = fishCompletion
+	default:
+		fmt.Fprintf(os.Stderr, "Error: unsupported shell %q (use bash, zsh or fish)\n", c.args[2])
+		return 1
+	}
+
+	fmt.Print(strings.ReplaceAll(script, "@COMMANDS@", strings.Join(completionCommands, " ")))
+	return 0
+}
+
+// completeCommand is the hidden __complete command the completion scripts
+// call. Given a command and the words typed after it, it prints the
+// candidates for the next word one per line, e.g. the disk names for
+// "pgpart __complete info". It only reads the disk list, so it works
+// without root.
+func (c *CLI) completeCommand() int {
+	if len(c.args) < 3 {
+		return 1
+	}
+	command, words := c.args[2], c.args[3:]
+
+	kind := ""
+	position := 0
+	for i := 0; i < len(words); i++ {
+		if valueKind, ok := completionValueFlags[words[i]]; ok {
+			if i == len(words)-1 {
+				// The word being completed is this flag's value
+				return printCompletions(valueKind)
+			}
+			i++
+			continue
+		}
+		if !strings.HasPrefix(words[i], "-") {
+			position++
+		}
+	}
+
+	kinds := completionArgs[command]
+	switch {
+	case position < len(kinds):
+		kind = kinds[position]
+	case len(kinds) > 0 && repeatedCompletionArgs[command]:
+		kind = kinds[len(kinds)-1]
+	}
+
+	return printCompletions(kind)
+}
+
+// printCompletions prints the candidates for an argument of the given kind
+// one per line
+func printCompletions(kind string) int {
+	candidates, err := completionCandidates(kind)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	for _, candidate := range candidates {
+		fmt.Println(candidate)
+	}
+	return 0
+}
+
+// completionCandidates returns the values an argument of the given kind
+// can take
+func completionCandidates(kind string) ([]string, error) {
+	switch kind {
+	case "disk", "partition", "device":
+		disks, err := partition.GetDisks()
+		if err != nil {
+			return nil, err
+		}
+		var names []string
+		for _, disk := range disks {
+			if kind != "partition" {
+				names = append(names, disk.Name)
+			}
+			if kind != "disk" {
+				for _, part := range disk.Partitions {
+					names = append(names, part.Name)
+				}
+			}
+		}
+		return names, nil
+	case "filesystem":
+		return strings.Fields(strings.ToLower(strings.Join(partition.FormatterNames(), " "))), nil
+	case "fstype":
+		filesystems, _ := completionCandidates("filesystem")
+		return append(filesystems, partition.PartitionTypeAliases()...), nil
+	case "type":
+		return partition.PartitionTypeAliases(), nil
+	case "attribute":
+		var names []string
+		for _, attr := range partition.GetAvailableAttributes() {
+			names = append(names, attr.Name)
+		}
+		return names, nil
+	case "wipe-method":
+		return partition.WipeMethods, nil
+	case "pool-layout":
+		return partition.ZFSPoolLayouts, nil
+	case "list-format":
+		return []string{"table", "csv", "json"}, nil
+	case "shell":
+		return []string{"bash", "zsh", "fish"}, nil
+	}
+	return nil, nil
+}
+
+const bashCompletion = `# bash completion for pgpart
+# Load it with: source <(pgpart completion bash)
+_pgpart() {
+    local cur="${COMP_WORDS[COMP_CWORD]}"
+    local i=1
+    while [[ $i -lt $COMP_CWORD && " -n --dry-run -y --yes " == *" ${COMP_WORDS[i]} "* ]]; do
+        ((i++))
+    done
+
+    if [[ $COMP_CWORD -eq $i ]]; then
+        COMPREPLY=($(compgen -W "@COMMANDS@" -- "$cur"))
+        return
+    fi
+    [[ $cur == -* ]] && return
+
+    COMPREPLY=($(compgen -W "$(pgpart __complete "${COMP_WORDS[@]:i:COMP_CWORD-i}" 2>/dev/null)" -- "$cur"))
+}
+complete -o default -F _pgpart pgpart
+`
+
+const zshCompletion = `#compdef pgpart
+# zsh completion for pgpart
+# Load it with: source <(pgpart completion zsh)
+# or save it as _pgpart in a directory on $fpath
+_pgpart() {
+    local -a commands candidates
+    commands=(@COMMANDS@)
+    local i=2
+    while (( i < CURRENT )) && [[ ${words[i]} == (-n|--dry-run|-y|--yes) ]]; do
+        (( i++ ))
+    done
+
+    if (( CURRENT == i )); then
+        compadd -a commands
+        return
+    fi
+    [[ ${words[CURRENT]} == -* ]] && return
+
+    candidates=(${(f)"$(pgpart __complete ${words[i,CURRENT-1]} 2>/dev/null)"})
+    if (( ${#candidates} )); then
+        compadd -a candidates
+    else
+        _files
+    fi
+}
+
+if [[ $funcstack[1] == _pgpart ]]; then
+    _pgpart "$@"
+else
+    compdef _pgpart pgpart
+fi
+`
+
+const fishCompletion = `# fish completion for pgpart
+# Load it with: pgpart completion fish | source
+# or save it as ~/.config/fish/completions/pgpart.fish
+function __pgpart_words
+    set -l words (commandline -opc)
+    set -e words[1]
+    while set -q words[1]; and contains -- $words[1] -n --dry-run -y --yes
+        set -e words[1]
+    end
+    printf '%s\n' $words
+end
+
+function __pgpart_needs_command
+    test (count (__pgpart_words)) -eq 0
+end
+
+complete -c pgpart -n __pgpart_needs_command -f -a "@COMMANDS@"
+complete -c pgpart -n 'not __pgpart_needs_command' -a '(pgpart __complete (__pgpart_words) 2>/dev/null)'
+`
@@ -1,7 +1,10 @@
 package partition
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"os"
 	"os/exec"
 	"strconv"
 	"strings"
@@ -13,11 +16,20 @@ type AlignmentInfo struct {
 	StartOffset    uint64
 	SectorSize     uint64
 	PhysicalSize   uint64
+	StripeOffset   uint64
 	IsAligned      bool
 	AlignmentType  string
 	Recommendation string
 }
 
+// DiskGeometry describes the sector layout reported by diskinfo -v
+type DiskGeometry struct {
+	SectorSize   uint64
+	StripeSize   uint64
+	StripeOffset uint64
+	NonRotating  bool
+}
+
 // Common alignment boundaries in bytes
 const (
 	Align4K   uint64 = 4096    // 4 KiB - minimum for advanced format
@@ -28,13 +40,17 @@ const (
 
 // CheckPartitionAlignment checks if a partition is properly aligned
 func CheckPartitionAlignment(partName string) (*AlignmentInfo, error) {
+	if fakeDisks != nil {
+		return fakeDisks.alignment(partName)
+	}
+
 	info := &AlignmentInfo{
 		Partition: partName,
 	}
 
 	// Get partition start offset using gpart show
 	cmd := exec.Command("gpart", "show", "-p", partName)
-	output, err := cmd.CombinedOutput()
+	output, err := runCommand(cmd)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get partition info: %v", err)
 	}
@@ -59,17 +75,12 @@ func CheckPartitionAlignment(partName string) (*AlignmentInfo, error) {
 		diskName = strings.TrimRight(partName, "0123456789ps")
 	}
 
-	// Get disk info for sector size
-	cmd = exec.Command("diskinfo", diskName)
-	output, err = cmd.CombinedOutput()
+	// Get sector and stripe sizes for the underlying disk
+	geom, err := GetDiskGeometry(diskName)
 	if err == nil {
-		fields := strings.Fields(string(output))
-		if len(fields) >= 2 {
-			sectorSize, err := strconv.ParseUint(fields[1], 10, 64)
-			if err == nil {
-				info.SectorSize = sectorSize
-			}
-		}
+		info.SectorSize = geom.SectorSize
+		info.PhysicalSize = geom.StripeSize
+		info.StripeOffset = geom.StripeOffset
 	}
 
 	// Default sector size if we couldn't determine it
@@ -77,25 +88,45 @@ func CheckPartitionAlignment(partName string) (*AlignmentInfo, error) {
 		info.SectorSize = 512
 	}
 
-	// Calculate physical sector size (often 4K for modern drives)
-	info.PhysicalSize = Align4K
+	// Assume 4K physical sectors when the device doesn't report a stripe size
+	if info.PhysicalSize == 0 {
+		info.PhysicalSize = Align4K
+	}
 
-	// Check alignment
+	// Check alignment relative to the start of the first physical stripe
 	startBytes := info.StartOffset * info.SectorSize
-	info.IsAligned, info.AlignmentType, info.Recommendation = checkAlignment(startBytes)
+	if startBytes >= info.StripeOffset {
+		startBytes -= info.StripeOffset
+	}
+	info.IsAligned, info.AlignmentType, info.Recommendation = checkAlignment(startBytes, info.PhysicalSize)
 
 	return info, nil
 }
 
-// checkAlignment determines if a byte offset is aligned and provides recommendations
-func checkAlignment(offset uint64) (bool, string, string) {
+// checkAlignment determines if a byte offset is aligned and provides recommendations.
+// physicalSize is the device's physical sector or stripe size; an offset that
+// isn't a multiple of it is misaligned regardless of the other boundaries.
+func checkAlignment(offset, physicalSize uint64) (bool, string, string) {
+	if physicalSize == 0 {
+		physicalSize = Align4K
+	}
+
+	if offset%physicalSize != 0 {
+		return false, "Misaligned", fmt.Sprintf("Partition should be aligned to the device's %s physical/stripe size (1 MiB or a multiple of %s recommended)",
+			FormatBytes(physicalSize), FormatBytes(physicalSize))
+	}
+
 	// Check various alignment levels
-	if offset%Align4M == 0 {
+	if offset%Align4M == 0 && Align4M%physicalSize == 0 {
 		return true, "4 MiB aligned", "Optimal alignment for SSDs"
 	}
-	if offset%Align1M == 0 {
+	if offset%Align1M == 0 && Align1M%physicalSize == 0 {
 		return true, "1 MiB aligned", "Recommended alignment for modern drives"
 	}
+	if physicalSize > Align4K {
+		// Aligned to the device stripe, which is what matters most for this hardware
+		return true, FormatBytes(physicalSize) + " stripe aligned", "Matches the device stripe size"
+	}
 	if offset%Align128K == 0 {
 		return true, "128 KiB aligned", "Good alignment, but 1 MiB recommended"
 	}
@@ -107,29 +138,91 @@ func checkAlignment(offset uint64) (bool, string, string) {
 	return false, "Misaligned", "Partition should be aligned to at least 1 MiB boundary for optimal performance"
 }
 
-// CalculateAlignedOffset calculates the next aligned offset for a given start position
+// GetDiskGeometry reads the logical sector size, stripe size and stripe offset
+// of a disk from diskinfo -v
+func GetDiskGeometry(diskName string) (*DiskGeometry, error) {
+	cmd := exec.Command("diskinfo", "-v", diskName)
+	output, err := runCommand(cmd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get disk geometry: %v", err)
+	}
+
+	return parseDiskinfoVerbose(string(output)), nil
+}
+
+// parseDiskinfoVerbose parses diskinfo -v output, which has one
+// "<value> # <description>" pair per line
+func parseDiskinfoVerbose(output string) *DiskGeometry {
+	geom := &DiskGeometry{}
+
+	for _, line := range strings.Split(output, "\n") {
+		parts := strings.SplitN(line, "#", 2)
+		if len(parts) != 2 {
+			continue
+		}
+
+		value := strings.TrimSpace(parts[0])
+		desc := strings.TrimSpace(parts[1])
+		num, err := strconv.ParseUint(value, 10, 64)
+
+		switch {
+		case desc == "sectorsize" && err == nil:
+			geom.SectorSize = num
+		case desc == "stripesize" && err == nil:
+			geom.StripeSize = num
+		case desc == "stripeoffset" && err == nil:
+			geom.StripeOffset = num
+		case strings.HasPrefix(desc, "Rotation rate") && err == nil:
+			geom.NonRotating = num == 0
+		}
+	}
+
+	return geom
+}
+
+// gcd returns the greatest common divisor of a and b
+func gcd(a, b uint64) uint64 {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+// CalculateAlignedOffset calculates the next aligned offset for a given start
+// position. An alignment of 0 leaves the offset unchanged.
 func CalculateAlignedOffset(offset, alignment uint64) uint64 {
-	if offset%alignment == 0 {
+	if alignment == 0 || offset%alignment == 0 {
 		return offset
 	}
 	return ((offset / alignment) + 1) * alignment
 }
 
-// GetOptimalAlignment returns the recommended alignment for a disk type
+// GetOptimalAlignment returns the recommended alignment for a disk type.
+// The result is always a multiple of the disk's stripe size.
 func GetOptimalAlignment(diskName string) uint64 {
-	// Check if SSD using rotation rate
-	cmd := exec.Command("diskinfo", "-v", diskName)
-	output, err := cmd.CombinedOutput()
-	if err == nil {
-		outputStr := string(output)
-		if strings.Contains(outputStr, "non-rotating") || strings.Contains(outputStr, "# Rotation rate") && strings.Contains(outputStr, "0") {
-			// SSD - use 4 MiB alignment
-			return Align4M
-		}
+	geom, err := GetDiskGeometry(diskName)
+	if err != nil {
+		// Default to 1 MiB for unknown devices
+		return Align1M
+	}
+
+	return optimalAlignment(geom)
+}
+
+// optimalAlignment picks an alignment for the given geometry
+func optimalAlignment(geom *DiskGeometry) uint64 {
+	// SSDs use 4 MiB alignment, HDDs and unknown types 1 MiB
+	alignment := Align1M
+	if geom.NonRotating {
+		alignment = Align4M
 	}
 
-	// Default to 1 MiB for HDDs and unknown types
-	return Align1M
+	// Round up to a common multiple of the stripe size (e.g. RAID stripes)
+	if geom.StripeSize > 0 && alignment%geom.StripeSize != 0 {
+		alignment = alignment / gcd(alignment, geom.StripeSize) * geom.StripeSize
+	}
+
+	return alignment
 }
 
 // AlignPartitionSize ensures partition size is aligned to sector boundaries
@@ -171,37 +264,26 @@ func FormatAlignmentInfo(info *AlignmentInfo) string {
 		status = "✗ MISALIGNED"
 	}
 
-	return fmt.Sprintf("%s: %s\n  Start: %d sectors (%d bytes)\n  Type: %s\n  Recommendation: %s",
+	return fmt.Sprintf("%s: %s\n  Start: %d sectors (%d bytes)\n  Physical/stripe size: %s\n  Type: %s\n  Recommendation: %s",
 		info.Partition, status, info.StartOffset, info.StartOffset*info.SectorSize,
-		info.AlignmentType, info.Recommendation)
+		FormatBytes(info.PhysicalSize), info.AlignmentType, info.Recommendation)
 }
 
-// CreateAlignedPartition creates a partition with optimal alignment
+// CreateAlignedPartition creates a partition like CreatePartition whose
+// start and size are multiples of alignment bytes, e.g. Align1M. An
+// alignment of 0 uses GetOptimalAlignment, 4 MiB on SSDs and 1 MiB on
+// other disks.
 func CreateAlignedPartition(disk string, size uint64, fsType string, alignment uint64) error {
-	// Get current disk info to find free space
-	disks, err := GetDisks()
-	if err != nil {
-		return err
-	}
-
-	var targetDisk *Disk
-	for i, d := range disks {
-		if d.Name == disk {
-			targetDisk = &disks[i]
-			break
-		}
-	}
+	return CreateAlignedPartitionAt(disk, size, fsType, 0, "", alignment)
+}
 
-	if targetDisk == nil {
-		return fmt.Errorf("disk %s not found", disk)
+// CreateAlignedPartitionAt creates a partition like CreatePartitionAt,
+// aligned like CreateAlignedPartition
+func CreateAlignedPartitionAt(disk string, size uint64, fsType string, index int, label string, alignment uint64) error {
+	if alignment == 0 {
+		alignment = GetOptimalAlignment(disk)
 	}
-
-	// Calculate aligned start position
-	// For now, we'll use gpart's default behavior which typically aligns to 1M
-	// In the future, we could add custom alignment using gpart's -a flag
-
-	// Create partition normally (gpart handles alignment automatically in modern FreeBSD)
-	return CreatePartition(disk, size, fsType)
+	return createPartition(context.Background(), disk, size, fsType, index, label, alignment, nil)
 }
 
 // GetAlignmentSummary returns a summary of alignment status for a disk
@@ -221,3 +303,217 @@ func GetAlignmentSummary(diskName string) (aligned, misaligned int, err error) {
 
 	return aligned, misaligned, nil
 }
+
+// Realignment describes how to move the start of a misaligned partition
+// up to the next aligned boundary while keeping its end, so it stays
+// within the space it has now. Offsets and sizes are in bytes.
+type Realignment struct {
+	Partition string
+	Disk      string
+	Index     string
+	Type      string
+	Label     string
+	Alignment uint64
+	OldStart  uint64
+	NewStart  uint64
+	OldSize   uint64
+	NewSize   uint64
+
+	// FileSystem is the filesystem found on the partition, if any. Moving
+	// the start cuts off its beginning, so it has to be backed up first
+	// and restored afterwards.
+	FileSystem string
+
+	// UnknownData is set when no filesystem was recognised but the start
+	// of the partition isn't all zeros, or couldn't be read, so it may
+	// hold data all the same
+	UnknownData bool
+}
+
+// realignCheckBytes is how much of the start of a partition without a
+// recognised filesystem must be zeros for it to count as empty
+const realignCheckBytes = 1024 * 1024
+
+// HasData reports whether a filesystem or other data was found on the
+// partition
+func (r *Realignment) HasData() bool {
+	return (r.FileSystem != "" && r.FileSystem != "unknown") || r.UnknownData
+}
+
+// DataDescription describes what HasData found, e.g. "a UFS filesystem"
+func (r *Realignment) DataDescription() string {
+	if r.FileSystem != "" && r.FileSystem != "unknown" {
+		return fmt.Sprintf("a %s filesystem", r.FileSystem)
+	}
+	return "data that isn't a recognised filesystem"
+}
+
+// readDeviceStart reads up to n bytes from the start of a device. Tests
+// replace it.
+var readDeviceStart = func(name string, n int) ([]byte, error) {
+	f, err := os.Open("/dev/" + name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", name, err)
+	}
+	defer f.Close()
+
+	buf := make([]byte, n)
+	read, err := io.ReadFull(f, buf)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return nil, fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	return buf[:read], nil
+}
+
+// leadingSectorsBlank reports whether the first realignCheckBytes of a
+// partition, or all of a smaller one, are zeros. Fake disks hold nothing
+// but the filesystems they list.
+func leadingSectorsBlank(partName string) (bool, error) {
+	if fakeDisks != nil {
+		return true, nil
+	}
+	data, err := readDeviceStart(partName, realignCheckBytes)
+	if err != nil {
+		return false, err
+	}
+	for _, b := range data {
+		if b != 0 {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// Commands returns the gpart commands that realign the partition, as
+// lines that can be pasted into sh
+func (r *Realignment) Commands() []string {
+	var lines []string
+	for _, cmd := range r.commands() {
+		lines = append(lines, shellQuoteCommand(cmd.Args))
+	}
+	return lines
+}
+
+// commands builds the gpart delete and add that recreate the partition at
+// its aligned start with the same index, type and label
+func (r *Realignment) commands() []*exec.Cmd {
+	sectorSize := deviceSectorSize(r.Disk)
+	partType, err := gpartType(r.Type)
+	if err != nil {
+		partType = r.Type
+	}
+
+	args := []string{"add", "-t", partType,
+		"-b", strconv.FormatUint(r.NewStart/sectorSize, 10),
+		"-s", strconv.FormatUint(r.NewSize/sectorSize, 10),
+		"-i", r.Index}
+	if r.Label != "" {
+		args = append(args, "-l", r.Label)
+	}
+	args = append(args, r.Disk)
+
+	return []*exec.Cmd{
+		exec.Command("gpart", "delete", "-i", r.Index, r.Disk),
+		exec.Command("gpart", args...),
+	}
+}
+
+// PlanRealignment works out how a partition would be realigned to the
+// disk's optimal alignment. It returns nil if the partition is aligned.
+func PlanRealignment(partName string) (*Realignment, error) {
+	disk, index, err := ParsePartitionName(partName)
+	if err != nil {
+		return nil, err
+	}
+	part, err := LookupPartition(disk, index)
+	if err != nil {
+		return nil, err
+	}
+	if part.SizeUnknown {
+		return nil, fmt.Errorf("the size of %s is unknown, so it can't be realigned", partName)
+	}
+
+	alignment := GetOptimalAlignment(disk)
+	start := part.Start * 512
+	end := start + part.Size*512
+	newStart := CalculateAlignedOffset(start, alignment)
+	if newStart == start {
+		return nil, nil
+	}
+	if newStart >= end || (end-newStart)/alignment == 0 {
+		return nil, fmt.Errorf("%s is smaller than one %s alignment unit past its aligned start; recreate it elsewhere instead",
+			partName, FormatBytes(alignment))
+	}
+
+	plan := &Realignment{
+		Partition:  partName,
+		Disk:       disk,
+		Index:      index,
+		Type:       part.Type,
+		Label:      part.Label,
+		Alignment:  alignment,
+		OldStart:   start,
+		NewStart:   newStart,
+		OldSize:    part.Size * 512,
+		NewSize:    (end - newStart) / alignment * alignment,
+		FileSystem: part.FileSystem,
+	}
+	if !plan.HasData() {
+		// Filesystem detection can miss data; only zeros are surely empty
+		blank, err := leadingSectorsBlank(partName)
+		plan.UnknownData = err != nil || !blank
+	}
+	return plan, nil
+}
+
+// RealignPartition recreates a misaligned partition that holds no
+// filesystem at its aligned start, keeping its index, type and label.
+// Partitions with a filesystem or other data are refused, since moving the
+// start would cut off the beginning of it, and so is active swap.
+func RealignPartition(partName string) error {
+	if err := CheckPrivileges(); err != nil {
+		return err
+	}
+	defer markDisksChanged()
+
+	plan, err := PlanRealignment(partName)
+	if err != nil {
+		return err
+	}
+	if plan == nil {
+		return nil
+	}
+	if plan.HasData() {
+		return fmt.Errorf("%s holds %s, which realigning would cut off; back it up, realign the empty partition and restore it",
+			partName, plan.DataDescription())
+	}
+	if active, err := IsSwapActive(partName); err != nil {
+		return err
+	} else if active {
+		return fmt.Errorf("%s is in use as swap; disable it before realigning", partName)
+	}
+
+	if err := CheckNotInFlight(partName); err != nil {
+		return err
+	}
+
+	if DryRun {
+		for _, cmd := range plan.commands() {
+			dryRun(cmd)
+		}
+		return nil
+	}
+
+	if err := DeletePartition(plan.Disk, plan.Index, false); err != nil {
+		return err
+	}
+
+	index, _ := strconv.Atoi(plan.Index)
+	region := FreeRegion{Start: plan.OldStart / 512, Size: plan.OldSize / 512}
+	if err := createPartition(context.Background(), plan.Disk, plan.NewSize, plan.Type, index, plan.Label, plan.Alignment, &region); err != nil {
+		return fmt.Errorf("%s was deleted but could not be recreated aligned; recreate it with %q: %w",
+			partName, plan.Commands()[1], err)
+	}
+
+	return nil
+}
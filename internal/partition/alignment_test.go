@@ -0,0 +1,239 @@
+package partition
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// fakeDeviceStart makes readDeviceStart return data, or err, for the rest
+// of the test
+func fakeDeviceStart(t *testing.T, data []byte, err error) {
+	t.Helper()
+	saved := readDeviceStart
+	readDeviceStart = func(name string, n int) ([]byte, error) {
+		if len(data) > n {
+			return data[:n], err
+		}
+		return data, err
+	}
+	t.Cleanup(func() { readDeviceStart = saved })
+}
+
+func TestLeadingSectorsBlank(t *testing.T) {
+	withData := make([]byte, realignCheckBytes)
+	withData[realignCheckBytes-1] = 0x55
+
+	tests := []struct {
+		name    string
+		data    []byte
+		err     error
+		want    bool
+		wantErr bool
+	}{
+		{"zeros", make([]byte, realignCheckBytes), nil, true, false},
+		{"small partition of zeros", make([]byte, 4096), nil, true, false},
+		{"data in the last checked byte", withData, nil, false, false},
+		{"unreadable", nil, errors.New("permission denied"), false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakeDeviceStart(t, tt.data, tt.err)
+			got, err := leadingSectorsBlank("ada1p6")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("leadingSectorsBlank() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("leadingSectorsBlank() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRealignmentHasData(t *testing.T) {
+	tests := []struct {
+		name string
+		plan Realignment
+		want bool
+	}{
+		{"filesystem", Realignment{FileSystem: "UFS"}, true},
+		{"swap", Realignment{FileSystem: "swap"}, true},
+		{"empty", Realignment{}, false},
+		{"unknown and blank", Realignment{FileSystem: "unknown"}, false},
+		{"unknown with data", Realignment{FileSystem: "unknown", UnknownData: true}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.plan.HasData(); got != tt.want {
+				t.Errorf("HasData() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCalculateAlignedOffset(t *testing.T) {
+	tests := []struct {
+		offset, alignment, want uint64
+	}{
+		{0, Align1M, 0},
+		{0, 0, 0},
+		{Align1M, Align1M, Align1M},
+		{3 * Align1M, Align1M, 3 * Align1M},
+		{4096, Align4K, 4096},
+		{1, Align1M, Align1M},
+		{Align1M + 1, Align1M, 2 * Align1M},
+		{34 * 512, Align1M, Align1M},
+		{12345, 0, 12345},
+	}
+
+	for _, tt := range tests {
+		if got := CalculateAlignedOffset(tt.offset, tt.alignment); got != tt.want {
+			t.Errorf("CalculateAlignedOffset(%d, %d) = %d, want %d", tt.offset, tt.alignment, got, tt.want)
+		}
+	}
+}
+
+func TestCreatePartitionAlignmentInSectors(t *testing.T) {
+	region := FreeRegion{Start: 2048, Size: 100 << 21}
+
+	tests := []struct {
+		sectorSize uint64
+		alignment  uint64
+		want       string
+		wantErr    string
+	}{
+		// gpart add -a takes a count of sectors, like -b and -s
+		{512, Align1M, "gpart add -t freebsd-ufs -b 2048 -s 2097152 -a 2048 ada3", ""},
+		{4096, Align1M, "gpart add -t freebsd-ufs -b 256 -s 262144 -a 256 ada3", ""},
+		{4096, Align4K, "gpart add -t freebsd-ufs -b 256 -s 262144 -a 1 ada3", ""},
+		{4096, 6144, "", "not a multiple of the 4096-byte sectors"},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%d on %d-byte sectors", tt.alignment, tt.sectorSize), func(t *testing.T) {
+			fake := useFakeRunner(t)
+			fake.Respond("diskinfo -v ada3", diskinfoVerbose("ada3", tt.sectorSize), nil)
+
+			err := createPartition(context.Background(), "ada3", 1<<30, "freebsd-ufs", 0, "", tt.alignment, &region)
+			adds := gpartLines(fake.Lines(), "gpart add")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("createPartition = %v, want an error containing %q", err, tt.wantErr)
+				}
+				if len(adds) != 0 {
+					t.Errorf("ran %q after refusing the alignment", adds)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("createPartition: %v", err)
+			}
+			if len(adds) != 1 || adds[0] != tt.want {
+				t.Errorf("ran %q, want %q", adds, tt.want)
+			}
+		})
+	}
+}
+
+// diskinfo -v output of an SSD behind a 64 KiB stripe
+const ssdDiskinfo = `/dev/ada0
+	512         	# sectorsize
+	500107862016	# mediasize in bytes (466G)
+	976773168   	# mediasize in sectors
+	65536       	# stripesize
+	4096        	# stripeoffset
+	969021      	# Cylinders according to firmware.
+	16          	# Heads according to firmware.
+	63          	# Sectors according to firmware.
+	Samsung SSD 860 EVO 500GB	# Disk descr.
+	S3Z1NB0K123456A	# Disk ident.
+	ahcich0     	# Attachment
+	Yes         	# TRIM/UNMAP support
+	0           	# Rotation rate in RPM
+	Not_Zoned   	# Zone Mode
+`
+
+func TestParseDiskinfoVerbose(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   DiskGeometry
+	}{
+		{"SSD with a stripe", ssdDiskinfo, DiskGeometry{SectorSize: 512, StripeSize: 65536, StripeOffset: 4096, NonRotating: true}},
+		{"HDD", "/dev/ada1\n\t4096\t# sectorsize\n\t0\t# stripesize\n\t0\t# stripeoffset\n\t7200\t# Rotation rate in RPM\n",
+			DiskGeometry{SectorSize: 4096}},
+		{"unknown rotation", "/dev/da0\n\t512\t# sectorsize\n\tUnknown\t# Rotation rate in RPM\n", DiskGeometry{SectorSize: 512}},
+		{"no output", "", DiskGeometry{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseDiskinfoVerbose(tt.output); *got != tt.want {
+				t.Errorf("parseDiskinfoVerbose = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGCD(t *testing.T) {
+	tests := []struct{ a, b, want uint64 }{
+		{12, 18, 6},
+		{Align1M, 196608, 65536},
+		{Align4M, 786432, 262144},
+		{7, 0, 7},
+		{0, 7, 7},
+	}
+	for _, tt := range tests {
+		if got := gcd(tt.a, tt.b); got != tt.want {
+			t.Errorf("gcd(%d, %d) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestOptimalAlignment(t *testing.T) {
+	tests := []struct {
+		name string
+		geom DiskGeometry
+		want uint64
+	}{
+		{"HDD", DiskGeometry{SectorSize: 512}, Align1M},
+		{"SSD", DiskGeometry{SectorSize: 512, NonRotating: true}, Align4M},
+		{"4K stripe", DiskGeometry{SectorSize: 512, StripeSize: 4096}, Align1M},
+		{"64K stripe", DiskGeometry{SectorSize: 512, StripeSize: 65536}, Align1M},
+		{"64K stripe on an SSD", DiskGeometry{SectorSize: 512, StripeSize: 65536, NonRotating: true}, Align4M},
+		// Three 64 KiB stripes: the smallest multiple of 192 KiB and 1 MiB
+		{"192K stripe", DiskGeometry{SectorSize: 512, StripeSize: 196608}, 3 * Align1M},
+		{"768K stripe on an SSD", DiskGeometry{SectorSize: 512, StripeSize: 786432, NonRotating: true}, 3 * Align4M},
+		{"8M stripe", DiskGeometry{SectorSize: 512, StripeSize: 8 << 20}, 8 << 20},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := optimalAlignment(&tt.geom)
+			if got != tt.want {
+				t.Errorf("optimalAlignment = %d, want %d", got, tt.want)
+			}
+			if tt.geom.StripeSize > 0 && got%tt.geom.StripeSize != 0 {
+				t.Errorf("alignment %d is not a multiple of the %d-byte stripe", got, tt.geom.StripeSize)
+			}
+		})
+	}
+}
+
+func TestGetOptimalAlignment(t *testing.T) {
+	fake := useFakeRunner(t)
+	fake.Respond("diskinfo -v ada0", ssdDiskinfo, nil)
+	fake.Respond("diskinfo -v ada9", "diskinfo: ada9: No such file or directory", errors.New("exit status 1"))
+
+	if got := GetOptimalAlignment("ada0"); got != Align4M {
+		t.Errorf("GetOptimalAlignment(ada0) = %d, want %d", got, Align4M)
+	}
+	if got := GetOptimalAlignment("ada9"); got != Align1M {
+		t.Errorf("GetOptimalAlignment(ada9) = %d, want the %d default", got, Align1M)
+	}
+}
@@ -3,6 +3,7 @@ package partition
 import (
 	"fmt"
 	"os/exec"
+	"strconv"
 	"strings"
 )
 
@@ -56,6 +57,10 @@ func GetAvailableAttributes() []GPTAttribute {
 
 // GetPartitionAttributes retrieves the current attributes of a partition
 func GetPartitionAttributes(partName string) (*AttributeInfo, error) {
+	if fakeDisks != nil {
+		return fakeDisks.getAttributes(partName)
+	}
+
 	// Extract disk name from partition name
 	diskName, _, err := ParsePartitionName(partName)
 	if err != nil {
@@ -71,10 +76,11 @@ func GetPartitionAttributes(partName string) (*AttributeInfo, error) {
 
 	// First try using gpart list for more detailed output
 	cmd := exec.Command("gpart", "list", partName)
-	output, err := cmd.CombinedOutput()
+	output, err := runCommand(cmd)
 
 	if err == nil {
-		// Parse gpart list output for attributes
+		// gpart list prints one attrib line per attribute set
+		var values []string
 		lines := strings.Split(string(output), "\n")
 		for _, line := range lines {
 			line = strings.TrimSpace(line)
@@ -82,7 +88,7 @@ func GetPartitionAttributes(partName string) (*AttributeInfo, error) {
 				// Extract attribute value
 				attrValue := strings.TrimPrefix(line, "attrib:")
 				attrValue = strings.TrimSpace(attrValue)
-				info.RawValue = attrValue
+				values = append(values, attrValue)
 
 				// Parse individual attributes
 				attrValueUpper := strings.ToUpper(attrValue)
@@ -98,15 +104,16 @@ func GetPartitionAttributes(partName string) (*AttributeInfo, error) {
 				if strings.Contains(attrValueUpper, "NOBLOCKIO") {
 					info.Attributes[AttrNoBlockIO] = true
 				}
-				break
 			}
 		}
+		info.RawValue = strings.Join(values, ",")
+		addRequiredAttribute(info, diskName, partName)
 		return info, nil
 	}
 
 	// Fallback to gpart show if gpart list fails
 	cmd = exec.Command("gpart", "show", "-l", "-p", diskName)
-	output, err = cmd.CombinedOutput()
+	output, err = runCommand(cmd)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get partition info: %v", err)
 	}
@@ -138,9 +145,27 @@ func GetPartitionAttributes(partName string) (*AttributeInfo, error) {
 		}
 	}
 
+	addRequiredAttribute(info, diskName, partName)
 	return info, nil
 }
 
+// addRequiredAttribute adds AttrRequired to info when the partition's GPT
+// entry has the required bit set. It is best-effort: non-GPT disks and
+// entries that can't be read are left without it.
+func addRequiredAttribute(info *AttributeInfo, diskName, partName string) {
+	_, index, err := ParsePartitionName(partName)
+	if err != nil {
+		return
+	}
+	n, err := strconv.Atoi(index)
+	if err != nil {
+		return
+	}
+	if attrs, err := gptEntryAttributes(diskName, n); err == nil && attrs&gptRequiredBit != 0 {
+		info.Attributes[AttrRequired] = true
+	}
+}
+
 // SetPartitionAttribute sets a GPT attribute on a partition
 func SetPartitionAttribute(partName, attribute string) error {
 	// Validate attribute name
@@ -155,9 +180,13 @@ func SetPartitionAttribute(partName, attribute string) error {
 		return fmt.Errorf("invalid attribute: %s", attribute)
 	}
 
+	if fakeDisks != nil {
+		return fakeDisks.setAttribute(partName, attribute, true)
+	}
+
 	// Set the attribute using gpart
 	cmd := exec.Command("gpart", "set", "-a", attribute, partName)
-	output, err := cmd.CombinedOutput()
+	output, err := runCommand(cmd)
 	if err != nil {
 		return fmt.Errorf("failed to set attribute %s: %v\nOutput: %s", attribute, err, string(output))
 	}
@@ -179,9 +208,13 @@ func UnsetPartitionAttribute(partName, attribute string) error {
 		return fmt.Errorf("invalid attribute: %s", attribute)
 	}
 
+	if fakeDisks != nil {
+		return fakeDisks.setAttribute(partName, attribute, false)
+	}
+
 	// Unset the attribute using gpart
 	cmd := exec.Command("gpart", "unset", "-a", attribute, partName)
-	output, err := cmd.CombinedOutput()
+	output, err := runCommand(cmd)
 	if err != nil {
 		return fmt.Errorf("failed to unset attribute %s: %v\nOutput: %s", attribute, err, string(output))
 	}
@@ -231,6 +264,9 @@ func GetAttributeSummary(partName string) string {
 	}
 
 	var attrs []string
+	if info.Attributes[AttrRequired] {
+		attrs = append(attrs, "Required")
+	}
 	if info.Attributes[AttrBootme] {
 		attrs = append(attrs, "Bootable")
 	}
@@ -270,6 +306,12 @@ func FormatAttributeInfo(info *AttributeInfo) string {
 		sb.WriteString(fmt.Sprintf("  %s %s - %s\n", status, attr.Name, attr.Description))
 	}
 
+	// The required attribute is read-only, so it is listed only when set
+	if info.Attributes[AttrRequired] {
+		sb.WriteString(fmt.Sprintf("  [✓] %s - Platform required - firmware or the OS depends on this partition (read-only)\n", AttrRequired))
+		hasAttributes = true
+	}
+
 	if !hasAttributes {
 		sb.WriteString("\nNo attributes are currently set.\n")
 	}
@@ -279,6 +321,10 @@ func FormatAttributeInfo(info *AttributeInfo) string {
 
 // ValidatePartitionForAttributes checks if a partition supports GPT attributes
 func ValidatePartitionForAttributes(partName string) error {
+	if fakeDisks != nil {
+		return fakeDisks.validateForAttributes(partName)
+	}
+
 	// Extract disk name
 	diskName, _, err := ParsePartitionName(partName)
 	if err != nil {
@@ -287,7 +333,7 @@ func ValidatePartitionForAttributes(partName string) error {
 
 	// Check if disk uses GPT
 	cmd := exec.Command("gpart", "show", diskName)
-	output, err := cmd.CombinedOutput()
+	output, err := runCommand(cmd)
 	if err != nil {
 		return fmt.Errorf("failed to check partition scheme: %v", err)
 	}
@@ -299,3 +345,113 @@ func ValidatePartitionForAttributes(partName string) error {
 
 	return nil
 }
+
+// BootFallbackState describes a partition's role in the bootonce/bootfailed
+// one-shot boot workflow used by gptboot
+type BootFallbackState struct {
+	Partition  string
+	Bootme     bool
+	Bootonce   bool
+	Bootfailed bool
+}
+
+// Role returns a short human-readable description of the partition's boot role
+func (s BootFallbackState) Role() string {
+	switch {
+	case s.Bootfailed:
+		return "Failed last one-shot boot"
+	case s.Bootonce:
+		return "Will be tried on next boot"
+	case s.Bootme:
+		return "Primary boot partition"
+	default:
+		return "Not bootable"
+	}
+}
+
+// GetBootFallbackStates returns the boot workflow state of every partition on a disk
+func GetBootFallbackStates(disk *Disk) ([]BootFallbackState, error) {
+	var states []BootFallbackState
+	for _, part := range disk.Partitions {
+		info, err := GetPartitionAttributes(part.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		states = append(states, BootFallbackState{
+			Partition:  part.Name,
+			Bootme:     info.Attributes[AttrBootme],
+			Bootonce:   info.Attributes[AttrBootonce],
+			Bootfailed: info.Attributes[AttrBootfailed],
+		})
+	}
+
+	return states, nil
+}
+
+// SetupBootOnce prepares a one-shot boot into partName: any bootonce flag on
+// the other partitions of the disk is cleared, bootfailed is cleared on the
+// target, and bootonce is set on it (gpart sets bootme along with bootonce).
+// If the boot fails, gptboot clears bootonce and sets bootfailed so the
+// primary partition is used again.
+func SetupBootOnce(disk *Disk, partName string) error {
+	states, err := GetBootFallbackStates(disk)
+	if err != nil {
+		return err
+	}
+
+	found := false
+	for _, state := range states {
+		if state.Partition == partName {
+			found = true
+			continue
+		}
+		if state.Bootonce {
+			if err := UnsetPartitionAttribute(state.Partition, AttrBootonce); err != nil {
+				return err
+			}
+		}
+	}
+
+	if !found {
+		return fmt.Errorf("partition %s not found on disk %s", partName, disk.Name)
+	}
+
+	info, err := GetPartitionAttributes(partName)
+	if err != nil {
+		return err
+	}
+
+	if info.Attributes[AttrBootfailed] {
+		if err := UnsetPartitionAttribute(partName, AttrBootfailed); err != nil {
+			return err
+		}
+	}
+
+	return SetPartitionAttribute(partName, AttrBootonce)
+}
+
+// ClearBootFailed unsets the bootfailed attribute on every partition of a
+// disk that has it, so a system stuck retrying an alternate boot partition
+// returns to normal
+func ClearBootFailed(disk string) error {
+	parts, err := getPartitions(disk)
+	if err != nil {
+		return fmt.Errorf("failed to list partitions on %s: %w", disk, err)
+	}
+
+	for _, part := range parts {
+		info, err := GetPartitionAttributes(part.Name)
+		if err != nil {
+			return err
+		}
+
+		if info.Attributes[AttrBootfailed] {
+			if err := UnsetPartitionAttribute(part.Name, AttrBootfailed); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -1,17 +1,31 @@
 package partition
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
 	"regexp"
+	"strings"
 	"sync"
+	"time"
 )
 
+// partitionNamePattern matches partition names like ada0p1, ada0s1a,
+// nvd0p2 and nvme0n1p3, where n1 is the NVMe namespace
+var partitionNamePattern = regexp.MustCompile(`^([a-z]+[0-9]+(?:n[0-9]+)?)([ps][0-9]+[a-z]?)$`)
+
 // ParsePartitionName extracts disk name and partition index from a partition name
-// Examples: ada0p1 -> (ada0, 1), ada0s1a -> (ada0, s1a)
+// Examples: ada0p1 -> (ada0, 1), ada0s1a -> (ada0, 1a), nvme0n1p3 -> (nvme0n1, 3).
+// A leading /dev/ is accepted, as in /dev/ada0p1.
 func ParsePartitionName(partName string) (disk string, index string, err error) {
-	// Match patterns like ada0p1, ada0s1, nvd0p2, etc.
-	re := regexp.MustCompile(`^([a-z]+[0-9]+)([ps][0-9]+[a-z]?)$`)
-	matches := re.FindStringSubmatch(partName)
+	name, err := NormalizeDeviceName(partName)
+	if err != nil {
+		return "", "", err
+	}
+	matches := partitionNamePattern.FindStringSubmatch(name)
 
 	if len(matches) != 3 {
 		return "", "", fmt.Errorf("invalid partition name format: %s", partName)
@@ -59,6 +73,9 @@ type BatchOperation struct {
 	Description string
 	Status      string // "pending", "running", "completed", "failed"
 	Error       string
+	// Warning notes something a completed operation could not do, such
+	// as grow a filesystem that doesn't support it
+	Warning string
 
 	// Operation-specific parameters
 	Disk           string
@@ -72,13 +89,46 @@ type BatchOperation struct {
 	DestIndex      string
 	FilesystemType string
 	Size           uint64
+
+	// Start places a created partition at this byte offset, and Alignment
+	// in bytes is passed to gpart add -a; zero leaves either to gpart
+	Start     uint64
+	Alignment uint64
+
+	// OnlineResize makes a resize resize the filesystem along with the
+	// partition: online if it is mounted, offline otherwise
+	OnlineResize bool
+
+	// Timeout bounds how long the operation may run; zero uses the
+	// queue's default timeout
+	Timeout time.Duration
 }
 
 // BatchQueue manages a queue of partition operations
 type BatchQueue struct {
-	operations []*BatchOperation
-	nextID     int
-	mu         sync.RWMutex
+	operations   []*BatchOperation
+	nextID       int
+	autoSavePath string
+	// defaultTimeout applies to operations without their own Timeout;
+	// zero means they may run indefinitely
+	defaultTimeout time.Duration
+	mu             sync.RWMutex
+}
+
+// batchQueueFile is the on-disk JSON form of a BatchQueue
+type batchQueueFile struct {
+	NextID     int               `json:"next_id"`
+	Operations []*BatchOperation `json:"operations"`
+}
+
+// DefaultAutoSavePath returns the file used to auto-save the batch queue,
+// in the state directory (see StateDir)
+func DefaultAutoSavePath() (string, error) {
+	dir, err := StateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "batch-autosave.json"), nil
 }
 
 // NewBatchQueue creates a new batch queue
@@ -98,6 +148,7 @@ func (bq *BatchQueue) AddOperation(op *BatchOperation) int {
 	op.Status = "pending"
 	bq.nextID++
 	bq.operations = append(bq.operations, op)
+	bq.autoSaveLocked()
 	return op.ID
 }
 
@@ -109,6 +160,7 @@ func (bq *BatchQueue) RemoveOperation(id int) error {
 	for i, op := range bq.operations {
 		if op.ID == id {
 			bq.operations = append(bq.operations[:i], bq.operations[i+1:]...)
+			bq.autoSaveLocked()
 			return nil
 		}
 	}
@@ -142,6 +194,7 @@ func (bq *BatchQueue) MoveOperation(id int, newPosition int) error {
 
 	// Insert at new position
 	bq.operations = append(bq.operations[:newPosition], append([]*BatchOperation{op}, bq.operations[newPosition:]...)...)
+	bq.autoSaveLocked()
 
 	return nil
 }
@@ -162,6 +215,7 @@ func (bq *BatchQueue) Clear() {
 	defer bq.mu.Unlock()
 
 	bq.operations = make([]*BatchOperation, 0)
+	bq.autoSaveLocked()
 }
 
 // Count returns the number of operations in the queue
@@ -172,8 +226,12 @@ func (bq *BatchQueue) Count() int {
 	return len(bq.operations)
 }
 
-// ExecuteAll executes all operations in the queue
-func (bq *BatchQueue) ExecuteAll(stopOnError bool, progressCallback func(int, int, string)) error {
+// ExecuteAll executes all operations in the queue, reporting each one to
+// progress, which may be nil, as it starts: done is the number of
+// operations before it and the message its description. In dry-run mode
+// the operations only print their commands, and the queue is left as it
+// was.
+func (bq *BatchQueue) ExecuteAll(stopOnError bool, progress ProgressReporter) error {
 	bq.mu.Lock()
 	defer bq.mu.Unlock()
 
@@ -182,17 +240,29 @@ func (bq *BatchQueue) ExecuteAll(stopOnError bool, progressCallback func(int, in
 		return fmt.Errorf("no operations to execute")
 	}
 
+	if DryRun {
+		return bq.dryRunLocked(stopOnError, progress)
+	}
+
+	defer bq.autoSaveLocked()
+
+	progress = orNoProgress(progress)
 	for i, op := range bq.operations {
 		if op.Status == "completed" {
 			continue
 		}
 
 		op.Status = "running"
-		if progressCallback != nil {
-			progressCallback(i+1, total, op.Description)
+		op.Warning = ""
+		bq.autoSaveLocked()
+		progress.Update(uint64(i), uint64(total), op.Description)
+
+		err := bq.executeWithTimeout(op)
+		var warning *operationWarning
+		if errors.As(err, &warning) {
+			op.Warning = warning.message
+			err = nil
 		}
-
-		err := bq.executeOperation(op)
 		if err != nil {
 			op.Status = "failed"
 			op.Error = err.Error()
@@ -207,32 +277,192 @@ func (bq *BatchQueue) ExecuteAll(stopOnError bool, progressCallback func(int, in
 	return nil
 }
 
-// executeOperation executes a single operation
-func (bq *BatchQueue) executeOperation(op *BatchOperation) error {
+// dryRunLocked runs the pending operations in dry-run mode without
+// changing their status. Each operation is checked against the disks as
+// they are now, not as the operations before it would leave them. The
+// caller must hold bq.mu.
+func (bq *BatchQueue) dryRunLocked(stopOnError bool, progress ProgressReporter) error {
+	progress = orNoProgress(progress)
+	var errs []error
+	for i, op := range bq.operations {
+		if op.Status == "completed" {
+			continue
+		}
+
+		progress.Update(uint64(i), uint64(len(bq.operations)), op.Description)
+
+		var warning *operationWarning
+		if err := bq.executeOperation(context.Background(), op); err != nil && !errors.As(err, &warning) {
+			err = fmt.Errorf("operation %d would fail: %v", op.ID, err)
+			if stopOnError {
+				return err
+			}
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// SetDefaultTimeout sets the timeout of operations that don't have their
+// own. Zero disables it.
+func (bq *BatchQueue) SetDefaultTimeout(timeout time.Duration) {
+	bq.mu.Lock()
+	defer bq.mu.Unlock()
+
+	bq.defaultTimeout = timeout
+}
+
+// DefaultTimeout returns the timeout of operations that don't have their own
+func (bq *BatchQueue) DefaultTimeout() time.Duration {
+	bq.mu.RLock()
+	defer bq.mu.RUnlock()
+
+	return bq.defaultTimeout
+}
+
+// executeWithTimeout executes an operation, stopping it once its timeout
+// expires so one stuck operation can't hold up the rest of the queue. The
+// operation's gpart, formatting tool or dd is killed, and it only returns
+// once that has exited, so the next operation never runs alongside it.
+// The caller must hold bq.mu.
+func (bq *BatchQueue) executeWithTimeout(op *BatchOperation) error {
+	timeout := op.Timeout
+	if timeout == 0 {
+		timeout = bq.defaultTimeout
+	}
+	if timeout <= 0 {
+		return bq.executeOperation(context.Background(), op)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	err := bq.executeOperation(ctx, op)
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("timed out after %s and was stopped; check %s before retrying: %w",
+			timeout, op.target(), err)
+	}
+	return err
+}
+
+// target names the disk or partition an operation works on
+func (op *BatchOperation) target() string {
+	switch op.Type {
+	case OpFormat:
+		return op.Partition
+	case OpCopy:
+		return op.DestPart
+	case OpMove:
+		return op.DestDisk
+	default:
+		return op.Disk
+	}
+}
+
+// executeOperation executes a single operation, stopping the commands it
+// runs once ctx is done
+func (bq *BatchQueue) executeOperation(ctx context.Context, op *BatchOperation) error {
 	switch op.Type {
 	case OpCreate:
-		return CreatePartition(op.Disk, op.Size, op.FilesystemType)
+		var region *FreeRegion
+		if op.Start > 0 {
+			region = &FreeRegion{Start: op.Start / 512, Size: op.Size / 512}
+		}
+		return createPartition(ctx, op.Disk, op.Size, op.FilesystemType, 0, "", op.Alignment, region)
 
 	case OpDelete:
-		return DeletePartition(op.Disk, op.Index)
+		return deletePartition(ctx, op.Disk, op.Index, false)
 
 	case OpFormat:
-		return FormatPartition(op.Partition, op.FilesystemType)
+		return formatPartition(ctx, op.Partition, op.FilesystemType, FormatOptions{}, false, nil, nil)
 
 	case OpResize:
-		return ResizePartition(op.Disk, op.Index, op.Size)
+		if op.OnlineResize {
+			return resizeOperationFilesystem(ctx, op)
+		}
+		return resizePartition(ctx, op.Disk, op.Index, op.Size, false)
 
 	case OpCopy:
-		return CopyPartition(op.SourcePart, op.DestPart, nil)
+		return CopyPartitionContext(ctx, op.SourcePart, op.DestPart, 0, nil, nil)
 
 	case OpMove:
-		return MovePartition(op.SourceDisk, op.SourceIndex, op.DestDisk, op.DestIndex, nil)
+		return movePartition(ctx, op.SourceDisk, op.SourceIndex, op.DestDisk, op.DestIndex, nil, nil)
 
 	default:
 		return fmt.Errorf("unknown operation type: %v", op.Type)
 	}
 }
 
+// operationWarning is returned by an operation that completed without
+// doing everything it was asked to. The operation counts as completed,
+// with the message as its warning.
+type operationWarning struct {
+	message string
+}
+
+func (w *operationWarning) Error() string {
+	return w.message
+}
+
+// resizeOperationFilesystem resizes the partition of a resize operation
+// together with its filesystem. Mounted filesystems and ZFS vdevs are
+// resized online, others offline. A filesystem that can't be grown is
+// left at its size with a warning; one that can't be shrunk is an error,
+// since shrinking the partition alone would cut it off. gpart is killed
+// once ctx is done.
+func resizeOperationFilesystem(ctx context.Context, op *BatchOperation) error {
+	part, err := LookupPartition(op.Disk, op.Index)
+	if err != nil {
+		return err
+	}
+
+	grow := op.Size > part.Size*512
+	fsType := strings.ToLower(part.FileSystem)
+
+	if part.MountPoint != "" || isZFS(part) {
+		ok, reason := CanResizeOnline(part, grow)
+		if ok {
+			return performOnlineResize(ctx, op.Disk, op.Index, op.Size, part)
+		}
+		if !grow {
+			return fmt.Errorf("cannot shrink %s while it is mounted: %s", part.Name, reason)
+		}
+		if err := resizePartition(ctx, op.Disk, op.Index, op.Size, false); err != nil {
+			return err
+		}
+		return &operationWarning{fmt.Sprintf("%s was resized, but its %s filesystem was not grown: %s",
+			part.Name, part.FileSystem, reason)}
+	}
+
+	hasFilesystem := fsType != "" && fsType != "unknown" && fsType != "swap"
+	if grow && hasFilesystem && !hasResizableFilesystem(fsType) {
+		if err := resizePartition(ctx, op.Disk, op.Index, op.Size, false); err != nil {
+			return err
+		}
+		return &operationWarning{fmt.Sprintf("%s was resized, but %s filesystems can't be grown, so it keeps its old size",
+			part.Name, part.FileSystem)}
+	}
+
+	_, err = resizeWithFilesystem(ctx, op.Disk, op.Index, op.Size, part)
+	return err
+}
+
+// GetWarningCount returns the number of operations that completed with a
+// warning
+func (bq *BatchQueue) GetWarningCount() int {
+	bq.mu.RLock()
+	defer bq.mu.RUnlock()
+
+	count := 0
+	for _, op := range bq.operations {
+		if op.Status == "completed" && op.Warning != "" {
+			count++
+		}
+	}
+	return count
+}
+
 // GetCompletedCount returns the number of completed operations
 func (bq *BatchQueue) GetCompletedCount() int {
 	bq.mu.RLock()
@@ -261,6 +491,27 @@ func (bq *BatchQueue) GetFailedCount() int {
 	return count
 }
 
+// ResetFailed marks the failed operations pending again and clears their
+// errors, so the next ExecuteAll retries them while completed operations
+// stay skipped. It returns the number of operations reset.
+func (bq *BatchQueue) ResetFailed() int {
+	bq.mu.Lock()
+	defer bq.mu.Unlock()
+
+	count := 0
+	for _, op := range bq.operations {
+		if op.Status == "failed" {
+			op.Status = "pending"
+			op.Error = ""
+			count++
+		}
+	}
+	if count > 0 {
+		bq.autoSaveLocked()
+	}
+	return count
+}
+
 // HasPendingOperations returns true if there are pending operations
 func (bq *BatchQueue) HasPendingOperations() bool {
 	bq.mu.RLock()
@@ -273,3 +524,109 @@ func (bq *BatchQueue) HasPendingOperations() bool {
 	}
 	return false
 }
+
+// SetAutoSavePath enables auto-saving the queue to path after every
+// modification. An empty path disables auto-save.
+func (bq *BatchQueue) SetAutoSavePath(path string) {
+	bq.mu.Lock()
+	defer bq.mu.Unlock()
+
+	bq.autoSavePath = path
+	bq.autoSaveLocked()
+}
+
+// autoSaveLocked writes the queue to the auto-save file, removing the file
+// once the queue is empty. The caller must hold bq.mu.
+func (bq *BatchQueue) autoSaveLocked() {
+	if bq.autoSavePath == "" {
+		return
+	}
+
+	if len(bq.operations) == 0 {
+		os.Remove(bq.autoSavePath)
+		return
+	}
+
+	// Auto-save is a best-effort safeguard, a failed write must not
+	// interrupt the operation that triggered it
+	bq.saveLocked(bq.autoSavePath)
+}
+
+// SaveToFile writes the queue to a JSON file
+func (bq *BatchQueue) SaveToFile(path string) error {
+	bq.mu.RLock()
+	defer bq.mu.RUnlock()
+
+	return bq.saveLocked(path)
+}
+
+// saveLocked writes the queue as JSON via a temporary file (see
+// writeFileAtomic)
+func (bq *BatchQueue) saveLocked(path string) error {
+	data, err := json.MarshalIndent(batchQueueFile{
+		NextID:     bq.nextID,
+		Operations: bq.operations,
+	}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode batch queue: %w", err)
+	}
+
+	if err := writeFileAtomic(path, data); err != nil {
+		return fmt.Errorf("failed to write batch queue: %w", err)
+	}
+
+	return nil
+}
+
+// LoadBatchQueue reads a queue previously written by SaveToFile or auto-save.
+// Operations that were running when the file was written are marked failed,
+// since their outcome is unknown.
+func LoadBatchQueue(path string) (*BatchQueue, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read batch queue: %w", err)
+	}
+
+	return DecodeBatchQueue(data)
+}
+
+// RecoverBatchQueue reads the auto-saved queue at path, like
+// LoadBatchQueue, but refuses a file that isn't a regular file owned by the
+// current user, since the operations in it would be run as that user
+func RecoverBatchQueue(path string) (*BatchQueue, error) {
+	if err := checkOwnFile(path); err != nil {
+		return nil, err
+	}
+	return LoadBatchQueue(path)
+}
+
+// DecodeBatchQueue builds a queue from the JSON written by SaveToFile
+func DecodeBatchQueue(data []byte) (*BatchQueue, error) {
+	var file batchQueueFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse batch queue: %w", err)
+	}
+
+	bq := NewBatchQueue()
+	for _, op := range file.Operations {
+		if op == nil {
+			continue
+		}
+		switch op.Status {
+		case "":
+			op.Status = "pending"
+		case "running":
+			op.Status = "failed"
+			op.Error = "interrupted before completion"
+		}
+		bq.operations = append(bq.operations, op)
+		if op.ID >= bq.nextID {
+			bq.nextID = op.ID + 1
+		}
+	}
+	if file.NextID > bq.nextID {
+		bq.nextID = file.NextID
+	}
+
+	return bq, nil
+}
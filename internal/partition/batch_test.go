@@ -0,0 +1,162 @@
+package partition
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBatchAutoSaveRecovery(t *testing.T) {
+	useStateDir(t, filepath.Join(t.TempDir(), "pgpart"))
+	path, err := DefaultAutoSavePath()
+	if err != nil {
+		t.Fatalf("DefaultAutoSavePath: %v", err)
+	}
+
+	bq := NewBatchQueue()
+	bq.SetAutoSavePath(path)
+	bq.AddOperation(&BatchOperation{Type: OpCreate, Description: "Create ada1p6"})
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("queue not auto-saved: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("auto-save mode %o, want 600", perm)
+	}
+
+	recovered, err := RecoverBatchQueue(path)
+	if err != nil {
+		t.Fatalf("RecoverBatchQueue: %v", err)
+	}
+	if recovered.Count() != 1 {
+		t.Errorf("recovered %d operations, want 1", recovered.Count())
+	}
+
+	if os.Geteuid() == 0 {
+		if err := os.Chown(path, 1, 1); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := RecoverBatchQueue(path); err == nil {
+			t.Error("RecoverBatchQueue loaded a file owned by another user")
+		}
+	}
+}
+
+func TestParsePartitionName(t *testing.T) {
+	tests := []struct {
+		name      string
+		wantDisk  string
+		wantIndex string
+		wantErr   bool
+	}{
+		{"ada0p1", "ada0", "1", false},
+		{"da0p2", "da0", "2", false},
+		{"ada0s1a", "ada0", "1a", false},
+		{"ada0s2", "ada0", "2", false},
+		{"nvme0n1p3", "nvme0n1", "3", false},
+		{"nvd0p12", "nvd0", "12", false},
+		{"/dev/ada0p1", "ada0", "1", false},
+		{"ada0", "", "", true},
+		{"ada0p", "", "", true},
+		{"nvme0n1", "", "", true},
+		{"gpt/rootfs", "", "", true},
+		{"p1", "", "", true},
+		{"", "", "", true},
+	}
+
+	for _, tt := range tests {
+		disk, index, err := ParsePartitionName(tt.name)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParsePartitionName(%q) error = %v, wantErr %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if disk != tt.wantDisk || index != tt.wantIndex {
+			t.Errorf("ParsePartitionName(%q) = %q, %q; want %q, %q", tt.name, disk, index, tt.wantDisk, tt.wantIndex)
+		}
+	}
+}
+
+// holdingRunner is a FakeRunner that runs the command line hold until its
+// context is done, as a hung command would run until it is killed. It
+// notes whether a command started while another was still running.
+type holdingRunner struct {
+	*FakeRunner
+	hold string
+
+	mu         sync.Mutex
+	running    bool
+	overlapped bool
+	killed     bool
+}
+
+func (r *holdingRunner) RunContext(ctx context.Context, stdin io.Reader, name string, args ...string) ([]byte, error) {
+	r.mu.Lock()
+	if r.running {
+		r.overlapped = true
+	}
+	r.running = true
+	r.mu.Unlock()
+	defer func() {
+		r.mu.Lock()
+		r.running = false
+		r.mu.Unlock()
+	}()
+
+	if strings.Join(append([]string{name}, args...), " ") == r.hold {
+		<-ctx.Done()
+		r.mu.Lock()
+		r.killed = true
+		r.mu.Unlock()
+		return nil, ctx.Err()
+	}
+	return r.FakeRunner.RunContext(ctx, stdin, name, args...)
+}
+
+func TestExecuteAllStopsTimedOutOperation(t *testing.T) {
+	runner := &holdingRunner{FakeRunner: NewFakeRunner(), hold: "gpart delete -i 2 ada3"}
+	saved := Runner
+	Runner = runner
+	t.Cleanup(func() { Runner = saved })
+
+	bq := NewBatchQueue()
+	bq.SetDefaultTimeout(50 * time.Millisecond)
+	bq.AddOperation(&BatchOperation{Type: OpDelete, Disk: "ada3", Index: "2", Description: "Delete ada3p2"})
+	bq.AddOperation(&BatchOperation{Type: OpDelete, Disk: "ada3", Index: "3", Description: "Delete ada3p3"})
+
+	done := make(chan error, 1)
+	go func() { done <- bq.ExecuteAll(false, nil) }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("ExecuteAll: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("ExecuteAll did not return after the timeout")
+	}
+
+	ops := bq.GetOperations()
+	if ops[0].Status != "failed" || !strings.Contains(ops[0].Error, "timed out") {
+		t.Errorf("first operation: status %q, error %q; want failed with a timeout", ops[0].Status, ops[0].Error)
+	}
+	if ops[1].Status != "completed" {
+		t.Errorf("second operation: status %q, error %q; want completed", ops[1].Status, ops[1].Error)
+	}
+
+	runner.mu.Lock()
+	defer runner.mu.Unlock()
+	if !runner.killed {
+		t.Error("the timed-out gpart delete was not cancelled")
+	}
+	if runner.overlapped {
+		t.Error("the next operation started while the timed-out one was still running")
+	}
+	if deletes := gpartLines(runner.Lines(), "gpart delete -i 3"); len(deletes) != 1 {
+		t.Errorf("second operation ran %q, want one gpart delete", deletes)
+	}
+}
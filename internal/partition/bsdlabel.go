@@ -0,0 +1,98 @@
+package partition
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// bsdLabelIndexPattern matches the index of a partition in a BSD label
+// inside an MBR slice, e.g. 1a for ada0s1a: the slice number followed by
+// the partition letter
+var bsdLabelIndexPattern = regexp.MustCompile(`^([0-9]+)([a-h])$`)
+
+// bsdLetterIndex returns the gpart index of a BSD label partition letter:
+// 1 for a, 2 for b and so on
+func bsdLetterIndex(letter byte) int {
+	return int(letter-'a') + 1
+}
+
+// bsdLabelTarget translates a disk and index naming a BSD label partition,
+// such as ada0 and 1a for ada0s1a, to the geom gpart must be run on and the
+// partition's index there: ada0s1 and 1. The disk may also be the slice
+// itself. Other indexes are returned unchanged.
+func bsdLabelTarget(disk, index string) (geom, gpartIndex string) {
+	matches := bsdLabelIndexPattern.FindStringSubmatch(index)
+	if matches == nil {
+		return disk, index
+	}
+
+	slice := "s" + matches[1]
+	geom = disk
+	if !strings.HasSuffix(disk, slice) {
+		geom = disk + slice
+	}
+	return geom, strconv.Itoa(bsdLetterIndex(matches[2][0]))
+}
+
+// bsdLabelDisks returns a disk for each BSD label found in the freebsd
+// slices of an MBR disk, e.g. ada0s1 holding ada0s1a and ada0s1b. gpart
+// treats a label as a partition table of its own on the slice, so it is
+// listed and partitioned like a disk, with the partitions' offsets relative
+// to the start of the slice.
+func bsdLabelDisks(disk Disk) []Disk {
+	var labels []Disk
+	for _, slice := range disk.Partitions {
+		if slice.Type != "freebsd" {
+			continue
+		}
+
+		parts, state, scheme, err := readPartitionTable(slice.Name)
+		if err != nil || scheme != "BSD" {
+			continue
+		}
+
+		labels = append(labels, Disk{
+			Name:       slice.Name,
+			Model:      fmt.Sprintf("BSD label on %s", disk.Name),
+			Size:       slice.Size * 512,
+			SectorSize: disk.SectorSize,
+			Scheme:     scheme,
+			Partitions: parts,
+			Device:     "/dev/" + slice.Name,
+			TableState: state,
+		})
+	}
+	return labels
+}
+
+// parseGpartShowScheme returns the partition scheme named in the "=>"
+// header of gpart show output, e.g. BSD for
+//
+//	=>      0  4194304  ada0s1  BSD  (2.0G)
+func parseGpartShowScheme(output string) string {
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "=>") {
+			continue
+		}
+		header := strings.Fields(strings.TrimPrefix(line, "=>"))
+		if len(header) >= 4 {
+			return header[3]
+		}
+	}
+	return ""
+}
+
+// bsdLabelPartitionName returns the device name of a BSD label partition
+// given by slice and letter, e.g. ada0s1a for ada0 and 1a, and whether
+// index has that form
+func bsdLabelPartitionName(disk, index string) (string, bool) {
+	matches := bsdLabelIndexPattern.FindStringSubmatch(index)
+	if matches == nil {
+		return "", false
+	}
+	geom, _ := bsdLabelTarget(disk, index)
+	return geom + matches[2], true
+}
@@ -0,0 +1,123 @@
+package partition
+
+import (
+	"reflect"
+	"testing"
+)
+
+// gpart show -p output for an MBR disk whose first slice holds a BSD label
+const (
+	mbrDiskShow = `=>      63  62914497  ada0  MBR  (30G)
+        63         1        - free -  (512B)
+        64  41943040  ada0s1  freebsd  [active]  (20G)
+  41943104  20971456  ada0s2  ntfs  (10G)
+`
+	bsdLabelShow = `=>        0  41943040  ada0s1  BSD  (20G)
+          0  33554432  ada0s1a  freebsd-ufs  (16G)
+   33554432   4194304  ada0s1b  freebsd-swap  (2.0G)
+   37748736   4194304      - free -  (2.0G)
+`
+)
+
+func TestParseGpartShowMBRDisk(t *testing.T) {
+	parts, err := parseGpartShow(mbrDiskShow)
+	if err != nil {
+		t.Fatalf("parseGpartShow: %v", err)
+	}
+
+	want := []Partition{
+		{Name: "ada0s1", Type: "freebsd", Start: 64, Size: 41943040, End: 41943104},
+		{Name: "ada0s2", Type: "ntfs", Start: 41943104, Size: 20971456, End: 62914560},
+	}
+	if !reflect.DeepEqual(parts, want) {
+		t.Errorf("parseGpartShow = %+v, want %+v", parts, want)
+	}
+	if scheme := parseGpartShowScheme(mbrDiskShow); scheme != "MBR" {
+		t.Errorf("parseGpartShowScheme = %q, want MBR", scheme)
+	}
+}
+
+func TestParseGpartShowBSDLabel(t *testing.T) {
+	parts, err := parseGpartShow(bsdLabelShow)
+	if err != nil {
+		t.Fatalf("parseGpartShow: %v", err)
+	}
+
+	// Offsets are relative to the start of the slice
+	want := []Partition{
+		{Name: "ada0s1a", Type: "freebsd-ufs", Start: 0, Size: 33554432, End: 33554432},
+		{Name: "ada0s1b", Type: "freebsd-swap", Start: 33554432, Size: 4194304, End: 37748736},
+	}
+	if !reflect.DeepEqual(parts, want) {
+		t.Errorf("parseGpartShow = %+v, want %+v", parts, want)
+	}
+	if scheme := parseGpartShowScheme(bsdLabelShow); scheme != "BSD" {
+		t.Errorf("parseGpartShowScheme = %q, want BSD", scheme)
+	}
+
+	for i, part := range parts {
+		if n := partitionIndex(part); n != i+1 {
+			t.Errorf("partitionIndex(%s) = %d, want %d", part.Name, n, i+1)
+		}
+	}
+}
+
+func TestParseGpartShowScheme(t *testing.T) {
+	tests := []struct {
+		output string
+		want   string
+	}{
+		{"=>      40  976773088  ada0  GPT  (466G)\n        40     409600  ada0p1  efi  (200M)\n", "GPT"},
+		{"=>      0  4194304  ada0s1  BSD  (2.0G)\n", "BSD"},
+		{"        40     409600  ada0p1  efi  (200M)\n", ""},
+		{"=>  40  976773088\n", ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := parseGpartShowScheme(tt.output); got != tt.want {
+			t.Errorf("parseGpartShowScheme(%q) = %q, want %q", tt.output, got, tt.want)
+		}
+	}
+}
+
+func TestBSDLabelTarget(t *testing.T) {
+	tests := []struct {
+		disk, index         string
+		wantGeom, wantIndex string
+	}{
+		{"ada0", "1b", "ada0s1", "2"},
+		{"ada0", "1a", "ada0s1", "1"},
+		{"ada0", "2h", "ada0s2", "8"},
+		{"ada0s1", "1a", "ada0s1", "1"},
+		{"ada0", "3", "ada0", "3"},
+		{"nvd0", "1i", "nvd0", "1i"},
+	}
+
+	for _, tt := range tests {
+		geom, index := bsdLabelTarget(tt.disk, tt.index)
+		if geom != tt.wantGeom || index != tt.wantIndex {
+			t.Errorf("bsdLabelTarget(%q, %q) = %q, %q; want %q, %q",
+				tt.disk, tt.index, geom, index, tt.wantGeom, tt.wantIndex)
+		}
+	}
+}
+
+func TestParsePartitionNameBSDLabel(t *testing.T) {
+	disk, index, err := ParsePartitionName("ada0s1a")
+	if err != nil || disk != "ada0" || index != "1a" {
+		t.Errorf("ParsePartitionName(ada0s1a) = %q, %q, %v; want ada0, 1a", disk, index, err)
+	}
+}
+
+func TestDeleteBSDLabelPartition(t *testing.T) {
+	fake := useFakeRunner(t)
+
+	if err := DeletePartition("ada0", "1b", false); err != nil {
+		t.Fatalf("DeletePartition(ada0, 1b): %v", err)
+	}
+	deletes := gpartLines(fake.Lines(), "gpart delete")
+	if want := "gpart delete -i 2 ada0s1"; len(deletes) != 1 || deletes[0] != want {
+		t.Errorf("ran %q, want %q", deletes, want)
+	}
+}
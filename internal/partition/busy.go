@@ -0,0 +1,138 @@
+package partition
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// BusyRetries is how many more times CreatePartition, DeletePartition and
+// ResizePartition run gpart when it fails because the device is busy, as
+// happens right after a delete or format while the kernel is still
+// releasing the disk. 0 turns retrying off.
+var BusyRetries = 3
+
+// BusyRetryDelay is how long to wait before the first retry of a busy
+// gpart command. Each further retry waits twice as long as the one before.
+var BusyRetryDelay = 250 * time.Millisecond
+
+// ProcessInfo describes a process holding a file or device open
+type ProcessInfo struct {
+	PID     int
+	Command string
+	User    string
+}
+
+// WhoUses returns the processes that hold a partition busy. For a mounted
+// partition this is every process with a file open on its filesystem,
+// otherwise the processes that have the device node itself open.
+func WhoUses(partName string) ([]ProcessInfo, error) {
+	var cmd *exec.Cmd
+	if mountPoint, _ := getMountPoint(partName); mountPoint != "" {
+		cmd = exec.Command("fstat", "-f", mountPoint)
+	} else {
+		cmd = exec.Command("fstat", "/dev/"+partName)
+	}
+
+	output, err := runCommand(cmd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to run fstat: %w (output: %s)", err, string(output))
+	}
+
+	return parseFstat(string(output)), nil
+}
+
+// parseFstat parses fstat output into a list of unique processes
+// Example line: root     sshd        1234 text /         123 -r-xr-xr-x  123 r
+func parseFstat(output string) []ProcessInfo {
+	var procs []ProcessInfo
+	seen := make(map[int]bool)
+
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 || fields[0] == "USER" {
+			continue
+		}
+
+		pid, err := strconv.Atoi(fields[2])
+		if err != nil || seen[pid] {
+			continue
+		}
+		seen[pid] = true
+
+		procs = append(procs, ProcessInfo{
+			PID:     pid,
+			Command: fields[1],
+			User:    fields[0],
+		})
+	}
+
+	return procs
+}
+
+// IsBusyError reports whether an error from a system tool indicates the
+// device is in use
+func IsBusyError(err error) bool {
+	if err == nil {
+		return false
+	}
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "busy") || strings.Contains(msg, "in use")
+}
+
+// isBusyOutput reports whether the output of a failed command says the
+// device was busy, e.g. "gpart: Device busy"
+func isBusyOutput(output []byte) bool {
+	return strings.Contains(strings.ToLower(string(output)), "busy")
+}
+
+// runRetryingBusy is runCommandContext, running cmd again up to
+// BusyRetries times, with a doubling delay in between, while it fails with
+// output saying the device is busy. The last attempt's output and error
+// are returned. Once ctx is done no more attempts are made.
+func runRetryingBusy(ctx context.Context, cmd *exec.Cmd) ([]byte, error) {
+	output, err := runCommandContext(ctx, cmd)
+	delay := BusyRetryDelay
+	for retry := 0; retry < BusyRetries && err != nil && isBusyOutput(output); retry++ {
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return output, err
+		}
+		delay *= 2
+		output, err = runCommandContext(ctx, cmd)
+	}
+	return output, err
+}
+
+// ExplainBusyError adds the list of processes holding partName to a
+// "device busy" error. Other errors are returned unchanged.
+func ExplainBusyError(partName string, err error) error {
+	if !IsBusyError(err) {
+		return err
+	}
+
+	procs, whoErr := WhoUses(partName)
+	if whoErr != nil || len(procs) == 0 {
+		return err
+	}
+
+	target := partName
+	if mountPoint, _ := getMountPoint(partName); mountPoint != "" {
+		target = mountPoint
+	}
+
+	return fmt.Errorf("%w\n\n%s is in use by %s", err, target, FormatProcessList(procs))
+}
+
+// FormatProcessList returns a list like "sshd (pid 1234), bash (pid 5678)"
+func FormatProcessList(procs []ProcessInfo) string {
+	items := make([]string, len(procs))
+	for i, p := range procs {
+		items[i] = fmt.Sprintf("%s (pid %d)", p.Command, p.PID)
+	}
+	return strings.Join(items, ", ")
+}
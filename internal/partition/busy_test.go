@@ -0,0 +1,80 @@
+package partition
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// useBusyRetries sets BusyRetries and makes the retries immediate for the
+// rest of the test
+func useBusyRetries(t *testing.T, retries int) {
+	t.Helper()
+	savedRetries, savedDelay := BusyRetries, BusyRetryDelay
+	BusyRetries, BusyRetryDelay = retries, time.Microsecond
+	t.Cleanup(func() { BusyRetries, BusyRetryDelay = savedRetries, savedDelay })
+}
+
+// countLines returns how many times line was run
+func countLines(lines []string, line string) int {
+	n := 0
+	for _, l := range lines {
+		if l == line {
+			n++
+		}
+	}
+	return n
+}
+
+func TestDeletePartitionRetriesWhileBusy(t *testing.T) {
+	useBusyRetries(t, 3)
+	fake := useFakeRunner(t)
+	exit1 := errors.New("exit status 1")
+	fake.Respond("gpart delete -i 2 ada3", "gpart: Device busy", exit1)
+	fake.Respond("gpart delete -i 2 ada3", "gpart: Device busy", exit1)
+	fake.Respond("gpart delete -i 2 ada3", "ada3p2 deleted", nil)
+
+	if err := DeletePartition("ada3", "2", false); err != nil {
+		t.Fatalf("DeletePartition = %v, want success on the third attempt", err)
+	}
+	if n := countLines(fake.Lines(), "gpart delete -i 2 ada3"); n != 3 {
+		t.Errorf("gpart delete ran %d times, want 3", n)
+	}
+}
+
+func TestDeletePartitionGivesUpAfterBusyRetries(t *testing.T) {
+	useBusyRetries(t, 2)
+	fake := useFakeRunner(t)
+	fake.Respond("gpart delete -i 2 ada3", "gpart: Device busy", errors.New("exit status 1"))
+
+	err := DeletePartition("ada3", "2", false)
+	if err == nil {
+		t.Fatal("DeletePartition succeeded, want the busy error")
+	}
+	// Where tests run there is no /dev/ada3, so the error says it's gone
+	var gone *DiskGoneError
+	if errors.As(err, &gone) {
+		err = gone.Err
+	}
+	if !strings.Contains(err.Error(), "Device busy") {
+		t.Errorf("DeletePartition = %v, want the busy error", err)
+	}
+	// The first attempt and BusyRetries more
+	if n := countLines(fake.Lines(), "gpart delete -i 2 ada3"); n != 3 {
+		t.Errorf("gpart delete ran %d times, want 3", n)
+	}
+}
+
+func TestDeletePartitionDoesNotRetryOtherErrors(t *testing.T) {
+	useBusyRetries(t, 3)
+	fake := useFakeRunner(t)
+	fake.Respond("gpart delete -i 9 ada3", "gpart: Invalid argument", errors.New("exit status 1"))
+
+	if err := DeletePartition("ada3", "9", false); err == nil {
+		t.Fatal("DeletePartition succeeded, want the gpart error")
+	}
+	if n := countLines(fake.Lines(), "gpart delete -i 9 ada3"); n != 1 {
+		t.Errorf("gpart delete ran %d times, want 1", n)
+	}
+}
@@ -0,0 +1,149 @@
+package partition
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// CloneDisk copies a whole disk, its partition table included, onto a disk
+// at least as large. See CloneDiskWithLog.
+func CloneDisk(sourceDisk, destDisk string, progress ProgressReporter) error {
+	return CloneDiskWithLog(sourceDisk, destDisk, progress, nil)
+}
+
+// CloneDiskWithLog is CloneDisk reporting its steps and the output of dd
+// to logger, which may be nil. A disk of the same size is copied with a
+// single dd of the whole disk. Onto a larger disk the source's partition
+// table is restored with gpart restore and each partition copied in turn,
+// leaving the space after them free. progress receives the bytes copied
+// over all partitions. Whatever the destination held is lost, so nothing
+// on it may be in use, and nothing on the source either, since it must
+// not change while it is copied.
+func CloneDiskWithLog(sourceDisk, destDisk string, progress ProgressReporter, logger OperationLogger) error {
+	if err := CheckPrivileges(); err != nil {
+		return err
+	}
+	defer markDisksChanged()
+
+	if sourceDisk == destDisk {
+		return fmt.Errorf("source and destination cannot be the same")
+	}
+
+	disks, err := GetDisks()
+	if err != nil {
+		return err
+	}
+	src, err := findDisk(disks, sourceDisk)
+	if err != nil {
+		return err
+	}
+	dst, err := findDisk(disks, destDisk)
+	if err != nil {
+		return err
+	}
+
+	if err := checkCloneTarget(src, dst); err != nil {
+		return err
+	}
+	if err := CheckDiskNotInFlight(sourceDisk); err != nil {
+		return err
+	}
+
+	logLine(logger, "%s: %s, %s: %s", sourceDisk, FormatBytes(src.Size), destDisk, FormatBytes(dst.Size))
+
+	if src.Size == dst.Size {
+		logStep(logger, "Copying all of %s to %s", sourceDisk, destDisk)
+		if fakeDisks != nil && !DryRun {
+			return fakeDisks.cloneDisk(sourceDisk, destDisk, progress)
+		}
+		if err := CopyPartitionWithLog(sourceDisk, destDisk, progress, logger); err != nil {
+			return err
+		}
+		logLine(logger, "Cloned %s to %s", sourceDisk, destDisk)
+		return nil
+	}
+
+	if src.Scheme == "" {
+		return fmt.Errorf("%s has no partition table; without one it can only be cloned onto a disk of the same size", sourceDisk)
+	}
+	return clonePartitions(src, dst, progress, logger)
+}
+
+// findDisk returns the named disk among disks
+func findDisk(disks []Disk, name string) (*Disk, error) {
+	for i := range disks {
+		if disks[i].Name == name {
+			return &disks[i], nil
+		}
+	}
+	return nil, fmt.Errorf("no such disk: %s", name)
+}
+
+// checkCloneTarget refuses to clone onto a disk that is smaller than the
+// source, has sectors of another size, belongs to a RAID array or is held
+// by another operation, and refuses while anything on either disk is in
+// use (see checkNotInUse): the source would change under the copy, and
+// whatever uses the destination would be overwritten.
+func checkCloneTarget(src, dst *Disk) error {
+	if dst.Size < src.Size {
+		return fmt.Errorf("%s (%s) is smaller than %s (%s); the destination must be at least as large as the source",
+			dst.Name, FormatBytes(dst.Size), src.Name, FormatBytes(src.Size))
+	}
+
+	srcSector, dstSector := deviceSectorSize(src.Name), deviceSectorSize(dst.Name)
+	if srcSector != dstSector {
+		return fmt.Errorf("%s has %d-byte sectors and %s %d-byte sectors; a disk can only be cloned onto one with the same sector size",
+			src.Name, srcSector, dst.Name, dstSector)
+	}
+
+	if err := CheckNotRAIDMember(dst.Name); err != nil {
+		return err
+	}
+	if err := CheckDiskNotInFlight(dst.Name); err != nil {
+		return err
+	}
+
+	if err := checkNotInUse(src.Name, src.Partitions, "cloning "+src.Name); err != nil {
+		return err
+	}
+	return checkNotInUse(dst.Name, dst.Partitions, "cloning onto "+dst.Name)
+}
+
+// clonePartitions restores the partition table of src on dst and copies
+// each of its partitions to the partition of the same index there
+func clonePartitions(src, dst *Disk, progress ProgressReporter, logger OperationLogger) error {
+	backup, err := BackupPartitionTable(src.Name)
+	if err != nil {
+		return err
+	}
+
+	logStep(logger, "Restoring the partition table of %s on %s", src.Name, dst.Name)
+	if DryRun {
+		dryRun(exec.Command("gpart", "backup", src.Name))
+		dryRun(exec.Command("gpart", "restore", "-F", "-l", dst.Name))
+	} else if err := RestorePartitionTable(dst.Name, backup, true); err != nil {
+		return err
+	}
+
+	var total uint64
+	for _, part := range src.Partitions {
+		total += part.Size * 512
+	}
+
+	progress = orNoProgress(progress)
+	var copied uint64
+	for _, part := range src.Partitions {
+		destPart := dst.Name + strings.TrimPrefix(part.Name, src.Name)
+		partProgress := ProgressFunc(func(done, _ uint64, message string) {
+			progress.Update(copied+done, total, message)
+		})
+		if err := CopyPartitionWithLog(part.Name, destPart, partProgress, logger); err != nil {
+			return fmt.Errorf("failed to copy %s to %s: %w", part.Name, destPart, err)
+		}
+		copied += part.Size * 512
+	}
+
+	logLine(logger, "Cloned %s to %s", src.Name, dst.Name)
+	return nil
+}
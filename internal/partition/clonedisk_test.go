@@ -0,0 +1,38 @@
+package partition
+
+import (
+	"strings"
+	"testing"
+)
+
+// useFakeDisks switches to a fresh fake disk backend for the rest of the
+// test
+func useFakeDisks(t *testing.T) {
+	t.Helper()
+	saved := fakeDisks
+	EnableFakeDisks()
+	t.Cleanup(func() { fakeDisks = saved })
+}
+
+func TestCloneDiskRefusesDisksInUse(t *testing.T) {
+	useFakeDisks(t)
+
+	tests := []struct {
+		name    string
+		src     string
+		dst     string
+		wantErr string
+	}{
+		{"mounted destination", "ada2", "ada1", "ada1p1 is mounted at /data; unmount it before cloning onto ada1"},
+		{"source in use", "ada0", "ada2", "before cloning ada0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CloneDisk(tt.src, tt.dst, nil)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("CloneDisk(%s, %s) = %v, want an error containing %q", tt.src, tt.dst, err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package partition
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// LayoutDifference describes how the partition at one index differs
+// between two disks. A or B is nil when only one disk has that index.
+type LayoutDifference struct {
+	Index  int
+	A      *Partition
+	B      *Partition
+	Fields []string // "size", "type", "filesystem", "missing"
+}
+
+// Description returns a one-line summary of the difference
+func (d LayoutDifference) Description() string {
+	switch {
+	case d.A == nil:
+		return fmt.Sprintf("Index %d: only on second disk (%s %s)", d.Index, FormatBytes(d.B.Size*512), d.B.Type)
+	case d.B == nil:
+		return fmt.Sprintf("Index %d: only on first disk (%s %s)", d.Index, FormatBytes(d.A.Size*512), d.A.Type)
+	}
+
+	var parts []string
+	for _, field := range d.Fields {
+		switch field {
+		case "size":
+			parts = append(parts, fmt.Sprintf("size %s vs %s", FormatBytes(d.A.Size*512), FormatBytes(d.B.Size*512)))
+		case "type":
+			parts = append(parts, fmt.Sprintf("type %s vs %s", d.A.Type, d.B.Type))
+		case "filesystem":
+			parts = append(parts, fmt.Sprintf("filesystem %s vs %s", displayFilesystem(d.A.FileSystem), displayFilesystem(d.B.FileSystem)))
+		}
+	}
+	return fmt.Sprintf("Index %d: %s", d.Index, strings.Join(parts, ", "))
+}
+
+// displayFilesystem returns fs or "none" if it is empty
+func displayFilesystem(fs string) string {
+	if fs == "" {
+		return "none"
+	}
+	return fs
+}
+
+// partitionIndex returns the gpart index of a partition in its table, or 0
+// if the name can't be parsed. BSD label partitions are numbered by letter
+// within their slice, so ada0s1b has index 2.
+func partitionIndex(part Partition) int {
+	_, index, err := ParsePartitionName(part.Name)
+	if err != nil {
+		return 0
+	}
+	if matches := bsdLabelIndexPattern.FindStringSubmatch(index); matches != nil {
+		return bsdLetterIndex(matches[2][0])
+	}
+	n, _ := strconv.Atoi(index)
+	return n
+}
+
+// IndexPartitions returns a disk's partitions keyed by gpart index, along
+// with the sorted list of indexes
+func IndexPartitions(disk Disk) (map[int]*Partition, []int) {
+	byIndex := make(map[int]*Partition)
+	var indexes []int
+	for i := range disk.Partitions {
+		n := partitionIndex(disk.Partitions[i])
+		if n == 0 {
+			continue
+		}
+		if _, dup := byIndex[n]; !dup {
+			indexes = append(indexes, n)
+		}
+		byIndex[n] = &disk.Partitions[i]
+	}
+	sort.Ints(indexes)
+	return byIndex, indexes
+}
+
+// CompareLayouts compares the partition tables of two disks by partition
+// index and returns one entry for each index whose size, type or
+// filesystem differs, or that exists on only one of the disks. Identical
+// layouts return nil.
+func CompareLayouts(a, b Disk) []LayoutDifference {
+	partsA, indexesA := IndexPartitions(a)
+	partsB, indexesB := IndexPartitions(b)
+
+	seen := make(map[int]bool)
+	var indexes []int
+	for _, n := range append(indexesA, indexesB...) {
+		if !seen[n] {
+			seen[n] = true
+			indexes = append(indexes, n)
+		}
+	}
+	sort.Ints(indexes)
+
+	var diffs []LayoutDifference
+	for _, n := range indexes {
+		diff := LayoutDifference{Index: n, A: partsA[n], B: partsB[n]}
+
+		if diff.A == nil || diff.B == nil {
+			diff.Fields = []string{"missing"}
+			diffs = append(diffs, diff)
+			continue
+		}
+
+		if diff.A.Size != diff.B.Size {
+			diff.Fields = append(diff.Fields, "size")
+		}
+		if diff.A.Type != diff.B.Type {
+			diff.Fields = append(diff.Fields, "type")
+		}
+		if !strings.EqualFold(diff.A.FileSystem, diff.B.FileSystem) {
+			diff.Fields = append(diff.Fields, "filesystem")
+		}
+
+		if len(diff.Fields) > 0 {
+			diffs = append(diffs, diff)
+		}
+	}
+
+	return diffs
+}
+
+// CanHoldLayout reports whether disk b is large enough to hold disk a's
+// partition layout at the same offsets, as a disk-to-disk clone would
+// need. The reason explains the result.
+func CanHoldLayout(a, b Disk) (bool, string) {
+	var end uint64
+	for _, part := range a.Partitions {
+		if part.End > end {
+			end = part.End
+		}
+	}
+
+	needed := (end + gptBackupSectors) * 512
+	if len(a.Partitions) == 0 {
+		needed = 0
+	}
+
+	if b.Size < needed {
+		return false, fmt.Sprintf("%s needs %s for %s's layout but is only %s",
+			b.Name, FormatBytes(needed), a.Name, FormatBytes(b.Size))
+	}
+
+	if a.SectorSize != 0 && b.SectorSize != 0 && a.SectorSize != b.SectorSize {
+		return false, fmt.Sprintf("%s has %d-byte sectors but %s has %d-byte sectors, so partition offsets don't carry over",
+			a.Name, a.SectorSize, b.Name, b.SectorSize)
+	}
+
+	return true, fmt.Sprintf("%s (%s) can hold %s's layout (%s used)",
+		b.Name, FormatBytes(b.Size), a.Name, FormatBytes(needed))
+}
@@ -2,23 +2,184 @@ package partition
 
 import (
 	"bufio"
+	"context"
 	"fmt"
+	"os"
 	"os/exec"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // CopyPartition copies data from source partition to destination partition
-func CopyPartition(sourcePart, destPart string, progressCallback func(float64)) error {
+func CopyPartition(sourcePart, destPart string, progress ProgressReporter) error {
+	return CopyPartitionWithLog(sourcePart, destPart, progress, nil)
+}
+
+// CopyPartitionWithLog is CopyPartition reporting its steps and the output
+// of dd to logger, which may be nil
+func CopyPartitionWithLog(sourcePart, destPart string, progress ProgressReporter, logger OperationLogger) error {
+	return CopyPartitionContext(context.Background(), sourcePart, destPart, 0, progress, logger)
+}
+
+// CopyBlockSize is the block size dd copies partitions in. Resumed copies
+// start at a multiple of it.
+const CopyBlockSize = 1024 * 1024
+
+// ddStopTimeout is how long a cancelled dd gets to report what it copied
+// and exit before it is killed
+const ddStopTimeout = 10 * time.Second
+
+// CopyInterruptedError reports a copy that was cancelled before it
+// finished. Copying again from Offset resumes it.
+type CopyInterruptedError struct {
+	Source string
+	Dest   string
+	Offset uint64 // bytes known to be copied, a multiple of CopyBlockSize
+	Size   uint64 // bytes to copy in all
+	Err    error
+}
+
+func (e *CopyInterruptedError) Error() string {
+	percent := 0.0
+	if e.Size > 0 {
+		percent = float64(e.Offset) / float64(e.Size) * 100
+	}
+	return fmt.Sprintf("copy of %s to %s cancelled after %s of %s (%.1f%%); resume from byte offset %d",
+		e.Source, e.Dest, FormatBytes(e.Offset), FormatBytes(e.Size), percent, e.Offset)
+}
+
+func (e *CopyInterruptedError) Unwrap() error {
+	return e.Err
+}
+
+// CopyProgress is how far a partition copy has got each time dd prints a
+// status line. It is passed on to the ProgressReporter of CopyPartition in
+// bytes, with its String as the message.
+type CopyProgress struct {
+	BytesCopied    uint64 // including the offset a resumed copy started at
+	BytesTotal     uint64
+	BytesPerSecond float64       // 0 until a second status line arrives
+	ETA            time.Duration // 0 while the speed is unknown
+}
+
+// Percent returns the share of the copy that is done, from 0 to 100
+func (p CopyProgress) Percent() float64 {
+	if p.BytesTotal == 0 {
+		return 0
+	}
+	return float64(p.BytesCopied) / float64(p.BytesTotal) * 100
+}
+
+// String returns the speed and time left, e.g. "1.20 GB/s, ETA 00:45", or
+// an empty string while the speed is unknown
+func (p CopyProgress) String() string {
+	if p.BytesPerSecond <= 0 {
+		return ""
+	}
+	return fmt.Sprintf("%s/s, ETA %s", FormatBytes(uint64(p.BytesPerSecond)), formatETA(p.ETA))
+}
+
+// report passes the progress on to a reporter, which may be nil
+func (p CopyProgress) report(progress ProgressReporter) {
+	if progress != nil {
+		progress.Update(p.BytesCopied, p.BytesTotal, p.String())
+	}
+}
+
+// formatETA formats a time left as mm:ss, or h:mm:ss from an hour on
+func formatETA(d time.Duration) string {
+	secs := int64(d.Round(time.Second) / time.Second)
+	if secs >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", secs/3600, secs/60%60, secs%60)
+	}
+	return fmt.Sprintf("%02d:%02d", secs/60, secs%60)
+}
+
+// copySpeedSmoothing is the weight a new speed sample gets against the
+// running average, so one slow or fast second doesn't swing the ETA
+const copySpeedSmoothing = 0.3
+
+// copyProgressTracker turns the byte counts of successive dd status lines
+// into CopyProgress, working out the speed from the bytes copied between
+// two lines and the time between them
+type copyProgressTracker struct {
+	offset   uint64 // where this run of dd started
+	total    uint64
+	last     uint64 // bytes dd had copied at the previous line
+	lastTime time.Time
+	speed    float64
+}
+
+// update records that dd has copied transferred bytes at now and returns
+// the progress of the whole copy
+func (t *copyProgressTracker) update(transferred uint64, now time.Time) CopyProgress {
+	if !t.lastTime.IsZero() && transferred > t.last {
+		if dt := now.Sub(t.lastTime).Seconds(); dt > 0 {
+			sample := float64(transferred-t.last) / dt
+			if t.speed == 0 {
+				t.speed = sample
+			} else {
+				t.speed += copySpeedSmoothing * (sample - t.speed)
+			}
+		}
+	}
+	if t.lastTime.IsZero() || transferred > t.last {
+		t.last = transferred
+		t.lastTime = now
+	}
+
+	progress := CopyProgress{
+		BytesCopied:    t.offset + transferred,
+		BytesTotal:     t.total,
+		BytesPerSecond: t.speed,
+	}
+	if progress.BytesCopied > progress.BytesTotal {
+		progress.BytesCopied = progress.BytesTotal
+	}
+	if t.speed > 0 {
+		left := progress.BytesTotal - progress.BytesCopied
+		progress.ETA = time.Duration(float64(left) / t.speed * float64(time.Second))
+	}
+	return progress
+}
+
+// CopyPartitionContext is CopyPartitionWithLog starting offset bytes into
+// both partitions, so an interrupted copy can be resumed, and stopping dd
+// when ctx is cancelled. The offset must be a multiple of CopyBlockSize. A
+// cancelled copy returns a *CopyInterruptedError with the offset to resume
+// from.
+func CopyPartitionContext(ctx context.Context, sourcePart, destPart string, offset uint64, progress ProgressReporter, logger OperationLogger) error {
 	if err := CheckPrivileges(); err != nil {
 		return err
 	}
+	defer markDisksChanged()
 
 	// Validate source and destination
 	if sourcePart == destPart {
 		return fmt.Errorf("source and destination cannot be the same")
 	}
 
+	if offset%CopyBlockSize != 0 {
+		return fmt.Errorf("copy offset %d is not a multiple of the %s copy block size", offset, FormatBytes(CopyBlockSize))
+	}
+
+	release, err := beginInFlight(fmt.Sprintf("copying %s to %s", sourcePart, destPart), sourcePart, destPart)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	if dryRun(ddCopyCommand(ctx, sourcePart, destPart, offset)) {
+		return nil
+	}
+
+	if fakeDisks != nil {
+		return fakeDisks.copyPartition(ctx, sourcePart, destPart, offset, progress, logger)
+	}
+
+	logStep(logger, "Checking that %s is at least as large as %s", destPart, sourcePart)
+
 	// Get source partition size
 	sourceSize, err := getPartitionSize(sourcePart)
 	if err != nil {
@@ -37,15 +198,13 @@ func CopyPartition(sourcePart, destPart string, progressCallback func(float64))
 			FormatBytes(destSize), sourceSize, destSize)
 	}
 
-	// Use dd with status=progress if available, otherwise use basic dd
-	blockSize := uint64(1024 * 1024) // 1MB blocks
-	cmd := exec.Command("dd",
-		"if=/dev/"+sourcePart,
-		"of=/dev/"+destPart,
-		fmt.Sprintf("bs=%d", blockSize),
-		"conv=sync,noerror",
-		"status=progress",
-	)
+	if offset >= sourceSize {
+		return fmt.Errorf("copy offset %s is past the end of %s (%s)", FormatBytes(offset), sourcePart, FormatBytes(sourceSize))
+	}
+
+	logLine(logger, "%s: %s, %s: %s", sourcePart, FormatBytes(sourceSize), destPart, FormatBytes(destSize))
+
+	cmd := ddCopyCommand(ctx, sourcePart, destPart, offset)
 
 	// Set up pipes to capture output
 	stderr, err := cmd.StderrPipe()
@@ -53,46 +212,124 @@ func CopyPartition(sourcePart, destPart string, progressCallback func(float64))
 		return fmt.Errorf("failed to create stderr pipe: %w", err)
 	}
 
+	if offset > 0 {
+		logStep(logger, "Resuming the copy of %s to %s at %s", sourcePart, destPart, FormatBytes(offset))
+	} else {
+		logStep(logger, "Copying %s to %s", sourcePart, destPart)
+	}
+	logLine(logger, "%s", strings.Join(cmd.Args, " "))
 	if err := cmd.Start(); err != nil {
 		return fmt.Errorf("failed to start dd command: %w", err)
 	}
 
-	// Monitor progress
-	if progressCallback != nil {
-		scanner := bufio.NewScanner(stderr)
-		for scanner.Scan() {
-			line := scanner.Text()
-			// Parse dd progress output
-			if strings.Contains(line, "bytes") {
-				progress := parseProgress(line, sourceSize)
-				progressCallback(progress)
-			}
+	// Monitor progress. dd blocks once the pipe fills, so its output is
+	// read even when nobody is listening. Its byte counts are for this
+	// run only, which starts at offset.
+	var transferred uint64
+	tracker := copyProgressTracker{offset: offset, total: sourceSize}
+	scanner := bufio.NewScanner(stderr)
+	scanner.Split(scanDDLines)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
 		}
+		// Parse dd progress output
+		if copied, ok := parseDDBytes(line); ok {
+			transferred = copied
+			tracker.update(transferred, time.Now()).report(progress)
+		}
+		logLine(logger, "%s", line)
 	}
 
 	if err := cmd.Wait(); err != nil {
-		return fmt.Errorf("partition copy failed: %w", err)
+		if ctx.Err() != nil {
+			// Only whole blocks dd reported are sure to be on the
+			// destination
+			done := offset + transferred/CopyBlockSize*CopyBlockSize
+			logLine(logger, "Cancelled after %s of %s", FormatBytes(done), FormatBytes(sourceSize))
+			return &CopyInterruptedError{Source: sourcePart, Dest: destPart, Offset: done, Size: sourceSize, Err: ctx.Err()}
+		}
+		err = fmt.Errorf("partition copy failed: %w", err)
+		if srcErr := ExplainDiskGone(sourcePart, err); IsDiskGone(srcErr) {
+			return srcErr
+		}
+		return ExplainDiskGone(destPart, err)
 	}
 
+	logLine(logger, "Copied %s to %s", sourcePart, destPart)
 	return nil
 }
 
+// ddCopyCommand returns the dd command that copies sourcePart onto destPart
+// in blocks of CopyBlockSize from offset on, reporting progress on stderr.
+// Cancelling ctx interrupts dd, which then prints how much it copied.
+func ddCopyCommand(ctx context.Context, sourcePart, destPart string, offset uint64) *exec.Cmd {
+	args := []string{
+		"if=/dev/" + sourcePart,
+		"of=/dev/" + destPart,
+		fmt.Sprintf("bs=%d", CopyBlockSize),
+		"conv=sync,noerror",
+		"status=progress",
+	}
+	if offset > 0 {
+		blocks := offset / CopyBlockSize
+		args = append(args, fmt.Sprintf("skip=%d", blocks), fmt.Sprintf("seek=%d", blocks))
+	}
+
+	cmd := exec.CommandContext(ctx, "dd", args...)
+	cmd.Cancel = func() error {
+		return cmd.Process.Signal(os.Interrupt)
+	}
+	cmd.WaitDelay = ddStopTimeout
+	return cmd
+}
+
+// scanDDLines splits dd output into lines. dd status=progress rewrites
+// its progress line in place, ending it with \r instead of \n.
+func scanDDLines(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	for i, b := range data {
+		if b == '\n' || b == '\r' {
+			return i + 1, data[:i], nil
+		}
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
 // MovePartition moves a partition by copying it and then deleting the source
-func MovePartition(sourceDisk, sourceIndex, destDisk, destIndex string, progressCallback func(float64)) error {
+func MovePartition(sourceDisk, sourceIndex, destDisk, destIndex string, progress ProgressReporter) error {
+	return MovePartitionWithLog(sourceDisk, sourceIndex, destDisk, destIndex, progress, nil)
+}
+
+// MovePartitionWithLog is MovePartition reporting its steps to logger,
+// which may be nil
+func MovePartitionWithLog(sourceDisk, sourceIndex, destDisk, destIndex string, progress ProgressReporter, logger OperationLogger) error {
+	return movePartition(context.Background(), sourceDisk, sourceIndex, destDisk, destIndex, progress, logger)
+}
+
+// movePartition implements MovePartitionWithLog, stopping dd or gpart once
+// ctx is done
+func movePartition(ctx context.Context, sourceDisk, sourceIndex, destDisk, destIndex string, progress ProgressReporter, logger OperationLogger) error {
 	if err := CheckPrivileges(); err != nil {
 		return err
 	}
+	defer markDisksChanged()
 
 	// First, copy the partition
 	sourcePart := fmt.Sprintf("%sp%s", sourceDisk, sourceIndex)
 	destPart := fmt.Sprintf("%sp%s", destDisk, destIndex)
 
-	if err := CopyPartition(sourcePart, destPart, progressCallback); err != nil {
+	if err := CopyPartitionContext(ctx, sourcePart, destPart, 0, progress, logger); err != nil {
 		return fmt.Errorf("failed to copy partition: %w", err)
 	}
 
+	logStep(logger, "Deleting source %s", sourcePart)
+
 	// After successful copy, delete the source partition
-	if err := DeletePartition(sourceDisk, sourceIndex); err != nil {
+	if err := deletePartition(ctx, sourceDisk, sourceIndex, false); err != nil {
 		return fmt.Errorf("copy succeeded but failed to delete source partition: %w", err)
 	}
 
@@ -100,14 +337,18 @@ func MovePartition(sourceDisk, sourceIndex, destDisk, destIndex string, progress
 }
 
 // ClonePartition creates a new partition with the same data
-func ClonePartition(sourcePart, destPart string, progressCallback func(float64)) error {
-	return CopyPartition(sourcePart, destPart, progressCallback)
+func ClonePartition(sourcePart, destPart string, progress ProgressReporter) error {
+	return CopyPartition(sourcePart, destPart, progress)
 }
 
 // getPartitionSize returns the size of a partition in bytes
 func getPartitionSize(partName string) (uint64, error) {
+	if fakeDisks != nil {
+		return fakeDisks.deviceSize(partName)
+	}
+
 	cmd := exec.Command("diskinfo", "/dev/"+partName)
-	output, err := cmd.CombinedOutput()
+	output, err := runCommand(cmd)
 	if err != nil {
 		return 0, fmt.Errorf("failed to get partition info: %w", err)
 	}
@@ -127,53 +368,17 @@ func getPartitionSize(partName string) (uint64, error) {
 	return size, nil
 }
 
-// parseProgress extracts progress percentage from dd output
-func parseProgress(line string, totalSize uint64) float64 {
-	// Example dd output: "524288000 bytes (524 MB) copied"
-	// Extract the number of bytes copied
+// parseDDBytes extracts the number of bytes copied from a dd progress or
+// summary line such as "524288000 bytes (524 MB) copied" or
+// "524288000 bytes transferred in 5.2 secs"
+func parseDDBytes(line string) (uint64, bool) {
 	fields := strings.Fields(line)
-	if len(fields) > 0 {
-		if bytes, err := strconv.ParseUint(fields[0], 10, 64); err == nil {
-			if totalSize > 0 {
-				return float64(bytes) / float64(totalSize) * 100.0
-			}
-		}
+	if len(fields) < 2 || fields[1] != "bytes" {
+		return 0, false
 	}
-	return 0.0
-}
-
-// VerifyPartitionCopy verifies that the copy was successful by comparing checksums
-func VerifyPartitionCopy(sourcePart, destPart string) error {
-	if err := CheckPrivileges(); err != nil {
-		return err
-	}
-
-	// Get source checksum
-	sourceChecksum, err := getPartitionChecksum(sourcePart)
+	bytes, err := strconv.ParseUint(fields[0], 10, 64)
 	if err != nil {
-		return fmt.Errorf("failed to get source checksum: %w", err)
+		return 0, false
 	}
-
-	// Get destination checksum
-	destChecksum, err := getPartitionChecksum(destPart)
-	if err != nil {
-		return fmt.Errorf("failed to get destination checksum: %w", err)
-	}
-
-	if sourceChecksum != destChecksum {
-		return fmt.Errorf("verification failed: checksums do not match")
-	}
-
-	return nil
-}
-
-// getPartitionChecksum calculates SHA256 checksum of partition data
-func getPartitionChecksum(partName string) (string, error) {
-	cmd := exec.Command("sha256", "-q", "/dev/"+partName)
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return "", err
-	}
-
-	return strings.TrimSpace(string(output)), nil
+	return bytes, true
 }
@@ -0,0 +1,89 @@
+package partition
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+var (
+	preferLabels   = true
+	preferLabelsMu sync.RWMutex
+)
+
+// SetPreferLabels sets whether device references use /dev/gpt/<label>
+// instead of the partition name when the partition has a label
+func SetPreferLabels(prefer bool) {
+	preferLabelsMu.Lock()
+	defer preferLabelsMu.Unlock()
+	preferLabels = prefer
+}
+
+// PreferLabels reports whether label-based device paths are preferred
+func PreferLabels() bool {
+	preferLabelsMu.RLock()
+	defer preferLabelsMu.RUnlock()
+	return preferLabels
+}
+
+// deviceNodeExists reports whether a device node exists. Tests replace it
+// to pretend label nodes exist.
+var deviceNodeExists = func(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// DevicePath returns the device node used to refer to a partition in mounts
+// and fstab entries. With the label preference enabled, a partition is
+// referred to by a name that survives device renumbering as long as its
+// node exists: /dev/gpt/<label> if it has a label, otherwise
+// /dev/gptid/<uuid> from its GPT partition GUID. Failing both, or with the
+// preference off, /dev/<name> is used.
+func DevicePath(part *Partition) string {
+	if PreferLabels() {
+		if part.Label != "" && ValidateGPTLabel(part.Label) == nil {
+			if labelPath := "/dev/gpt/" + part.Label; deviceNodeExists(labelPath) {
+				return labelPath
+			}
+		}
+		if part.UUID != "" {
+			if idPath := "/dev/gptid/" + part.UUID; deviceNodeExists(idPath) {
+				return idPath
+			}
+		}
+	}
+
+	return "/dev/" + part.Name
+}
+
+// deviceNamePattern matches the device names under /dev that pgpart works
+// with: disks and partitions such as ada0, nvme0n1 and da0s1a, and geom
+// providers below a class directory such as gpt/rootfs or diskid/DISK-X1
+var deviceNamePattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_.:+-]*(/[A-Za-z0-9_.:+-]+)*$`)
+
+// NormalizeDeviceName turns a device argument into the bare name the rest
+// of the package expects: a leading /dev/ is stripped, so /dev/ada0 and
+// ada0 name the same disk, and the result is checked to be a plausible
+// device name. Everything that takes a disk or partition name from the
+// user goes through it, which keeps /dev/ from being prepended twice.
+func NormalizeDeviceName(name string) (string, error) {
+	trimmed := strings.TrimSpace(name)
+	if strings.HasPrefix(trimmed, "/dev/") {
+		trimmed = strings.TrimLeft(strings.TrimPrefix(trimmed, "/dev/"), "/")
+	}
+
+	if trimmed == "" {
+		return "", fmt.Errorf("device name is empty")
+	}
+	if !deviceNamePattern.MatchString(trimmed) {
+		return "", fmt.Errorf("invalid device name %q: expected a name like ada0, ada0p1 or /dev/nvme0n1", name)
+	}
+	for _, component := range strings.Split(trimmed, "/") {
+		if component == "." || component == ".." {
+			return "", fmt.Errorf("invalid device name %q: it must not contain . or .. components", name)
+		}
+	}
+	return trimmed, nil
+}
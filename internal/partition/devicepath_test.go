@@ -0,0 +1,93 @@
+package partition
+
+import "testing"
+
+// fakeDeviceNodes makes only the given device nodes exist for the rest of
+// the test
+func fakeDeviceNodes(t *testing.T, nodes ...string) {
+	t.Helper()
+	saved := deviceNodeExists
+	deviceNodeExists = func(path string) bool {
+		for _, node := range nodes {
+			if path == node {
+				return true
+			}
+		}
+		return false
+	}
+	t.Cleanup(func() { deviceNodeExists = saved })
+}
+
+// preferLabelsFor sets the label preference for the rest of the test
+func preferLabelsFor(t *testing.T, prefer bool) {
+	t.Helper()
+	saved := PreferLabels()
+	SetPreferLabels(prefer)
+	t.Cleanup(func() { SetPreferLabels(saved) })
+}
+
+func TestDevicePath(t *testing.T) {
+	const uuid = "5f3c0004-8d2e-11ee-b9d1-0242ac120006"
+	fakeDeviceNodes(t, "/dev/gpt/data", "/dev/gptid/"+uuid)
+
+	tests := []struct {
+		name   string
+		part   Partition
+		prefer bool
+		want   string
+	}{
+		{"label", Partition{Name: "ada1p1", Label: "data", UUID: uuid}, true, "/dev/gpt/data"},
+		{"gptid without a label", Partition{Name: "ada1p1", UUID: uuid}, true, "/dev/gptid/" + uuid},
+		{"gptid when the label node is missing", Partition{Name: "ada1p1", Label: "other", UUID: uuid}, true, "/dev/gptid/" + uuid},
+		{"gptid for an invalid label", Partition{Name: "ada1p1", Label: "my data", UUID: uuid}, true, "/dev/gptid/" + uuid},
+		{"name when neither node exists", Partition{Name: "ada1p2", Label: "other", UUID: "0000"}, true, "/dev/ada1p2"},
+		{"name without label or GUID", Partition{Name: "da0s1"}, true, "/dev/da0s1"},
+		{"name with the preference off", Partition{Name: "ada1p1", Label: "data", UUID: uuid}, false, "/dev/ada1p1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			preferLabelsFor(t, tt.prefer)
+			if got := DevicePath(&tt.part); got != tt.want {
+				t.Errorf("DevicePath() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeDeviceName(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    string
+		wantErr bool
+	}{
+		{"ada0", "ada0", false},
+		{"/dev/ada0", "ada0", false},
+		{"  /dev/ada0p2 ", "ada0p2", false},
+		{"nvme0n1", "nvme0n1", false},
+		{"/dev/nvme0n1p3", "nvme0n1p3", false},
+		{"gpt/label", "gpt/label", false},
+		{"/dev/gpt/rootfs", "gpt/rootfs", false},
+		{"diskid/DISK-X1", "diskid/DISK-X1", false},
+		{"..", "", true},
+		{"gpt/..", "", true},
+		{"/dev/../etc/passwd", "", true},
+		{"", "", true},
+		{"   ", "", true},
+		{"/dev/", "", true},
+		{"ada 0", "", true},
+		{"ada0; rm -rf /", "", true},
+		{"0ada", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := NormalizeDeviceName(tt.name)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("NormalizeDeviceName(%q) error = %v, wantErr %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("NormalizeDeviceName(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
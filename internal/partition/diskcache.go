@@ -0,0 +1,100 @@
+package partition
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// disksChanged counts the operations that changed disks, partitions or
+// their filesystems. Every DiskCache compares it with the value it saw at
+// its last scan, so an operation invalidates all caches at once.
+var disksChanged atomic.Uint64
+
+// markDisksChanged invalidates every DiskCache. Mutating operations defer
+// it right after their privilege check, so the cache is invalidated even
+// when an operation fails halfway and leaves the disks partly changed.
+func markDisksChanged() {
+	disksChanged.Add(1)
+}
+
+// DiskCache memoizes the result of GetDisks, which runs geom, gpart and
+// fstyp for every disk and partition. A cached result is reused until it
+// is older than the TTL or an operation of this package changed the
+// disks. It is safe for concurrent use.
+type DiskCache struct {
+	mu         sync.Mutex
+	ttl        time.Duration
+	disks      []Disk
+	scanned    time.Time
+	generation uint64 // value of disksChanged at the last scan
+	valid      bool
+}
+
+// NewDiskCache creates a cache whose results expire after ttl. A ttl of
+// zero or less disables caching; every call then rescans.
+func NewDiskCache(ttl time.Duration) *DiskCache {
+	return &DiskCache{ttl: ttl}
+}
+
+// Disks returns the cached disks, rescanning if the cache is empty,
+// expired or invalidated
+func (c *DiskCache) Disks() ([]Disk, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.valid && c.ttl > 0 && time.Since(c.scanned) < c.ttl && c.generation == disksChanged.Load() {
+		return copyDisks(c.disks), nil
+	}
+	return c.scanLocked()
+}
+
+// Refresh rescans the disks regardless of the cached result, e.g. after
+// a disk was plugged in or changed by another program
+func (c *DiskCache) Refresh() ([]Disk, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.scanLocked()
+}
+
+// Invalidate drops the cached result so the next Disks call rescans
+func (c *DiskCache) Invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.valid = false
+	c.disks = nil
+}
+
+// scanLocked runs GetDisks and caches its result. A failed scan leaves the
+// cache empty rather than serving the disks from before it. The caller
+// must hold c.mu.
+func (c *DiskCache) scanLocked() ([]Disk, error) {
+	// Read the generation first: an operation finishing during the scan
+	// then leaves the result stale and the next call rescans
+	generation := disksChanged.Load()
+
+	disks, err := GetDisks()
+	if err != nil {
+		c.valid = false
+		c.disks = nil
+		return nil, err
+	}
+
+	c.disks = disks
+	c.scanned = time.Now()
+	c.generation = generation
+	c.valid = true
+	return copyDisks(disks), nil
+}
+
+// copyDisks copies a disk list deeply enough that callers can modify the
+// disks and their partitions without changing the cached ones
+func copyDisks(disks []Disk) []Disk {
+	copied := make([]Disk, len(disks))
+	for i, disk := range disks {
+		copied[i] = copyDisk(disk)
+	}
+	return copied
+}
@@ -5,6 +5,7 @@ import (
 	"os/exec"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // DiskInfo contains detailed information about a disk
@@ -22,6 +23,7 @@ type DiskInfo struct {
 	SMARTEnabled bool
 	Attributes   []SMARTAttribute
 	Capabilities []string
+	Power        PowerManagement
 }
 
 // SMARTAttribute represents a SMART attribute
@@ -34,10 +36,19 @@ type SMARTAttribute struct {
 	RawValue    string
 	Status      string
 	Description string
+
+	// IncreasedSince is set by TrackSMARTTrends when the raw value grew
+	// since the snapshot taken at that time
+	IncreasedSince   time.Time
+	PreviousRawValue uint64
 }
 
 // GetDetailedDiskInfo retrieves comprehensive disk information including SMART data
 func GetDetailedDiskInfo(diskName string) (*DiskInfo, error) {
+	if fakeDisks != nil {
+		return fakeDisks.diskInfo(diskName)
+	}
+
 	info := &DiskInfo{
 		Device: diskName,
 	}
@@ -62,7 +73,7 @@ func GetDetailedDiskInfo(diskName string) (*DiskInfo, error) {
 // getGeomInfo gets basic disk information from geom
 func getGeomInfo(info *DiskInfo) error {
 	cmd := exec.Command("geom", "disk", "list", info.Device)
-	output, err := cmd.CombinedOutput()
+	output, err := runCommand(cmd)
 	if err != nil {
 		return err
 	}
@@ -91,7 +102,7 @@ func getGeomInfo(info *DiskInfo) error {
 
 	// Get partition scheme
 	cmd = exec.Command("gpart", "show", info.Device)
-	output, _ = cmd.CombinedOutput()
+	output, _ = runCommand(cmd)
 	lines = strings.Split(string(output), "\n")
 	for _, line := range lines {
 		if strings.Contains(line, "=>") {
@@ -114,7 +125,7 @@ func getSMARTInfo(info *DiskInfo) error {
 
 	// Get SMART overall health
 	cmd := exec.Command("smartctl", "-H", "/dev/"+info.Device)
-	output, err := cmd.CombinedOutput()
+	output, err := runCommand(cmd)
 	outStr := string(output)
 
 	if err == nil {
@@ -130,7 +141,7 @@ func getSMARTInfo(info *DiskInfo) error {
 
 	// Get detailed SMART attributes
 	cmd = exec.Command("smartctl", "-A", "/dev/"+info.Device)
-	output, err = cmd.CombinedOutput()
+	output, err = runCommand(cmd)
 	if err != nil {
 		return nil // Don't fail if attributes aren't available
 	}
@@ -139,54 +150,96 @@ func getSMARTInfo(info *DiskInfo) error {
 
 	// Get SMART information (temperature, power on hours, etc.)
 	cmd = exec.Command("smartctl", "-a", "/dev/"+info.Device)
-	output, _ = cmd.CombinedOutput()
+	output, _ = runCommand(cmd)
 	parseSMARTDetails(info, string(output))
 
 	return nil
 }
 
-// parseSMARTAttributes parses SMART attribute table
-func parseSMARTAttributes(info *DiskInfo, output string) {
-	lines := strings.Split(output, "\n")
-	inTable := false
+// smartAttributeColumns are the attribute table columns the parser needs.
+// The remaining columns (FLAG/FLAGS, TYPE, UPDATED, WHEN_FAILED/FAIL) vary
+// between smartmontools versions and the -f old/brief output formats.
+var smartAttributeColumns = []string{"ID#", "ATTRIBUTE_NAME", "VALUE", "WORST", "THRESH", "RAW_VALUE"}
+
+// parseSMARTHeader maps the column names of an attribute table header to
+// their field positions. It returns nil if line isn't such a header.
+func parseSMARTHeader(line string) map[string]int {
+	columns := make(map[string]int)
+	for i, name := range strings.Fields(line) {
+		columns[name] = i
+	}
+	for _, name := range smartAttributeColumns {
+		if _, ok := columns[name]; !ok {
+			return nil
+		}
+	}
+	return columns
+}
 
-	for _, line := range lines {
+// whenFailedColumn returns the position of the failure column, which is
+// WHEN_FAILED in the old format and FAIL in the brief one
+func whenFailedColumn(columns map[string]int) (int, bool) {
+	if i, ok := columns["WHEN_FAILED"]; ok {
+		return i, true
+	}
+	i, ok := columns["FAIL"]
+	return i, ok
+}
+
+// parseSMARTAttributeTable parses the ATA attribute table in smartctl -A or
+// -a output. Columns are located by name from the header, so the table is
+// read correctly whichever columns a smartmontools version prints. The raw
+// value is the last column and may contain spaces, e.g. "34 (Min/Max 20/45)".
+func parseSMARTAttributeTable(output string) []SMARTAttribute {
+	var attrs []SMARTAttribute
+	var columns map[string]int
+
+	for _, line := range strings.Split(output, "\n") {
 		line = strings.TrimSpace(line)
 
-		if strings.Contains(line, "ID#") && strings.Contains(line, "ATTRIBUTE_NAME") {
-			inTable = true
+		if header := parseSMARTHeader(line); header != nil {
+			columns = header
 			continue
 		}
 
-		if !inTable || line == "" {
+		if columns == nil {
 			continue
 		}
 
 		fields := strings.Fields(line)
-		if len(fields) < 10 {
+		rawIdx := columns["RAW_VALUE"]
+		if len(fields) <= rawIdx {
+			// A blank line or the flag legend ends the table
+			if line == "" {
+				columns = nil
+			}
 			continue
 		}
 
-		id, err := strconv.Atoi(fields[0])
+		id, err := strconv.Atoi(fields[columns["ID#"]])
 		if err != nil {
 			continue
 		}
 
-		value, _ := strconv.Atoi(fields[3])
-		worst, _ := strconv.Atoi(fields[4])
-		threshold, _ := strconv.Atoi(fields[5])
+		value, _ := strconv.Atoi(fields[columns["VALUE"]])
+		worst, _ := strconv.Atoi(fields[columns["WORST"]])
+		threshold, _ := strconv.Atoi(fields[columns["THRESH"]])
 
 		attr := SMARTAttribute{
 			ID:        id,
-			Name:      fields[1],
+			Name:      fields[columns["ATTRIBUTE_NAME"]],
 			Value:     value,
 			Worst:     worst,
 			Threshold: threshold,
-			RawValue:  fields[9],
+			RawValue:  strings.Join(fields[rawIdx:], " "),
 		}
 
 		// Determine status
-		if value <= threshold {
+		failedNow := false
+		if i, ok := whenFailedColumn(columns); ok && i < rawIdx {
+			failedNow = fields[i] == "FAILING_NOW"
+		}
+		if failedNow || value <= threshold {
 			attr.Status = "FAILING"
 		} else if value < threshold+10 {
 			attr.Status = "WARNING"
@@ -197,40 +250,139 @@ func parseSMARTAttributes(info *DiskInfo, output string) {
 		// Add human-readable description
 		attr.Description = getSMARTAttributeDescription(attr.Name, attr.ID)
 
-		info.Attributes = append(info.Attributes, attr)
+		attrs = append(attrs, attr)
 	}
+
+	return attrs
 }
 
-// parseSMARTDetails extracts temperature, power on hours, etc.
-func parseSMARTDetails(info *DiskInfo, output string) {
-	lines := strings.Split(output, "\n")
+// parseNVMeHealth parses the "SMART/Health Information" section smartctl
+// prints for NVMe devices, which is a list of "Name: value" lines rather
+// than an attribute table. The entries are returned as attributes with ID
+// 0, and the temperature, power-on hours and power cycles are stored in info.
+func parseNVMeHealth(info *DiskInfo, output string) []SMARTAttribute {
+	values := make(map[string]string)
+	var order []string
+	inSection := false
 
-	for _, line := range lines {
+	for _, line := range strings.Split(output, "\n") {
 		line = strings.TrimSpace(line)
 
-		if strings.Contains(line, "Temperature_Celsius") || strings.Contains(line, "Airflow_Temperature") {
-			fields := strings.Fields(line)
-			if len(fields) >= 10 {
-				if temp, err := strconv.Atoi(fields[9]); err == nil {
-					info.Temperature = temp
-				}
+		if strings.HasPrefix(line, "SMART/Health Information") {
+			inSection = true
+			continue
+		}
+		if !inSection {
+			continue
+		}
+		if line == "" {
+			if len(order) > 0 {
+				break
 			}
-		} else if strings.Contains(line, "Power_On_Hours") {
-			fields := strings.Fields(line)
-			if len(fields) >= 10 {
-				if hours, err := strconv.ParseUint(fields[9], 10, 64); err == nil {
-					info.PowerOnHours = hours
-				}
+			continue
+		}
+
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		name = strings.TrimSpace(name)
+		values[name] = strings.TrimSpace(value)
+		order = append(order, name)
+	}
+
+	if len(order) == 0 {
+		return nil
+	}
+
+	// nvmeNumber returns the leading number of a value like "1,234",
+	// "38 Celsius" or "100%"
+	nvmeNumber := func(value string) (uint64, bool) {
+		return parseRawValue(strings.NewReplacer(",", "", "%", " ").Replace(value))
+	}
+
+	if temp, ok := nvmeNumber(values["Temperature"]); ok {
+		info.Temperature = int(temp)
+	}
+	if hours, ok := nvmeNumber(values["Power On Hours"]); ok {
+		info.PowerOnHours = hours
+	}
+	if cycles, ok := nvmeNumber(values["Power Cycles"]); ok {
+		info.PowerCycles = cycles
+	}
+
+	spareThreshold, _ := nvmeNumber(values["Available Spare Threshold"])
+
+	var attrs []SMARTAttribute
+	for _, name := range order {
+		raw := values[name]
+		number, _ := nvmeNumber(raw)
+		attr := SMARTAttribute{
+			Name:     strings.ReplaceAll(name, " ", "_"),
+			RawValue: raw,
+			Status:   "OK",
+		}
+
+		switch name {
+		case "Critical Warning":
+			if raw != "0x00" && raw != "0" {
+				attr.Status = "FAILING"
 			}
-		} else if strings.Contains(line, "Power_Cycle_Count") || strings.Contains(line, "Start_Stop_Count") {
-			fields := strings.Fields(line)
-			if len(fields) >= 10 {
-				if cycles, err := strconv.ParseUint(fields[9], 10, 64); err == nil {
-					info.PowerCycles = cycles
-				}
+		case "Available Spare":
+			attr.Value = int(number)
+			attr.Worst = int(number)
+			attr.Threshold = int(spareThreshold)
+			if number <= spareThreshold {
+				attr.Status = "FAILING"
+			} else if number < spareThreshold+10 {
+				attr.Status = "WARNING"
+			}
+		case "Percentage Used":
+			if number >= 100 {
+				attr.Status = "WARNING"
 			}
+		case "Media and Data Integrity Errors":
+			if number > 0 {
+				attr.Status = "WARNING"
+			}
+		}
+
+		attr.Description = getSMARTAttributeDescription(attr.Name, attr.ID)
+		attrs = append(attrs, attr)
+	}
+
+	return attrs
+}
+
+// parseSMARTAttributes parses the SMART attributes of an ATA or NVMe device
+func parseSMARTAttributes(info *DiskInfo, output string) {
+	attrs := parseSMARTAttributeTable(output)
+	if len(attrs) == 0 {
+		attrs = parseNVMeHealth(info, output)
+	}
+	info.Attributes = append(info.Attributes, attrs...)
+}
+
+// parseSMARTDetails extracts temperature, power on hours, etc.
+func parseSMARTDetails(info *DiskInfo, output string) {
+	for _, attr := range parseSMARTAttributeTable(output) {
+		raw, ok := parseRawValue(attr.RawValue)
+		if !ok {
+			continue
+		}
+
+		switch attr.Name {
+		case "Temperature_Celsius", "Airflow_Temperature_Cel":
+			info.Temperature = int(raw)
+		case "Power_On_Hours":
+			info.PowerOnHours = raw
+		case "Power_Cycle_Count", "Start_Stop_Count":
+			info.PowerCycles = raw
 		}
 	}
+
+	// NVMe devices report these in their health log instead
+	parseNVMeHealth(info, output)
 }
 
 // getCapabilities determines disk capabilities
@@ -239,7 +391,7 @@ func getCapabilities(info *DiskInfo) {
 
 	// Check for TRIM support
 	cmd := exec.Command("camcontrol", "identify", info.Device)
-	output, err := cmd.CombinedOutput()
+	output, err := runCommand(cmd)
 	if err == nil {
 		outStr := strings.ToLower(string(output))
 		if strings.Contains(outStr, "trim") || strings.Contains(outStr, "data set management") {
@@ -251,6 +403,7 @@ func getCapabilities(info *DiskInfo) {
 		if strings.Contains(outStr, "nvme") {
 			info.Capabilities = append(info.Capabilities, "NVMe")
 		}
+		info.Power = parsePowerManagement(string(output))
 	}
 
 	// Check if it's an SSD
@@ -270,31 +423,36 @@ func getCapabilities(info *DiskInfo) {
 // getSMARTAttributeDescription returns a human-readable description
 func getSMARTAttributeDescription(name string, id int) string {
 	descriptions := map[string]string{
-		"Raw_Read_Error_Rate":     "Rate of hardware read errors",
-		"Throughput_Performance":  "Overall throughput performance",
-		"Spin_Up_Time":            "Time to spin up to operating speed",
-		"Start_Stop_Count":        "Number of spindle start/stop cycles",
-		"Reallocated_Sector_Ct":   "Count of reallocated sectors",
-		"Seek_Error_Rate":         "Rate of seek errors",
-		"Seek_Time_Performance":   "Seek time performance",
-		"Power_On_Hours":          "Total hours powered on",
-		"Spin_Retry_Count":        "Number of retry attempts to spin up",
-		"Power_Cycle_Count":       "Number of power-on events",
-		"End-to-End_Error":        "Errors in data transfer",
-		"Reported_Uncorrect":      "Uncorrectable sector count",
-		"Command_Timeout":         "Count of command timeouts",
-		"Temperature_Celsius":     "Current drive temperature",
-		"Hardware_ECC_Recovered":  "ECC errors corrected by hardware",
-		"Current_Pending_Sector":  "Sectors waiting to be remapped",
-		"Offline_Uncorrectable":   "Uncorrectable offline errors",
-		"UDMA_CRC_Error_Count":    "CRC errors during UDMA transfers",
-		"Multi_Zone_Error_Rate":   "Write error rate across zones",
-		"Wear_Leveling_Count":     "SSD wear leveling count",
-		"Total_LBAs_Written":      "Total logical blocks written",
-		"Total_LBAs_Read":         "Total logical blocks read",
-		"Available_Reservd_Space": "Available reserved space (SSD)",
-		"Runtime_Bad_Block":       "Runtime bad block count",
-		"Airflow_Temperature_Cel": "Airflow temperature",
+		"Raw_Read_Error_Rate":             "Rate of hardware read errors",
+		"Throughput_Performance":          "Overall throughput performance",
+		"Spin_Up_Time":                    "Time to spin up to operating speed",
+		"Start_Stop_Count":                "Number of spindle start/stop cycles",
+		"Reallocated_Sector_Ct":           "Count of reallocated sectors",
+		"Seek_Error_Rate":                 "Rate of seek errors",
+		"Seek_Time_Performance":           "Seek time performance",
+		"Power_On_Hours":                  "Total hours powered on",
+		"Spin_Retry_Count":                "Number of retry attempts to spin up",
+		"Power_Cycle_Count":               "Number of power-on events",
+		"End-to-End_Error":                "Errors in data transfer",
+		"Reported_Uncorrect":              "Uncorrectable sector count",
+		"Command_Timeout":                 "Count of command timeouts",
+		"Temperature_Celsius":             "Current drive temperature",
+		"Hardware_ECC_Recovered":          "ECC errors corrected by hardware",
+		"Current_Pending_Sector":          "Sectors waiting to be remapped",
+		"Offline_Uncorrectable":           "Uncorrectable offline errors",
+		"UDMA_CRC_Error_Count":            "CRC errors during UDMA transfers",
+		"Multi_Zone_Error_Rate":           "Write error rate across zones",
+		"Wear_Leveling_Count":             "SSD wear leveling count",
+		"Total_LBAs_Written":              "Total logical blocks written",
+		"Total_LBAs_Read":                 "Total logical blocks read",
+		"Available_Reservd_Space":         "Available reserved space (SSD)",
+		"Runtime_Bad_Block":               "Runtime bad block count",
+		"Airflow_Temperature_Cel":         "Airflow temperature",
+		"Critical_Warning":                "NVMe critical warning flags (0x00 if none)",
+		"Available_Spare":                 "Remaining spare capacity (NVMe)",
+		"Percentage_Used":                 "Estimated share of rated endurance used (NVMe)",
+		"Unsafe_Shutdowns":                "Power losses without a clean shutdown",
+		"Media_and_Data_Integrity_Errors": "Unrecovered data integrity errors (NVMe)",
 	}
 
 	if desc, ok := descriptions[name]; ok {
@@ -0,0 +1,188 @@
+package partition
+
+import "testing"
+
+// smartctl -A from smartmontools 6.6, in the default (old) format with
+// the FLAG, TYPE, UPDATED and WHEN_FAILED columns
+const smartctl66Attributes = `smartctl 6.6 2017-11-05 r4594 [FreeBSD 12.1-RELEASE amd64] (local build)
+Copyright (C) 2002-17, Bruce Allen, Christian Franke, www.smartmontools.org
+
+=== START OF READ SMART DATA SECTION ===
+SMART Attributes Data Structure revision number: 16
+Vendor Specific SMART Attributes with Thresholds:
+ID# ATTRIBUTE_NAME          FLAG     VALUE WORST THRESH TYPE      UPDATED  WHEN_FAILED RAW_VALUE
+  1 Raw_Read_Error_Rate     0x002f   200   200   051    Pre-fail  Always       -       0
+  5 Reallocated_Sector_Ct   0x0033   130   130   140    Pre-fail  Always   FAILING_NOW 1234
+  9 Power_On_Hours          0x0032   078   078   000    Old_age   Always       -       16234
+ 12 Power_Cycle_Count       0x0032   100   100   000    Old_age   Always       -       412
+194 Temperature_Celsius     0x0022   114   098   000    Old_age   Always       -       36
+199 UDMA_CRC_Error_Count    0x0032   200   200   000    Old_age   Always       -       2
+
+`
+
+// smartctl -A -f brief from smartmontools 7.4, with the FLAGS and FAIL
+// columns, raw values containing spaces and the flag legend below
+const smartctl74BriefAttributes = `smartctl 7.4 2023-08-01 r5530 [FreeBSD 14.1-RELEASE amd64] (local build)
+Copyright (C) 2002-23, Bruce Allen, Christian Franke, www.smartmontools.org
+
+=== START OF READ SMART DATA SECTION ===
+SMART Attributes Data Structure revision number: 1
+Vendor Specific SMART Attributes with Thresholds:
+ID# ATTRIBUTE_NAME          FLAGS    VALUE WORST THRESH FAIL RAW_VALUE
+  1 Raw_Read_Error_Rate     POSR-K   100   100   050    -    0
+  5 Reallocated_Sector_Ct   PO--CK   015   015   010    -    1840
+  9 Power_On_Hours          -O--CK   095   095   000    -    21876
+ 12 Power_Cycle_Count       -O--CK   100   100   000    -    98
+190 Airflow_Temperature_Cel -O---K   067   049   000    -    33 (Min/Max 20/51)
+                            ||||||_ K auto-keep
+                            |||||__ C event count
+                            ||||___ R error rate
+                            |||____ S speed/performance
+                            ||_____ O updated online
+                            |______ P prefailure warning
+
+`
+
+// smartctl -a of an NVMe drive, which has a health log instead of an
+// attribute table
+const smartctlNVMeHealth = `smartctl 7.4 2023-08-01 r5530 [FreeBSD 14.1-RELEASE amd64] (local build)
+
+=== START OF SMART DATA SECTION ===
+SMART overall-health self-assessment test result: PASSED
+
+SMART/Health Information (NVMe Log 0x02)
+Critical Warning:                   0x00
+Temperature:                        38 Celsius
+Available Spare:                    100%
+Available Spare Threshold:          10%
+Percentage Used:                    3%
+Data Units Read:                    12,345,678 [6.32 TB]
+Power Cycles:                       1,027
+Power On Hours:                     8,760
+Unsafe Shutdowns:                   45
+Media and Data Integrity Errors:    0
+
+Error Information (NVMe Log 0x01, 16 of 64 entries)
+No Errors Logged
+`
+
+func TestParseSMARTAttributeTable(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   []SMARTAttribute
+	}{
+		{"smartmontools 6.6", smartctl66Attributes, []SMARTAttribute{
+			{ID: 1, Name: "Raw_Read_Error_Rate", Value: 200, Worst: 200, Threshold: 51, RawValue: "0", Status: "OK"},
+			{ID: 5, Name: "Reallocated_Sector_Ct", Value: 130, Worst: 130, Threshold: 140, RawValue: "1234", Status: "FAILING"},
+			{ID: 9, Name: "Power_On_Hours", Value: 78, Worst: 78, Threshold: 0, RawValue: "16234", Status: "OK"},
+			{ID: 12, Name: "Power_Cycle_Count", Value: 100, Worst: 100, Threshold: 0, RawValue: "412", Status: "OK"},
+			{ID: 194, Name: "Temperature_Celsius", Value: 114, Worst: 98, Threshold: 0, RawValue: "36", Status: "OK"},
+			{ID: 199, Name: "UDMA_CRC_Error_Count", Value: 200, Worst: 200, Threshold: 0, RawValue: "2", Status: "OK"},
+		}},
+		{"smartmontools 7.4 brief", smartctl74BriefAttributes, []SMARTAttribute{
+			{ID: 1, Name: "Raw_Read_Error_Rate", Value: 100, Worst: 100, Threshold: 50, RawValue: "0", Status: "OK"},
+			{ID: 5, Name: "Reallocated_Sector_Ct", Value: 15, Worst: 15, Threshold: 10, RawValue: "1840", Status: "WARNING"},
+			{ID: 9, Name: "Power_On_Hours", Value: 95, Worst: 95, Threshold: 0, RawValue: "21876", Status: "OK"},
+			{ID: 12, Name: "Power_Cycle_Count", Value: 100, Worst: 100, Threshold: 0, RawValue: "98", Status: "OK"},
+			{ID: 190, Name: "Airflow_Temperature_Cel", Value: 67, Worst: 49, Threshold: 0, RawValue: "33 (Min/Max 20/51)", Status: "OK"},
+		}},
+		{"NVMe", smartctlNVMeHealth, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseSMARTAttributeTable(tt.output)
+			if len(got) != len(tt.want) {
+				t.Fatalf("parsed %d attributes, want %d: %+v", len(got), len(tt.want), got)
+			}
+			for i, want := range tt.want {
+				attr := got[i]
+				attr.Description = ""
+				if attr != want {
+					t.Errorf("attribute %d = %+v, want %+v", i, attr, want)
+				}
+			}
+		})
+	}
+}
+
+func TestParseSMARTDetails(t *testing.T) {
+	tests := []struct {
+		name        string
+		output      string
+		temperature int
+		hours       uint64
+		cycles      uint64
+	}{
+		{"smartmontools 6.6", smartctl66Attributes, 36, 16234, 412},
+		{"smartmontools 7.4 brief", smartctl74BriefAttributes, 33, 21876, 98},
+		{"NVMe", smartctlNVMeHealth, 38, 8760, 1027},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info := &DiskInfo{}
+			parseSMARTDetails(info, tt.output)
+			if info.Temperature != tt.temperature || info.PowerOnHours != tt.hours || info.PowerCycles != tt.cycles {
+				t.Errorf("temperature %d, hours %d, cycles %d; want %d, %d, %d",
+					info.Temperature, info.PowerOnHours, info.PowerCycles, tt.temperature, tt.hours, tt.cycles)
+			}
+		})
+	}
+}
+
+func TestParseNVMeHealth(t *testing.T) {
+	info := &DiskInfo{}
+	parseSMARTAttributes(info, smartctlNVMeHealth)
+
+	byName := make(map[string]SMARTAttribute)
+	var names []string
+	for _, attr := range info.Attributes {
+		byName[attr.Name] = attr
+		names = append(names, attr.Name)
+	}
+	if len(info.Attributes) != 10 {
+		t.Errorf("parsed attributes %q, want the 10 entries of the health log", names)
+	}
+
+	spare := byName["Available_Spare"]
+	if spare.Value != 100 || spare.Threshold != 10 || spare.Status != "OK" {
+		t.Errorf("Available_Spare = %+v, want value 100, threshold 10, OK", spare)
+	}
+	if raw := byName["Data_Units_Read"].RawValue; raw != "12,345,678 [6.32 TB]" {
+		t.Errorf("Data_Units_Read raw value = %q", raw)
+	}
+	for name, attr := range byName {
+		if attr.Status != "OK" {
+			t.Errorf("%s is %s on a healthy drive", name, attr.Status)
+		}
+	}
+}
+
+func TestParseNVMeHealthDegraded(t *testing.T) {
+	output := `SMART/Health Information (NVMe Log 0x02)
+Critical Warning:                   0x04
+Available Spare:                    5%
+Available Spare Threshold:          10%
+Percentage Used:                    104%
+Media and Data Integrity Errors:    3
+`
+	want := map[string]string{
+		"Critical_Warning":                "FAILING",
+		"Available_Spare":                 "FAILING",
+		"Available_Spare_Threshold":       "OK",
+		"Percentage_Used":                 "WARNING",
+		"Media_and_Data_Integrity_Errors": "WARNING",
+	}
+
+	attrs := parseNVMeHealth(&DiskInfo{}, output)
+	if len(attrs) != len(want) {
+		t.Fatalf("parsed %d attributes, want %d", len(attrs), len(want))
+	}
+	for _, attr := range attrs {
+		if attr.Status != want[attr.Name] {
+			t.Errorf("%s status = %s, want %s", attr.Name, attr.Status, want[attr.Name])
+		}
+	}
+}
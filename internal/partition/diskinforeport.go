@@ -0,0 +1,117 @@
+package partition
+
+// DiskInfoSchemaVersion is the version of the DiskInfoReport JSON schema.
+// It is incremented whenever a field is renamed, removed or changes
+// meaning; adding fields does not change it.
+const DiskInfoSchemaVersion = 1
+
+// Health levels derived from SMART data
+const (
+	HealthOK       = "ok"
+	HealthWarning  = "warning"
+	HealthCritical = "critical"
+	HealthUnknown  = "unknown"
+)
+
+// DiskInfoReport is the machine-readable form of DiskInfo, with a stable
+// JSON schema for monitoring systems
+type DiskInfoReport struct {
+	SchemaVersion int                  `json:"schema_version"`
+	Device        string               `json:"device"`
+	Model         string               `json:"model"`
+	Serial        string               `json:"serial"`
+	SizeBytes     uint64               `json:"size_bytes"`
+	SectorSize    uint64               `json:"sector_size"`
+	Temperature   int                  `json:"temperature_celsius"`
+	PowerOnHours  uint64               `json:"power_on_hours"`
+	PowerCycles   uint64               `json:"power_cycles"`
+	SMARTEnabled  bool                 `json:"smart_enabled"`
+	SMARTStatus   string               `json:"smart_status"`
+	Health        string               `json:"health"`
+	Capabilities  []string             `json:"capabilities"`
+	Attributes    []SMARTAttributeJSON `json:"attributes"`
+}
+
+// SMARTAttributeJSON is one SMART attribute in a DiskInfoReport. RawValue
+// is smartctl's raw value text; RawNumeric is its leading integer, or null
+// if it has none.
+type SMARTAttributeJSON struct {
+	ID         int     `json:"id"`
+	Name       string  `json:"name"`
+	Value      int     `json:"value"`
+	Worst      int     `json:"worst"`
+	Threshold  int     `json:"threshold"`
+	RawValue   string  `json:"raw_value"`
+	RawNumeric *uint64 `json:"raw_numeric"`
+	Status     string  `json:"status"`
+}
+
+// HealthLevel summarizes SMART data as HealthOK, HealthWarning,
+// HealthCritical or HealthUnknown. A failed overall status or a failing
+// attribute is critical; attributes near their threshold or a temperature
+// above 60°C are a warning.
+func (info *DiskInfo) HealthLevel() string {
+	level := HealthUnknown
+	if info.SMARTStatus == "PASSED" {
+		level = HealthOK
+	}
+
+	for _, attr := range info.Attributes {
+		switch attr.Status {
+		case "FAILING":
+			return HealthCritical
+		case "WARNING":
+			level = HealthWarning
+		}
+	}
+
+	if info.SMARTStatus == "FAILED" {
+		return HealthCritical
+	}
+	if info.Temperature > 60 {
+		level = HealthWarning
+	}
+
+	return level
+}
+
+// NewDiskInfoReport converts info to its machine-readable form
+func NewDiskInfoReport(info *DiskInfo) DiskInfoReport {
+	report := DiskInfoReport{
+		SchemaVersion: DiskInfoSchemaVersion,
+		Device:        info.Device,
+		Model:         info.Model,
+		Serial:        info.Serial,
+		SizeBytes:     info.Size,
+		SectorSize:    info.SectorSize,
+		Temperature:   info.Temperature,
+		PowerOnHours:  info.PowerOnHours,
+		PowerCycles:   info.PowerCycles,
+		SMARTEnabled:  info.SMARTEnabled,
+		SMARTStatus:   info.SMARTStatus,
+		Health:        info.HealthLevel(),
+		Capabilities:  info.Capabilities,
+		Attributes:    make([]SMARTAttributeJSON, 0, len(info.Attributes)),
+	}
+	if report.Capabilities == nil {
+		report.Capabilities = []string{}
+	}
+
+	for _, attr := range info.Attributes {
+		entry := SMARTAttributeJSON{
+			ID:        attr.ID,
+			Name:      attr.Name,
+			Value:     attr.Value,
+			Worst:     attr.Worst,
+			Threshold: attr.Threshold,
+			RawValue:  attr.RawValue,
+			Status:    attr.Status,
+		}
+		if raw, ok := parseRawValue(attr.RawValue); ok {
+			entry.RawNumeric = &raw
+		}
+		report.Attributes = append(report.Attributes, entry)
+	}
+
+	return report
+}
@@ -0,0 +1,350 @@
+package partition
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// LayoutPartition is one partition of a DiskLayout
+type LayoutPartition struct {
+	// Size is a size such as "32G", "512M" or "25%" of the disk as
+	// ParsePlanSize reads it, or "rest" for the space the others leave,
+	// which only the last partition may use
+	Size   string `json:"size"`
+	Type   string `json:"type"`             // gpart type alias or type GUID
+	Label  string `json:"label,omitempty"`  // GPT label, if any
+	Format string `json:"format,omitempty"` // filesystem to create, if any
+}
+
+// DiskLayout describes a whole disk: its partition scheme and the
+// partitions to create on it, in order
+type DiskLayout struct {
+	Scheme     string            `json:"scheme,omitempty"` // GPT (the default) or MBR
+	Partitions []LayoutPartition `json:"partitions"`
+}
+
+// LoadDiskLayout reads a layout file. JSON files hold a DiskLayout object
+// or just its list of partitions; anything else is read as TOML:
+//
+//	scheme = "gpt"
+//
+//	[[partitions]]
+//	size = "512M"
+//	type = "efi"
+//	format = "fat32"
+//
+//	[[partitions]]
+//	size = "rest"
+//	type = "freebsd-ufs"
+//	label = "root"
+//	format = "ufs"
+func LoadDiskLayout(path string) (DiskLayout, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return DiskLayout{}, fmt.Errorf("failed to read layout file: %w", err)
+	}
+	return DecodeDiskLayout(data)
+}
+
+// DecodeDiskLayout parses a layout in the formats LoadDiskLayout accepts
+func DecodeDiskLayout(data []byte) (DiskLayout, error) {
+	var layout DiskLayout
+	trimmed := bytes.TrimSpace(data)
+	switch {
+	case bytes.HasPrefix(trimmed, []byte("[")) && !bytes.HasPrefix(trimmed, []byte("[[")):
+		if err := json.Unmarshal(trimmed, &layout.Partitions); err != nil {
+			return DiskLayout{}, fmt.Errorf("invalid layout: %w", err)
+		}
+	case bytes.HasPrefix(trimmed, []byte("{")):
+		if err := json.Unmarshal(trimmed, &layout); err != nil {
+			return DiskLayout{}, fmt.Errorf("invalid layout: %w", err)
+		}
+	default:
+		var err error
+		if layout, err = parseLayoutTOML(string(data)); err != nil {
+			return DiskLayout{}, fmt.Errorf("invalid layout: %w", err)
+		}
+	}
+
+	if len(layout.Partitions) == 0 {
+		return DiskLayout{}, fmt.Errorf("invalid layout: no partitions")
+	}
+	return layout, nil
+}
+
+// parseLayoutTOML reads the part of TOML a layout needs: a top-level scheme
+// key and [[partitions]] tables of string keys, with # comments
+func parseLayoutTOML(text string) (DiskLayout, error) {
+	var layout DiskLayout
+	var current *LayoutPartition
+	for n, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(stripTOMLComment(line))
+		if line == "" {
+			continue
+		}
+
+		if line == "[[partitions]]" {
+			layout.Partitions = append(layout.Partitions, LayoutPartition{})
+			current = &layout.Partitions[len(layout.Partitions)-1]
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			return DiskLayout{}, fmt.Errorf("line %d: unknown table %s", n+1, line)
+		}
+
+		key, raw, ok := strings.Cut(line, "=")
+		if !ok {
+			return DiskLayout{}, fmt.Errorf("line %d: expected key = \"value\"", n+1)
+		}
+		key = strings.TrimSpace(key)
+		value, err := strconv.Unquote(strings.TrimSpace(raw))
+		if err != nil {
+			return DiskLayout{}, fmt.Errorf("line %d: the value of %s must be a quoted string", n+1, key)
+		}
+
+		if current == nil {
+			if key != "scheme" {
+				return DiskLayout{}, fmt.Errorf("line %d: unknown key %s", n+1, key)
+			}
+			layout.Scheme = value
+			continue
+		}
+		switch key {
+		case "size":
+			current.Size = value
+		case "type":
+			current.Type = value
+		case "label":
+			current.Label = value
+		case "format":
+			current.Format = value
+		default:
+			return DiskLayout{}, fmt.Errorf("line %d: unknown partition key %s", n+1, key)
+		}
+	}
+	return layout, nil
+}
+
+// stripTOMLComment removes a # comment that isn't inside a quoted string
+func stripTOMLComment(line string) string {
+	inString := false
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			i++
+		case '"':
+			inString = !inString
+		case '#':
+			if !inString {
+				return line[:i]
+			}
+		}
+	}
+	return line
+}
+
+// SchemeName returns the gpart scheme name of a layout, GPT by default
+func (l DiskLayout) SchemeName() string {
+	if l.Scheme == "" {
+		return "GPT"
+	}
+	return strings.ToUpper(l.Scheme)
+}
+
+// PlanDiskLayout checks a layout against a disk and places its partitions,
+// without changing anything. The disk must not have a partition table yet,
+// and the partitions must fit on it.
+func PlanDiskLayout(disk *Disk, layout DiskLayout) (*LayoutPlan, error) {
+	scheme := layout.SchemeName()
+	if scheme != "GPT" && scheme != "MBR" {
+		return nil, fmt.Errorf("unsupported partition scheme %q (use GPT or MBR)", layout.Scheme)
+	}
+	if disk.Scheme != "" || len(disk.Partitions) > 0 {
+		return nil, fmt.Errorf("%s already has a partition table; destroy it before applying a layout", disk.Name)
+	}
+
+	if scheme == "MBR" && len(layout.Partitions) > 4 {
+		return nil, fmt.Errorf("an MBR partition table holds at most 4 partitions, not %d", len(layout.Partitions))
+	}
+
+	var planned []PlannedPartition
+	rest := false
+	for i, p := range layout.Partitions {
+		n := i + 1
+		// The type registry is of GPT types; MBR types such as freebsd or
+		// fat32 are left to gpart
+		if p.Type == "" {
+			return nil, fmt.Errorf("partition %d: no type given", n)
+		}
+		if scheme == "GPT" {
+			if err := ValidatePartitionType(p.Type); err != nil {
+				return nil, fmt.Errorf("partition %d: %w", n, err)
+			}
+		}
+		if p.Label != "" {
+			if scheme != "GPT" {
+				return nil, fmt.Errorf("partition %d: %s partitions have no labels", n, scheme)
+			}
+			if err := ValidateGPTLabel(p.Label); err != nil {
+				return nil, fmt.Errorf("partition %d: %w", n, err)
+			}
+		}
+		if p.Format != "" {
+			if strings.EqualFold(p.Format, "zfs") {
+				return nil, fmt.Errorf("partition %d: ZFS filesystems live in pools; leave format empty and create the pool with pgpart create-pool", n)
+			}
+			formatter, ok := GetFormatter(p.Format)
+			if !ok {
+				return nil, fmt.Errorf("partition %d: unsupported filesystem type: %s", n, p.Format)
+			}
+			// Building the command fails if the tool isn't installed,
+			// which is better found out before the disk is partitioned
+			if fakeDisks == nil {
+				if _, err := formatter.BuildCommand(disk.Name, FormatOptions{}); err != nil {
+					return nil, fmt.Errorf("partition %d: %w", n, err)
+				}
+			}
+		}
+
+		if p.Size == "rest" {
+			if n != len(layout.Partitions) {
+				return nil, fmt.Errorf("partition %d: only the last partition can use the rest of the disk", n)
+			}
+			rest = true
+			continue
+		}
+		size, percent, err := ParsePlanSize(p.Size)
+		if err != nil {
+			return nil, fmt.Errorf("partition %d: %w", n, err)
+		}
+		planned = append(planned, PlannedPartition{Type: p.Type, Size: size, Percent: percent})
+	}
+
+	empty := &Disk{Name: disk.Name, Size: disk.Size}
+	plan := PlanLayout(empty, Align1M, planned)
+	if rest {
+		last := layout.Partitions[len(layout.Partitions)-1]
+		cursor := plan.FreeStart + plan.Used
+		entry := PlanEntry{PlannedPartition: PlannedPartition{Type: last.Type}}
+		entry.Start = CalculateAlignedOffset(cursor, plan.Alignment)
+		entry.Padding = entry.Start - cursor
+		if !plan.Overflow && entry.Start < plan.FreeStart+plan.FreeBytes {
+			entry.Bytes = (plan.FreeStart + plan.FreeBytes - entry.Start) / (1024 * 1024) * (1024 * 1024)
+		}
+		if entry.Bytes == 0 {
+			plan.Warnings = append(plan.Warnings, fmt.Sprintf("Partition %d (%s) has no space left", len(layout.Partitions), last.Type))
+		} else if err := CheckMinimumSize(entry.Bytes, last.Type); err != nil {
+			plan.Warnings = append(plan.Warnings, fmt.Sprintf("Partition %d: %v", len(layout.Partitions), err))
+		}
+		plan.Entries = append(plan.Entries, entry)
+		if entry.Bytes > 0 {
+			plan.Used = entry.Start + entry.Bytes - plan.FreeStart
+			plan.Remaining = plan.FreeStart + plan.FreeBytes - (entry.Start + entry.Bytes)
+		}
+	}
+
+	if len(plan.Warnings) > 0 {
+		return plan, fmt.Errorf("layout can't be applied to %s (%s): %s", disk.Name, FormatBytes(disk.Size), strings.Join(plan.Warnings, "; "))
+	}
+	return plan, nil
+}
+
+// ApplyLayout partitions an empty disk as layout describes: it creates the
+// partition table, adds each partition in order and formats those with a
+// filesystem. See ApplyLayoutWithLog.
+func ApplyLayout(disk string, layout DiskLayout) error {
+	return ApplyLayoutWithLog(disk, layout, nil)
+}
+
+// ApplyLayoutWithLog is ApplyLayout reporting its steps to logger, which
+// may be nil. The whole layout is checked against the disk before anything
+// is written, and if a step fails after the partition table was created
+// the table is destroyed again, leaving the disk empty as it was found.
+func ApplyLayoutWithLog(disk string, layout DiskLayout, logger OperationLogger) error {
+	if err := CheckPrivileges(); err != nil {
+		return err
+	}
+	defer markDisksChanged()
+
+	if err := CheckDiskNotInFlight(disk); err != nil {
+		return err
+	}
+	if err := CheckNotRAIDMember(disk); err != nil {
+		return err
+	}
+
+	target, err := lookupDisk(disk)
+	if err != nil {
+		return err
+	}
+	plan, err := PlanDiskLayout(target, layout)
+	if err != nil {
+		return err
+	}
+
+	scheme := layout.SchemeName()
+	logStep(logger, "Creating a %s partition table on %s", scheme, disk)
+	if err := CreatePartitionTable(disk, scheme); err != nil {
+		return err
+	}
+
+	if err := applyLayoutPartitions(disk, scheme, layout, plan, logger); err != nil {
+		if DryRun {
+			return err
+		}
+		logStep(logger, "Removing the partition table from %s", disk)
+		if undoErr := DestroyPartitionTable(disk); undoErr != nil {
+			return fmt.Errorf("%w (removing the new partition table also failed: %v)", err, undoErr)
+		}
+		return err
+	}
+
+	logLine(logger, "Applied the layout to %s", disk)
+	return nil
+}
+
+// applyLayoutPartitions creates and formats the planned partitions on a
+// disk with a new, empty partition table
+func applyLayoutPartitions(disk, scheme string, layout DiskLayout, plan *LayoutPlan, logger OperationLogger) error {
+	for i, p := range layout.Partitions {
+		entry := plan.Entries[i]
+		// On the new table gpart hands out indexes in order
+		partName := fmt.Sprintf("%sp%d", disk, i+1)
+		if scheme == "MBR" {
+			partName = fmt.Sprintf("%ss%d", disk, i+1)
+		}
+
+		size := entry.Bytes
+		if p.Size == "rest" && !DryRun {
+			// Let gpart fill what is left rather than trust the plan's
+			// estimate of the space its metadata takes
+			size = 0
+		}
+		logStep(logger, "Creating %s: %s %s", partName, FormatBytes(entry.Bytes), p.Type)
+		if err := createPartition(context.Background(), disk, size, p.Type, 0, p.Label, Align1M, nil); err != nil {
+			return fmt.Errorf("partition %d: %w", i+1, err)
+		}
+
+		if p.Format != "" {
+			logStep(logger, "Formatting %s as %s", partName, p.Format)
+			if err := FormatPartition(partName, p.Format, false); err != nil {
+				return fmt.Errorf("partition %d: %w", i+1, err)
+			}
+		}
+	}
+	return nil
+}
+
+// lookupDisk returns the named disk as GetDisks reports it
+func lookupDisk(name string) (*Disk, error) {
+	disks, err := GetDisks()
+	if err != nil {
+		return nil, err
+	}
+	return findDisk(disks, name)
+}
@@ -0,0 +1,51 @@
+package partition
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// DryRun makes the operations that change disks print the commands they
+// would run instead of running them. Their checks still run, so a dry run
+// fails where the real operation would fail before touching a disk.
+var DryRun bool
+
+// DryRunOutput receives the commands printed in dry-run mode
+var DryRunOutput io.Writer = os.Stdout
+
+// dryRun prints cmd and returns true in dry-run mode, in which case the
+// caller returns without running it
+func dryRun(cmd *exec.Cmd) bool {
+	if !DryRun {
+		return false
+	}
+	fmt.Fprintln(DryRunOutput, shellQuoteCommand(cmd.Args))
+	return true
+}
+
+// shellQuoteCommand joins a command and its arguments into a line that can
+// be pasted into sh, quoting the arguments that need it
+func shellQuoteCommand(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = shellQuote(arg)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// shellQuote quotes arg with single quotes unless it consists only of
+// characters that sh takes literally
+func shellQuote(arg string) string {
+	if arg == "" {
+		return "''"
+	}
+	for _, r := range arg {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_./:=,+@%", r)) {
+			return "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+		}
+	}
+	return arg
+}
@@ -0,0 +1,1454 @@
+package partition
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// fakeDisks is the in-memory disk backend used when EnableFakeDisks has been
+// called. It is nil in normal operation.
+var fakeDisks *fakeDiskBackend
+
+// fakeDiskBackend holds a canned set of disks that operations modify in
+// memory instead of running gpart, newfs and friends
+type fakeDiskBackend struct {
+	mu         sync.Mutex
+	disks      []Disk
+	attributes map[string]map[string]bool
+	info       map[string]DiskInfo
+	geli       map[string]bool // GELI providers, true when attached
+	ufs        map[string]UFSTuning
+	swap       map[string]bool     // partitions in use as swap
+	pools      map[string][]string // imported ZFS pools and their vdev partitions
+	selfTests  map[string]fakeSelfTest
+	headers    map[string]string // header backup files and the filesystem they saved
+	uuids      int               // GPT partition GUIDs handed out so far
+}
+
+// fakeSelfTest is the most recent SMART self-test started on a fake disk
+type fakeSelfTest struct {
+	testType string
+	started  time.Time
+}
+
+// fakeSelfTestDurations are how long fake self-tests run, scaled down from
+// minutes and hours so the progress display can be watched to the end
+var fakeSelfTestDurations = map[string]time.Duration{
+	"short":      20 * time.Second,
+	"long":       90 * time.Second,
+	"conveyance": 40 * time.Second,
+}
+
+// EnableFakeDisks replaces the real disk backend with canned disks held in
+// memory. Every read returns the fake disks and every mutating operation
+// updates the in-memory model, so the UI can be exercised on any machine
+// without root privileges or risk to real data.
+func EnableFakeDisks() {
+	fakeDisks = newFakeDiskBackend()
+}
+
+// FakeDisksEnabled reports whether the fake disk backend is active
+func FakeDisksEnabled() bool {
+	return fakeDisks != nil
+}
+
+// newFakeDiskBackend builds the canned disks: a GPT SSD with a typical
+// FreeBSD install, a GPT HDD with mixed filesystems, an MBR USB stick with a
+// BSD label in one of its slices and a blank disk with a failing SMART
+// status
+func newFakeDiskBackend() *fakeDiskBackend {
+	const mb = 1024 * 1024
+	const gb = 1024 * mb
+
+	f := &fakeDiskBackend{
+		attributes: make(map[string]map[string]bool),
+		info:       make(map[string]DiskInfo),
+		geli:       make(map[string]bool),
+		ufs:        make(map[string]UFSTuning),
+		swap:       make(map[string]bool),
+		pools:      make(map[string][]string),
+		selfTests:  make(map[string]fakeSelfTest),
+		headers:    make(map[string]string),
+	}
+
+	ada0 := Disk{Name: "ada0", Model: "Samsung SSD 860 EVO 500GB", Size: 500107862016, SectorSize: 512, Scheme: "GPT"}
+	f.appendPartition(&ada0, "efi", 260*mb, "FAT32", "efiboot0", "/boot/efi")
+	f.appendPartition(&ada0, "freebsd-swap", 4*gb, "swap", "swap0", "")
+	f.appendPartition(&ada0, "freebsd-zfs", 200*gb, "ZFS", "zfs0", "")
+
+	ada1 := Disk{Name: "ada1", Model: "WDC WD40EFRX-68N32N0", Size: 4000787030016, SectorSize: 512, Scheme: "GPT"}
+	f.appendPartition(&ada1, "freebsd-ufs", 1024*gb, "UFS", "data", "/data")
+	f.appendPartition(&ada1, "ms-basic-data", 500*gb, "NTFS", "windows", "")
+	f.appendPartition(&ada1, "linux-data", 200*gb, "ext4", "linux", "")
+	f.appendPartition(&ada1, "freebsd-ufs", 100*gb, "GELI", "private", "")
+	f.appendPartition(&ada1, "freebsd-ufs", 100*gb, "GELI", "archive", "")
+
+	da0 := Disk{Name: "da0", Model: "SanDisk Cruzer Blade", Size: 16008609792, SectorSize: 512, Scheme: "MBR"}
+	f.appendPartition(&da0, "fat32lba", 8*gb, "FAT32", "", "")
+	f.appendPartition(&da0, "freebsd", 6*gb, "", "", "")
+
+	// The freebsd slice holds a BSD label, which GetDisks lists as a disk
+	// of its own
+	da0s2 := Disk{Name: "da0s2", Model: "BSD label on da0", Size: 6 * gb, SectorSize: 512, Scheme: "BSD"}
+	f.appendPartition(&da0s2, "freebsd-ufs", 4*gb, "UFS", "", "")
+	f.appendPartition(&da0s2, "freebsd-swap", 1*gb, "swap", "", "")
+
+	ada2 := Disk{Name: "ada2", Model: "ST2000DM008-2FR102", Size: 2000398934016, SectorSize: 512}
+
+	f.disks = []Disk{ada0, ada1, da0, da0s2, ada2}
+	for i := range f.disks {
+		f.disks[i].Device = "/dev/" + f.disks[i].Name
+	}
+
+	f.attributes["ada0p1"] = map[string]bool{AttrBootme: true, AttrRequired: true}
+	f.geli["ada1p4"] = false
+	f.geli["ada1p5"] = false
+	f.swap["ada0p2"] = true
+	f.pools["zroot"] = []string{"ada0p3"}
+
+	f.info["ada0"] = DiskInfo{
+		Serial: "S3Z9NB0K123456A", SMARTEnabled: true, SMARTStatus: "PASSED",
+		Temperature: 34, PowerOnHours: 8123, PowerCycles: 912,
+		Attributes: []SMARTAttribute{
+			{ID: 5, Name: "Reallocated_Sector_Ct", Value: 100, Worst: 100, Threshold: 10, RawValue: "0", Status: "OK"},
+			{ID: 177, Name: "Wear_Leveling_Count", Value: 97, Worst: 97, Threshold: 0, RawValue: "31", Status: "OK"},
+			{ID: 194, Name: "Temperature_Celsius", Value: 66, Worst: 52, Threshold: 0, RawValue: "34", Status: "OK"},
+		},
+		Capabilities: []string{"TRIM", "NCQ"},
+	}
+	f.info["ada1"] = DiskInfo{
+		Serial: "WD-WCC7K1234567", SMARTEnabled: true, SMARTStatus: "PASSED",
+		Temperature: 58, PowerOnHours: 41230, PowerCycles: 143,
+		Attributes: []SMARTAttribute{
+			{ID: 5, Name: "Reallocated_Sector_Ct", Value: 200, Worst: 200, Threshold: 140, RawValue: "8", Status: "OK"},
+			{ID: 194, Name: "Temperature_Celsius", Value: 92, Worst: 85, Threshold: 0, RawValue: "58", Status: "OK"},
+			{ID: 197, Name: "Current_Pending_Sector", Value: 200, Worst: 200, Threshold: 0, RawValue: "2", Status: "OK"},
+		},
+		Capabilities: []string{"NCQ"},
+		Power:        PowerManagement{Supported: true, APMSupported: true, APMEnabled: true, APMLevel: 128},
+	}
+	f.info["ada2"] = DiskInfo{
+		Serial: "ZFL1ABCD", SMARTEnabled: true, SMARTStatus: "FAILED",
+		Temperature: 41, PowerOnHours: 52011, PowerCycles: 388,
+		Attributes: []SMARTAttribute{
+			{ID: 5, Name: "Reallocated_Sector_Ct", Value: 3, Worst: 3, Threshold: 10, RawValue: "3912", Status: "FAILING"},
+			{ID: 187, Name: "Reported_Uncorrect", Value: 1, Worst: 1, Threshold: 0, RawValue: "214", Status: "OK"},
+			{ID: 197, Name: "Current_Pending_Sector", Value: 100, Worst: 100, Threshold: 0, RawValue: "56", Status: "OK"},
+		},
+		Capabilities: []string{"NCQ"},
+		Power:        PowerManagement{Supported: true},
+	}
+	f.info["da0"] = DiskInfo{Serial: "4C530001234567891234"}
+
+	for name, info := range f.info {
+		for i := range info.Attributes {
+			info.Attributes[i].Description = getSMARTAttributeDescription(info.Attributes[i].Name, info.Attributes[i].ID)
+		}
+		f.info[name] = info
+	}
+
+	return f
+}
+
+// appendPartition adds a partition after the last one on disk
+func (f *fakeDiskBackend) appendPartition(disk *Disk, partType string, size uint64, fs, label, mountPoint string) {
+	start := f.nextStart(disk)
+	sectors := size / 512
+	disk.Partitions = append(disk.Partitions, Partition{
+		Name:       fakePartitionName(disk, f.nextIndex(disk)),
+		Type:       partType,
+		Size:       sectors,
+		Start:      start,
+		End:        start + sectors,
+		FileSystem: fs,
+		Label:      label,
+		MountPoint: mountPoint,
+		UUID:       f.newUUID(disk),
+	})
+}
+
+// newUUID returns a partition GUID that no other fake partition has had,
+// or "" on disks whose scheme has none
+func (f *fakeDiskBackend) newUUID(disk *Disk) string {
+	if disk.Scheme != "GPT" {
+		return ""
+	}
+	f.uuids++
+	return fmt.Sprintf("5f3c%04x-8d2e-11ee-b9d1-%012x", f.uuids, 0x0242ac120002+f.uuids)
+}
+
+// nextStart returns the first 1 MiB aligned sector after the last partition
+func (f *fakeDiskBackend) nextStart(disk *Disk) uint64 {
+	return f.nextAlignedStart(disk, Align1M)
+}
+
+// nextAlignedStart returns the first sector after the last partition that
+// is aligned to alignment bytes
+func (f *fakeDiskBackend) nextAlignedStart(disk *Disk, alignment uint64) uint64 {
+	start := uint64(gptFirstUsableSector)
+	for _, part := range disk.Partitions {
+		if part.End > start {
+			start = part.End
+		}
+	}
+	return CalculateAlignedOffset(start*512, alignment) / 512
+}
+
+// nextIndex returns the lowest unused partition index on disk
+func (f *fakeDiskBackend) nextIndex(disk *Disk) int {
+	used := make(map[int]bool)
+	for _, part := range disk.Partitions {
+		if n := partitionIndex(part); n > 0 {
+			used[n] = true
+		}
+	}
+	index := 1
+	for used[index] {
+		index++
+	}
+	return index
+}
+
+// fakePartitionName names a partition the way FreeBSD does for the disk's scheme
+func fakePartitionName(disk *Disk, index int) string {
+	switch disk.Scheme {
+	case "MBR":
+		return fmt.Sprintf("%ss%d", disk.Name, index)
+	case "BSD":
+		return fmt.Sprintf("%s%c", disk.Name, 'a'+index-1)
+	}
+	return fmt.Sprintf("%sp%d", disk.Name, index)
+}
+
+// findDisk returns the named disk. The caller must hold f.mu.
+func (f *fakeDiskBackend) findDisk(name string) (*Disk, error) {
+	for i := range f.disks {
+		if f.disks[i].Name == name {
+			return &f.disks[i], nil
+		}
+	}
+	return nil, fmt.Errorf("no such disk: %s", name)
+}
+
+// findPartition returns the named partition. The caller must hold f.mu.
+func (f *fakeDiskBackend) findPartition(partName string) (*Disk, int, error) {
+	for i := range f.disks {
+		for j := range f.disks[i].Partitions {
+			if f.disks[i].Partitions[j].Name == partName {
+				return &f.disks[i], j, nil
+			}
+		}
+	}
+	return nil, -1, fmt.Errorf("no such partition: %s", partName)
+}
+
+// findPartitionByIndex returns the partition with the given gpart index
+func (f *fakeDiskBackend) findPartitionByIndex(diskName, index string) (*Disk, int, error) {
+	disk, err := f.findDisk(diskName)
+	if err != nil {
+		return nil, -1, err
+	}
+	n, err := strconv.Atoi(index)
+	if err != nil {
+		return nil, -1, fmt.Errorf("invalid partition index: %s", index)
+	}
+	return f.findPartition(fakePartitionName(disk, n))
+}
+
+// copyDisk returns a deep copy so callers can't modify the model
+func copyDisk(disk Disk) Disk {
+	disk.Partitions = append([]Partition(nil), disk.Partitions...)
+	return disk
+}
+
+func (f *fakeDiskBackend) getDisks() []Disk {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	disks := make([]Disk, len(f.disks))
+	for i, disk := range f.disks {
+		disks[i] = copyDisk(disk)
+	}
+	return disks
+}
+
+// scheme returns the partition scheme of a fake disk, "" if it has no
+// partition table or doesn't exist
+func (f *fakeDiskBackend) scheme(diskName string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if disk, err := f.findDisk(diskName); err == nil {
+		return disk.Scheme
+	}
+	return ""
+}
+
+func (f *fakeDiskBackend) getPartitions(diskName string) ([]Partition, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	disk, err := f.findDisk(diskName)
+	if err != nil {
+		return nil, err
+	}
+	if disk.Scheme == "" {
+		return nil, fmt.Errorf("failed to get partitions: %s has no partition table", diskName)
+	}
+	return copyDisk(*disk).Partitions, nil
+}
+
+func (f *fakeDiskBackend) refreshFilesystems(disk *Disk) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for i := range disk.Partitions {
+		part := &disk.Partitions[i]
+		if model, j, err := f.findPartition(part.Name); err == nil {
+			part.FileSystem = model.Partitions[j].FileSystem
+			part.MountPoint = model.Partitions[j].MountPoint
+		}
+	}
+	return nil
+}
+
+// createPartition appends a partition after the last one, or places it at
+// the start of region when that is set, filling the region if fill is set.
+// Like gpart add -a, a non-zero alignment rounds the start up and the size
+// down to multiples of it; otherwise partitions start 1 MiB aligned.
+func (f *fakeDiskBackend) createPartition(diskName string, size uint64, partType string, index int, label string, region *FreeRegion, fill bool, alignment uint64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	disk, err := f.findDisk(diskName)
+	if err != nil {
+		return err
+	}
+	if disk.Scheme == "" {
+		return fmt.Errorf("failed to create partition: %s has no partition table", diskName)
+	}
+
+	if label != "" && disk.Scheme != "GPT" {
+		return fmt.Errorf("failed to create partition: %s partition tables don't support labels", disk.Scheme)
+	}
+
+	name := fakePartitionName(disk, f.nextIndex(disk))
+	if index > 0 {
+		name = fakePartitionName(disk, index)
+	}
+
+	var start, sectors uint64
+	if region != nil {
+		start, sectors = region.Start, size/512
+		if alignment > 0 {
+			start = CalculateAlignedOffset(region.Start*512, alignment) / 512
+			if start >= region.Start+region.Size {
+				return fmt.Errorf("failed to create partition: no %s aligned space in the free region", FormatBytes(alignment))
+			}
+		}
+		end := region.Start + region.Size
+		if fill {
+			sectors = end - start
+		}
+		if alignment > 0 {
+			sectors = sectors * 512 / alignment * alignment / 512
+		}
+		if start+sectors > end {
+			return fmt.Errorf("failed to create partition: not enough free space at sector %d of %s", region.Start, diskName)
+		}
+		for _, part := range disk.Partitions {
+			if start < part.End && part.Start < start+sectors {
+				return fmt.Errorf("failed to create partition: sector %d of %s is not free", start, diskName)
+			}
+		}
+	} else {
+		start = f.nextStart(disk)
+		if alignment > 0 {
+			size = size / alignment * alignment
+			start = f.nextAlignedStart(disk, alignment)
+		}
+		sectors = size / 512
+		if (start+sectors)*512 > disk.Size-gptBackupSectors*512 {
+			return fmt.Errorf("failed to create partition: not enough free space on %s", diskName)
+		}
+	}
+	if sectors == 0 && alignment > 0 {
+		return fmt.Errorf("failed to create partition: size is smaller than the %s alignment", FormatBytes(alignment))
+	}
+
+	disk.Partitions = append(disk.Partitions, Partition{
+		Name:  name,
+		Type:  partType,
+		Size:  sectors,
+		Start: start,
+		End:   start + sectors,
+		Label: label,
+		UUID:  f.newUUID(disk),
+	})
+	sort.Slice(disk.Partitions, func(i, j int) bool {
+		return disk.Partitions[i].Start < disk.Partitions[j].Start
+	})
+	return nil
+}
+
+// freeSpace returns the gaps between the partitions of a fake disk and the
+// space after the last one, each starting 1 MiB aligned like nextStart
+func (f *fakeDiskBackend) freeSpace(diskName string) ([]FreeRegion, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	disk, err := f.findDisk(diskName)
+	if err != nil {
+		return nil, err
+	}
+	if disk.Scheme == "" {
+		return nil, fmt.Errorf("failed to read free space: %s has no partition table", diskName)
+	}
+
+	parts := make([]Partition, len(disk.Partitions))
+	copy(parts, disk.Partitions)
+	sort.Slice(parts, func(i, j int) bool { return parts[i].Start < parts[j].Start })
+
+	var regions []FreeRegion
+	addRegion := func(start, end uint64) {
+		start = CalculateAlignedOffset(start*512, Align1M) / 512
+		if end > start {
+			regions = append(regions, FreeRegion{Start: start, Size: end - start})
+		}
+	}
+
+	cursor := uint64(gptFirstUsableSector)
+	for _, part := range parts {
+		addRegion(cursor, part.Start)
+		if part.End > cursor {
+			cursor = part.End
+		}
+	}
+	addRegion(cursor, disk.Size/512-gptBackupSectors)
+	return regions, nil
+}
+
+func (f *fakeDiskBackend) deletePartition(diskName, index string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	disk, i, err := f.findPartitionByIndex(diskName, index)
+	if err != nil {
+		return fmt.Errorf("failed to delete partition: %w", err)
+	}
+	if disk.Partitions[i].MountPoint != "" {
+		return fmt.Errorf("failed to delete partition: %s is mounted at %s", disk.Partitions[i].Name, disk.Partitions[i].MountPoint)
+	}
+	// Like gpart, refuse to delete a slice whose BSD label is still there
+	if label, err := f.findDisk(disk.Partitions[i].Name); err == nil && label.Scheme != "" {
+		return fmt.Errorf("failed to delete partition: %s holds a %s partition table (Device busy)", label.Name, label.Scheme)
+	}
+
+	delete(f.attributes, disk.Partitions[i].Name)
+	delete(f.geli, disk.Partitions[i].Name)
+	delete(f.ufs, disk.Partitions[i].Name)
+	delete(f.swap, disk.Partitions[i].Name)
+	disk.Partitions = append(disk.Partitions[:i], disk.Partitions[i+1:]...)
+	return nil
+}
+
+func (f *fakeDiskBackend) resizePartition(diskName, index string, newSize uint64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	disk, i, err := f.findPartitionByIndex(diskName, index)
+	if err != nil {
+		return fmt.Errorf("failed to resize partition: %w", err)
+	}
+
+	part := &disk.Partitions[i]
+	sectors := newSize / 512
+	limit := disk.Size/512 - gptBackupSectors
+	for _, other := range disk.Partitions {
+		if other.Start > part.Start && other.Start < limit {
+			limit = other.Start
+		}
+	}
+	if part.Start+sectors > limit {
+		return fmt.Errorf("failed to resize partition: not enough free space after %s", part.Name)
+	}
+
+	part.Size = sectors
+	part.End = part.Start + sectors
+	return nil
+}
+
+func (f *fakeDiskBackend) setPartitionLabel(partName, label string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	disk, i, err := f.findPartition(partName)
+	if err != nil {
+		return fmt.Errorf("failed to set the label of %s: %w", partName, err)
+	}
+	if disk.Scheme != "GPT" {
+		return fmt.Errorf("failed to set the label of %s: %s has no GPT partition table", partName, disk.Name)
+	}
+
+	disk.Partitions[i].Label = label
+	return nil
+}
+
+func (f *fakeDiskBackend) setPartitionType(partName, partType string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	disk, i, err := f.findPartition(partName)
+	if err != nil {
+		return fmt.Errorf("failed to change the type of %s: %w", partName, err)
+	}
+
+	if alias, ok := TypeAliasForGUID(partType); ok {
+		partType = alias
+	}
+	disk.Partitions[i].Type = partType
+	return nil
+}
+
+func (f *fakeDiskBackend) formatPartition(partName, fsType string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	disk, i, err := f.findPartition(partName)
+	if err != nil {
+		return fmt.Errorf("failed to format partition: %w", err)
+	}
+	if disk.Partitions[i].MountPoint != "" {
+		return fmt.Errorf("failed to format partition: %s is mounted at %s", partName, disk.Partitions[i].MountPoint)
+	}
+
+	disk.Partitions[i].FileSystem = fsType
+	delete(f.geli, partName)
+	delete(f.ufs, partName)
+	delete(f.swap, partName)
+	return nil
+}
+
+func (f *fakeDiskBackend) createPartitionTable(diskName, scheme string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	disk, err := f.findDisk(diskName)
+	if err != nil {
+		return err
+	}
+	if disk.Scheme != "" {
+		return fmt.Errorf("failed to create partition table: %s already has a %s table", diskName, disk.Scheme)
+	}
+
+	disk.Scheme = strings.ToUpper(scheme)
+	disk.Partitions = nil
+	return nil
+}
+
+func (f *fakeDiskBackend) destroyPartitionTable(diskName string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	disk, err := f.findDisk(diskName)
+	if err != nil {
+		return err
+	}
+	for _, part := range disk.Partitions {
+		if part.MountPoint != "" {
+			return fmt.Errorf("failed to destroy partition table: %s is mounted at %s", part.Name, part.MountPoint)
+		}
+		delete(f.attributes, part.Name)
+		delete(f.geli, part.Name)
+		delete(f.ufs, part.Name)
+		delete(f.swap, part.Name)
+	}
+
+	disk.Scheme = ""
+	disk.Partitions = nil
+	return nil
+}
+
+func (f *fakeDiskBackend) copyPartition(ctx context.Context, sourcePart, destPart string, offset uint64, progress ProgressReporter, logger OperationLogger) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	srcDisk, i, err := f.findPartition(sourcePart)
+	if err != nil {
+		return fmt.Errorf("failed to get source partition size: %w", err)
+	}
+	destDisk, j, err := f.findPartition(destPart)
+	if err != nil {
+		return fmt.Errorf("failed to get destination partition size: %w", err)
+	}
+
+	src := srcDisk.Partitions[i]
+	dest := &destDisk.Partitions[j]
+	if dest.Size < src.Size {
+		return fmt.Errorf("destination partition (%s) is too small - source: %d bytes, dest: %d bytes",
+			FormatBytes(dest.Size*512), src.Size*512, dest.Size*512)
+	}
+
+	size := src.Size * 512
+	if offset >= size {
+		return fmt.Errorf("copy offset %s is past the end of %s (%s)", FormatBytes(offset), sourcePart, FormatBytes(size))
+	}
+
+	logStep(logger, "Copying %s to %s", sourcePart, destPart)
+	// The fake copy is instant; pretend each quarter takes a second so
+	// there is a speed to show
+	tracker := copyProgressTracker{offset: offset, total: size}
+	clock := time.Now()
+	done := offset
+	for p := 25.0; p <= 100; p += 25 {
+		if err := ctx.Err(); err != nil {
+			return &CopyInterruptedError{Source: sourcePart, Dest: destPart, Offset: done, Size: size, Err: err}
+		}
+		done = offset + uint64(p/100*float64(size-offset))/CopyBlockSize*CopyBlockSize
+		if p == 100 {
+			done = size
+		}
+		tracker.update(done-offset, clock).report(progress)
+		clock = clock.Add(time.Second)
+		logLine(logger, "%d bytes transferred", done-offset)
+	}
+
+	dest.FileSystem = src.FileSystem
+	return nil
+}
+
+// cloneDisk copies the partition table and the partitions' contents of a
+// fake disk onto another of the same size
+func (f *fakeDiskBackend) cloneDisk(sourceDisk, destDisk string, progress ProgressReporter) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	src, err := f.findDisk(sourceDisk)
+	if err != nil {
+		return err
+	}
+	dst, err := f.findDisk(destDisk)
+	if err != nil {
+		return err
+	}
+
+	for _, part := range dst.Partitions {
+		delete(f.attributes, part.Name)
+		delete(f.geli, part.Name)
+		delete(f.ufs, part.Name)
+		delete(f.swap, part.Name)
+	}
+
+	dst.Scheme = src.Scheme
+	dst.Partitions = nil
+	for _, part := range src.Partitions {
+		part.Name = destDisk + strings.TrimPrefix(part.Name, sourceDisk)
+		part.MountPoint = ""
+		dst.Partitions = append(dst.Partitions, part)
+	}
+
+	orNoProgress(progress).Update(src.Size, src.Size, "")
+	return nil
+}
+
+// deviceSize returns the size in bytes of a fake partition or disk
+func (f *fakeDiskBackend) deviceSize(name string) (uint64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if disk, i, err := f.findPartition(name); err == nil {
+		return disk.Partitions[i].Size * 512, nil
+	}
+	disk, err := f.findDisk(name)
+	if err != nil {
+		return 0, err
+	}
+	return disk.Size, nil
+}
+
+// ataSecurity reports ATA secure erase support for the fake SSDs
+func (f *fakeDiskBackend) ataSecurity(diskName string) ATASecurity {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	disk, err := f.findDisk(diskName)
+	if err != nil {
+		return ATASecurity{}
+	}
+	return ATASecurity{Supported: strings.Contains(disk.Model, "SSD")}
+}
+
+// nonRotating reports the fake SSDs as not rotating
+func (f *fakeDiskBackend) nonRotating(diskName string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	disk, err := f.findDisk(diskName)
+	return err == nil && strings.Contains(disk.Model, "SSD")
+}
+
+// wipe forgets what was on a fake partition, or on every partition of a
+// fake disk along with its partition table
+func (f *fakeDiskBackend) wipe(name string, passes int, progress ProgressReporter, logger OperationLogger) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var wiped []*Partition
+	var wipedDisk *Disk
+	var size uint64
+	if disk, i, err := f.findPartition(name); err == nil {
+		wiped = append(wiped, &disk.Partitions[i])
+		size = disk.Partitions[i].Size * 512
+	} else if wipedDisk, err = f.findDisk(name); err == nil {
+		for i := range wipedDisk.Partitions {
+			wiped = append(wiped, &wipedDisk.Partitions[i])
+		}
+		size = wipedDisk.Size
+	} else {
+		return err
+	}
+
+	progress = orNoProgress(progress)
+	for pass := 1; pass <= passes; pass++ {
+		logStep(logger, "Pass %d of %d: overwriting %s", pass, passes, name)
+		progress.Update(uint64(pass)*size, uint64(passes)*size, "")
+	}
+
+	for _, part := range wiped {
+		part.FileSystem = ""
+		delete(f.geli, part.Name)
+		delete(f.ufs, part.Name)
+		delete(f.swap, part.Name)
+	}
+	if wipedDisk != nil {
+		wipedDisk.Scheme = ""
+		wipedDisk.Partitions = nil
+	}
+	return nil
+}
+
+// verifyCopy treats every raw copy of the fake backend as exact
+func (f *fakeDiskBackend) verifyCopy(sourcePart, destPart string, progressCallback func(float64)) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	srcDisk, i, err := f.findPartition(sourcePart)
+	if err != nil {
+		return fmt.Errorf("failed to get source partition size: %w", err)
+	}
+	destDisk, j, err := f.findPartition(destPart)
+	if err != nil {
+		return fmt.Errorf("failed to get destination partition size: %w", err)
+	}
+
+	src := srcDisk.Partitions[i]
+	dest := destDisk.Partitions[j]
+	if dest.Size < src.Size {
+		return fmt.Errorf("verification failed: %s (%s) is smaller than %s (%s)",
+			destPart, FormatBytes(dest.Size*512), sourcePart, FormatBytes(src.Size*512))
+	}
+
+	if progressCallback != nil {
+		for p := 25.0; p <= 100; p += 25 {
+			progressCallback(p)
+		}
+	}
+	return nil
+}
+
+// copyFilesystem pretends the fake partitions are half full, so a
+// filesystem copy fits in a destination at least half the source's size
+func (f *fakeDiskBackend) copyFilesystem(sourcePart, destPart string, progressCallback func(float64), logger OperationLogger) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	srcDisk, i, err := f.findPartition(sourcePart)
+	if err != nil {
+		return err
+	}
+	destDisk, j, err := f.findPartition(destPart)
+	if err != nil {
+		return err
+	}
+
+	src := srcDisk.Partitions[i]
+	dest := &destDisk.Partitions[j]
+	if !CanCopyFilesystem(src.FileSystem) {
+		return fmt.Errorf("filesystem-aware copy is not supported for %s filesystems; use a raw copy instead", src.FileSystem)
+	}
+	if dest.MountPoint != "" {
+		return fmt.Errorf("destination %s is mounted at %s; unmount it first", destPart, dest.MountPoint)
+	}
+
+	used := src.Size * 512 / 2
+	if used > dest.Size*512/100*90 {
+		return fmt.Errorf("destination partition (%s) is too small for the %s of data on %s",
+			FormatBytes(dest.Size*512), FormatBytes(used), sourcePart)
+	}
+
+	logStep(logger, "Formatting %s as %s", destPart, src.FileSystem)
+	logStep(logger, "Copying the files of %s to %s", sourcePart, destPart)
+	if progressCallback != nil {
+		for p := 10.0; p <= 100; p += 30 {
+			progressCallback(p)
+		}
+	}
+
+	dest.FileSystem = src.FileSystem
+	return nil
+}
+
+// swapDevice returns the device a fake partition swaps on, or ""
+func (f *fakeDiskBackend) swapDevice(partName string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.swap[partName] {
+		return "/dev/" + partName
+	}
+	return ""
+}
+
+func (f *fakeDiskBackend) enableSwap(partName string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, _, err := f.findPartition(partName); err != nil {
+		return err
+	}
+	f.swap[partName] = true
+	return nil
+}
+
+func (f *fakeDiskBackend) disableSwap(partName string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	delete(f.swap, partName)
+	return nil
+}
+
+func (f *fakeDiskBackend) mountPartition(partName, mountPoint string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	disk, i, err := f.findPartition(partName)
+	if err != nil {
+		return err
+	}
+	if disk.Partitions[i].MountPoint != "" {
+		return fmt.Errorf("failed to mount %s: already mounted at %s", partName, disk.Partitions[i].MountPoint)
+	}
+
+	disk.Partitions[i].MountPoint = mountPoint
+	return nil
+}
+
+// mountPoint returns where a fake partition is mounted, or "" if it isn't
+func (f *fakeDiskBackend) mountPoint(partName string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	disk, i, err := f.findPartition(strings.TrimPrefix(partName, "/dev/"))
+	if err != nil {
+		return ""
+	}
+	return disk.Partitions[i].MountPoint
+}
+
+// usage reports fake filesystems as a little over a third full
+func (f *fakeDiskBackend) usage(mountPoint string) (uint64, uint64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, disk := range f.disks {
+		for _, part := range disk.Partitions {
+			if part.MountPoint == mountPoint {
+				total := part.Size * 512
+				return total * 37 / 100, total, nil
+			}
+		}
+	}
+	return 0, 0, fmt.Errorf("%s is not a mount point", mountPoint)
+}
+
+func (f *fakeDiskBackend) unmountPartition(partName string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	disk, i, err := f.findPartition(partName)
+	if err != nil {
+		return err
+	}
+
+	disk.Partitions[i].MountPoint = ""
+	return nil
+}
+
+func (f *fakeDiskBackend) geliStatus(partName string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.geli[partName] {
+		return GELIAttached
+	}
+	return GELIDetached
+}
+
+// attachGELI accepts any non-empty passphrase
+func (f *fakeDiskBackend) attachGELI(partName, passphrase string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, _, err := f.findPartition(partName); err != nil {
+		return "", err
+	}
+	attached, ok := f.geli[partName]
+	if !ok {
+		return "", fmt.Errorf("failed to attach %s: not a GELI provider", partName)
+	}
+	if attached {
+		return "", fmt.Errorf("failed to attach %s: provider %s.eli already exists", partName, partName)
+	}
+	if passphrase == "" {
+		return "", fmt.Errorf("failed to attach %s: wrong key", partName)
+	}
+
+	f.geli[partName] = true
+	return partName + ".eli", nil
+}
+
+// initGELI turns a fake partition into a detached GELI provider
+func (f *fakeDiskBackend) initGELI(partName string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	disk, i, err := f.findPartition(partName)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt %s: %w", partName, err)
+	}
+	if f.geli[partName] {
+		return fmt.Errorf("failed to encrypt %s: provider %s.eli is attached", partName, partName)
+	}
+
+	disk.Partitions[i].FileSystem = "GELI"
+	delete(f.ufs, partName)
+	f.geli[partName] = false
+	return nil
+}
+
+// detachGELI locks an attached fake GELI provider
+func (f *fakeDiskBackend) detachGELI(partName string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	attached, ok := f.geli[partName]
+	if !ok || !attached {
+		return fmt.Errorf("failed to detach %s.eli: no such provider", partName)
+	}
+
+	f.geli[partName] = false
+	return nil
+}
+
+// backupPartitionHeader remembers the filesystem of a fake partition under
+// the path of its header backup
+func (f *fakeDiskBackend) backupPartitionHeader(partName, path string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	disk, i, err := f.findPartition(partName)
+	if err != nil {
+		return fmt.Errorf("failed to back up the header of %s: %w", partName, err)
+	}
+
+	f.headers[path] = disk.Partitions[i].FileSystem
+	return nil
+}
+
+// restorePartitionHeader gives a fake partition back the filesystem its
+// header backup was taken from
+func (f *fakeDiskBackend) restorePartitionHeader(partName, path string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	disk, i, err := f.findPartition(partName)
+	if err != nil {
+		return fmt.Errorf("failed to restore the header of %s: %w", partName, err)
+	}
+	fs, ok := f.headers[path]
+	if !ok {
+		return fmt.Errorf("failed to restore the header of %s: %s is not a header backup", partName, path)
+	}
+
+	disk.Partitions[i].FileSystem = fs
+	delete(f.ufs, partName)
+	return nil
+}
+
+// createZFSPool records a new pool and marks its partitions as ZFS
+func (f *fakeDiskBackend) createZFSPool(poolName string, partNames []string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, exists := f.pools[poolName]; exists {
+		return fmt.Errorf("failed to create ZFS pool %s: pool already exists", poolName)
+	}
+
+	for _, name := range partNames {
+		disk, i, err := f.findPartition(name)
+		if err != nil {
+			return fmt.Errorf("failed to create ZFS pool %s: %w", poolName, err)
+		}
+		if mp := disk.Partitions[i].MountPoint; mp != "" {
+			return fmt.Errorf("%s is mounted at %s; unmount it first", name, mp)
+		}
+		if f.swap[name] {
+			return fmt.Errorf("failed to create ZFS pool %s: %s is in use as swap", poolName, name)
+		}
+		for pool, vdevs := range f.pools {
+			for _, vdev := range vdevs {
+				if vdev == name {
+					return fmt.Errorf("failed to create ZFS pool %s: %s is part of active pool '%s'", poolName, name, pool)
+				}
+			}
+		}
+	}
+
+	for _, name := range partNames {
+		disk, i, _ := f.findPartition(name)
+		disk.Partitions[i].FileSystem = "ZFS"
+		delete(f.geli, name)
+		delete(f.ufs, name)
+	}
+	f.pools[poolName] = append([]string(nil), partNames...)
+	return nil
+}
+
+// filesystemSize returns the size of a fake partition, since fake
+// filesystems always fill their partitions
+func (f *fakeDiskBackend) filesystemSize(partName string) (uint64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	disk, i, err := f.findPartition(partName)
+	if err != nil {
+		return 0, err
+	}
+	return disk.Partitions[i].Size * 512, nil
+}
+
+// ufsTuning returns the newfs defaults, soft updates with journaling,
+// unless they were changed
+func (f *fakeDiskBackend) ufsTuning(partName string) (*UFSTuning, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, _, err := f.findPartition(partName); err != nil {
+		return nil, err
+	}
+	tuning, ok := f.ufs[partName]
+	if !ok {
+		tuning = UFSTuning{SoftUpdates: true, Journaling: true}
+	}
+	return &tuning, nil
+}
+
+func (f *fakeDiskBackend) setUFSTuning(partName string, tuning UFSTuning) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, _, err := f.findPartition(partName); err != nil {
+		return err
+	}
+	f.ufs[partName] = tuning
+	return nil
+}
+
+func (f *fakeDiskBackend) getAttributes(partName string) (*AttributeInfo, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, _, err := f.findPartition(partName); err != nil {
+		return nil, fmt.Errorf("failed to get partition info: %w", err)
+	}
+
+	info := &AttributeInfo{
+		Partition:  partName,
+		Attributes: make(map[string]bool),
+	}
+	var names []string
+	for _, attr := range GetAvailableAttributes() {
+		if f.attributes[partName][attr.Name] {
+			info.Attributes[attr.Name] = true
+			names = append(names, attr.Name)
+		}
+	}
+	// Like gpart, the raw value doesn't mention the required attribute
+	if f.attributes[partName][AttrRequired] {
+		info.Attributes[AttrRequired] = true
+	}
+	info.RawValue = strings.Join(names, ",")
+	return info, nil
+}
+
+func (f *fakeDiskBackend) setAttribute(partName, attribute string, set bool) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	disk, _, err := f.findPartition(partName)
+	if err != nil {
+		return err
+	}
+	if disk.Scheme != "GPT" {
+		return fmt.Errorf("attributes are only supported on GPT partitions")
+	}
+
+	if f.attributes[partName] == nil {
+		f.attributes[partName] = make(map[string]bool)
+	}
+	f.attributes[partName][attribute] = set
+	return nil
+}
+
+func (f *fakeDiskBackend) validateForAttributes(partName string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	disk, _, err := f.findPartition(partName)
+	if err != nil {
+		return err
+	}
+	if disk.Scheme != "GPT" {
+		return fmt.Errorf("partition %s is not on a GPT disk (attributes only available for GPT)", partName)
+	}
+	return nil
+}
+
+func (f *fakeDiskBackend) alignment(partName string) (*AlignmentInfo, error) {
+	f.mu.Lock()
+	disk, i, err := f.findPartition(partName)
+	var start uint64
+	if err == nil {
+		start = disk.Partitions[i].Start
+	}
+	f.mu.Unlock()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get partition info: %w", err)
+	}
+
+	info := &AlignmentInfo{
+		Partition:    partName,
+		StartOffset:  start,
+		SectorSize:   512,
+		PhysicalSize: Align4K,
+	}
+	info.IsAligned, info.AlignmentType, info.Recommendation = checkAlignment(start*512, Align4K)
+	return info, nil
+}
+
+func (f *fakeDiskBackend) diskInfo(diskName string) (*DiskInfo, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	disk, err := f.findDisk(diskName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get geom info: %w", err)
+	}
+
+	info := f.info[diskName]
+	info.Device = diskName
+	info.Model = disk.Model
+	info.Size = disk.Size
+	info.SectorSize = disk.SectorSize
+	info.Scheme = disk.Scheme
+	info.Attributes = append([]SMARTAttribute(nil), info.Attributes...)
+	info.Capabilities = append([]string(nil), info.Capabilities...)
+	return &info, nil
+}
+
+func (f *fakeDiskBackend) supportedSMARTTests(diskName string) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	disk, err := f.findDisk(diskName)
+	if err != nil || !f.info[diskName].SMARTEnabled {
+		return nil
+	}
+	// SSDs have no heads to park, so they usually lack the conveyance test
+	if strings.Contains(disk.Model, "SSD") {
+		return []string{"short", "long"}
+	}
+	return append([]string(nil), SMARTTestTypes...)
+}
+
+func (f *fakeDiskBackend) runSMARTTest(diskName, testType string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if test, ok := f.selfTests[diskName]; ok && time.Since(test.started) < fakeSelfTestDurations[test.testType] {
+		return fmt.Errorf("failed to start %s self-test on %s: exit status 4 (output: Can't start self-test without aborting current test)",
+			testType, diskName)
+	}
+	f.selfTests[diskName] = fakeSelfTest{testType: testType, started: time.Now()}
+	return nil
+}
+
+func (f *fakeDiskBackend) smartTestProgress(diskName string) (int, string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, err := f.findDisk(diskName); err != nil {
+		return 0, "", ExplainDiskGone(diskName, fmt.Errorf("failed to read self-test status of %s: %w", diskName, err))
+	}
+
+	test, ok := f.selfTests[diskName]
+	if !ok {
+		return 0, "No self-tests have been logged", nil
+	}
+
+	duration := fakeSelfTestDurations[test.testType]
+	if elapsed := time.Since(test.started); elapsed < duration {
+		// Drives report the remaining work in steps of 10%
+		remaining := int((duration-elapsed)*10/duration+1) * 10
+		if remaining > 100 {
+			remaining = 100
+		}
+		return remaining, SMARTTestInProgress, nil
+	}
+
+	if f.info[diskName].SMARTStatus == "FAILED" {
+		return 0, "Completed: read failure", nil
+	}
+	return 0, "Completed without error", nil
+}
+
+func (f *fakeDiskBackend) attachImage(path string, size, sectorSize uint64) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if sectorSize == 0 {
+		sectorSize = 512
+	}
+
+	unit := 0
+	for {
+		if _, err := f.findDisk(fmt.Sprintf("md%d", unit)); err != nil {
+			break
+		}
+		unit++
+	}
+
+	name := fmt.Sprintf("md%d", unit)
+	f.disks = append(f.disks, Disk{
+		Name: name, Device: "/dev/" + name, Model: "Disk image " + path,
+		Size: size, SectorSize: sectorSize,
+	})
+	return name, nil
+}
+
+func (f *fakeDiskBackend) detachImage(mdName string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for i := range f.disks {
+		if f.disks[i].Name != mdName {
+			continue
+		}
+		for _, part := range f.disks[i].Partitions {
+			if part.MountPoint != "" {
+				return fmt.Errorf("failed to detach %s: %s is mounted at %s", mdName, part.Name, part.MountPoint)
+			}
+		}
+		f.disks = append(f.disks[:i], f.disks[i+1:]...)
+		return nil
+	}
+	return fmt.Errorf("no such disk: %s", mdName)
+}
+
+func (f *fakeDiskBackend) sectorSize(diskName string) uint64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if disk, err := f.findDisk(diskName); err == nil && disk.SectorSize != 0 {
+		return disk.SectorSize
+	}
+	return 512
+}
+
+// poolsOnDisk returns the fake pools whose vdevs all lie on diskName
+func (f *fakeDiskBackend) poolsOnDisk(diskName string) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.poolsOnDiskLocked(diskName)
+}
+
+// poolsOnDiskLocked is poolsOnDisk for callers that hold f.mu
+func (f *fakeDiskBackend) poolsOnDiskLocked(diskName string) []string {
+	var pools []string
+	for pool, vdevs := range f.pools {
+		whole := len(vdevs) > 0
+		for _, vdev := range vdevs {
+			if disk, _, err := f.findPartition(vdev); err != nil || disk.Name != diskName {
+				whole = false
+			}
+		}
+		if whole {
+			pools = append(pools, pool)
+		}
+	}
+	sort.Strings(pools)
+	return pools
+}
+
+// checkNotInUse is checkNotInUse for the fake disks, whose partitions are
+// only ever used under their own names
+func (f *fakeDiskBackend) checkNotInUse(name, action string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	onDevice := deviceMatcher(name, nil)
+	for _, disk := range f.disks {
+		for _, part := range disk.Partitions {
+			if !onDevice(part.Name) {
+				continue
+			}
+			if part.MountPoint != "" {
+				return fmt.Errorf("%s is mounted at %s; unmount it before %s", part.Name, part.MountPoint, action)
+			}
+			if f.swap[part.Name] {
+				return fmt.Errorf("%s is in use as swap; disable it before %s", part.Name, action)
+			}
+			if f.geli[part.Name] {
+				return fmt.Errorf("%s is attached as %s.eli; detach it before %s", part.Name, part.Name, action)
+			}
+		}
+	}
+
+	pools := make([]string, 0, len(f.pools))
+	for pool := range f.pools {
+		pools = append(pools, pool)
+	}
+	sort.Strings(pools)
+	for _, pool := range pools {
+		for _, vdev := range f.pools[pool] {
+			if onDevice(vdev) {
+				return fmt.Errorf("%s is in ZFS pool %s; export the pool before %s", vdev, pool, action)
+			}
+		}
+	}
+	return nil
+}
+
+func (f *fakeDiskBackend) prepareDisk(diskName string, exportPools bool) (PrepareResult, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	disk, err := f.findDisk(diskName)
+	if err != nil {
+		return PrepareResult{}, err
+	}
+
+	result := PrepareResult{Disk: diskName}
+	for i := range disk.Partitions {
+		part := &disk.Partitions[i]
+		if f.swap[part.Name] {
+			delete(f.swap, part.Name)
+			result.SwapDisabled = append(result.SwapDisabled, "/dev/"+part.Name)
+		}
+		if part.MountPoint != "" {
+			result.Unmounted = append(result.Unmounted, fmt.Sprintf("%s (/dev/%s)", part.MountPoint, part.Name))
+			part.MountPoint = ""
+		}
+	}
+
+	for _, pool := range f.poolsOnDiskLocked(diskName) {
+		if !exportPools {
+			result.Remaining = append(result.Remaining, fmt.Sprintf("ZFS pool %s is imported", pool))
+			continue
+		}
+		delete(f.pools, pool)
+		result.PoolsExported = append(result.PoolsExported, pool)
+	}
+
+	return result, nil
+}
+
+func (f *fakeDiskBackend) backupPartitionTable(diskName string) ([]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	disk, err := f.findDisk(diskName)
+	if err != nil {
+		return nil, err
+	}
+	if disk.Scheme == "" {
+		return nil, fmt.Errorf("failed to back up partition table: %s has no partition table", diskName)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s 128\n", disk.Scheme)
+	for _, part := range disk.Partitions {
+		fmt.Fprintf(&b, "%d %s %d %d", partitionIndex(part), part.Type, part.Start, part.Size)
+		if part.Label != "" {
+			fmt.Fprintf(&b, " %s", part.Label)
+		}
+		b.WriteString("\n")
+	}
+	return []byte(b.String()), nil
+}
+
+func (f *fakeDiskBackend) restorePartitionTable(diskName string, backup []byte) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	disk, err := f.findDisk(diskName)
+	if err != nil {
+		return err
+	}
+	for _, part := range disk.Partitions {
+		if part.MountPoint != "" {
+			return fmt.Errorf("failed to restore partition table: %s is mounted at %s", part.Name, part.MountPoint)
+		}
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(backup)), "\n")
+	restored := Disk{Scheme: strings.ToUpper(strings.Fields(lines[0])[0]), Name: disk.Name}
+	for _, line := range lines[1:] {
+		fields := strings.Fields(line)
+		if len(fields) < 4 {
+			continue
+		}
+		index, _ := strconv.Atoi(fields[0])
+		start, _ := strconv.ParseUint(fields[2], 10, 64)
+		size, _ := strconv.ParseUint(fields[3], 10, 64)
+		if (start+size)*512 > disk.Size {
+			return fmt.Errorf("failed to restore partition table: partition %d ends beyond the end of %s", index, diskName)
+		}
+		part := Partition{
+			Name: fakePartitionName(&restored, index), Type: fields[1],
+			Start: start, Size: size, End: start + size,
+		}
+		if len(fields) > 4 {
+			part.Label = fields[4]
+		}
+		part.UUID = f.newUUID(&restored)
+		restored.Partitions = append(restored.Partitions, part)
+	}
+
+	for _, part := range disk.Partitions {
+		delete(f.attributes, part.Name)
+		delete(f.geli, part.Name)
+		delete(f.ufs, part.Name)
+		delete(f.swap, part.Name)
+	}
+	disk.Scheme = restored.Scheme
+	disk.Partitions = restored.Partitions
+	return nil
+}
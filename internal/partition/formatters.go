@@ -0,0 +1,405 @@
+package partition
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// FormatOptions holds optional settings passed to a filesystem formatter.
+// The zero value formats with the tool's defaults.
+type FormatOptions struct {
+	// Label is the volume label of the new filesystem
+	Label string
+	// BlockSize is the block or cluster size in bytes, 0 for the default
+	BlockSize uint64
+	// ReservedPercent is the share of blocks kept for root, nil for the
+	// default. Only UFS and ext2/3/4 reserve blocks.
+	ReservedPercent *int
+	// ExtraArgs are passed to the tool as they are, before the device
+	ExtraArgs []string
+}
+
+// Formatter creates a filesystem on a partition
+type Formatter interface {
+	// Name returns the display name of the filesystem (e.g. "UFS")
+	Name() string
+	// ToolBinary returns the program used to create the filesystem
+	ToolBinary() string
+	// InstallHint returns how to install ToolBinary, or "" if it is part of the base system
+	InstallHint() string
+	// BuildCommand returns the command that formats the given partition
+	BuildCommand(partName string, opts FormatOptions) (*exec.Cmd, error)
+	// ParseProgress extracts a progress percentage from a line of tool
+	// output. FormatPartitionWithLog passes it every line, and every
+	// counter a tool redraws in place.
+	ParseProgress(line string) (float64, bool)
+}
+
+var (
+	formatters     = make(map[string]Formatter)
+	formatterOrder []string
+	formattersMu   sync.RWMutex
+)
+
+// RegisterFormatter adds a formatter to the registry. Registering a name
+// twice replaces the earlier formatter.
+func RegisterFormatter(f Formatter) {
+	formattersMu.Lock()
+	defer formattersMu.Unlock()
+
+	key := strings.ToLower(f.Name())
+	if _, exists := formatters[key]; !exists {
+		formatterOrder = append(formatterOrder, f.Name())
+	}
+	formatters[key] = f
+}
+
+// GetFormatter looks up a formatter by filesystem name (case-insensitive)
+func GetFormatter(name string) (Formatter, bool) {
+	formattersMu.RLock()
+	defer formattersMu.RUnlock()
+
+	f, ok := formatters[strings.ToLower(name)]
+	return f, ok
+}
+
+// FormatterNames returns the names of all registered formatters in registration order
+func FormatterNames() []string {
+	formattersMu.RLock()
+	defer formattersMu.RUnlock()
+
+	names := make([]string, len(formatterOrder))
+	copy(names, formatterOrder)
+	return names
+}
+
+// FilesystemSupport describes whether a registered filesystem can be
+// created on this system
+type FilesystemSupport struct {
+	Name        string `json:"name"`
+	Tool        string `json:"tool"`
+	Available   bool   `json:"available"`
+	InstallHint string `json:"install_hint,omitempty"`
+}
+
+// toolChecker is implemented by formatters that can use more than one
+// tool, so availability isn't just a lookup of ToolBinary
+type toolChecker interface {
+	ToolAvailable() bool
+}
+
+// SupportedFilesystems reports, for each registered formatter in
+// registration order, whether its tool is installed and how to install it
+func SupportedFilesystems() []FilesystemSupport {
+	var supports []FilesystemSupport
+	for _, name := range FormatterNames() {
+		f, ok := GetFormatter(name)
+		if !ok {
+			continue
+		}
+
+		support := FilesystemSupport{
+			Name:        f.Name(),
+			Tool:        f.ToolBinary(),
+			InstallHint: f.InstallHint(),
+		}
+		checker, isChecker := f.(toolChecker)
+		switch {
+		case fakeDisks != nil:
+			// The fake backend formats without running any tool
+			support.Available = true
+		case isChecker:
+			support.Available = checker.ToolAvailable()
+		default:
+			_, err := exec.LookPath(f.ToolBinary())
+			support.Available = err == nil
+		}
+		supports = append(supports, support)
+	}
+	return supports
+}
+
+// optionFormatter is implemented by formatters that map the settings of
+// FormatOptions to flags of their tool
+type optionFormatter interface {
+	optionArgs(opts FormatOptions) ([]string, error)
+}
+
+// CheckFormatOptions returns an error if a filesystem doesn't support one
+// of the settings in opts or a value is out of its range, so it can be
+// reported before anything is formatted
+func CheckFormatOptions(fsType string, opts FormatOptions) error {
+	formatter, ok := GetFormatter(fsType)
+	if !ok {
+		return fmt.Errorf("unsupported filesystem type: %s", fsType)
+	}
+	if of, ok := formatter.(optionFormatter); ok {
+		_, err := of.optionArgs(opts)
+		return err
+	}
+	if opts.Label != "" || opts.BlockSize != 0 || opts.ReservedPercent != nil {
+		return fmt.Errorf("%s takes no label, block size or reserved space options", formatter.Name())
+	}
+	return nil
+}
+
+// formatFlags are the flags of a formatting tool for the settings of
+// FormatOptions. An empty flag means the filesystem has no such setting.
+type formatFlags struct {
+	label        string
+	maxLabel     int // longest label in characters
+	blockSize    string
+	minBlockSize uint64
+	maxBlockSize uint64
+	reserved     string
+	maxReserved  int
+}
+
+// commandFormatter is a Formatter that runs a single external tool
+type commandFormatter struct {
+	name     string
+	binary   string
+	hint     string
+	flags    formatFlags
+	args     func(device string, opts FormatOptions) []string
+	progress func(line string) (float64, bool)
+}
+
+func (f *commandFormatter) Name() string        { return f.name }
+func (f *commandFormatter) ToolBinary() string  { return f.binary }
+func (f *commandFormatter) InstallHint() string { return f.hint }
+
+func (f *commandFormatter) BuildCommand(partName string, opts FormatOptions) (*exec.Cmd, error) {
+	if _, err := exec.LookPath(f.binary); err != nil {
+		if f.hint != "" {
+			return nil, fmt.Errorf("%s not found - %s", f.binary, f.hint)
+		}
+		return nil, fmt.Errorf("%s not found", f.binary)
+	}
+
+	opts, err := f.withOptionArgs(opts)
+	if err != nil {
+		return nil, err
+	}
+	args := f.args("/dev/"+partName, opts)
+	return exec.Command(f.binary, args...), nil
+}
+
+// withOptionArgs returns opts with the flags for its settings put in
+// front of its ExtraArgs, where the args function picks them up
+func (f *commandFormatter) withOptionArgs(opts FormatOptions) (FormatOptions, error) {
+	flags, err := f.optionArgs(opts)
+	if err != nil {
+		return opts, err
+	}
+	opts.ExtraArgs = append(flags, opts.ExtraArgs...)
+	return opts, nil
+}
+
+// optionArgs returns the tool's flags for the settings in opts
+func (f *commandFormatter) optionArgs(opts FormatOptions) ([]string, error) {
+	var args []string
+
+	if opts.Label != "" {
+		if f.flags.label == "" {
+			return nil, fmt.Errorf("%s filesystems have no volume label", f.name)
+		}
+		if len(opts.Label) > f.flags.maxLabel {
+			return nil, fmt.Errorf("%s labels are at most %d characters long", f.name, f.flags.maxLabel)
+		}
+		for _, r := range opts.Label {
+			if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+				return nil, fmt.Errorf("invalid character %q in label %q: use letters, digits, '-' and '_'", r, opts.Label)
+			}
+		}
+		args = append(args, f.flags.label, opts.Label)
+	}
+
+	if opts.BlockSize != 0 {
+		if f.flags.blockSize == "" {
+			return nil, fmt.Errorf("the block size of %s filesystems can't be set", f.name)
+		}
+		if opts.BlockSize&(opts.BlockSize-1) != 0 || opts.BlockSize < f.flags.minBlockSize || opts.BlockSize > f.flags.maxBlockSize {
+			return nil, fmt.Errorf("%s block size must be a power of two from %s to %s",
+				f.name, FormatBytes(f.flags.minBlockSize), FormatBytes(f.flags.maxBlockSize))
+		}
+		args = append(args, f.flags.blockSize, strconv.FormatUint(opts.BlockSize, 10))
+	}
+
+	if opts.ReservedPercent != nil {
+		if f.flags.reserved == "" {
+			return nil, fmt.Errorf("%s filesystems have no reserved space", f.name)
+		}
+		if *opts.ReservedPercent < 0 || *opts.ReservedPercent > f.flags.maxReserved {
+			return nil, fmt.Errorf("%s reserved space must be from 0 to %d%%", f.name, f.flags.maxReserved)
+		}
+		args = append(args, f.flags.reserved, strconv.Itoa(*opts.ReservedPercent))
+	}
+
+	return args, nil
+}
+
+func (f *commandFormatter) ParseProgress(line string) (float64, bool) {
+	if f.progress == nil {
+		return 0, false
+	}
+	return f.progress(line)
+}
+
+// parseMke2fsProgress parses mke2fs output like "Writing inode tables: 12/64",
+// or the bare "13/64" mke2fs overwrites the counter with
+func parseMke2fsProgress(line string) (float64, bool) {
+	if idx := strings.LastIndex(line, ":"); idx >= 0 {
+		line = line[idx+1:]
+	}
+
+	parts := strings.SplitN(strings.TrimSpace(line), "/", 2)
+	if len(parts) != 2 {
+		return 0, false
+	}
+
+	totalFields := strings.Fields(parts[1])
+	if len(totalFields) == 0 {
+		return 0, false
+	}
+
+	done, err1 := strconv.ParseFloat(parts[0], 64)
+	total, err2 := strconv.ParseFloat(totalFields[0], 64)
+	if err1 != nil || err2 != nil || total <= 0 {
+		return 0, false
+	}
+
+	return done / total * 100.0, true
+}
+
+// withExtra appends the caller's extra arguments before the device
+func withExtra(args []string, opts FormatOptions, device string) []string {
+	args = append(args, opts.ExtraArgs...)
+	return append(args, device)
+}
+
+// exfatFormatter uses mkexfatfs (exfat-utils) or newfs_exfat, whichever is installed
+type exfatFormatter struct {
+	commandFormatter
+}
+
+// exfatBinaries lists the supported exFAT tools in order of preference
+var exfatBinaries = []string{"mkexfatfs", "newfs_exfat"}
+
+// ToolAvailable reports whether any of the exFAT tools is installed
+func (f *exfatFormatter) ToolAvailable() bool {
+	for _, binary := range exfatBinaries {
+		if _, err := exec.LookPath(binary); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *exfatFormatter) BuildCommand(partName string, opts FormatOptions) (*exec.Cmd, error) {
+	opts, err := f.withOptionArgs(opts)
+	if err != nil {
+		return nil, err
+	}
+	for _, binary := range exfatBinaries {
+		if _, err := exec.LookPath(binary); err == nil {
+			args := f.args("/dev/"+partName, opts)
+			return exec.Command(binary, args...), nil
+		}
+	}
+
+	return nil, fmt.Errorf("%s not found - %s", strings.Join(exfatBinaries, "/"), f.hint)
+}
+
+func newExtFormatter(name string) Formatter {
+	return &commandFormatter{
+		name:   name,
+		binary: "mke2fs",
+		hint:   "install e2fsprogs package: pkg install e2fsprogs",
+		flags: formatFlags{
+			label:        "-L",
+			maxLabel:     16,
+			blockSize:    "-b",
+			minBlockSize: 1024,
+			maxBlockSize: 65536,
+			reserved:     "-m",
+			maxReserved:  50,
+		},
+		args: func(device string, opts FormatOptions) []string {
+			return withExtra([]string{"-t", name}, opts, device)
+		},
+		progress: parseMke2fsProgress,
+	}
+}
+
+func init() {
+	RegisterFormatter(&commandFormatter{
+		name:   "UFS",
+		binary: "newfs",
+		flags: formatFlags{
+			label:        "-L",
+			maxLabel:     31,
+			blockSize:    "-b",
+			minBlockSize: 4096,
+			maxBlockSize: 65536,
+			reserved:     "-m",
+			maxReserved:  99,
+		},
+		args: func(device string, opts FormatOptions) []string {
+			return withExtra([]string{"-U"}, opts, device)
+		},
+	})
+
+	RegisterFormatter(&commandFormatter{
+		name:   "FAT32",
+		binary: "newfs_msdos",
+		// -b is the cluster size
+		flags: formatFlags{
+			label:        "-L",
+			maxLabel:     11,
+			blockSize:    "-b",
+			minBlockSize: 512,
+			maxBlockSize: 65536,
+		},
+		args: func(device string, opts FormatOptions) []string {
+			return withExtra([]string{"-F", "32"}, opts, device)
+		},
+	})
+
+	RegisterFormatter(newExtFormatter("ext2"))
+	RegisterFormatter(newExtFormatter("ext3"))
+	RegisterFormatter(newExtFormatter("ext4"))
+
+	RegisterFormatter(&commandFormatter{
+		name:   "NTFS",
+		binary: "mkntfs",
+		hint:   "install ntfsprogs or ntfs-3g package: pkg install fusefs-ntfs",
+		// -c is the cluster size
+		flags: formatFlags{
+			label:        "-L",
+			maxLabel:     32,
+			blockSize:    "-c",
+			minBlockSize: 512,
+			maxBlockSize: 65536,
+		},
+		args: func(device string, opts FormatOptions) []string {
+			return withExtra([]string{"-f"}, opts, device)
+		},
+	})
+
+	RegisterFormatter(&exfatFormatter{commandFormatter{
+		name:   "exFAT",
+		binary: exfatBinaries[0],
+		hint:   "install exfat-utils package: pkg install exfat-utils",
+		flags: formatFlags{
+			label:    "-n",
+			maxLabel: 15,
+		},
+		args: func(device string, opts FormatOptions) []string {
+			return withExtra(nil, opts, device)
+		},
+	}})
+}
@@ -0,0 +1,105 @@
+package partition
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseMke2fsProgress(t *testing.T) {
+	tests := []struct {
+		line   string
+		want   float64
+		wantOK bool
+	}{
+		{"Writing inode tables: 16/64", 25, true},
+		{"Allocating group tables: 64/64", 100, true},
+		{"13/64", 20.3125, true},
+		{"Writing inode tables: done", 0, false},
+		{"Creating filesystem with 262144 4k blocks and 65536 inodes", 0, false},
+		{"Writing inode tables: 3/0", 0, false},
+		{"", 0, false},
+	}
+
+	for _, tt := range tests {
+		got, ok := parseMke2fsProgress(tt.line)
+		if ok != tt.wantOK || got != tt.want {
+			t.Errorf("parseMke2fsProgress(%q) = %v, %v, want %v, %v", tt.line, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+// recordingLogger is an OperationLogger that keeps what it is given
+type recordingLogger struct {
+	steps []string
+	lines []string
+}
+
+func (l *recordingLogger) Step(description string) { l.steps = append(l.steps, description) }
+func (l *recordingLogger) Log(line string)         { l.lines = append(l.lines, line) }
+
+func TestReportFormatOutput(t *testing.T) {
+	formatter, ok := GetFormatter("ext4")
+	if !ok {
+		t.Fatal("no ext4 formatter registered")
+	}
+
+	// mke2fs redraws its counters with backspaces
+	output := "mke2fs 1.47.0 (5-Feb-2023)\n" +
+		"Allocating group tables: 0/4\b\b\b   \b\b\b1/4\b\b\b2/4\b\b\bdone                            \n" +
+		"Writing inode tables: 0/4\b\b\b4/4\b\b\bdone                            \n"
+
+	type update struct {
+		done    uint64
+		message string
+	}
+	var updates []update
+	progress := ProgressFunc(func(done, total uint64, message string) {
+		if total != 100 {
+			t.Errorf("progress total = %d, want 100", total)
+		}
+		updates = append(updates, update{done, message})
+	})
+	logger := &recordingLogger{}
+
+	all := reportFormatOutput(strings.NewReader(output), formatter, progress, logger)
+
+	wantUpdates := []update{
+		{0, "Allocating group tables"},
+		{25, "Allocating group tables"},
+		{50, "Allocating group tables"},
+		{0, "Writing inode tables"},
+		{100, "Writing inode tables"},
+	}
+	if !reflect.DeepEqual(updates, wantUpdates) {
+		t.Errorf("progress updates = %v, want %v", updates, wantUpdates)
+	}
+
+	wantLines := []string{"mke2fs 1.47.0 (5-Feb-2023)", "done", "done"}
+	if !reflect.DeepEqual(logger.lines, wantLines) {
+		t.Errorf("logged lines = %q, want %q", logger.lines, wantLines)
+	}
+
+	if strings.Contains(all, "\b") || !strings.Contains(all, "Writing inode tables") {
+		t.Errorf("returned output = %q, want the whole output without backspaces", all)
+	}
+}
+
+func TestFormatPartitionReportsProgress(t *testing.T) {
+	fake := useFakeRunner(t)
+	fake.Respond("mke2fs -t ext4 /dev/ada3p1", "Writing inode tables: 2/8\b\b\b8/8\b\b\bdone\n", nil)
+
+	var last uint64
+	progress := ProgressFunc(func(done, _ uint64, _ string) { last = done })
+	logger := &recordingLogger{}
+
+	if err := FormatPartitionWithLog("ada3p1", "ext4", FormatOptions{}, false, progress, logger); err != nil {
+		t.Fatalf("FormatPartitionWithLog() = %v", err)
+	}
+	if last != 100 {
+		t.Errorf("last progress = %d, want 100", last)
+	}
+	if len(logger.steps) != 1 || !strings.Contains(logger.steps[0], "ada3p1") {
+		t.Errorf("steps = %q, want one step formatting ada3p1", logger.steps)
+	}
+}
@@ -0,0 +1,137 @@
+package partition
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// FreeRegion is an unpartitioned range of a disk. Like Partition, Start
+// and Size are in 512-byte units.
+type FreeRegion struct {
+	Start uint64
+	Size  uint64
+}
+
+// Bytes returns the size of the region in bytes
+func (r FreeRegion) Bytes() uint64 {
+	return r.Size * 512
+}
+
+// GetFreeSpace returns the free regions of a disk's partition table, as
+// reported by gpart show
+func GetFreeSpace(disk string) ([]FreeRegion, error) {
+	if fakeDisks != nil {
+		return fakeDisks.freeSpace(disk)
+	}
+
+	output, err := Runner.Run("gpart", "show", "-p", disk)
+	if err != nil {
+		return nil, ExplainDiskGone(disk, fmt.Errorf("failed to read free space: %w (output: %s)", err, string(output)))
+	}
+
+	regions := parseFreeRegions(string(output))
+	if sectorSize := deviceSectorSize(disk); sectorSize > 512 && sectorSize%512 == 0 {
+		factor := sectorSize / 512
+		for i := range regions {
+			regions[i].Start *= factor
+			regions[i].Size *= factor
+		}
+	}
+	return regions, nil
+}
+
+// parseFreeRegions reads the free space lines of gpart show output, e.g.
+//
+//	976771112       2015         - free -  (1.0M)
+func parseFreeRegions(output string) []FreeRegion {
+	var regions []FreeRegion
+	for _, line := range strings.Split(output, "\n") {
+		if !strings.Contains(line, "- free -") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		start, err1 := strconv.ParseUint(fields[0], 10, 64)
+		size, err2 := strconv.ParseUint(fields[1], 10, 64)
+		if err1 != nil || err2 != nil || size == 0 {
+			continue
+		}
+		regions = append(regions, FreeRegion{Start: start, Size: size})
+	}
+	return regions
+}
+
+// LargestFreeRegion returns the largest free region of a disk, or an
+// error if the disk has no free space at all
+func LargestFreeRegion(disk string) (FreeRegion, error) {
+	regions, err := GetFreeSpace(disk)
+	if err != nil {
+		return FreeRegion{}, err
+	}
+
+	var largest FreeRegion
+	for _, region := range regions {
+		if region.Size > largest.Size {
+			largest = region
+		}
+	}
+	if largest.Size == 0 {
+		return FreeRegion{}, fmt.Errorf("no free space on %s", disk)
+	}
+	return largest, nil
+}
+
+// UsableBytes returns how much of the region a partition can use when its
+// start is rounded up and its size down to multiples of alignment bytes,
+// as gpart add -a does. An alignment of 0 uses the whole region.
+func (r FreeRegion) UsableBytes(alignment uint64) uint64 {
+	if alignment == 0 {
+		return r.Bytes()
+	}
+	start := CalculateAlignedOffset(r.Start*512, alignment)
+	end := (r.Start + r.Size) * 512
+	if start >= end {
+		return 0
+	}
+	return (end - start) / alignment * alignment
+}
+
+// MaxPartitionSize returns the size in bytes of the largest partition that
+// can be created on a disk with the given alignment: the most usable space
+// of any of its free regions
+func MaxPartitionSize(disk string, alignment uint64) (uint64, error) {
+	regions, err := GetFreeSpace(disk)
+	if err != nil {
+		return 0, err
+	}
+
+	var largest uint64
+	for _, region := range regions {
+		if usable := region.UsableBytes(alignment); usable > largest {
+			largest = usable
+		}
+	}
+	return largest, nil
+}
+
+// checkSizeFits returns an error if a partition of size bytes with the
+// given alignment doesn't fit in any free region of a disk, so the user
+// gets the sizes involved instead of gpart's terse error
+func checkSizeFits(disk string, size, alignment uint64) error {
+	largest, err := MaxPartitionSize(disk, alignment)
+	if err != nil {
+		return err
+	}
+	if size <= largest {
+		return nil
+	}
+
+	if alignment > 0 {
+		return fmt.Errorf("requested %s but only %s free on %s with %s alignment",
+			FormatBytes(size), FormatBytes(largest), disk, FormatBytes(alignment))
+	}
+	return fmt.Errorf("requested %s but only %s free on %s", FormatBytes(size), FormatBytes(largest), disk)
+}
@@ -0,0 +1,239 @@
+package partition
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// fsCopySupported lists the filesystems CopyFilesystem can recreate and
+// fill file by file. ZFS, swap and the FUSE-only filesystems are excluded.
+var fsCopySupported = map[string]bool{
+	"ufs":   true,
+	"fat32": true,
+	"ext2":  true,
+	"ext3":  true,
+	"ext4":  true,
+}
+
+// CanCopyFilesystem reports whether CopyFilesystem supports fsType
+func CanCopyFilesystem(fsType string) bool {
+	return fsCopySupported[strings.ToLower(fsType)]
+}
+
+// CopyFilesystem copies the files of the filesystem on src to dest rather
+// than its raw sectors. dest is reformatted with the same filesystem at its
+// own size, so it may be smaller than src as long as the files fit. UFS is
+// copied with dump/restore, other filesystems by mounting both sides and
+// piping tar. progressCallback receives a percentage.
+func CopyFilesystem(src, dest string, progressCallback func(float64)) error {
+	return CopyFilesystemWithLog(src, dest, progressCallback, nil)
+}
+
+// CopyFilesystemWithLog is CopyFilesystem reporting its steps and the
+// commands it runs to logger, which may be nil
+func CopyFilesystemWithLog(src, dest string, progressCallback func(float64), logger OperationLogger) error {
+	if err := CheckPrivileges(); err != nil {
+		return err
+	}
+	defer markDisksChanged()
+
+	if src == dest {
+		return fmt.Errorf("source and destination cannot be the same")
+	}
+
+	release, err := beginInFlight(fmt.Sprintf("copying the files of %s to %s", src, dest), src, dest)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	if fakeDisks != nil {
+		return fakeDisks.copyFilesystem(src, dest, progressCallback, logger)
+	}
+
+	report := func(progress float64) {
+		if progressCallback != nil {
+			progressCallback(progress)
+		}
+	}
+
+	fsType, _ := getFileSystem(src)
+	if !CanCopyFilesystem(fsType) {
+		return fmt.Errorf("filesystem-aware copy is not supported for %s filesystems; use a raw copy instead", fsType)
+	}
+
+	if mp, _ := getMountPoint(dest); mp != "" {
+		return fmt.Errorf("destination %s is mounted at %s; unmount it first", dest, mp)
+	}
+
+	// Mount the source read-only unless it is already mounted
+	logStep(logger, "Mounting %s read-only and checking that its files fit on %s", src, dest)
+	srcMount, _ := getMountPoint(src)
+	srcWasMounted := srcMount != ""
+	if !srcWasMounted {
+		dir, err := mountTemporary(src, fsType, true)
+		if err != nil {
+			return err
+		}
+		defer unmountTemporary(dir)
+		srcMount = dir
+		logLine(logger, "Mounted %s read-only at %s", src, dir)
+	} else {
+		logLine(logger, "%s is already mounted at %s", src, srcMount)
+	}
+
+	used, _, err := GetUsage(srcMount)
+	if err != nil {
+		return err
+	}
+	destSize, err := getPartitionSize(dest)
+	if err != nil {
+		return fmt.Errorf("failed to get destination partition size: %w", err)
+	}
+	// Leave room for filesystem metadata and the UFS reserved space
+	if used > destSize/100*90 {
+		return fmt.Errorf("destination partition (%s) is too small for the %s of data on %s",
+			FormatBytes(destSize), FormatBytes(used), src)
+	}
+	logLine(logger, "%s holds %s of data, %s is %s", src, FormatBytes(used), dest, FormatBytes(destSize))
+	report(5)
+
+	formatter, ok := GetFormatter(fsType)
+	if !ok {
+		return fmt.Errorf("unsupported filesystem type: %s", fsType)
+	}
+	formatCmd, err := formatter.BuildCommand(dest, FormatOptions{})
+	if err != nil {
+		return err
+	}
+	logStep(logger, "Formatting %s as %s", dest, fsType)
+	logLine(logger, "%s", strings.Join(formatCmd.Args, " "))
+	if output, err := runCommand(formatCmd); err != nil {
+		return ExplainDiskGone(dest, fmt.Errorf("failed to format %s: %w (output: %s)", dest, err, string(output)))
+	}
+	report(10)
+
+	destMount, err := mountTemporary(dest, fsType, false)
+	if err != nil {
+		return err
+	}
+	defer unmountTemporary(destMount)
+
+	var producer, consumer *exec.Cmd
+	if strings.EqualFold(fsType, "ufs") {
+		dumpArgs := []string{"-0", "-a", "-f", "-"}
+		if srcWasMounted {
+			// Dump a snapshot so files changing during the copy stay consistent
+			dumpArgs = append(dumpArgs, "-L")
+		}
+		producer = exec.Command("dump", append(dumpArgs, "/dev/"+src)...)
+		consumer = exec.Command("restore", "-r", "-f", "-")
+		consumer.Dir = destMount
+	} else {
+		producer = exec.Command("tar", "-cf", "-", "-C", srcMount, ".")
+		consumer = exec.Command("tar", "-xpf", "-", "-C", destMount)
+	}
+
+	logStep(logger, "Copying the files of %s to %s", src, dest)
+	logLine(logger, "%s | %s", strings.Join(producer.Args, " "), strings.Join(consumer.Args, " "))
+	if err := runPipeline(producer, consumer, func() {
+		if copied, _, err := GetUsage(destMount); err == nil && used > 0 {
+			progress := 10 + 90*float64(copied)/float64(used)
+			if progress > 99 {
+				progress = 99
+			}
+			report(progress)
+		}
+	}); err != nil {
+		return ExplainDiskGone(dest, fmt.Errorf("filesystem copy failed: %w", err))
+	}
+
+	// restore leaves its bookkeeping file in the target directory
+	os.Remove(filepath.Join(destMount, "restoresymtable"))
+	report(100)
+
+	logLine(logger, "Copied the files of %s to %s", src, dest)
+	return nil
+}
+
+// runPipeline runs producer | consumer, calling tick every second until
+// both finish
+func runPipeline(producer, consumer *exec.Cmd, tick func()) error {
+	pipe, err := producer.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("failed to create pipe: %w", err)
+	}
+	consumer.Stdin = pipe
+
+	var producerErr, consumerErr strings.Builder
+	producer.Stderr = &producerErr
+	consumer.Stderr = &consumerErr
+
+	if err := consumer.Start(); err != nil {
+		return fmt.Errorf("failed to start %s: %w", consumer.Path, err)
+	}
+	if err := producer.Start(); err != nil {
+		consumer.Process.Kill()
+		consumer.Wait()
+		return fmt.Errorf("failed to start %s: %w", producer.Path, err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				tick()
+			}
+		}
+	}()
+
+	pErr := producer.Wait()
+	cErr := consumer.Wait()
+	close(done)
+
+	if pErr != nil {
+		return fmt.Errorf("%s failed: %w (output: %s)", filepath.Base(producer.Path), pErr, producerErr.String())
+	}
+	if cErr != nil {
+		return fmt.Errorf("%s failed: %w (output: %s)", filepath.Base(consumer.Path), cErr, consumerErr.String())
+	}
+	return nil
+}
+
+// mountTemporary mounts a partition on a new temporary directory
+func mountTemporary(partName, fsType string, readOnly bool) (string, error) {
+	dir, err := os.MkdirTemp("", "pgpart-"+partName+"-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create mount point: %w", err)
+	}
+
+	args := []string{"-t", mountFSType(fsType)}
+	if readOnly {
+		args = append(args, "-r")
+	}
+	args = append(args, "/dev/"+partName, dir)
+
+	cmd := exec.Command("mount", args...)
+	output, err := runCommand(cmd)
+	if err != nil {
+		os.Remove(dir)
+		return "", ExplainDiskGone(partName, fmt.Errorf("failed to mount %s: %w (output: %s)", partName, err, string(output)))
+	}
+
+	return dir, nil
+}
+
+// unmountTemporary unmounts and removes a directory made by mountTemporary
+func unmountTemporary(dir string) {
+	Runner.Run("umount", dir)
+	os.Remove(dir)
+}
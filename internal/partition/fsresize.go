@@ -0,0 +1,159 @@
+package partition
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// ResizeWithFilesystem resizes an unmounted partition together with its
+// filesystem, in the order that keeps the data intact: when shrinking, the
+// filesystem is shrunk to fit first and the partition only after that
+// succeeded; when growing, the partition is grown first and the filesystem
+// then expanded into it. Partitions without a recognized filesystem are
+// resized on their own. It reports whether the filesystem was resized.
+func ResizeWithFilesystem(disk, index string, newSizeBytes uint64, part *Partition) (bool, error) {
+	return resizeWithFilesystem(context.Background(), disk, index, newSizeBytes, part)
+}
+
+// resizeWithFilesystem implements ResizeWithFilesystem, killing gpart once
+// ctx is done. The filesystem tools are left to finish, since a filesystem
+// whose resize is cut short can be left damaged; once ctx is done, the
+// gpart step after them fails without changing the partition.
+func resizeWithFilesystem(ctx context.Context, disk, index string, newSizeBytes uint64, part *Partition) (bool, error) {
+	if part.MountPoint != "" {
+		return false, fmt.Errorf("%s is mounted at %s; unmount it or use an online resize", part.Name, part.MountPoint)
+	}
+
+	if err := CheckZFSShrink(part, newSizeBytes); err != nil {
+		return false, err
+	}
+
+	// gpart resize works in whole sectors, so that is what the filesystem
+	// must fit in
+	sectorSize := deviceSectorSize(disk)
+	newSizeBytes = newSizeBytes / sectorSize * sectorSize
+	shrink := newSizeBytes < part.Size*512
+	fsType := strings.ToLower(part.FileSystem)
+
+	if !hasResizableFilesystem(fsType) {
+		if shrink && fsType != "" && fsType != "unknown" && fsType != "swap" {
+			return false, fmt.Errorf("cannot shrink %s: %s filesystems can't be shrunk, and shrinking the partition alone would cut off its end", part.Name, part.FileSystem)
+		}
+		return false, resizePartition(ctx, disk, index, newSizeBytes, false)
+	}
+
+	if shrink {
+		if fsType == "ufs" {
+			return false, fmt.Errorf("cannot shrink %s: UFS filesystems can't be shrunk, and shrinking the partition alone would cut off its end", part.Name)
+		}
+
+		if err := shrinkFilesystem(part, fsType, newSizeBytes); err != nil {
+			return false, fmt.Errorf("failed to shrink the %s filesystem on %s: %w\n\nNo changes were made to the partition.", part.FileSystem, part.Name, err)
+		}
+
+		if err := resizePartition(ctx, disk, index, newSizeBytes, false); err != nil {
+			return true, fmt.Errorf("filesystem shrunk successfully, but partition resize failed: %w\n\nThe filesystem is now smaller than the partition, which is safe. Retry the partition resize once the problem is fixed.", err)
+		}
+		return true, nil
+	}
+
+	if err := resizePartition(ctx, disk, index, newSizeBytes, false); err != nil {
+		return false, err
+	}
+
+	if err := growFilesystem(part, fsType); err != nil {
+		return false, fmt.Errorf("partition resized successfully, but filesystem grow failed: %w\n\nThe partition is now larger but the filesystem has not expanded to fill it.", err)
+	}
+	return true, nil
+}
+
+// hasResizableFilesystem reports whether ResizeWithFilesystem can resize
+// fsType offline in at least one direction
+func hasResizableFilesystem(fsType string) bool {
+	switch fsType {
+	case "ufs", "ext2", "ext3", "ext4", "ntfs":
+		return true
+	}
+	return false
+}
+
+// shrinkFilesystem shrinks an unmounted filesystem to newSizeBytes after
+// checking that it can be done
+func shrinkFilesystem(part *Partition, fsType string, newSizeBytes uint64) error {
+	if fakeDisks != nil {
+		return nil
+	}
+
+	device := "/dev/" + part.Name
+
+	switch fsType {
+	case "ext2", "ext3", "ext4":
+		// resize2fs refuses to shrink a filesystem that hasn't just been checked
+		check := exec.Command("e2fsck", "-f", "-y", device)
+		resize := exec.Command("resize2fs", device, fmt.Sprintf("%dK", newSizeBytes/1024))
+		if DryRun {
+			dryRun(check)
+			dryRun(resize)
+			return nil
+		}
+		if output, err := runCommand(check); err != nil {
+			// e2fsck exits with 1 when it corrected errors
+			if exitErr, ok := err.(*exec.ExitError); !ok || exitErr.ExitCode() > 1 {
+				return fmt.Errorf("e2fsck failed: %w (output: %s)", err, string(output))
+			}
+		}
+		if output, err := runCommand(resize); err != nil {
+			return fmt.Errorf("resize2fs failed: %w (output: %s)", err, string(output))
+		}
+	case "ntfs":
+		size := fmt.Sprintf("%d", newSizeBytes)
+		cmd := exec.Command("ntfsresize", "-f", "-s", size, device)
+		cmd.Stdin = strings.NewReader("y\n") // answer its confirmation prompt
+		if dryRun(cmd) {
+			return nil
+		}
+		// A trial run first, so a volume that can't shrink that far is left untouched
+		if output, err := Runner.Run("ntfsresize", "--no-action", "-f", "-s", size, device); err != nil {
+			return fmt.Errorf("ntfsresize check failed: %w (output: %s)", err, string(output))
+		}
+		if output, err := runCommand(cmd); err != nil {
+			return fmt.Errorf("ntfsresize failed: %w (output: %s)", err, string(output))
+		}
+	default:
+		return fmt.Errorf("shrinking %s filesystems is not supported", fsType)
+	}
+
+	return nil
+}
+
+// growFilesystem expands an unmounted filesystem to fill its partition
+func growFilesystem(part *Partition, fsType string) error {
+	if fakeDisks != nil {
+		return nil
+	}
+
+	device := "/dev/" + part.Name
+
+	var cmd *exec.Cmd
+	switch fsType {
+	case "ufs":
+		cmd = exec.Command("growfs", "-y", device)
+	case "ext2", "ext3", "ext4":
+		cmd = exec.Command("resize2fs", device)
+	case "ntfs":
+		cmd = exec.Command("ntfsresize", "-f", device)
+		cmd.Stdin = strings.NewReader("y\n")
+	default:
+		return fmt.Errorf("growing %s filesystems is not supported", fsType)
+	}
+
+	if dryRun(cmd) {
+		return nil
+	}
+	if output, err := runCommand(cmd); err != nil {
+		return fmt.Errorf("%s failed: %w (output: %s)", cmd.Args[0], err, string(output))
+	}
+	return nil
+}
@@ -0,0 +1,188 @@
+package partition
+
+import (
+	"bufio"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// FilesystemSize returns the size in bytes that the filesystem on a
+// partition records in its superblock, which can differ from the size of
+// the partition holding it. UFS and ext2/3/4 are supported.
+func FilesystemSize(part *Partition) (uint64, error) {
+	if fakeDisks != nil {
+		return fakeDisks.filesystemSize(part.Name)
+	}
+
+	switch strings.ToLower(part.FileSystem) {
+	case "ufs":
+		return ufsSize(part.Name)
+	case "ext2", "ext3", "ext4":
+		output, err := Runner.Run("dumpe2fs", "-h", "/dev/"+part.Name)
+		if err != nil {
+			return 0, fmt.Errorf("dumpe2fs failed: %w (output: %s)", err, string(output))
+		}
+		return parseDumpe2fsSize(string(output))
+	default:
+		return 0, fmt.Errorf("reading the size of %s filesystems is not supported", part.FileSystem)
+	}
+}
+
+// ufsSize reads the superblock summary at the top of dumpfs output, e.g.
+//
+//	ncg	4	size	262144	blocks	253239
+//	fsize	4096	shift	12	mask	0xfffff000
+//
+// where size counts fragments of fsize bytes. dumpfs goes on to list every
+// cylinder group, so it is stopped once both values are known.
+func ufsSize(partName string) (uint64, error) {
+	cmd := exec.Command("dumpfs", "/dev/"+partName)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return 0, fmt.Errorf("failed to create pipe: %w", err)
+	}
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	if err := cmd.Start(); err != nil {
+		return 0, fmt.Errorf("failed to start dumpfs: %w", err)
+	}
+
+	var header strings.Builder
+	scanner := bufio.NewScanner(stdout)
+	for lines := 0; scanner.Scan() && lines < 40; lines++ {
+		header.WriteString(scanner.Text() + "\n")
+		if size, err := parseDumpfsSize(header.String()); err == nil {
+			cmd.Process.Kill()
+			cmd.Wait()
+			return size, nil
+		}
+	}
+
+	cmd.Process.Kill()
+	if err := cmd.Wait(); err != nil && stderr.Len() > 0 {
+		return 0, fmt.Errorf("dumpfs failed: %w (output: %s)", err, stderr.String())
+	}
+	return parseDumpfsSize(header.String())
+}
+
+// parseDumpfsSize computes the filesystem size from dumpfs output
+func parseDumpfsSize(output string) (uint64, error) {
+	var frags, fragSize uint64
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		for i := 0; i+1 < len(fields); i++ {
+			switch fields[i] {
+			case "size":
+				if frags == 0 {
+					frags, _ = strconv.ParseUint(fields[i+1], 10, 64)
+				}
+			case "fsize":
+				if fragSize == 0 {
+					fragSize, _ = strconv.ParseUint(fields[i+1], 10, 64)
+				}
+			}
+		}
+	}
+
+	if frags == 0 || fragSize == 0 {
+		return 0, fmt.Errorf("could not find the filesystem size in dumpfs output")
+	}
+	return frags * fragSize, nil
+}
+
+// parseDumpe2fsSize computes the filesystem size from dumpe2fs -h output,
+// which has lines such as
+// Block count:              262144
+// Block size:               4096
+func parseDumpe2fsSize(output string) (uint64, error) {
+	var blocks, blockSize uint64
+	for _, line := range strings.Split(output, "\n") {
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		n, err := strconv.ParseUint(strings.TrimSpace(value), 10, 64)
+		if err != nil {
+			continue
+		}
+		switch strings.TrimSpace(key) {
+		case "Block count":
+			blocks = n
+		case "Block size":
+			blockSize = n
+		}
+	}
+
+	if blocks == 0 || blockSize == 0 {
+		return 0, fmt.Errorf("could not find the filesystem size in dumpe2fs output")
+	}
+	return blocks * blockSize, nil
+}
+
+// FilesystemOverrun reports whether the filesystem on a partition claims
+// more space than the partition entry gives it, as left behind by a
+// botched resize, and returns the filesystem's size. Filesystems whose
+// size can't be read are never reported.
+func FilesystemOverrun(part *Partition) (uint64, bool) {
+	if !canReadFilesystemSize(part.FileSystem) || part.SizeUnknown {
+		return 0, false
+	}
+
+	fsSize, err := FilesystemSize(part)
+	if err != nil {
+		return 0, false
+	}
+	return fsSize, fsSize > part.Size*512
+}
+
+// OverrunDescription describes a filesystem of fsSize bytes that doesn't
+// fit its partition
+func OverrunDescription(part *Partition, fsSize uint64) string {
+	return fmt.Sprintf("the %s filesystem is %s but the partition is only %s; grow the partition entry to match it",
+		part.FileSystem, FormatBytes(fsSize), FormatBytes(part.Size*512))
+}
+
+// canReadFilesystemSize reports whether FilesystemSize supports fsType
+func canReadFilesystemSize(fsType string) bool {
+	switch strings.ToLower(fsType) {
+	case "ufs", "ext2", "ext3", "ext4":
+		return true
+	}
+	return false
+}
+
+// GrowPartitionToFilesystem repairs a partition entry that is smaller than
+// the filesystem inside it by growing the entry to cover the whole
+// filesystem. Only the partition table changes; the filesystem and its
+// data are left untouched.
+func GrowPartitionToFilesystem(disk, index string) error {
+	part, err := LookupPartition(disk, index)
+	if err != nil {
+		return err
+	}
+
+	if !canReadFilesystemSize(part.FileSystem) {
+		return fmt.Errorf("cannot read the size of the %s filesystem on %s", part.FileSystem, part.Name)
+	}
+
+	fsSize, err := FilesystemSize(part)
+	if err != nil {
+		return fmt.Errorf("failed to read the filesystem size of %s: %w", part.Name, err)
+	}
+
+	if fsSize <= part.Size*512 {
+		return fmt.Errorf("%s (%s) already holds its %s filesystem; nothing to repair",
+			part.Name, FormatBytes(part.Size*512), FormatBytes(fsSize))
+	}
+
+	// gpart resize works in whole sectors, so round up to stay at least as
+	// large as the filesystem
+	sectorSize := deviceSectorSize(disk)
+	newSize := (fsSize + sectorSize - 1) / sectorSize * sectorSize
+	if err := ResizePartition(disk, index, newSize, false); err != nil {
+		return fmt.Errorf("failed to grow %s to its %s filesystem: %w", part.Name, FormatBytes(fsSize), err)
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package partition
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// FstabEntry returns the /etc/fstab line that mounts a partition at
+// mountPoint, or enables it as swap. The device is given as DevicePath
+// chooses it, so with the label preference on the entry keeps working
+// after the disk is renumbered. The root filesystem is checked first at
+// boot and other UFS filesystems after it; the rest aren't checked.
+func FstabEntry(part *Partition, mountPoint string) (string, error) {
+	device := DevicePath(part)
+	fsType := strings.ToLower(part.FileSystem)
+
+	if fsType == "swap" || part.Type == "freebsd-swap" {
+		return fmt.Sprintf("%s\tnone\tswap\tsw\t0\t0", device), nil
+	}
+
+	if mountPoint == "" {
+		return "", fmt.Errorf("a mount point is needed for the fstab entry of %s", part.Name)
+	}
+	if !filepath.IsAbs(mountPoint) || strings.ContainsAny(mountPoint, " \t") {
+		return "", fmt.Errorf("mount point %q must be an absolute path without spaces", mountPoint)
+	}
+
+	switch fsType {
+	case "ufs":
+		pass := 2
+		if mountPoint == "/" {
+			pass = 1
+		}
+		return fmt.Sprintf("%s\t%s\tufs\trw\t%d\t%d", device, mountPoint, pass, pass), nil
+	case "fat32", "ext2", "ext3", "ext4":
+		return fmt.Sprintf("%s\t%s\t%s\trw\t0\t0", device, mountPoint, mountFSType(fsType)), nil
+	case "zfs":
+		return "", fmt.Errorf("%s holds a ZFS pool, whose datasets are mounted by zfs rather than from fstab", part.Name)
+	case "", "unknown":
+		return "", fmt.Errorf("%s has no filesystem pgpart recognises; format it first", part.Name)
+	default:
+		return "", fmt.Errorf("pgpart can't write fstab entries for %s filesystems", part.FileSystem)
+	}
+}
@@ -0,0 +1,40 @@
+package partition
+
+import "testing"
+
+func TestFstabEntry(t *testing.T) {
+	fakeDeviceNodes(t, "/dev/gpt/rootfs")
+	preferLabelsFor(t, true)
+
+	tests := []struct {
+		name       string
+		part       Partition
+		mountPoint string
+		want       string
+		wantErr    bool
+	}{
+		{"root by label", Partition{Name: "ada0p2", Label: "rootfs", FileSystem: "UFS"}, "/", "/dev/gpt/rootfs\t/\tufs\trw\t1\t1", false},
+		{"other ufs", Partition{Name: "ada1p1", FileSystem: "UFS"}, "/data", "/dev/ada1p1\t/data\tufs\trw\t2\t2", false},
+		{"fat32", Partition{Name: "da0s1", FileSystem: "FAT32"}, "/mnt/usb", "/dev/da0s1\t/mnt/usb\tmsdosfs\trw\t0\t0", false},
+		{"ext4", Partition{Name: "ada1p3", FileSystem: "ext4"}, "/mnt/linux", "/dev/ada1p3\t/mnt/linux\text2fs\trw\t0\t0", false},
+		{"swap by type", Partition{Name: "ada0p3", Type: "freebsd-swap"}, "", "/dev/ada0p3\tnone\tswap\tsw\t0\t0", false},
+		{"no mount point", Partition{Name: "ada1p1", FileSystem: "UFS"}, "", "", true},
+		{"relative mount point", Partition{Name: "ada1p1", FileSystem: "UFS"}, "data", "", true},
+		{"mount point with a space", Partition{Name: "ada1p1", FileSystem: "UFS"}, "/my data", "", true},
+		{"zfs", Partition{Name: "ada0p4", FileSystem: "ZFS"}, "/tank", "", true},
+		{"unformatted", Partition{Name: "ada2p1", FileSystem: "unknown"}, "/mnt", "", true},
+		{"ntfs", Partition{Name: "ada1p2", FileSystem: "NTFS"}, "/mnt/win", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := FstabEntry(&tt.part, tt.mountPoint)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("FstabEntry() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("FstabEntry() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,191 @@
+package partition
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// GELI encryption states of a partition
+const (
+	GELINone     = ""
+	GELIAttached = "attached"
+	GELIDetached = "detached"
+)
+
+// IsGELIProvider reports whether fstyp detected GELI metadata on a partition
+func IsGELIProvider(part *Partition) bool {
+	return strings.EqualFold(part.FileSystem, "geli")
+}
+
+// GELIStatus returns GELIAttached or GELIDetached for a GELI-encrypted
+// partition, depending on whether its .eli provider exists, and GELINone
+// for any other partition
+func GELIStatus(part *Partition) string {
+	if !IsGELIProvider(part) {
+		return GELINone
+	}
+
+	if fakeDisks != nil {
+		return fakeDisks.geliStatus(part.Name)
+	}
+
+	if _, err := os.Stat("/dev/" + part.Name + ".eli"); err == nil {
+		return GELIAttached
+	}
+	return GELIDetached
+}
+
+// geliSectorSize is the sector size InitGELI gives new providers. 4096
+// bytes halves the encryption overhead of 512-byte sectors and suits
+// modern disks.
+const geliSectorSize = 4096
+
+// minGELIPassphrase is the shortest passphrase InitGELI accepts
+const minGELIPassphrase = 8
+
+// InitGELI encrypts a partition with GELI, protecting its key with
+// passphrase. Everything on the partition is lost. The new provider is
+// left detached; AttachGELI makes its decrypted .eli provider available
+// for formatting. geli keeps a backup of the metadata in /var/backups.
+// The passphrase is passed on stdin, so it appears in no command line,
+// dry-run output or log.
+func InitGELI(partName, passphrase string) error {
+	if err := CheckPrivileges(); err != nil {
+		return err
+	}
+	defer markDisksChanged()
+
+	if len(passphrase) < minGELIPassphrase {
+		return fmt.Errorf("the passphrase must be at least %d characters long", minGELIPassphrase)
+	}
+
+	if err := CheckNotInFlight(partName); err != nil {
+		return err
+	}
+	if err := checkNotMounted(partName); err != nil {
+		return err
+	}
+	if active, err := IsSwapActive(partName); err == nil && active {
+		return fmt.Errorf("%s is in use as swap; disable it before encrypting", partName)
+	}
+
+	// -J - reads the passphrase from stdin instead of asking for it twice
+	// on a terminal
+	cmd := exec.Command("geli", "init", "-J", "-", "-s", strconv.Itoa(geliSectorSize), "/dev/"+partName)
+	if dryRun(cmd) {
+		return nil
+	}
+
+	if fakeDisks != nil {
+		return fakeDisks.initGELI(partName)
+	}
+
+	cmd.Stdin = strings.NewReader(passphrase)
+	output, err := runCommand(cmd)
+	if err != nil {
+		return ExplainDiskGone(partName, fmt.Errorf("failed to encrypt %s: %w (output: %s)", partName, err, strings.TrimSpace(string(output))))
+	}
+
+	return nil
+}
+
+// AttachGELI attaches a GELI provider with a passphrase and returns the
+// name of the decrypted .eli provider
+func AttachGELI(partName, passphrase string) (string, error) {
+	if err := CheckPrivileges(); err != nil {
+		return "", err
+	}
+	defer markDisksChanged()
+
+	if fakeDisks != nil {
+		return fakeDisks.attachGELI(partName, passphrase)
+	}
+
+	// -j - reads the passphrase from stdin rather than prompting on a terminal
+	cmd := exec.Command("geli", "attach", "-j", "-", "/dev/"+partName)
+	cmd.Stdin = strings.NewReader(passphrase)
+	output, err := runCommand(cmd)
+	if err != nil {
+		return "", ExplainDiskGone(partName, fmt.Errorf("failed to attach %s: %w (output: %s)", partName, err, string(output)))
+	}
+
+	return partName + ".eli", nil
+}
+
+// DetachGELI detaches the decrypted .eli provider of a GELI-encrypted
+// partition, locking it again. A mounted .eli provider is refused.
+func DetachGELI(partName string) error {
+	if err := CheckPrivileges(); err != nil {
+		return err
+	}
+	defer markDisksChanged()
+
+	provider := partName + ".eli"
+	if err := checkNotMounted(provider); err != nil {
+		return err
+	}
+
+	cmd := exec.Command("geli", "detach", provider)
+	if dryRun(cmd) {
+		return nil
+	}
+
+	if fakeDisks != nil {
+		return fakeDisks.detachGELI(partName)
+	}
+
+	output, err := runCommand(cmd)
+	if err != nil {
+		return ExplainDiskGone(partName, fmt.Errorf("failed to detach %s: %w (output: %s)", provider, err, strings.TrimSpace(string(output))))
+	}
+
+	return nil
+}
+
+// AttachAllGELI attaches every detached GELI provider on a disk with the
+// same passphrase and returns the .eli providers of all its encrypted
+// partitions, including those that were already attached. Providers that
+// fail to attach, e.g. because they use a different passphrase, are
+// skipped and reported together in the error.
+func AttachAllGELI(disk, passphrase string) ([]string, error) {
+	if err := CheckPrivileges(); err != nil {
+		return nil, err
+	}
+
+	partitions, _, err := getPartitionTable(disk)
+	if err != nil {
+		return nil, err
+	}
+
+	var providers, failures []string
+	found := 0
+	for i := range partitions {
+		part := &partitions[i]
+		switch GELIStatus(part) {
+		case GELIAttached:
+			found++
+			providers = append(providers, part.Name+".eli")
+		case GELIDetached:
+			found++
+			provider, err := AttachGELI(part.Name, passphrase)
+			if err != nil {
+				failures = append(failures, err.Error())
+				continue
+			}
+			providers = append(providers, provider)
+		}
+	}
+
+	if found == 0 {
+		return nil, fmt.Errorf("no GELI-encrypted partitions found on %s", disk)
+	}
+	if len(failures) > 0 {
+		return providers, fmt.Errorf("%d of %d encrypted partition(s) could not be attached:\n%s",
+			len(failures), found, strings.Join(failures, "\n"))
+	}
+
+	return providers, nil
+}
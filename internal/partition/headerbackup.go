@@ -0,0 +1,129 @@
+package partition
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// DefaultHeaderBackupMB is how much of a partition is saved before it is
+// formatted: enough for the boot sector, superblock or volume header of
+// every supported filesystem
+const DefaultHeaderBackupMB = 16
+
+// BackupPartitionHeader copies the first mb megabytes of a partition to a
+// new file in the state directory (see StateDir) with dd and returns its
+// path. The file is the caller's to remove; OperationHistory removes the
+// backups of its format entries when they are dropped. In dry run mode the
+// dd command is printed and the returned path is empty.
+func BackupPartitionHeader(partName string, mb int) (string, error) {
+	if err := CheckPrivileges(); err != nil {
+		return "", err
+	}
+
+	if mb <= 0 {
+		return "", fmt.Errorf("header backup size must be at least 1 MB, got %d", mb)
+	}
+
+	dir, err := StateDir()
+	if err != nil {
+		return "", err
+	}
+	file, err := os.CreateTemp(dir, "header-"+partName+"-*.img")
+	if err != nil {
+		return "", fmt.Errorf("failed to create header backup file: %w", err)
+	}
+	path := file.Name()
+	file.Close()
+
+	cmd := exec.Command("dd", "if=/dev/"+partName, "of="+path, "bs=1m", "count="+strconv.Itoa(mb))
+	if dryRun(cmd) {
+		os.Remove(path)
+		return "", nil
+	}
+
+	if fakeDisks != nil {
+		if err := fakeDisks.backupPartitionHeader(partName, path); err != nil {
+			os.Remove(path)
+			return "", err
+		}
+		return path, nil
+	}
+
+	output, err := runCommand(cmd)
+	if err != nil {
+		os.Remove(path)
+		return "", ExplainDiskGone(partName, fmt.Errorf("failed to back up the header of %s: %w (output: %s)",
+			partName, err, strings.TrimSpace(string(output))))
+	}
+
+	return path, nil
+}
+
+// RestorePartitionHeader writes a header saved by BackupPartitionHeader back
+// to the start of a partition. This only restores what was in the saved
+// megabytes, i.e. the old filesystem's metadata at the start of the
+// partition. Metadata the format rewrote further in, such as UFS cylinder
+// groups or ext inode tables, and any file data it overwrote stay lost, so
+// the old filesystem may need fsck or recovery tools before it mounts.
+func RestorePartitionHeader(partName, backupPath string) error {
+	if err := CheckPrivileges(); err != nil {
+		return err
+	}
+	defer markDisksChanged()
+
+	if err := CheckNotInFlight(partName); err != nil {
+		return err
+	}
+	if err := checkNotMounted(partName); err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(backupPath); err != nil {
+		return fmt.Errorf("header backup of %s is gone: %w", partName, err)
+	}
+
+	cmd := exec.Command("dd", "if="+backupPath, "of=/dev/"+partName, "bs=1m")
+	if dryRun(cmd) {
+		return nil
+	}
+
+	if fakeDisks != nil {
+		return fakeDisks.restorePartitionHeader(partName, backupPath)
+	}
+
+	output, err := runCommand(cmd)
+	if err != nil {
+		return ExplainDiskGone(partName, fmt.Errorf("failed to restore the header of %s: %w (output: %s)",
+			partName, err, strings.TrimSpace(string(output))))
+	}
+
+	return nil
+}
+
+// FormatPartitionWithHeaderBackup saves the first backupMB megabytes of a
+// partition with BackupPartitionHeader before formatting it, so that
+// RestorePartitionHeader can bring back the old filesystem's metadata. It
+// returns the path of the backup, which is removed again if formatting
+// fails. progress and logger are passed on to FormatPartitionWithLog.
+func FormatPartitionWithHeaderBackup(partition string, fsType string, opts FormatOptions, backupMB int, progress ProgressReporter, logger OperationLogger) (string, error) {
+	if _, err := checkFormat(partition, fsType, opts, false); err != nil {
+		return "", err
+	}
+
+	backupPath, err := BackupPartitionHeader(partition, backupMB)
+	if err != nil {
+		return "", err
+	}
+
+	if err := FormatPartitionWithLog(partition, fsType, opts, false, progress, logger); err != nil {
+		if backupPath != "" {
+			os.Remove(backupPath)
+		}
+		return "", err
+	}
+
+	return backupPath, nil
+}
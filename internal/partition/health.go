@@ -0,0 +1,85 @@
+package partition
+
+import "sync"
+
+// maxParallelSMARTQueries bounds how many disks CheckDisksHealth queries at
+// once, so a large enclosure doesn't start dozens of smartctl processes
+const maxParallelSMARTQueries = 8
+
+// DiskHealth is the SMART health summary of one disk, as printed by
+// pgpart health
+type DiskHealth struct {
+	Disk              string `json:"disk"`
+	SMARTStatus       string `json:"smart_status"`
+	Health            string `json:"health"`
+	Temperature       int    `json:"temperature_celsius"`
+	PowerOnHours      uint64 `json:"power_on_hours"`
+	FailingAttributes int    `json:"failing_attributes"`
+	WarningAttributes int    `json:"warning_attributes"`
+	Error             string `json:"error,omitempty"`
+}
+
+// Failed reports whether the disk failed its SMART self-assessment or has
+// an attribute past its threshold
+func (h DiskHealth) Failed() bool {
+	return h.SMARTStatus == "FAILED" || h.FailingAttributes > 0
+}
+
+// NewDiskHealth summarizes the SMART data in info
+func NewDiskHealth(info *DiskInfo) DiskHealth {
+	health := DiskHealth{
+		Disk:         info.Device,
+		SMARTStatus:  info.SMARTStatus,
+		Health:       info.HealthLevel(),
+		Temperature:  info.Temperature,
+		PowerOnHours: info.PowerOnHours,
+	}
+	if health.SMARTStatus == "" {
+		health.SMARTStatus = "UNKNOWN"
+	}
+
+	for _, attr := range info.Attributes {
+		switch attr.Status {
+		case "FAILING":
+			health.FailingAttributes++
+		case "WARNING":
+			health.WarningAttributes++
+		}
+	}
+
+	return health
+}
+
+// CheckDisksHealth queries the SMART data of every disk in parallel and
+// returns their summaries in the order of disks. A disk whose data can't
+// be read is reported with HealthUnknown and the error.
+func CheckDisksHealth(disks []Disk) []DiskHealth {
+	results := make([]DiskHealth, len(disks))
+	limit := make(chan struct{}, maxParallelSMARTQueries)
+
+	var wg sync.WaitGroup
+	for i := range disks {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			limit <- struct{}{}
+			defer func() { <-limit }()
+
+			info, err := GetDetailedDiskInfo(disks[i].Name)
+			if err != nil {
+				results[i] = DiskHealth{
+					Disk:        disks[i].Name,
+					SMARTStatus: "UNKNOWN",
+					Health:      HealthUnknown,
+					Error:       err.Error(),
+				}
+				return
+			}
+			results[i] = NewDiskHealth(info)
+			results[i].Disk = disks[i].Name
+		}(i)
+	}
+	wg.Wait()
+
+	return results
+}
@@ -2,6 +2,7 @@ package partition
 
 import (
 	"fmt"
+	"os"
 	"sync"
 	"time"
 )
@@ -30,10 +31,23 @@ type HistoryEntry struct {
 	OldSize   uint64
 	OldFSType string
 
+	// FilesystemResized is true if a resize also grew or shrank the
+	// filesystem, so replaying it on the partition alone is unsafe
+	FilesystemResized bool
+
 	// Attribute operation details
 	Partition     string
 	AttributeName string
 	AttributeSet  bool // true if attribute was set, false if unset
+
+	// Type change details
+	OldType string
+	NewType string
+
+	// Format details. HeaderBackup is the file BackupPartitionHeader saved
+	// the start of the partition to before formatting, "" if there is none.
+	FormatOptions FormatOptions
+	HeaderBackup  string
 }
 
 // OperationHistory manages the history of partition operations
@@ -53,15 +67,31 @@ func NewOperationHistory() *OperationHistory {
 	}
 }
 
+// dropRedoLocked removes the entries after the current position, which a
+// new operation leaves nothing to redo, along with their header backups.
+// The caller must hold oh.mu.
+func (oh *OperationHistory) dropRedoLocked() {
+	if oh.currentPos < len(oh.entries)-1 {
+		removeHeaderBackups(oh.entries[oh.currentPos+1:])
+		oh.entries = oh.entries[:oh.currentPos+1]
+	}
+}
+
+// removeHeaderBackups deletes the header backup files of entries
+func removeHeaderBackups(entries []*HistoryEntry) {
+	for _, entry := range entries {
+		if entry.HeaderBackup != "" {
+			os.Remove(entry.HeaderBackup)
+		}
+	}
+}
+
 // RecordCreate records a partition creation operation
 func (oh *OperationHistory) RecordCreate(disk, index string, size uint64, fsType string) {
 	oh.mu.Lock()
 	defer oh.mu.Unlock()
 
-	// Remove any entries after current position (invalidate redo)
-	if oh.currentPos < len(oh.entries)-1 {
-		oh.entries = oh.entries[:oh.currentPos+1]
-	}
+	oh.dropRedoLocked()
 
 	entry := &HistoryEntry{
 		ID:            oh.nextID,
@@ -89,9 +119,7 @@ func (oh *OperationHistory) RecordDelete(disk, index string, size uint64, fsType
 	oh.mu.Lock()
 	defer oh.mu.Unlock()
 
-	if oh.currentPos < len(oh.entries)-1 {
-		oh.entries = oh.entries[:oh.currentPos+1]
-	}
+	oh.dropRedoLocked()
 
 	entry := &HistoryEntry{
 		ID:          oh.nextID,
@@ -111,25 +139,31 @@ func (oh *OperationHistory) RecordDelete(disk, index string, size uint64, fsType
 	oh.nextID++
 }
 
-// RecordFormat records a partition format operation
-func (oh *OperationHistory) RecordFormat(partition, oldFSType, newFSType string) {
+// RecordFormat records a partition format operation. A format is only
+// reversible when headerBackup names a header saved by
+// BackupPartitionHeader, and undoing it only restores the old filesystem's
+// metadata, not data the format overwrote.
+func (oh *OperationHistory) RecordFormat(partition, oldFSType, newFSType string, opts FormatOptions, headerBackup string) {
 	oh.mu.Lock()
 	defer oh.mu.Unlock()
 
-	if oh.currentPos < len(oh.entries)-1 {
-		oh.entries = oh.entries[:oh.currentPos+1]
-	}
+	oh.dropRedoLocked()
 
 	entry := &HistoryEntry{
-		ID:          oh.nextID,
-		Timestamp:   time.Now(),
-		Operation:   "format",
-		Description: fmt.Sprintf("Formatted %s from %s to %s", partition, oldFSType, newFSType),
-		Reversible:  false, // Cannot restore data
-		Reversed:    false,
-		Disk:        partition,
-		FSType:      newFSType,
-		OldFSType:   oldFSType,
+		ID:            oh.nextID,
+		Timestamp:     time.Now(),
+		Operation:     "format",
+		Description:   fmt.Sprintf("Formatted %s from %s to %s", partition, oldFSType, newFSType),
+		Reversible:    headerBackup != "", // Only the header can be restored
+		Reversed:      false,
+		Disk:          partition,
+		FSType:        newFSType,
+		OldFSType:     oldFSType,
+		FormatOptions: opts,
+		HeaderBackup:  headerBackup,
+	}
+	if headerBackup != "" {
+		entry.UndoOperation = "restoreheader"
 	}
 
 	oh.entries = append(oh.entries, entry)
@@ -137,20 +171,24 @@ func (oh *OperationHistory) RecordFormat(partition, oldFSType, newFSType string)
 	oh.nextID++
 }
 
-// RecordResize records a partition resize operation
-func (oh *OperationHistory) RecordResize(disk, index string, oldSize, newSize uint64) {
+// RecordResize records a partition resize operation. filesystemResized
+// reports whether the filesystem was resized along with the partition.
+func (oh *OperationHistory) RecordResize(disk, index string, oldSize, newSize uint64, filesystemResized bool) {
 	oh.mu.Lock()
 	defer oh.mu.Unlock()
 
-	if oh.currentPos < len(oh.entries)-1 {
-		oh.entries = oh.entries[:oh.currentPos+1]
+	oh.dropRedoLocked()
+
+	description := fmt.Sprintf("Resized %s%s from %.2f GB to %.2f GB", disk, index, float64(oldSize)/(1024*1024*1024), float64(newSize)/(1024*1024*1024))
+	if filesystemResized {
+		description += " (with filesystem)"
 	}
 
 	entry := &HistoryEntry{
 		ID:            oh.nextID,
 		Timestamp:     time.Now(),
 		Operation:     "resize",
-		Description:   fmt.Sprintf("Resized %s%s from %.2f GB to %.2f GB", disk, index, float64(oldSize)/(1024*1024*1024), float64(newSize)/(1024*1024*1024)),
+		Description:   description,
 		Reversible:    true,
 		Reversed:      false,
 		UndoOperation: "resize",
@@ -161,6 +199,8 @@ func (oh *OperationHistory) RecordResize(disk, index string, oldSize, newSize ui
 		Index:         index,
 		Size:          newSize,
 		OldSize:       oldSize,
+
+		FilesystemResized: filesystemResized,
 	}
 
 	oh.entries = append(oh.entries, entry)
@@ -173,9 +213,7 @@ func (oh *OperationHistory) RecordCopy(source, dest string, size uint64) {
 	oh.mu.Lock()
 	defer oh.mu.Unlock()
 
-	if oh.currentPos < len(oh.entries)-1 {
-		oh.entries = oh.entries[:oh.currentPos+1]
-	}
+	oh.dropRedoLocked()
 
 	entry := &HistoryEntry{
 		ID:          oh.nextID,
@@ -199,9 +237,7 @@ func (oh *OperationHistory) RecordAttributeChange(partition, attribute string, w
 	oh.mu.Lock()
 	defer oh.mu.Unlock()
 
-	if oh.currentPos < len(oh.entries)-1 {
-		oh.entries = oh.entries[:oh.currentPos+1]
-	}
+	oh.dropRedoLocked()
 
 	var action string
 	if nowSet {
@@ -228,6 +264,53 @@ func (oh *OperationHistory) RecordAttributeChange(partition, attribute string, w
 	oh.nextID++
 }
 
+// RecordTypeChange records a change of a partition's type
+func (oh *OperationHistory) RecordTypeChange(partition, oldType, newType string) {
+	oh.mu.Lock()
+	defer oh.mu.Unlock()
+
+	oh.dropRedoLocked()
+
+	entry := &HistoryEntry{
+		ID:            oh.nextID,
+		Timestamp:     time.Now(),
+		Operation:     "settype",
+		Description:   fmt.Sprintf("Changed type of %s from %s to %s", partition, oldType, newType),
+		Reversible:    true, // Only the table entry changes
+		Reversed:      false,
+		UndoOperation: "settype",
+		Partition:     partition,
+		OldType:       oldType,
+		NewType:       newType,
+	}
+
+	oh.entries = append(oh.entries, entry)
+	oh.currentPos = len(oh.entries) - 1
+	oh.nextID++
+}
+
+// CheckResizeReplay returns an error if undoing (or, with undo false,
+// redoing) a resize entry would shrink the partition below a filesystem that
+// was resized with it. Only the partition is resized on undo/redo, so the
+// filesystem has to be shrunk by hand first.
+func (e *HistoryEntry) CheckResizeReplay(undo bool) error {
+	if e.Operation != "resize" || !e.FilesystemResized {
+		return nil
+	}
+
+	from, to := e.OldSize, e.Size
+	if undo {
+		from, to = e.Size, e.UndoSize
+	}
+
+	if to < from {
+		return fmt.Errorf("the filesystem on %s%s was resized to %s along with the partition; shrinking the partition to %s would cut off the filesystem. Shrink the filesystem first, then resize the partition",
+			e.Disk, e.Index, FormatBytes(from), FormatBytes(to))
+	}
+
+	return nil
+}
+
 // CanUndo returns true if there is an operation to undo
 func (oh *OperationHistory) CanUndo() bool {
 	oh.mu.RLock()
@@ -344,11 +427,14 @@ func (oh *OperationHistory) RestoreReversedState(entryID int, reversed bool) {
 	}
 }
 
-// Clear clears the entire history
+// Clear clears the entire history and removes the header backups saved
+// for it. Call it when the application exits, since the backups can only
+// be restored through the history.
 func (oh *OperationHistory) Clear() {
 	oh.mu.Lock()
 	defer oh.mu.Unlock()
 
+	removeHeaderBackups(oh.entries)
 	oh.entries = make([]*HistoryEntry, 0)
 	oh.currentPos = -1
 }
@@ -0,0 +1,48 @@
+package partition
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// headerBackupFile creates a stand-in for a saved header
+func headerBackupFile(t *testing.T, name string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte("header"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func TestHistoryRemovesDroppedHeaderBackups(t *testing.T) {
+	first := headerBackupFile(t, "header-ada1p1.img")
+	second := headerBackupFile(t, "header-ada1p2.img")
+
+	oh := NewOperationHistory()
+	oh.RecordFormat("ada1p1", "UFS", "ext4", FormatOptions{}, first)
+	oh.RecordFormat("ada1p2", "UFS", "FAT32", FormatOptions{}, second)
+
+	if _, err := oh.GetUndoOperation(); err != nil {
+		t.Fatal(err)
+	}
+	// A new operation replaces the undone format, which can't be redone
+	oh.RecordTypeChange("ada1p3", "freebsd-ufs", "linux-data")
+	if exists(second) {
+		t.Error("header backup of the dropped format was kept")
+	}
+	if !exists(first) {
+		t.Error("header backup of a format still in the history was removed")
+	}
+
+	oh.Clear()
+	if exists(first) {
+		t.Error("Clear kept a header backup")
+	}
+}
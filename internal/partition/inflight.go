@@ -0,0 +1,160 @@
+package partition
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// InFlightOperation is a long-running operation, such as a copy, that holds
+// partitions which must not be modified until it finishes
+type InFlightOperation struct {
+	ID          int
+	Description string
+	Partitions  []string
+}
+
+var inFlight = struct {
+	sync.Mutex
+	nextID   int
+	ops      map[int]*InFlightOperation
+	onChange func()
+}{ops: make(map[int]*InFlightOperation)}
+
+// OnInFlightChange registers fn to be called whenever an in-flight operation
+// starts or finishes, e.g. to refresh the UI. It replaces any earlier callback.
+func OnInFlightChange(fn func()) {
+	inFlight.Lock()
+	defer inFlight.Unlock()
+	inFlight.onChange = fn
+}
+
+// beginInFlight registers an operation holding the given partitions. It
+// fails if any of them is already held by another operation. The returned
+// function must be called when the operation finishes.
+func beginInFlight(description string, partitions ...string) (func(), error) {
+	inFlight.Lock()
+	for _, name := range partitions {
+		if op := findInFlightLocked(name); op != nil {
+			inFlight.Unlock()
+			return nil, inFlightError(name, op)
+		}
+	}
+
+	inFlight.nextID++
+	id := inFlight.nextID
+	inFlight.ops[id] = &InFlightOperation{
+		ID:          id,
+		Description: description,
+		Partitions:  partitions,
+	}
+	onChange := inFlight.onChange
+	inFlight.Unlock()
+
+	if onChange != nil {
+		onChange()
+	}
+
+	return func() {
+		inFlight.Lock()
+		delete(inFlight.ops, id)
+		onChange := inFlight.onChange
+		inFlight.Unlock()
+
+		if onChange != nil {
+			onChange()
+		}
+	}, nil
+}
+
+// findInFlightLocked returns the operation holding partName, if any. The
+// caller must hold inFlight.
+func findInFlightLocked(partName string) *InFlightOperation {
+	for _, op := range inFlight.ops {
+		for _, name := range op.Partitions {
+			if name == partName {
+				return op
+			}
+		}
+	}
+	return nil
+}
+
+// inFlightError explains that partName is held by op
+func inFlightError(partName string, op *InFlightOperation) error {
+	return fmt.Errorf("%s is in use by an operation in progress (%s); wait for it to finish", partName, op.Description)
+}
+
+// InFlightOperationFor returns the operation holding partName, if any
+func InFlightOperationFor(partName string) (InFlightOperation, bool) {
+	inFlight.Lock()
+	defer inFlight.Unlock()
+
+	if op := findInFlightLocked(partName); op != nil {
+		return *op, true
+	}
+	return InFlightOperation{}, false
+}
+
+// GetInFlightOperations returns all operations in progress, oldest first
+func GetInFlightOperations() []InFlightOperation {
+	inFlight.Lock()
+	defer inFlight.Unlock()
+
+	ops := make([]InFlightOperation, 0, len(inFlight.ops))
+	for _, op := range inFlight.ops {
+		ops = append(ops, *op)
+	}
+	sort.Slice(ops, func(i, j int) bool { return ops[i].ID < ops[j].ID })
+	return ops
+}
+
+// CheckNotInFlight returns an error if partName is the source or
+// destination of an operation in progress
+func CheckNotInFlight(partName string) error {
+	inFlight.Lock()
+	defer inFlight.Unlock()
+
+	if op := findInFlightLocked(partName); op != nil {
+		return inFlightError(partName, op)
+	}
+	return nil
+}
+
+// checkIndexNotInFlight is CheckNotInFlight for a partition given by disk
+// and gpart index, which may be a GPT (p) or MBR (s) partition, or a BSD
+// label partition given by slice and letter such as 1a. An operation
+// holding the whole disk, such as a wipe or a clone, holds the partition too.
+func checkIndexNotInFlight(disk, index string) error {
+	if err := CheckNotInFlight(disk); err != nil {
+		return err
+	}
+	if name, ok := bsdLabelPartitionName(disk, index); ok {
+		return CheckNotInFlight(name)
+	}
+	for _, sep := range []string{"p", "s"} {
+		if err := CheckNotInFlight(disk + sep + index); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CheckDiskNotInFlight returns an error if disk itself or any partition on
+// it is held by an operation in progress
+func CheckDiskNotInFlight(disk string) error {
+	inFlight.Lock()
+	defer inFlight.Unlock()
+
+	for _, op := range inFlight.ops {
+		for _, name := range op.Partitions {
+			if name == disk {
+				return inFlightError(name, op)
+			}
+			if d, _, err := ParsePartitionName(name); err == nil && d == disk {
+				return inFlightError(name, op)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package partition
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWholeDiskInFlightHoldsItsPartitions(t *testing.T) {
+	fake := useFakeRunner(t)
+	fake.Respond("diskinfo -v ada0", diskinfoVerbose("ada0", 512), nil)
+
+	// A wipe or a same-size clone of the disk holds just its name
+	release, err := beginInFlight("wiping ada0", "ada0")
+	if err != nil {
+		t.Fatalf("beginInFlight: %v", err)
+	}
+	defer release()
+
+	refused := map[string]func() error{
+		"delete": func() error { return DeletePartition("ada0", "1", false) },
+		"resize": func() error { return ResizePartition("ada0", "1", 1<<30, false) },
+		"create": func() error { return CreatePartition("ada0", 1<<30, "freebsd-ufs") },
+		"format": func() error { return FormatPartition("ada0p1", "ufs", false) },
+	}
+	for name, op := range refused {
+		if err := op(); err == nil || !strings.Contains(err.Error(), "wiping ada0") {
+			t.Errorf("%s on ada0 while it is being wiped = %v, want the in-flight error", name, err)
+		}
+	}
+	if cmds := gpartLines(fake.Lines(), "gpart "); len(cmds) != 0 {
+		t.Errorf("ran %q while ada0 was held", cmds)
+	}
+
+	if err := CheckDiskNotInFlight("ada0"); err == nil {
+		t.Error("CheckDiskNotInFlight(ada0) succeeded while ada0 is held")
+	}
+	if err := CheckDiskNotInFlight("ada1"); err != nil {
+		t.Errorf("CheckDiskNotInFlight(ada1) = %v, want nil", err)
+	}
+}
@@ -0,0 +1,133 @@
+package partition
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// maxGPTLabelLength is the size of the GPT partition name field in UTF-16
+// code units
+const maxGPTLabelLength = 36
+
+// ValidateGPTLabel checks that a label can be stored by gpart and referenced
+// as /dev/gpt/<label>. The UEFI spec allows any UTF-16 text, but labels
+// become device paths on FreeBSD, so only letters, digits and ._:- are
+// accepted.
+func ValidateGPTLabel(label string) error {
+	if label == "" {
+		return fmt.Errorf("label cannot be empty")
+	}
+
+	if len(label) > maxGPTLabelLength {
+		return fmt.Errorf("label %q is too long (%d characters, maximum is %d)", label, len(label), maxGPTLabelLength)
+	}
+
+	for _, r := range label {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '.', r == '_', r == ':', r == '-':
+		case r == ' ':
+			return fmt.Errorf("label %q contains a space, which breaks /dev/gpt/ references", label)
+		case r == '/':
+			return fmt.Errorf("label %q contains '/', which would create a subdirectory under /dev/gpt/", label)
+		default:
+			return fmt.Errorf("label %q contains %q; only letters, digits and . _ : - are allowed", label, r)
+		}
+	}
+
+	if label == "." || label == ".." {
+		return fmt.Errorf("label %q is not a valid device name", label)
+	}
+
+	return nil
+}
+
+// SetPartitionLabel changes the GPT label of a partition with gpart modify.
+// The partition and its data are left alone, but /dev/gpt/<label> follows
+// the new label, so fstab entries using the old one must be updated.
+func SetPartitionLabel(partName, label string) error {
+	if err := CheckPrivileges(); err != nil {
+		return err
+	}
+	defer markDisksChanged()
+
+	if err := ValidateGPTLabel(label); err != nil {
+		return err
+	}
+
+	disk, index, err := ParsePartitionName(partName)
+	if err != nil {
+		return err
+	}
+
+	if err := CheckNotInFlight(partName); err != nil {
+		return err
+	}
+
+	cmd := exec.Command("gpart", "modify", "-i", index, "-l", label, disk)
+	if dryRun(cmd) {
+		return nil
+	}
+
+	if fakeDisks != nil {
+		return fakeDisks.setPartitionLabel(partName, label)
+	}
+
+	output, err := runCommand(cmd)
+	if err != nil {
+		return ExplainDiskGone(disk, fmt.Errorf("failed to set the label of %s: %w (output: %s)",
+			partName, err, strings.TrimSpace(string(output))))
+	}
+
+	return nil
+}
+
+// getPartitionLabels returns the labels of a disk's partitions by name.
+// Labels are extras, so a disk whose labels can't be read gets none
+// rather than failing detection.
+func getPartitionLabels(diskName string) map[string]string {
+	output, err := Runner.Run("gpart", "show", "-lp", diskName)
+	if err != nil {
+		return nil
+	}
+	return parseGpartLabels(string(output))
+}
+
+// parseGpartLabels reads gpart show -lp output, in which the label takes
+// the place of the partition type:
+//
+//	=>      40  976773088  ada0  GPT  (466G)
+//	        40       1024  ada0p1  gptboot0  (512K)
+//	      1064        984          - free -  (492K)
+//	      2048    4194304  ada0p2  (null)  (2.0G)
+//
+// Partitions without a label, shown as (null), are left out, as are the
+// [active] and similar flags of MBR slices.
+func parseGpartLabels(output string) map[string]string {
+	labels := make(map[string]string)
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 4 {
+			continue
+		}
+		if _, err := strconv.ParseUint(fields[0], 10, 64); err != nil {
+			continue
+		}
+		name := fields[2]
+		if name == "-" {
+			continue
+		}
+
+		end := len(fields)
+		for end > 3 && (strings.HasPrefix(fields[end-1], "(") && fields[end-1] != "(null)" || strings.HasPrefix(fields[end-1], "[")) {
+			end--
+		}
+		label := strings.Join(fields[3:end], " ")
+		if label != "" && label != "(null)" {
+			labels[name] = label
+		}
+	}
+	return labels
+}
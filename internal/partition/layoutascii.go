@@ -0,0 +1,146 @@
+package partition
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// layoutBarWidth is the number of characters in the layout bar
+const layoutBarWidth = 64
+
+// minLayoutGap is the smallest unpartitioned gap RenderLayoutASCII shows,
+// in 512-byte units; smaller gaps are alignment padding
+const minLayoutGap = 2048
+
+// layoutSegment is a partition or a free gap in a rendered layout
+type layoutSegment struct {
+	start, size uint64 // 512-byte units
+	part        *Partition
+	key         byte // character drawn for the segment in the bar
+}
+
+// RenderLayoutASCII renders a disk's layout as text for bug reports and
+// records: a bar showing where each partition and free gap lies, followed
+// by a table with their offsets, sizes, types, filesystems and mount points
+func RenderLayoutASCII(disk Disk) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "%s  %s", disk.Name, FormatBytes(disk.Size))
+	if disk.Scheme != "" {
+		fmt.Fprintf(&b, "  %s", disk.Scheme)
+	}
+	if disk.Model != "" {
+		fmt.Fprintf(&b, "  %s", disk.Model)
+	}
+	b.WriteString("\n")
+
+	if disk.Scheme == "" {
+		b.WriteString("(no partition table)\n")
+		return b.String()
+	}
+
+	segments := layoutSegments(disk)
+	b.WriteString("[" + renderLayoutBar(segments) + "]\n\n")
+
+	var table strings.Builder
+	w := tabwriter.NewWriter(&table, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "KEY\tSTART\tSIZE\tNAME\tTYPE\tFILESYSTEM\tMOUNT\tLABEL")
+	for _, seg := range segments {
+		if seg.part == nil {
+			fmt.Fprintf(w, "%c\t%d\t%s\t- free -\t\t\t\t\n", seg.key, seg.start, FormatBytes(seg.size*512))
+			continue
+		}
+		part := seg.part
+		size := FormatBytes(part.Size * 512)
+		if part.SizeUnknown {
+			size = "unknown"
+		}
+		fmt.Fprintf(w, "%c\t%d\t%s\t%s\t%s\t%s\t%s\t%s\n", seg.key, part.Start, size, part.Name,
+			part.Type, orDash(part.FileSystem), orDash(part.MountPoint), orDash(part.Label))
+	}
+	w.Flush()
+
+	// Free rows leave the trailing columns empty
+	for _, line := range strings.Split(strings.TrimRight(table.String(), "\n"), "\n") {
+		b.WriteString(strings.TrimRight(line, " ") + "\n")
+	}
+	return b.String()
+}
+
+// layoutSegments returns the partitions of a disk and the free gaps
+// between them in disk order. Partitions are keyed 1-9 then a-z, free
+// space with '.'.
+func layoutSegments(disk Disk) []layoutSegment {
+	parts := make([]*Partition, len(disk.Partitions))
+	for i := range disk.Partitions {
+		parts[i] = &disk.Partitions[i]
+	}
+	sort.Slice(parts, func(i, j int) bool { return parts[i].Start < parts[j].Start })
+
+	var segments []layoutSegment
+	addGap := func(start, end uint64) {
+		if end > start && end-start >= minLayoutGap {
+			segments = append(segments, layoutSegment{start: start, size: end - start, key: '.'})
+		}
+	}
+
+	const keys = "123456789abcdefghijklmnopqrstuvwxyz"
+	cursor := uint64(gptFirstUsableSector)
+	for i, part := range parts {
+		addGap(cursor, part.Start)
+		key := byte('#')
+		if i < len(keys) {
+			key = keys[i]
+		}
+		segments = append(segments, layoutSegment{start: part.Start, size: part.Size, part: part, key: key})
+		if part.End > cursor {
+			cursor = part.End
+		}
+	}
+	if disk.Size/512 > gptBackupSectors {
+		addGap(cursor, disk.Size/512-gptBackupSectors)
+	}
+	return segments
+}
+
+// renderLayoutBar draws segments in proportion to the space they span.
+// Every segment gets at least one character so small partitions such as
+// freebsd-boot stay visible.
+func renderLayoutBar(segments []layoutSegment) string {
+	bar := []byte(strings.Repeat(" ", layoutBarWidth))
+	if len(segments) == 0 {
+		return string(bar)
+	}
+
+	first := segments[0].start
+	last := segments[len(segments)-1]
+	total := last.start + last.size - first
+	if total == 0 {
+		return string(bar)
+	}
+
+	pos := 0
+	for i, seg := range segments {
+		end := int((seg.start + seg.size - first) * layoutBarWidth / total)
+		if i == len(segments)-1 {
+			end = layoutBarWidth
+		}
+		if end <= pos {
+			end = pos + 1
+		}
+		for ; pos < end && pos < layoutBarWidth; pos++ {
+			bar[pos] = seg.key
+		}
+	}
+	return string(bar)
+}
+
+// orDash returns s, or "-" when it is empty
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,73 @@
+package partition
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// knownSchemes are the partition schemes gpart can report
+var knownSchemes = map[string]bool{
+	"GPT": true, "MBR": true, "EBR": true, "BSD": true, "BSD64": true,
+	"APM": true, "LDM": true, "VTOC8": true,
+}
+
+// diagnoseLayout works out why no partitions were read from a disk. It
+// returns the scheme gpart reports, if any, and a description of the
+// problem, which is empty when the disk really has no partitions.
+func diagnoseLayout(diskName string) (string, string) {
+	cmd := exec.Command("gpart", "show", "-p", diskName)
+	output, err := runCommand(cmd)
+	return parseLayoutDiagnosis(string(output), err)
+}
+
+// parseLayoutDiagnosis interprets the output of gpart show for a disk
+// without partitions
+func parseLayoutDiagnosis(output string, err error) (string, string) {
+	if err != nil {
+		// gpart knows no geom for a disk without a partition table
+		if strings.Contains(strings.ToLower(output), "no such geom") {
+			return "", ""
+		}
+		return "", fmt.Sprintf("gpart show failed: %v (output: %s)", err, strings.TrimSpace(output))
+	}
+
+	scheme := ""
+	entries := 0
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "=>"):
+			header := strings.Fields(strings.TrimPrefix(line, "=>"))
+			if len(header) >= 4 {
+				scheme = strings.ToUpper(header[3])
+			}
+		case !strings.Contains(line, "- free -"):
+			entries++
+		}
+	}
+
+	switch {
+	case scheme == "":
+		return "", "gpart output has no table header, so the layout could not be read"
+	case !knownSchemes[scheme]:
+		return scheme, fmt.Sprintf("unrecognized partition scheme %s", scheme)
+	case entries > 0:
+		return scheme, fmt.Sprintf("gpart lists %d entr(ies) that could not be parsed", entries)
+	}
+	return scheme, ""
+}
+
+// NoPartitionsReason explains why a disk shows no partitions: it is
+// unpartitioned, its table is empty, or its layout could not be read
+func (d Disk) NoPartitionsReason() string {
+	switch {
+	case d.LayoutProblem != "":
+		return "Failed to read the partition layout: " + d.LayoutProblem
+	case d.Scheme == "":
+		return "gpart reports no partition scheme - the disk is unpartitioned"
+	default:
+		return fmt.Sprintf("The %s partition table is empty", d.Scheme)
+	}
+}
@@ -0,0 +1,183 @@
+package partition
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// Logical sector sizes accepted when attaching a disk image. 512 matches
+// classic and 512e media, 4096 matches 4Kn media.
+const (
+	MinImageSectorSize uint64 = 512
+	MaxImageSectorSize uint64 = 65536
+)
+
+// ValidateSectorSize checks that size is a usable logical sector size: a
+// power of two between MinImageSectorSize and MaxImageSectorSize. Zero
+// means the default and is accepted.
+func ValidateSectorSize(size uint64) error {
+	if size == 0 {
+		return nil
+	}
+	if size < MinImageSectorSize || size > MaxImageSectorSize || size&(size-1) != 0 {
+		return fmt.Errorf("invalid sector size %d: must be a power of two between %d and %d",
+			size, MinImageSectorSize, MaxImageSectorSize)
+	}
+	return nil
+}
+
+// AttachImage attaches a disk image file as an md device and returns the
+// device name, e.g. md0. A non-zero sectorSize sets the logical sector size
+// of the device (mdconfig -S), so an image meant for 4Kn media is laid out
+// with 4096-byte sectors regardless of the host's disks.
+func AttachImage(path string, sectorSize uint64) (string, error) {
+	if err := CheckPrivileges(); err != nil {
+		return "", err
+	}
+	defer markDisksChanged()
+
+	if err := ValidateSectorSize(sectorSize); err != nil {
+		return "", err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("cannot open image: %w", err)
+	}
+	if !info.Mode().IsRegular() {
+		return "", fmt.Errorf("%s is not a regular file", path)
+	}
+	if sectorSize != 0 && uint64(info.Size())%sectorSize != 0 {
+		return "", fmt.Errorf("image size %d is not a multiple of the %d-byte sector size", info.Size(), sectorSize)
+	}
+
+	if fakeDisks != nil {
+		return fakeDisks.attachImage(path, uint64(info.Size()), sectorSize)
+	}
+
+	args := []string{"-a", "-t", "vnode", "-f", path}
+	if sectorSize != 0 {
+		args = append(args, "-S", strconv.FormatUint(sectorSize, 10))
+	}
+
+	cmd := exec.Command("mdconfig", args...)
+	output, err := runCommand(cmd)
+	if err != nil {
+		return "", fmt.Errorf("failed to attach image: %w (output: %s)", err, string(output))
+	}
+
+	return strings.TrimSpace(string(output)), nil
+}
+
+// DetachImage detaches an md device created by AttachImage
+func DetachImage(mdName string) error {
+	if err := CheckPrivileges(); err != nil {
+		return err
+	}
+	defer markDisksChanged()
+
+	if !isMDDevice(mdName) {
+		return fmt.Errorf("%s is not an md device", mdName)
+	}
+
+	if fakeDisks != nil {
+		return fakeDisks.detachImage(mdName)
+	}
+
+	cmd := exec.Command("mdconfig", "-d", "-u", mdName)
+	output, err := runCommand(cmd)
+	if err != nil {
+		return ExplainBusyError(mdName, fmt.Errorf("failed to detach %s: %w (output: %s)", mdName, err, string(output)))
+	}
+
+	return nil
+}
+
+// isMDDevice reports whether name is an md unit such as md0
+func isMDDevice(name string) bool {
+	unit := strings.TrimPrefix(name, "md")
+	if unit == name || unit == "" {
+		return false
+	}
+	_, err := strconv.Atoi(unit)
+	return err == nil
+}
+
+// getImageDisks lists attached md devices as disks. geom md list uses the
+// same layout as geom disk list, with the backing file in place of descr.
+func getImageDisks() []Disk {
+	cmd := exec.Command("geom", "md", "list")
+	output, err := runCommand(cmd)
+	if err != nil {
+		// No md devices attached, or the md class isn't loaded
+		return nil
+	}
+
+	disks := parseGeomDiskList(string(output))
+	files := parseMDBackingFiles(string(output))
+	for i := range disks {
+		disks[i].Model = "Memory disk"
+		if file := files[disks[i].Name]; file != "" {
+			disks[i].Model = "Disk image " + file
+		}
+	}
+	return disks
+}
+
+// parseMDBackingFiles maps md device names to the files backing them
+func parseMDBackingFiles(output string) map[string]string {
+	files := make(map[string]string)
+	name := ""
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "Geom name:"):
+			name = strings.TrimSpace(strings.TrimPrefix(line, "Geom name:"))
+		case strings.HasPrefix(line, "file:") && name != "":
+			files[name] = strings.TrimSpace(strings.TrimPrefix(line, "file:"))
+		}
+	}
+	return files
+}
+
+// deviceSectorSize returns the logical sector size of a disk, defaulting
+// to 512 bytes when it can't be read
+func deviceSectorSize(diskName string) uint64 {
+	if fakeDisks != nil {
+		return fakeDisks.sectorSize(diskName)
+	}
+
+	if geom, err := GetDiskGeometry(diskName); err == nil && geom.SectorSize != 0 {
+		return geom.SectorSize
+	}
+	return 512
+}
+
+// normalizeSectors converts partition offsets and sizes reported by gpart
+// in sectors of sectorSize bytes into the 512-byte units Partition uses
+func normalizeSectors(parts []Partition, sectorSize uint64) {
+	if sectorSize <= 512 || sectorSize%512 != 0 {
+		return
+	}
+	factor := sectorSize / 512
+	for i := range parts {
+		parts[i].Start *= factor
+		parts[i].Size *= factor
+		parts[i].End *= factor
+	}
+}
+
+// sizeInSectors returns sizeBytes as the whole number of the disk's sectors
+// gpart is given with -s, so a size is passed on exactly rather than in
+// whole megabytes. A remainder of less than one sector, as left by a
+// fractional size such as 10.3G, is dropped.
+func sizeInSectors(disk string, sizeBytes uint64) (uint64, error) {
+	sectorSize := deviceSectorSize(disk)
+	if sizeBytes < sectorSize {
+		return 0, fmt.Errorf("size %s is smaller than one %d-byte sector of %s", FormatBytes(sizeBytes), sectorSize, disk)
+	}
+	return sizeBytes / sectorSize, nil
+}
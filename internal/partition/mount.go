@@ -0,0 +1,185 @@
+package partition
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// mountPointPerm is the mode of mount point directories CreateMountPoint
+// makes. It only shows while nothing is mounted; the mounted filesystem's
+// root directory brings its own permissions.
+const mountPointPerm = 0755
+
+// checkNotMounted returns an error if a partition is mounted
+func checkNotMounted(partName string) error {
+	mountPoint, err := getMountPoint(partName)
+	if err != nil || mountPoint == "" {
+		// Without a mount table there is nothing to go on; the tools
+		// refuse busy devices themselves
+		return nil
+	}
+	return fmt.Errorf("partition %s is mounted at %s; unmount first", partName, mountPoint)
+}
+
+// checkIndexNotMounted is checkNotMounted for the partition at a gpart
+// index, whichever of the GPT and MBR names it has, or for a BSD label
+// partition given by slice and letter
+func checkIndexNotMounted(disk, index string) error {
+	if name, ok := bsdLabelPartitionName(disk, index); ok {
+		return checkNotMounted(name)
+	}
+	for _, sep := range []string{"p", "s"} {
+		if err := checkNotMounted(disk + sep + index); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MissingMountPointError reports that a mount point directory doesn't
+// exist. Callers can offer to make it with CreateMountPoint and retry.
+type MissingMountPointError struct {
+	Path string
+}
+
+func (e *MissingMountPointError) Error() string {
+	return fmt.Sprintf("mount point %s does not exist", e.Path)
+}
+
+// IsMissingMountPoint reports whether err was caused by a missing mount
+// point directory
+func IsMissingMountPoint(err error) bool {
+	var missing *MissingMountPointError
+	return errors.As(err, &missing)
+}
+
+// CheckMountPoint verifies that mountPoint is an absolute path to an
+// existing directory. A missing directory is reported as a
+// MissingMountPointError; anything else in the way, such as a regular
+// file, is a plain error.
+func CheckMountPoint(mountPoint string) error {
+	if !filepath.IsAbs(mountPoint) {
+		return fmt.Errorf("mount point %q must be an absolute path", mountPoint)
+	}
+
+	// The fake disks mount nowhere, so their mount points always exist
+	if fakeDisks != nil {
+		return nil
+	}
+
+	info, err := os.Stat(mountPoint)
+	if errors.Is(err, os.ErrNotExist) {
+		return &MissingMountPointError{Path: mountPoint}
+	}
+	if err != nil {
+		return fmt.Errorf("cannot check mount point %s: %w", mountPoint, err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("mount point %s exists but is not a directory", mountPoint)
+	}
+	return nil
+}
+
+// CreateMountPoint creates a mount point directory and any missing
+// parents, as mkdir -p would
+func CreateMountPoint(mountPoint string) error {
+	if !filepath.IsAbs(mountPoint) {
+		return fmt.Errorf("mount point %q must be an absolute path", mountPoint)
+	}
+
+	if fakeDisks != nil {
+		return nil
+	}
+
+	if err := os.MkdirAll(mountPoint, mountPointPerm); err != nil {
+		if errors.Is(err, os.ErrPermission) {
+			return fmt.Errorf("no permission to create mount point %s; create it as root or pick a directory you can write to: %w", mountPoint, err)
+		}
+		return fmt.Errorf("failed to create mount point %s: %w", mountPoint, err)
+	}
+	return nil
+}
+
+// mountFSType maps a detected filesystem name to the mount(8) -t type
+func mountFSType(fsType string) string {
+	switch strings.ToLower(fsType) {
+	case "fat32":
+		return "msdosfs"
+	case "ext2", "ext3", "ext4":
+		return "ext2fs"
+	default:
+		return "ufs"
+	}
+}
+
+// MountPartition mounts a partition at the given mount point, using the
+// device path chosen by DevicePath. The mount point directory must exist;
+// if it doesn't, a MissingMountPointError is returned.
+func MountPartition(part *Partition, mountPoint string) error {
+	if err := CheckPrivileges(); err != nil {
+		return err
+	}
+	defer markDisksChanged()
+
+	if err := CheckMountPoint(mountPoint); err != nil {
+		return err
+	}
+
+	if fakeDisks != nil {
+		return fakeDisks.mountPartition(part.Name, mountPoint)
+	}
+
+	device := DevicePath(part)
+	cmd := exec.Command("mount", "-t", mountFSType(part.FileSystem), device, mountPoint)
+	output, err := runCommand(cmd)
+	if err != nil {
+		return ExplainDiskGone(part.Name, fmt.Errorf("failed to mount %s at %s: %w (output: %s)", device, mountPoint, err, string(output)))
+	}
+
+	return nil
+}
+
+// UnmountPartition unmounts a mounted partition
+func UnmountPartition(partName string) error {
+	if err := CheckPrivileges(); err != nil {
+		return err
+	}
+	defer markDisksChanged()
+
+	if fakeDisks != nil {
+		return fakeDisks.unmountPartition(partName)
+	}
+
+	mountPoint, err := getMountPoint(partName)
+	if err != nil {
+		return fmt.Errorf("failed to check mount state of %s: %w", partName, err)
+	}
+	if mountPoint == "" {
+		return nil
+	}
+
+	cmd := exec.Command("umount", mountPoint)
+	output, err := runCommand(cmd)
+	if err != nil {
+		err = fmt.Errorf("failed to unmount %s: %w (output: %s)", mountPoint, err, string(output))
+		return ExplainBusyError(partName, err)
+	}
+
+	// A partition mounted in more than one place is still mounted
+	if remaining, err := getMountPoint(partName); err == nil && remaining != "" {
+		return fmt.Errorf("%s is still mounted at %s after unmounting %s", partName, remaining, mountPoint)
+	}
+	return nil
+}
+
+// CurrentMountPoint returns where a partition is mounted according to the
+// mount table right now, or "" if it isn't mounted. Unlike the MountPoint
+// of a scanned Partition it can't be stale, and it follows mounts through
+// the partition's gpt/ and gptid/ labels.
+func CurrentMountPoint(partName string) (string, error) {
+	return getMountPoint(partName)
+}
@@ -0,0 +1,109 @@
+package partition
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckNotMountedByLabel(t *testing.T) {
+	fake := useFakeRunner(t)
+	fake.Respond("mount", "/dev/gpt/data on /data (ufs, local)\n", nil)
+	fake.Respond("glabel status -s", "gpt/data  N/A  ada1p1\n", nil)
+
+	err := checkNotMounted("ada1p1")
+	if err == nil || !strings.Contains(err.Error(), "mounted at /data") {
+		t.Fatalf("checkNotMounted(ada1p1) = %v, want it reported mounted at /data", err)
+	}
+	if err := checkIndexNotMounted("ada1", "1"); err == nil {
+		t.Error("checkIndexNotMounted(ada1, 1) allowed a partition mounted by label")
+	}
+	if err := checkNotMounted("ada1p2"); err != nil {
+		t.Errorf("checkNotMounted(ada1p2) = %v for an unmounted partition", err)
+	}
+}
+
+func TestDeletePartitionRefusesLabelMount(t *testing.T) {
+	fake := useFakeRunner(t)
+	fake.Respond("mount", "/dev/gpt/data on /data (ufs, local)\n", nil)
+	fake.Respond("glabel status -s", "gpt/data  N/A  ada1p1\n", nil)
+
+	if err := DeletePartition("ada1", "1", false); err == nil {
+		t.Fatal("DeletePartition deleted a partition mounted by label")
+	}
+	for _, line := range fake.Lines() {
+		if strings.HasPrefix(line, "gpart delete") {
+			t.Errorf("ran %q on a mounted partition", line)
+		}
+	}
+}
+
+func TestAllowMounted(t *testing.T) {
+	tests := []struct {
+		name string
+		run  func(allowMounted bool) error
+		want string
+	}{
+		{"delete", func(allow bool) error { return DeletePartition("ada1", "1", allow) }, "gpart delete -i 1 ada1"},
+		{"format", func(allow bool) error { return FormatPartition("ada1p1", "ext4", allow) }, "mke2fs -t ext4 /dev/ada1p1"},
+		{"resize", func(allow bool) error { return ResizePartition("ada1", "1", 1<<30, allow) }, "gpart resize -i 1 -s 2097152 ada1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := useFakeRunner(t)
+			fake.Respond("mount", "/dev/ada1p1 on /data (ufs, local)\n", nil)
+			fake.Respond("diskinfo -v ada1", diskinfoVerbose("ada1", 512), nil)
+
+			err := tt.run(false)
+			if err == nil || !strings.Contains(err.Error(), "mounted at /data") {
+				t.Errorf("%s of a mounted partition = %v, want it refused", tt.name, err)
+			}
+			if containsLine(fake.Lines(), tt.want) {
+				t.Errorf("ran %q without allowMounted", tt.want)
+			}
+
+			if err := tt.run(true); err != nil {
+				t.Fatalf("%s with allowMounted = %v", tt.name, err)
+			}
+			if !containsLine(fake.Lines(), tt.want) {
+				t.Errorf("commands %q don't include %q", fake.Lines(), tt.want)
+			}
+		})
+	}
+}
+
+func TestUnmountPartitionByLabel(t *testing.T) {
+	fake := useFakeRunner(t)
+	fake.Respond("mount", "/dev/gpt/data on /data (ufs, local)\n", nil)
+	fake.Respond("mount", "/dev/ada0p2 on / (ufs, local)\n", nil)
+	fake.Respond("glabel status -s", "gpt/data  N/A  ada1p1\n", nil)
+
+	if err := UnmountPartition("ada1p1"); err != nil {
+		t.Fatalf("UnmountPartition(ada1p1): %v", err)
+	}
+	if !containsLine(fake.Lines(), "umount /data") {
+		t.Errorf("commands %q don't unmount /data", fake.Lines())
+	}
+}
+
+func TestUnmountPartitionStillMounted(t *testing.T) {
+	fake := useFakeRunner(t)
+	fake.Respond("mount", "/dev/ada1p1 on /mnt (ufs, local)\n/dev/gpt/data on /data (ufs, local)\n", nil)
+	fake.Respond("mount", "/dev/gpt/data on /data (ufs, local)\n", nil)
+	fake.Respond("glabel status -s", "gpt/data  N/A  ada1p1\n", nil)
+
+	err := UnmountPartition("ada1p1")
+	if err == nil || !strings.Contains(err.Error(), "still mounted at /data") {
+		t.Fatalf("UnmountPartition(ada1p1) = %v, want it reported still mounted at /data", err)
+	}
+}
+
+// containsLine reports whether lines has line
+func containsLine(lines []string, line string) bool {
+	for _, l := range lines {
+		if l == line {
+			return true
+		}
+	}
+	return false
+}
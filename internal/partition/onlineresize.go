@@ -1,6 +1,7 @@
 package partition
 
 import (
+	"context"
 	"fmt"
 	"os/exec"
 	"strings"
@@ -50,6 +51,14 @@ func GetOnlineResizeCapability(fsType string) OnlineResizeCapability {
 			Command:         "xfs_growfs",
 			Notes:           "XFS can be grown while mounted. Cannot shrink XFS filesystems.",
 		}
+	case "zfs":
+		return OnlineResizeCapability{
+			SupportsGrow:    true,
+			SupportsShrink:  false,
+			RequiresMounted: false, // The pool must be imported, not mounted
+			Command:         "zpool online -e",
+			Notes:           "ZFS vdevs can be expanded while the pool is imported. ZFS pools cannot be shrunk.",
+		}
 	default:
 		return OnlineResizeCapability{
 			SupportsGrow:    false,
@@ -73,6 +82,10 @@ func CanResizeOnline(part *Partition, grow bool) (bool, string) {
 		return false, fmt.Sprintf("%s does not support online grow", part.FileSystem)
 	}
 
+	if !grow && isZFS(part) {
+		return false, zfsShrinkMessage
+	}
+
 	if !grow && !capability.SupportsShrink {
 		return false, fmt.Sprintf("%s does not support online shrink", part.FileSystem)
 	}
@@ -101,6 +114,10 @@ func ResizeFilesystemOnline(part *Partition, newSizeBytes uint64) error {
 		return fmt.Errorf("%s does not support online grow", part.FileSystem)
 	}
 
+	if !isGrow && isZFS(part) {
+		return fmt.Errorf("%s", zfsShrinkMessage)
+	}
+
 	if !isGrow && !capability.SupportsShrink {
 		return fmt.Errorf("%s does not support online shrink", part.FileSystem)
 	}
@@ -113,6 +130,8 @@ func ResizeFilesystemOnline(part *Partition, newSizeBytes uint64) error {
 		return resizeExt234Online(part, newSizeBytes)
 	case "xfs":
 		return resizeXFSOnline(part)
+	case "zfs":
+		return resizeZFSOnline(part)
 	default:
 		return fmt.Errorf("online resize not implemented for %s", part.FileSystem)
 	}
@@ -127,7 +146,10 @@ func resizeUFSOnline(part *Partition) error {
 	// Run growfs on the mounted filesystem
 	// growfs will automatically grow to fill the partition
 	cmd := exec.Command("growfs", "-y", part.MountPoint)
-	output, err := cmd.CombinedOutput()
+	if dryRun(cmd) {
+		return nil
+	}
+	output, err := runCommand(cmd)
 	if err != nil {
 		return fmt.Errorf("growfs failed: %v\nOutput: %s", err, string(output))
 	}
@@ -145,13 +167,16 @@ func resizeExt234Online(part *Partition, newSizeBytes uint64) error {
 	var cmd *exec.Cmd
 	if newSizeK > 0 {
 		// Specify target size
-		cmd = exec.Command("resize2fs", part.Name, fmt.Sprintf("%dK", newSizeK))
+		cmd = exec.Command("resize2fs", "/dev/"+part.Name, fmt.Sprintf("%dK", newSizeK))
 	} else {
 		// Grow to fill partition
-		cmd = exec.Command("resize2fs", part.Name)
+		cmd = exec.Command("resize2fs", "/dev/"+part.Name)
+	}
+	if dryRun(cmd) {
+		return nil
 	}
 
-	output, err := cmd.CombinedOutput()
+	output, err := runCommand(cmd)
 	if err != nil {
 		return fmt.Errorf("resize2fs failed: %v\nOutput: %s", err, string(output))
 	}
@@ -167,7 +192,10 @@ func resizeXFSOnline(part *Partition) error {
 
 	// xfs_growfs grows to fill the partition
 	cmd := exec.Command("xfs_growfs", part.MountPoint)
-	output, err := cmd.CombinedOutput()
+	if dryRun(cmd) {
+		return nil
+	}
+	output, err := runCommand(cmd)
 	if err != nil {
 		return fmt.Errorf("xfs_growfs failed: %v\nOutput: %s", err, string(output))
 	}
@@ -175,9 +203,89 @@ func resizeXFSOnline(part *Partition) error {
 	return nil
 }
 
+// zfsShrinkMessage explains why a ZFS partition can't be made smaller
+const zfsShrinkMessage = "ZFS pools cannot be shrunk; back up the pool and recreate it on a smaller partition instead"
+
+// isZFS reports whether a partition holds a ZFS vdev
+func isZFS(part *Partition) bool {
+	return strings.EqualFold(part.FileSystem, "zfs") || part.Type == "freebsd-zfs"
+}
+
+// CheckZFSShrink returns an error if resizing part to newSizeBytes would
+// shrink a ZFS vdev, which would destroy the pool
+func CheckZFSShrink(part *Partition, newSizeBytes uint64) error {
+	if isZFS(part) && newSizeBytes < part.Size*512 {
+		return fmt.Errorf("cannot shrink %s: %s", part.Name, zfsShrinkMessage)
+	}
+	return nil
+}
+
+// resizeZFSOnline expands the vdev on a grown partition with zpool online -e
+// so that its pool can use the new space
+func resizeZFSOnline(part *Partition) error {
+	if fakeDisks != nil {
+		return nil
+	}
+
+	pool, vdev, err := findZFSPool(part)
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command("zpool", "online", "-e", pool, vdev)
+	if dryRun(cmd) {
+		return nil
+	}
+	output, err := runCommand(cmd)
+	if err != nil {
+		return fmt.Errorf("zpool online -e failed: %v\nOutput: %s", err, string(output))
+	}
+
+	return nil
+}
+
+// findZFSPool returns the imported pool that uses part as a vdev, along
+// with the vdev path as zpool status reports it
+func findZFSPool(part *Partition) (string, string, error) {
+	cmd := exec.Command("zpool", "status", "-P")
+	output, err := runCommand(cmd)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to run zpool status: %w (output: %s)", err, string(output))
+	}
+
+	candidates := map[string]bool{"/dev/" + part.Name: true}
+	if part.Label != "" {
+		candidates["/dev/gpt/"+part.Label] = true
+	}
+
+	var pool string
+	for _, line := range strings.Split(string(output), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if fields[0] == "pool:" && len(fields) > 1 {
+			pool = fields[1]
+			continue
+		}
+		if pool != "" && candidates[fields[0]] {
+			return pool, fields[0], nil
+		}
+	}
+
+	return "", "", fmt.Errorf("%s is not a vdev of any imported ZFS pool; import the pool and try again", part.Name)
+}
+
 // PerformOnlineResize performs a complete online resize operation
 // This includes resizing the partition AND the filesystem
 func PerformOnlineResize(diskName, partIndex string, newSizeBytes uint64, part *Partition) error {
+	return performOnlineResize(context.Background(), diskName, partIndex, newSizeBytes, part)
+}
+
+// performOnlineResize implements PerformOnlineResize, killing gpart once
+// ctx is done. Like resizeWithFilesystem, it lets the filesystem tools
+// finish.
+func performOnlineResize(ctx context.Context, diskName, partIndex string, newSizeBytes uint64, part *Partition) error {
 	// First, verify online resize is possible
 	isGrow := newSizeBytes > (part.Size * 512)
 	canResize, reason := CanResizeOnline(part, isGrow)
@@ -190,7 +298,7 @@ func PerformOnlineResize(diskName, partIndex string, newSizeBytes uint64, part *
 		// This is safe: if filesystem grow fails, we just have extra unused space
 
 		// Step 1: Resize the partition
-		if err := ResizePartition(diskName, partIndex, newSizeBytes); err != nil {
+		if err := resizePartition(ctx, diskName, partIndex, newSizeBytes, true); err != nil {
 			return fmt.Errorf("failed to resize partition: %v", err)
 		}
 
@@ -198,8 +306,8 @@ func PerformOnlineResize(diskName, partIndex string, newSizeBytes uint64, part *
 		if err := ResizeFilesystemOnline(part, newSizeBytes); err != nil {
 			// Partition was resized but filesystem wasn't
 			// This is non-critical - the partition is larger, filesystem just doesn't use all the space
-			return fmt.Errorf("partition resized successfully, but filesystem grow failed: %v\n\nThe partition is now larger but the filesystem has not expanded to fill it.\nYou can try running the filesystem resize command manually:\n- UFS: growfs -y %s\n- ext2/3/4: resize2fs %s\n- XFS: xfs_growfs %s",
-				err, part.MountPoint, part.Name, part.MountPoint)
+			return fmt.Errorf("partition resized successfully, but filesystem grow failed: %v\n\nThe partition is now larger but the filesystem has not expanded to fill it.\nYou can try running the filesystem resize command manually:\n- UFS: growfs -y %s\n- ext2/3/4: resize2fs %s\n- XFS: xfs_growfs %s\n- ZFS: zpool online -e <pool> /dev/%s",
+				err, part.MountPoint, part.Name, part.MountPoint, part.Name)
 		}
 	} else {
 		// For SHRINKING: Shrink filesystem first, then resize partition
@@ -213,11 +321,11 @@ func PerformOnlineResize(diskName, partIndex string, newSizeBytes uint64, part *
 		}
 
 		// Step 2: Resize the partition
-		if err := ResizePartition(diskName, partIndex, newSizeBytes); err != nil {
+		if err := resizePartition(ctx, diskName, partIndex, newSizeBytes, true); err != nil {
 			// Filesystem was shrunk but partition wasn't
 			// This is problematic - filesystem is smaller than partition
 			return fmt.Errorf("filesystem shrunk successfully, but partition resize failed: %v\n\nWARNING: The filesystem has been shrunk but the partition size was not changed.\nThe filesystem is now smaller than the partition.\nYou can try resizing the partition manually with: gpart resize -i %s -s %d %s",
-				err, partIndex, newSizeBytes, diskName)
+				err, partIndex, newSizeBytes/deviceSectorSize(diskName), diskName)
 		}
 	}
 
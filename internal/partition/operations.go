@@ -1,9 +1,15 @@
 package partition
 
 import (
+	"bufio"
+	"bytes"
+	"context"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
+	"regexp"
+	"strconv"
 	"strings"
 )
 
@@ -13,98 +19,482 @@ type Operation struct {
 }
 
 func CheckPrivileges() error {
+	// A dry run only reads the disks, and a fake runner none at all
+	if fakeDisks != nil || DryRun || usingFakeRunner() {
+		return nil
+	}
 	if os.Geteuid() != 0 {
 		return fmt.Errorf("this application requires root privileges to manage partitions")
 	}
 	return nil
 }
 
+// minimumSizes holds the smallest practical partition size for each
+// filesystem, keyed by both filesystem name and gpart partition type
+var minimumSizes = map[string]uint64{
+	"ufs":           4 * 1024 * 1024,
+	"freebsd-ufs":   4 * 1024 * 1024,
+	"zfs":           64 * 1024 * 1024,
+	"freebsd-zfs":   64 * 1024 * 1024,
+	"fat32":         33 * 1024 * 1024,
+	"ms-basic-data": 33 * 1024 * 1024,
+	"exfat":         1 * 1024 * 1024,
+	"ext2":          2 * 1024 * 1024,
+	"ext3":          16 * 1024 * 1024,
+	"ext4":          16 * 1024 * 1024,
+	"ntfs":          8 * 1024 * 1024,
+	"swap":          1 * 1024 * 1024,
+	"freebsd-swap":  1 * 1024 * 1024,
+}
+
+// defaultMinimumSize applies to filesystems and types without a known minimum
+const defaultMinimumSize = 1024 * 1024
+
+// MinimumSizeForFilesystem returns the smallest size in bytes that can hold
+// the given filesystem. fsType may be a filesystem name (e.g. "UFS") or a
+// gpart partition type (e.g. "freebsd-zfs").
+func MinimumSizeForFilesystem(fsType string) uint64 {
+	if size, ok := minimumSizes[strings.ToLower(fsType)]; ok {
+		return size
+	}
+	return defaultMinimumSize
+}
+
+// MinimumSizeForPartition returns the minimum size in bytes of an existing
+// partition, based on its detected filesystem or, failing that, its type
+func MinimumSizeForPartition(part *Partition) uint64 {
+	if part.FileSystem != "" && part.FileSystem != "unknown" {
+		return MinimumSizeForFilesystem(part.FileSystem)
+	}
+	return MinimumSizeForFilesystem(part.Type)
+}
+
+// CheckMinimumSize returns an error if size is too small for fsType
+func CheckMinimumSize(size uint64, fsType string) error {
+	minSize := MinimumSizeForFilesystem(fsType)
+	if size < minSize {
+		return fmt.Errorf("%s is too small for %s (minimum is %s)", FormatBytes(size), fsType, FormatBytes(minSize))
+	}
+	return nil
+}
+
+var typeGUIDPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// IsTypeGUID reports whether s is a well-formed partition type GUID,
+// optionally prefixed with '!' as gpart expects for raw types
+func IsTypeGUID(s string) bool {
+	return typeGUIDPattern.MatchString(strings.TrimPrefix(s, "!"))
+}
+
+// gpartType converts a partition type to the form passed to gpart -t.
+// Named types are passed through; raw GUIDs get gpart's '!' prefix.
+func gpartType(fsType string) (string, error) {
+	if IsTypeGUID(fsType) {
+		return "!" + strings.ToLower(strings.TrimPrefix(fsType, "!")), nil
+	}
+	if strings.HasPrefix(fsType, "!") {
+		return "", fmt.Errorf("invalid partition type GUID: %s", strings.TrimPrefix(fsType, "!"))
+	}
+	return fsType, nil
+}
+
+// CreatePartition creates a partition of size bytes on disk. A size of 0
+// fills the disk's largest free region; a size that fits in no free region
+// is refused before gpart runs.
 func CreatePartition(disk string, size uint64, fsType string) error {
+	return CreatePartitionAt(disk, size, fsType, 0, "")
+}
+
+// CreatePartitionWithLabel creates a partition like CreatePartition and
+// gives it a GPT label, so it appears as /dev/gpt/<label>
+func CreatePartitionWithLabel(disk string, size uint64, fsType, label string) error {
+	return CreatePartitionAt(disk, size, fsType, 0, label)
+}
+
+// CreatePartitionAt creates a partition like CreatePartition at the given
+// gpart index, e.g. to recreate a deleted slot that /etc/fstab refers to.
+// An index of 0 lets gpart use the first free index. A non-empty label is
+// set as the GPT label of the new partition.
+func CreatePartitionAt(disk string, size uint64, fsType string, index int, label string) error {
+	return createPartition(context.Background(), disk, size, fsType, index, label, 0, nil)
+}
+
+// CreatePartitionInRegion creates a partition like CreatePartitionWithLabel
+// at the start of a free region returned by GetFreeSpace, so it lands in
+// that region rather than wherever gpart finds room. A size of 0 fills the
+// whole region; a larger size than the region has is refused.
+func CreatePartitionInRegion(disk string, region FreeRegion, size uint64, fsType, label string) error {
+	if region.Size == 0 {
+		return fmt.Errorf("free region at sector %d on %s is empty", region.Start, disk)
+	}
+	return createPartition(context.Background(), disk, size, fsType, 0, label, 0, &region)
+}
+
+// createPartition implements CreatePartitionAt, CreatePartitionInRegion and
+// CreateAlignedPartitionAt. A non-zero alignment in bytes is passed to gpart
+// add -a, which rounds the start and size of the partition to multiples of
+// it; zero leaves the placement to gpart's defaults. A non-nil region places
+// the partition at its start. gpart is killed once ctx is done.
+func createPartition(ctx context.Context, disk string, size uint64, fsType string, index int, label string, alignment uint64, region *FreeRegion) error {
 	if err := CheckPrivileges(); err != nil {
 		return err
 	}
+	defer markDisksChanged()
+
+	if index < 0 {
+		return fmt.Errorf("invalid partition index: %d", index)
+	}
+
+	if alignment > 0 {
+		if sectorSize := deviceSectorSize(disk); alignment%sectorSize != 0 {
+			return fmt.Errorf("alignment %s is not a multiple of the %d-byte sectors of %s", FormatBytes(alignment), sectorSize, disk)
+		}
+	}
+
+	if label != "" {
+		if err := ValidateGPTLabel(label); err != nil {
+			return err
+		}
+	}
+
+	if err := CheckNotRAIDMember(disk); err != nil {
+		return err
+	}
+
+	if err := CheckDiskNotInFlight(disk); err != nil {
+		return err
+	}
+
+	// A size of 0 means the rest of the region, by default the largest
+	// free region of the disk
+	if region == nil && size == 0 {
+		largest, err := LargestFreeRegion(disk)
+		if err != nil {
+			return err
+		}
+		region = &largest
+	}
+	fill := size == 0
+	if fill {
+		size = region.Bytes()
+	} else if region != nil && size > region.UsableBytes(alignment) {
+		return fmt.Errorf("%s does not fit in the %s free region at sector %d of %s",
+			FormatBytes(size), FormatBytes(region.UsableBytes(alignment)), region.Start, disk)
+	} else if region == nil {
+		if err := checkSizeFits(disk, size, alignment); err != nil {
+			return err
+		}
+	}
+
+	if err := CheckMinimumSize(size, fsType); err != nil {
+		return err
+	}
+
+	var sectors uint64
+	if !fill {
+		var err error
+		if sectors, err = sizeInSectors(disk, size); err != nil {
+			return err
+		}
+	}
+
+	partType, err := gpartType(fsType)
+	if err != nil {
+		return err
+	}
+
+	if index > 0 {
+		if err := checkIndexFree(disk, index); err != nil {
+			return err
+		}
+	}
 
-	sizeStr := fmt.Sprintf("%dM", size/(1024*1024))
+	args := []string{"add", "-t", partType}
+	if region != nil {
+		args = append(args, "-b", strconv.FormatUint(region.Start*512/deviceSectorSize(disk), 10))
+	}
+	// Without -s gpart fills the free space starting at -b
+	if !fill {
+		args = append(args, "-s", strconv.FormatUint(sectors, 10))
+	}
+	if index > 0 {
+		args = append(args, "-i", strconv.Itoa(index))
+	}
+	if label != "" {
+		args = append(args, "-l", label)
+	}
+	if alignment > 0 {
+		// Like -b, a plain number is a count of sectors
+		args = append(args, "-a", strconv.FormatUint(alignment/deviceSectorSize(disk), 10))
+	}
+	args = append(args, disk)
 
-	cmd := exec.Command("gpart", "add", "-t", fsType, "-s", sizeStr, disk)
-	output, err := cmd.CombinedOutput()
+	cmd := exec.Command("gpart", args...)
+	if dryRun(cmd) {
+		return nil
+	}
+
+	if fakeDisks != nil {
+		return fakeDisks.createPartition(disk, size, partType, index, label, region, fill, alignment)
+	}
+
+	output, err := runRetryingBusy(ctx, cmd)
 	if err != nil {
-		return fmt.Errorf("failed to create partition: %w (output: %s)", err, string(output))
+		return ExplainDiskGone(disk, fmt.Errorf("failed to create partition: %w (output: %s)", err, string(output)))
 	}
 
 	return nil
 }
 
-func DeletePartition(disk string, index string) error {
+// checkIndexFree returns an error if a partition on disk already uses index
+func checkIndexFree(disk string, index int) error {
+	partitions, _, err := getPartitionTable(disk)
+	if err != nil {
+		return err
+	}
+
+	for _, part := range partitions {
+		if partitionIndex(part) == index {
+			return fmt.Errorf("index %d on %s is already used by %s", index, disk, part.Name)
+		}
+	}
+	return nil
+}
+
+// DeletePartition deletes the partition at a gpart index on disk. A BSD
+// label partition can be given by slice and letter, e.g. index 1a on ada0
+// for ada0s1a. A mounted partition is refused unless allowMounted is set,
+// which is only for callers that have made sure deleting it is safe.
+func DeletePartition(disk string, index string, allowMounted bool) error {
+	return deletePartition(context.Background(), disk, index, allowMounted)
+}
+
+// deletePartition implements DeletePartition, killing gpart once ctx is
+// done
+func deletePartition(ctx context.Context, disk string, index string, allowMounted bool) error {
 	if err := CheckPrivileges(); err != nil {
 		return err
 	}
+	defer markDisksChanged()
+
+	if err := checkIndexNotInFlight(disk, index); err != nil {
+		return err
+	}
+
+	if !allowMounted {
+		if err := checkIndexNotMounted(disk, index); err != nil {
+			return err
+		}
+	}
 
-	cmd := exec.Command("gpart", "delete", "-i", index, disk)
-	output, err := cmd.CombinedOutput()
+	// BSD label partitions are deleted from the label on their slice
+	geom, gpartIndex := bsdLabelTarget(disk, index)
+	cmd := exec.Command("gpart", "delete", "-i", gpartIndex, geom)
+	if dryRun(cmd) {
+		return nil
+	}
+
+	if fakeDisks != nil {
+		return fakeDisks.deletePartition(geom, gpartIndex)
+	}
+
+	output, err := runRetryingBusy(ctx, cmd)
 	if err != nil {
-		return fmt.Errorf("failed to delete partition: %w (output: %s)", err, string(output))
+		return ExplainDiskGone(disk, fmt.Errorf("failed to delete partition: %w (output: %s)", err, string(output)))
 	}
 
 	return nil
 }
 
-func FormatPartition(partition string, fsType string) error {
+// FormatPartition creates a filesystem on a partition with the formatting
+// tool's defaults. A mounted partition is refused unless allowMounted is
+// set; formatting a mounted filesystem can corrupt it.
+func FormatPartition(partition string, fsType string, allowMounted bool) error {
+	return FormatPartitionWithOptions(partition, fsType, FormatOptions{}, allowMounted)
+}
+
+// FormatPartitionWithOptions is FormatPartition with a volume label, block
+// size or reserved space set through opts. Settings the filesystem doesn't
+// have are refused rather than ignored.
+func FormatPartitionWithOptions(partition string, fsType string, opts FormatOptions, allowMounted bool) error {
+	return FormatPartitionWithLog(partition, fsType, opts, allowMounted, nil, nil)
+}
+
+// FormatPartitionWithLog is FormatPartitionWithOptions reporting the
+// formatting tool's output to logger and the progress its Formatter reads
+// from it to progress, in percent. Either may be nil. Tools that report no
+// progress, such as newfs, leave progress untouched.
+func FormatPartitionWithLog(partition string, fsType string, opts FormatOptions, allowMounted bool, progress ProgressReporter, logger OperationLogger) error {
+	return formatPartition(context.Background(), partition, fsType, opts, allowMounted, progress, logger)
+}
+
+// formatPartition implements FormatPartitionWithLog, killing the
+// formatting tool once ctx is done
+func formatPartition(ctx context.Context, partition string, fsType string, opts FormatOptions, allowMounted bool, progress ProgressReporter, logger OperationLogger) error {
 	if err := CheckPrivileges(); err != nil {
 		return err
 	}
+	defer markDisksChanged()
+
+	formatter, err := checkFormat(partition, fsType, opts, allowMounted)
+	if err != nil {
+		return err
+	}
+
+	if fakeDisks != nil && !DryRun {
+		return fakeDisks.formatPartition(partition, formatter.Name())
+	}
+
+	cmd, err := formatter.BuildCommand(partition, opts)
+	if err != nil {
+		return err
+	}
+	if dryRun(cmd) {
+		return nil
+	}
+
+	logStep(logger, "Formatting %s as %s", partition, formatter.Name())
+	logLine(logger, "%s", strings.Join(cmd.Args, " "))
+
+	var output string
+	if progress == nil && logger == nil || usingFakeRunner() {
+		var raw []byte
+		raw, err = runCommandContext(ctx, cmd)
+		output = reportFormatOutput(bytes.NewReader(raw), formatter, progress, logger)
+	} else {
+		output, err = runFormatCommand(commandContext(ctx, cmd), formatter, progress, logger)
+	}
+	if err != nil {
+		return ExplainDiskGone(partition, fmt.Errorf("failed to format partition: %w (output: %s)", err, output))
+	}
+
+	return nil
+}
+
+// runFormatCommand runs a formatting tool, reporting its output as it
+// comes with reportFormatOutput, and returns the output
+func runFormatCommand(cmd *exec.Cmd, formatter Formatter, progress ProgressReporter, logger OperationLogger) (string, error) {
+	reader, writer := io.Pipe()
+	cmd.Stdout = writer
+	cmd.Stderr = writer
+	if err := cmd.Start(); err != nil {
+		return "", err
+	}
+
+	done := make(chan string)
+	go func() {
+		done <- reportFormatOutput(reader, formatter, progress, logger)
+	}()
+
+	err := cmd.Wait()
+	writer.Close()
+	return <-done, err
+}
 
-	var cmd *exec.Cmd
-	switch strings.ToLower(fsType) {
-	case "ufs":
-		cmd = exec.Command("newfs", "-U", "/dev/"+partition)
-	case "fat32":
-		cmd = exec.Command("newfs_msdos", "-F", "32", "/dev/"+partition)
-	case "ext2":
-		// Check if mke2fs is available
-		if _, err := exec.LookPath("mke2fs"); err != nil {
-			return fmt.Errorf("mke2fs not found - install e2fsprogs package: pkg install e2fsprogs")
+// reportFormatOutput reads a formatting tool's output, passing each line
+// the formatter finds progress in to progress with the stage it belongs
+// to, e.g. "Writing inode tables", and every other line to logger. Tools
+// that redraw a counter in place, as mke2fs does with backspaces, are
+// split at each redraw. It returns the whole output.
+func reportFormatOutput(r io.Reader, formatter Formatter, progress ProgressReporter, logger OperationLogger) string {
+	var all strings.Builder
+	stage := ""
+
+	scanner := bufio.NewScanner(io.TeeReader(r, &all))
+	scanner.Split(scanFormatOutput)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
 		}
-		cmd = exec.Command("mke2fs", "-t", "ext2", "/dev/"+partition)
-	case "ext3":
-		if _, err := exec.LookPath("mke2fs"); err != nil {
-			return fmt.Errorf("mke2fs not found - install e2fsprogs package: pkg install e2fsprogs")
+		if colon := strings.Index(line, ":"); colon > 0 {
+			stage = strings.TrimSpace(line[:colon])
 		}
-		cmd = exec.Command("mke2fs", "-t", "ext3", "/dev/"+partition)
-	case "ext4":
-		if _, err := exec.LookPath("mke2fs"); err != nil {
-			return fmt.Errorf("mke2fs not found - install e2fsprogs package: pkg install e2fsprogs")
+		if percent, ok := formatter.ParseProgress(line); ok {
+			if progress != nil {
+				progress.Update(uint64(percent), 100, stage)
+			}
+			continue
 		}
-		cmd = exec.Command("mke2fs", "-t", "ext4", "/dev/"+partition)
-	case "ntfs":
-		// Check if mkntfs is available
-		if _, err := exec.LookPath("mkntfs"); err != nil {
-			return fmt.Errorf("mkntfs not found - install ntfsprogs or ntfs-3g package: pkg install fusefs-ntfs")
+		logLine(logger, "%s", line)
+	}
+	// Drain what the scanner gave up on, so the tool never blocks
+	io.Copy(io.Discard, r)
+
+	return strings.TrimSpace(strings.ReplaceAll(all.String(), "\b", ""))
+}
+
+// scanFormatOutput is a bufio.SplitFunc that splits at newlines, carriage
+// returns and backspaces
+func scanFormatOutput(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	for i, b := range data {
+		if b == '\n' || b == '\r' || b == '\b' {
+			return i + 1, data[:i], nil
 		}
-		cmd = exec.Command("mkntfs", "-f", "/dev/"+partition)
-	case "zfs":
-		return fmt.Errorf("ZFS pools must be created using 'zpool create' command directly")
-	default:
-		return fmt.Errorf("unsupported filesystem type: %s", fsType)
 	}
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
 
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("failed to format partition: %w (output: %s)", err, string(output))
+// checkFormat checks that a partition can be formatted as fsType with opts
+// and returns the formatter to use. Mounted partitions are refused unless
+// allowMounted is set.
+func checkFormat(partition string, fsType string, opts FormatOptions, allowMounted bool) (Formatter, error) {
+	if err := CheckNotInFlight(partition); err != nil {
+		return nil, err
+	}
+	if disk, _, err := ParsePartitionName(partition); err == nil {
+		if err := CheckNotInFlight(disk); err != nil {
+			return nil, err
+		}
 	}
 
-	return nil
+	if !allowMounted {
+		if err := checkNotMounted(partition); err != nil {
+			return nil, err
+		}
+	}
+
+	if strings.EqualFold(fsType, "zfs") {
+		return nil, fmt.Errorf("ZFS filesystems live in pools; create one with CreateZFSPool (pgpart create-pool) instead of formatting")
+	}
+
+	formatter, ok := GetFormatter(fsType)
+	if !ok {
+		return nil, fmt.Errorf("unsupported filesystem type: %s", fsType)
+	}
+
+	if err := CheckFormatOptions(fsType, opts); err != nil {
+		return nil, err
+	}
+
+	return formatter, nil
 }
 
 func CreatePartitionTable(disk string, scheme string) error {
 	if err := CheckPrivileges(); err != nil {
 		return err
 	}
+	defer markDisksChanged()
+
+	if err := CheckNotRAIDMember(disk); err != nil {
+		return err
+	}
 
 	cmd := exec.Command("gpart", "create", "-s", scheme, disk)
-	output, err := cmd.CombinedOutput()
+	if dryRun(cmd) {
+		return nil
+	}
+
+	if fakeDisks != nil {
+		return fakeDisks.createPartitionTable(disk, scheme)
+	}
+
+	output, err := runCommand(cmd)
 	if err != nil {
-		return fmt.Errorf("failed to create partition table: %w (output: %s)", err, string(output))
+		return ExplainDiskGone(disk, fmt.Errorf("failed to create partition table: %w (output: %s)", err, string(output)))
 	}
 
 	return nil
@@ -114,27 +504,172 @@ func DestroyPartitionTable(disk string) error {
 	if err := CheckPrivileges(); err != nil {
 		return err
 	}
+	defer markDisksChanged()
+
+	if err := CheckDiskNotInFlight(disk); err != nil {
+		return err
+	}
 
 	cmd := exec.Command("gpart", "destroy", "-F", disk)
-	output, err := cmd.CombinedOutput()
+	if dryRun(cmd) {
+		return nil
+	}
+
+	if fakeDisks != nil {
+		return fakeDisks.destroyPartitionTable(disk)
+	}
+
+	output, err := runCommand(cmd)
+	if err != nil {
+		return ExplainDiskGone(disk, fmt.Errorf("failed to destroy partition table: %w (output: %s)", err, string(output)))
+	}
+
+	return nil
+}
+
+// ResizePartition changes the size of a partition's entry, leaving its
+// filesystem alone. Mounted partitions are refused unless allowMounted is
+// set; PerformOnlineResize resizes those together with their filesystem.
+// Like DeletePartition, it takes BSD label partitions by slice and letter.
+func ResizePartition(disk string, index string, newSize uint64, allowMounted bool) error {
+	return resizePartition(context.Background(), disk, index, newSize, allowMounted)
+}
+
+// resizePartition implements ResizePartition, killing gpart once ctx is
+// done. The online resize path passes allowMounted, as its partitions are
+// mounted by definition.
+func resizePartition(ctx context.Context, disk string, index string, newSize uint64, allowMounted bool) error {
+	if err := CheckPrivileges(); err != nil {
+		return err
+	}
+	defer markDisksChanged()
+
+	if err := checkIndexNotInFlight(disk, index); err != nil {
+		return err
+	}
+
+	if !allowMounted {
+		if err := checkIndexNotMounted(disk, index); err != nil {
+			return err
+		}
+	}
+
+	sectors, err := sizeInSectors(disk, newSize)
+	if err != nil {
+		return err
+	}
+	sizeStr := strconv.FormatUint(sectors, 10)
+
+	geom, gpartIndex := bsdLabelTarget(disk, index)
+	cmd := exec.Command("gpart", "resize", "-i", gpartIndex, "-s", sizeStr, geom)
+	if dryRun(cmd) {
+		return nil
+	}
+
+	if fakeDisks != nil {
+		return fakeDisks.resizePartition(geom, gpartIndex, newSize)
+	}
+
+	output, err := runRetryingBusy(ctx, cmd)
+	if err != nil {
+		return ExplainDiskGone(disk, fmt.Errorf("failed to resize partition: %w (output: %s)", err, string(output)))
+	}
+
+	return nil
+}
+
+// BackupPartitionTable returns the partition table of a disk in the text
+// form of gpart backup, which RestorePartitionTable accepts
+func BackupPartitionTable(disk string) ([]byte, error) {
+	if fakeDisks != nil {
+		return fakeDisks.backupPartitionTable(disk)
+	}
+
+	output, err := Runner.Run("gpart", "backup", disk)
 	if err != nil {
-		return fmt.Errorf("failed to destroy partition table: %w (output: %s)", err, string(output))
+		return nil, ExplainDiskGone(disk, fmt.Errorf("failed to back up partition table: %w (output: %s)", err, string(output)))
+	}
+
+	if err := ValidatePartitionTableBackup(output); err != nil {
+		return nil, fmt.Errorf("gpart backup returned an unusable backup: %w", err)
+	}
+
+	return output, nil
+}
+
+// ValidatePartitionTableBackup checks that data looks like gpart backup
+// output: a header with the scheme, e.g. "GPT 128", followed by one line
+// per partition with its index, type, start and size
+func ValidatePartitionTableBackup(data []byte) error {
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) == 0 || strings.TrimSpace(lines[0]) == "" {
+		return fmt.Errorf("backup is empty")
+	}
+
+	header := strings.Fields(lines[0])
+	if !knownSchemes[strings.ToUpper(header[0])] {
+		return fmt.Errorf("line 1: %q is not a partition scheme header", lines[0])
+	}
+	if len(header) > 1 {
+		if _, err := strconv.Atoi(header[1]); err != nil {
+			return fmt.Errorf("line 1: invalid entry count %q", header[1])
+		}
+	}
+
+	for i, line := range lines[1:] {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) < 4 {
+			return fmt.Errorf("line %d: expected index, type, start and size, got %q", i+2, line)
+		}
+		for _, field := range []string{fields[0], fields[2], fields[3]} {
+			if _, err := strconv.ParseUint(field, 10, 64); err != nil {
+				return fmt.Errorf("line %d: %q is not a number", i+2, field)
+			}
+		}
 	}
 
 	return nil
 }
 
-func ResizePartition(disk string, index string, newSize uint64) error {
+// RestorePartitionTable writes a partition table saved by
+// BackupPartitionTable to a disk with gpart restore, including labels. A
+// disk that already has partitions is only overwritten when force is set.
+func RestorePartitionTable(disk string, backup []byte, force bool) error {
 	if err := CheckPrivileges(); err != nil {
 		return err
 	}
+	defer markDisksChanged()
+
+	if err := ValidatePartitionTableBackup(backup); err != nil {
+		return fmt.Errorf("invalid partition table backup: %w", err)
+	}
+
+	if err := CheckNotRAIDMember(disk); err != nil {
+		return err
+	}
 
-	sizeStr := fmt.Sprintf("%dM", newSize/(1024*1024))
+	if err := CheckDiskNotInFlight(disk); err != nil {
+		return err
+	}
+
+	if parts, _, err := getPartitionTable(disk); err == nil && len(parts) > 0 && !force {
+		return fmt.Errorf("%s already has %d partition(s); restoring would replace them, use force to overwrite", disk, len(parts))
+	}
+
+	if fakeDisks != nil {
+		return fakeDisks.restorePartitionTable(disk, backup)
+	}
 
-	cmd := exec.Command("gpart", "resize", "-i", index, "-s", sizeStr, disk)
-	output, err := cmd.CombinedOutput()
+	// -F destroys an existing table first, which at this point is empty or
+	// meant to be replaced; -l restores the labels
+	cmd := exec.Command("gpart", "restore", "-F", "-l", disk)
+	cmd.Stdin = strings.NewReader(string(backup))
+	output, err := runCommand(cmd)
 	if err != nil {
-		return fmt.Errorf("failed to resize partition: %w (output: %s)", err, string(output))
+		return ExplainDiskGone(disk, fmt.Errorf("failed to restore partition table: %w (output: %s)", err, string(output)))
 	}
 
 	return nil
@@ -0,0 +1,117 @@
+package partition
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// diskinfoVerbose returns diskinfo -v output for a disk of sectorSize-byte
+// sectors
+func diskinfoVerbose(disk string, sectorSize uint64) string {
+	return fmt.Sprintf("%s\n\t%d\t# sectorsize\n\t1000204886016\t# mediasize in bytes (932G)\n\t0\t# stripesize\n\t0\t# stripeoffset\n", disk, sectorSize)
+}
+
+func TestSizeInSectors(t *testing.T) {
+	size103G, err := ParseSize("10.3G")
+	if err != nil {
+		t.Fatalf("ParseSize(10.3G): %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		size       uint64
+		sectorSize uint64
+		want       uint64
+		wantErr    bool
+	}{
+		{"10.3G on 512-byte sectors", size103G, 512, 21600665, false},
+		{"10.3G on 4096-byte sectors", size103G, 4096, 2700083, false},
+		{"whole MiB on 512-byte sectors", 10 << 20, 512, 20480, false},
+		{"whole MiB on 4096-byte sectors", 10 << 20, 4096, 2560, false},
+		{"one sector", 4096, 4096, 1, false},
+		{"less than a sector", 4095, 4096, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := useFakeRunner(t)
+			fake.Respond("diskinfo -v ada3", diskinfoVerbose("ada3", tt.sectorSize), nil)
+
+			got, err := sizeInSectors("ada3", tt.size)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("sizeInSectors(%d) error = %v, wantErr %v", tt.size, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("sizeInSectors(%d) = %d, want %d", tt.size, got, tt.want)
+			}
+		})
+	}
+}
+
+// gpartLines returns the command lines that start with prefix
+func gpartLines(lines []string, prefix string) []string {
+	var matched []string
+	for _, line := range lines {
+		if strings.HasPrefix(line, prefix) {
+			matched = append(matched, line)
+		}
+	}
+	return matched
+}
+
+func TestCreatePartitionSizeInSectors(t *testing.T) {
+	size, _ := ParseSize("10.3G")
+	region := FreeRegion{Start: 2048, Size: 100 << 21}
+
+	tests := []struct {
+		sectorSize uint64
+		want       string
+	}{
+		// -b is the region start of 2048 512-byte units in the disk's sectors
+		{512, "gpart add -t freebsd-ufs -b 2048 -s 21600665 ada3"},
+		{4096, "gpart add -t freebsd-ufs -b 256 -s 2700083 ada3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%d-byte sectors", tt.sectorSize), func(t *testing.T) {
+			fake := useFakeRunner(t)
+			fake.Respond("diskinfo -v ada3", diskinfoVerbose("ada3", tt.sectorSize), nil)
+
+			if err := CreatePartitionInRegion("ada3", region, size, "freebsd-ufs", ""); err != nil {
+				t.Fatalf("CreatePartitionInRegion: %v", err)
+			}
+			adds := gpartLines(fake.Lines(), "gpart add")
+			if len(adds) != 1 || adds[0] != tt.want {
+				t.Errorf("ran %q, want %q", adds, tt.want)
+			}
+		})
+	}
+}
+
+func TestResizePartitionSizeInSectors(t *testing.T) {
+	size, _ := ParseSize("10.3G")
+
+	tests := []struct {
+		sectorSize uint64
+		want       string
+	}{
+		{512, "gpart resize -i 2 -s 21600665 ada3"},
+		{4096, "gpart resize -i 2 -s 2700083 ada3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%d-byte sectors", tt.sectorSize), func(t *testing.T) {
+			fake := useFakeRunner(t)
+			fake.Respond("diskinfo -v ada3", diskinfoVerbose("ada3", tt.sectorSize), nil)
+
+			if err := ResizePartition("ada3", "2", size, false); err != nil {
+				t.Fatalf("ResizePartition: %v", err)
+			}
+			resizes := gpartLines(fake.Lines(), "gpart resize")
+			if len(resizes) != 1 || resizes[0] != tt.want {
+				t.Errorf("ran %q, want %q", resizes, tt.want)
+			}
+		})
+	}
+}
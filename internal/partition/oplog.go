@@ -0,0 +1,25 @@
+package partition
+
+import "fmt"
+
+// OperationLogger receives a running account of a long operation such as
+// a copy: Step when it moves on to a new step and Log for detail like the
+// commands it runs and their output
+type OperationLogger interface {
+	Step(description string)
+	Log(line string)
+}
+
+// logStep reports a new step to logger, which may be nil
+func logStep(logger OperationLogger, format string, args ...interface{}) {
+	if logger != nil {
+		logger.Step(fmt.Sprintf(format, args...))
+	}
+}
+
+// logLine reports a line of detail to logger, which may be nil
+func logLine(logger OperationLogger, format string, args ...interface{}) {
+	if logger != nil {
+		logger.Log(fmt.Sprintf(format, args...))
+	}
+}
@@ -1,48 +1,105 @@
 package partition
 
 import (
+	"encoding/json"
 	"fmt"
+	"math"
 	"os/exec"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 )
 
+// Partition describes one entry of a partition table. Size, Start and End
+// are in 512-byte units whatever the sector size of the disk; the JSON form
+// gives the size in bytes.
 type Partition struct {
-	Name       string
-	Type       string
-	Size       uint64
-	Start      uint64
-	End        uint64
-	FileSystem string
-	Label      string
-	MountPoint string
+	Name       string `json:"name"`
+	Type       string `json:"type"`
+	Size       uint64 `json:"size"`
+	Start      uint64 `json:"start_sector"`
+	End        uint64 `json:"end_sector"`
+	FileSystem string `json:"filesystem"`
+	Label      string `json:"label"`
+	MountPoint string `json:"mount_point"`
+
+	// UUID is the GPT partition GUID (gpart's rawuuid), which unlike the
+	// device name stays the same across boots. Other schemes have none.
+	UUID string `json:"uuid"`
+
+	// SizeUnknown is set when gpart reported a size of zero or one that
+	// runs past the end of the partition table
+	SizeUnknown bool `json:"size_unknown"`
 }
 
 type Disk struct {
-	Name       string
-	Model      string
-	Size       uint64
-	SectorSize uint64
-	Scheme     string
-	Partitions []Partition
-	Device     string
+	Name       string      `json:"name"`
+	Model      string      `json:"model"`
+	Size       uint64      `json:"size"`
+	SectorSize uint64      `json:"sector_size"`
+	Scheme     string      `json:"scheme"`
+	Partitions []Partition `json:"partitions"`
+	Device     string      `json:"device"`
+
+	// RAIDMemberOf names the software RAID set this disk is a component of
+	RAIDMemberOf string `json:"raid_member_of,omitempty"`
+	// RAIDType is set for synthetic disks representing a RAID set (mirror, stripe, raid)
+	RAIDType string `json:"raid_type,omitempty"`
+
+	// TableState reports uncommitted or corrupt partition table state
+	TableState TableState `json:"table_state"`
+
+	// LayoutProblem explains why no partitions could be read from a disk
+	// that may have some, e.g. because gpart failed. It is empty when the
+	// layout was read successfully.
+	LayoutProblem string `json:"layout_problem,omitempty"`
 }
 
 func GetDisks() ([]Disk, error) {
+	if fakeDisks != nil {
+		return fakeDisks.getDisks(), nil
+	}
+
 	cmd := exec.Command("geom", "disk", "list")
-	output, err := cmd.CombinedOutput()
+	output, err := runCommand(cmd)
 	if err != nil {
 		return nil, fmt.Errorf("failed to execute geom disk list: %w (output: %s)", err, string(output))
 	}
 
 	disks := parseGeomDiskList(string(output))
 
+	// Flag RAID members and add the RAID devices themselves
+	sets := GetRAIDSets()
+	for i := range disks {
+		if set := RAIDSetForDisk(disks[i].Name, sets); set != nil {
+			disks[i].RAIDMemberOf = set.Name
+		}
+	}
+	for _, set := range sets {
+		disks = append(disks, raidDisk(set))
+	}
+	disks = append(disks, getImageDisks()...)
+
 	for i := range disks {
-		parts, err := getPartitions(disks[i].Name)
-		if err != nil {
+		parts, state, scheme, err := readPartitionTable(disks[i].Name)
+		if err == nil && len(parts) > 0 {
+			disks[i].Partitions = parts
+			disks[i].Scheme = scheme
+			disks[i].TableState = state
 			continue
 		}
-		disks[i].Partitions = parts
+
+		// Tell a blank disk apart from one whose layout couldn't be read
+		disks[i].Scheme, disks[i].LayoutProblem = diagnoseLayout(disks[i].Name)
+		disks[i].TableState = state
+	}
+
+	// BSD labels in MBR slices are partition tables of their own
+	for _, disk := range disks {
+		if disk.Scheme == "MBR" {
+			disks = append(disks, bsdLabelDisks(disk)...)
+		}
 	}
 
 	return disks, nil
@@ -93,19 +150,68 @@ func parseGeomDiskList(output string) []Disk {
 }
 
 func getPartitions(diskName string) ([]Partition, error) {
+	parts, _, err := getPartitionTable(diskName)
+	return parts, err
+}
+
+// getPartitionTable returns a disk's partitions along with the state of its table
+func getPartitionTable(diskName string) ([]Partition, TableState, error) {
+	parts, state, _, err := readPartitionTable(diskName)
+	return parts, state, err
+}
+
+// readPartitionTable is getPartitionTable that also returns the scheme of
+// the table, e.g. GPT, MBR or BSD
+func readPartitionTable(diskName string) ([]Partition, TableState, string, error) {
+	if fakeDisks != nil {
+		parts, err := fakeDisks.getPartitions(diskName)
+		return parts, TableState{}, fakeDisks.scheme(diskName), err
+	}
+
 	cmd := exec.Command("gpart", "show", "-p", diskName)
-	output, err := cmd.CombinedOutput()
+	output, err := runCommand(cmd)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get partitions: %w", err)
+		return nil, TableState{}, "", fmt.Errorf("failed to get partitions: %w", err)
+	}
+
+	parts, err := parseGpartShow(string(output))
+	if err != nil {
+		return nil, TableState{}, "", err
+	}
+	normalizeSectors(parts, deviceSectorSize(diskName))
+	labels := getPartitionLabels(diskName)
+	uuids := getPartitionUUIDs(diskName)
+	for i := range parts {
+		parts[i].Label = labels[parts[i].Name]
+		parts[i].UUID = uuids[parts[i].Name]
+	}
+	detectFilesystems(parts)
+
+	state := parseGpartShowState(string(output))
+	if !state.Modified {
+		state.Modified = getTableModified(diskName)
 	}
 
-	return parseGpartShow(string(output))
+	return parts, state, parseGpartShowScheme(string(output)), nil
 }
 
+// parseGpartShow reads the partitions from gpart show -p output, whose
+// lines give the start, size, provider name and type of each partition:
+//
+//	=>      40  976773088  ada0  GPT  (466G)
+//	        40     409600  ada0p1  efi  (200M)
+//	    409640  976363488  ada0p2  freebsd-ufs  (466G)
+//
+// Providers are named for the scheme, e.g. ada0s1 in an MBR table and
+// ada0s1a in the BSD label on that slice. Free space lines are skipped.
 func parseGpartShow(output string) ([]Partition, error) {
 	var partitions []Partition
 	lines := strings.Split(output, "\n")
 
+	// The "=>" header gives the usable range of the table, e.g.
+	// =>       40  976773088  ada0  GPT  (466G)
+	var tableEnd uint64
+
 	for _, line := range lines {
 		line = strings.TrimSpace(line)
 		if line == "" {
@@ -113,6 +219,18 @@ func parseGpartShow(output string) ([]Partition, error) {
 		}
 
 		if strings.HasPrefix(line, "=>") {
+			header := strings.Fields(strings.TrimPrefix(line, "=>"))
+			if len(header) >= 2 {
+				start, err1 := strconv.ParseUint(header[0], 10, 64)
+				size, err2 := strconv.ParseUint(header[1], 10, 64)
+				if err1 == nil && err2 == nil && start+size >= start {
+					tableEnd = start + size
+				}
+			}
+			continue
+		}
+
+		if strings.Contains(line, "- free -") {
 			continue
 		}
 
@@ -128,20 +246,15 @@ func parseGpartShow(output string) ([]Partition, error) {
 					End:   start + size,
 				}
 
-				if len(fields) >= 3 {
-					part.Type = fields[2]
+				// Flag sizes that can't be real rather than trusting them
+				if size == 0 || part.End < start || (tableEnd > 0 && part.End > tableEnd) {
+					part.SizeUnknown = true
 				}
-				if len(fields) >= 4 {
-					part.Name = fields[3]
-				}
-
-				if part.Name != "" && !strings.HasPrefix(part.Name, "-") {
-					fs, _ := getFileSystem(part.Name)
-					part.FileSystem = fs
 
-					mp, _ := getMountPoint(part.Name)
-					part.MountPoint = mp
+				part.Name = fields[2]
+				part.Type = fields[3]
 
+				if part.Name != "" && !strings.HasPrefix(part.Name, "-") {
 					partitions = append(partitions, part)
 				}
 			}
@@ -151,10 +264,179 @@ func parseGpartShow(output string) ([]Partition, error) {
 	return partitions, nil
 }
 
+// LookupPartition returns the partition at a gpart index on disk. BSD label
+// partitions can be given by slice and letter, e.g. index 1a on ada0 for
+// ada0s1a.
+func LookupPartition(disk, index string) (*Partition, error) {
+	geom, gpartIndex := bsdLabelTarget(disk, index)
+	n, err := strconv.Atoi(gpartIndex)
+	if err != nil {
+		return nil, fmt.Errorf("invalid partition index: %s", index)
+	}
+
+	partitions, _, err := getPartitionTable(geom)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range partitions {
+		if partitionIndex(partitions[i]) == n {
+			return &partitions[i], nil
+		}
+	}
+	return nil, fmt.Errorf("no partition with index %s on %s", index, disk)
+}
+
+// RefreshPartitionFilesystems re-detects the filesystem and mount point of
+// each of the disk's partitions in place, without re-reading the partition
+// table. It is much faster than GetDisks after an operation that only
+// changes filesystems, such as a format.
+func RefreshPartitionFilesystems(disk *Disk) error {
+	if fakeDisks != nil {
+		return fakeDisks.refreshFilesystems(disk)
+	}
+
+	return detectFilesystems(disk.Partitions)
+}
+
+// maxDetectWorkers bounds the fstyp/file processes detectFilesystems runs
+// at once. BenchmarkDetectFilesystems sets it to 1 for the sequential
+// baseline.
+var maxDetectWorkers = 8
+
+// detectFilesystems fills in the filesystem and mount point of each
+// partition in place. mount is run once for all of them and the
+// filesystems are probed concurrently, each worker writing only its own
+// partitions, so their order is unchanged.
+func detectFilesystems(parts []Partition) error {
+	mounts, mountErr := readMountTable()
+
+	workers := maxDetectWorkers
+	if len(parts) < workers {
+		workers = len(parts)
+	}
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				// getFileSystem reports unrecognised partitions as
+				// "unknown" rather than failing
+				parts[i].FileSystem, _ = getFileSystem(parts[i].Name)
+			}
+		}()
+	}
+	for i := range parts {
+		parts[i].MountPoint = mounts[parts[i].Name]
+		if parts[i].MountPoint == "" && parts[i].Label != "" {
+			// Mounted through its label, as MountPartition prefers
+			parts[i].MountPoint = mounts["gpt/"+parts[i].Label]
+		}
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	if mountErr != nil {
+		return fmt.Errorf("failed to detect mount points: %w", mountErr)
+	}
+	return nil
+}
+
+// readMountTable runs mount once and maps the device names of mounted
+// filesystems, without /dev/, to their mount points. A filesystem mounted
+// through a label, such as gpt/rootfs or gptid/<uuid> as MountPartition
+// does, is also listed under the partition glabel status says the label is
+// on, so a partition is found mounted whichever of its names was used.
+func readMountTable() (map[string]string, error) {
+	output, err := Runner.Run("mount")
+	if err != nil {
+		return nil, err
+	}
+	mounts := parseMountTable(string(output))
+
+	for device := range mounts {
+		if strings.Contains(device, "/") {
+			// Without glabel the raw names still work
+			labels, _ := Runner.Run("glabel", "status", "-s")
+			resolveLabelMounts(mounts, parseGlabelStatus(string(labels)))
+			break
+		}
+	}
+	return mounts, nil
+}
+
+// parseGlabelStatus maps each label in glabel status -s output to the
+// provider it is on:
+//
+//	gpt/rootfs  N/A  ada0p2
+//	gptid/5f3c0004-8d2e-11ee-b9d1-0242ac120006  N/A  ada0p2
+func parseGlabelStatus(output string) map[string]string {
+	providers := make(map[string]string)
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 || fields[0] == "Name" {
+			continue
+		}
+		providers[fields[0]] = fields[len(fields)-1]
+	}
+	return providers
+}
+
+// resolveLabelMounts adds the mount point of each label device in mounts
+// under the provider the label is on, unless the provider is mounted
+// under its own name too
+func resolveLabelMounts(mounts, providers map[string]string) {
+	labels := make([]string, 0, len(mounts))
+	for device := range mounts {
+		if _, ok := providers[device]; ok {
+			labels = append(labels, device)
+		}
+	}
+	// Mounted twice through different labels, the first in sorted order
+	// is reported, so the result doesn't depend on map order
+	sort.Strings(labels)
+	for _, label := range labels {
+		provider := providers[label]
+		if _, seen := mounts[provider]; !seen {
+			mounts[provider] = mounts[label]
+		}
+	}
+}
+
+// parseMountTable parses FreeBSD mount output such as
+//
+//	/dev/ada0p2 on / (ufs, local, journaled soft-updates)
+//
+// Mount points may contain spaces, so the mount point is everything
+// between " on " and the last " (".
+func parseMountTable(output string) map[string]string {
+	mounts := make(map[string]string)
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		on := strings.Index(line, " on ")
+		if on < 0 {
+			continue
+		}
+		device := strings.TrimPrefix(line[:on], "/dev/")
+		mountPoint := line[on+len(" on "):]
+		if paren := strings.LastIndex(mountPoint, " ("); paren >= 0 {
+			mountPoint = mountPoint[:paren]
+		}
+		if _, seen := mounts[device]; !seen {
+			mounts[device] = mountPoint
+		}
+	}
+	return mounts
+}
+
 func getFileSystem(partName string) (string, error) {
 	// Try fstyp first (FreeBSD native filesystem type detection)
 	cmd := exec.Command("fstyp", "/dev/"+partName)
-	output, err := cmd.CombinedOutput()
+	output, err := runCommand(cmd)
 
 	if err == nil && len(output) > 0 {
 		fsType := strings.TrimSpace(string(output))
@@ -164,6 +446,10 @@ func getFileSystem(partName string) (string, error) {
 			return "UFS", nil
 		case strings.HasPrefix(fsType, "zfs"):
 			return "ZFS", nil
+		case fsType == "geli":
+			return "GELI", nil
+		case strings.Contains(fsType, "exfat"):
+			return "exFAT", nil
 		case strings.Contains(fsType, "msdos") || strings.Contains(fsType, "fat"):
 			return "FAT32", nil
 		case strings.HasPrefix(fsType, "ext2"):
@@ -184,7 +470,7 @@ func getFileSystem(partName string) (string, error) {
 
 	// Fallback to file command
 	cmd = exec.Command("file", "-s", "/dev/"+partName)
-	output, err = cmd.CombinedOutput()
+	output, err = runCommand(cmd)
 	if err != nil {
 		return "unknown", nil
 	}
@@ -197,6 +483,8 @@ func getFileSystem(partName string) (string, error) {
 		return "UFS", nil
 	case strings.Contains(outStr, "zfs"):
 		return "ZFS", nil
+	case strings.Contains(outStr, "exfat"):
+		return "exFAT", nil
 	case strings.Contains(outStr, "fat") || strings.Contains(outStr, "msdos"):
 		return "FAT32", nil
 	case strings.Contains(outStr, "ext4"):
@@ -216,50 +504,45 @@ func getFileSystem(partName string) (string, error) {
 	return "unknown", nil
 }
 
+// getMountPoint returns where a partition is mounted, or "" if it isn't.
+// The device must match exactly, so ada0p1 doesn't match /dev/ada0p10.
 func getMountPoint(partName string) (string, error) {
-	cmd := exec.Command("mount")
-	output, err := cmd.CombinedOutput()
+	if fakeDisks != nil {
+		return fakeDisks.mountPoint(partName), nil
+	}
+
+	mounts, err := readMountTable()
 	if err != nil {
 		return "", err
 	}
+	return mounts[strings.TrimPrefix(partName, "/dev/")], nil
+}
 
-	lines := strings.Split(string(output), "\n")
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if line == "" {
-			continue
-		}
-
-		// FreeBSD mount format: /dev/ada0p2 on / (ufs, local, journaled soft-updates)
-		// Look for the partition name with or without /dev/ prefix
-		if strings.Contains(line, "/dev/"+partName) || strings.Contains(line, partName) {
-			// Split and look for "on" keyword
-			parts := strings.Fields(line)
-			for i, part := range parts {
-				if part == "on" && i+1 < len(parts) {
-					// The mount point is right after "on"
-					mountPoint := parts[i+1]
-					// Remove any trailing parenthesis or other characters
-					if idx := strings.Index(mountPoint, "("); idx > 0 {
-						mountPoint = mountPoint[:idx]
-					}
-					return mountPoint, nil
-				}
-			}
+// MarshalJSON encodes the partition with its size in bytes
+func (p Partition) MarshalJSON() ([]byte, error) {
+	type plain Partition
+	return json.Marshal(struct {
+		plain
+		Size uint64 `json:"size"`
+	}{plain(p), p.Size * 512})
+}
 
-			// Fallback: try old method (assume mount point is at index 2)
-			if len(parts) >= 3 {
-				mountPoint := parts[2]
-				// Clean up the mount point
-				if idx := strings.Index(mountPoint, "("); idx > 0 {
-					mountPoint = mountPoint[:idx]
-				}
-				return mountPoint, nil
-			}
-		}
+// MarshalJSON encodes the disk with an empty partition list as [] rather
+// than null
+func (d Disk) MarshalJSON() ([]byte, error) {
+	type plain Disk
+	if d.Partitions == nil {
+		d.Partitions = []Partition{}
 	}
+	return json.Marshal(plain(d))
+}
 
-	return "", nil
+// DisplaySize returns the partition size for display, or "?" if it is unknown
+func (p *Partition) DisplaySize() string {
+	if p.SizeUnknown || p.Size == 0 {
+		return "?"
+	}
+	return FormatBytes(p.Size * 512)
 }
 
 func FormatBytes(bytes uint64) string {
@@ -280,3 +563,55 @@ func FormatBytes(bytes uint64) string {
 
 	return fmt.Sprintf("%.2f %s", float64(bytes)/float64(div), units[exp])
 }
+
+// MaxParsedSize is the largest size ParseSize accepts (1 EiB), well beyond
+// any real disk
+const MaxParsedSize uint64 = 1 << 60
+
+// ParseSize parses a size in bytes such as "10G", "512M", "1.5G", "4K" or
+// "1024". The K, M, G and T suffixes are powers of 1024; a plain number is
+// a count of bytes.
+func ParseSize(text string) (uint64, error) {
+	if len(text) == 0 {
+		return 0, fmt.Errorf("empty size string")
+	}
+
+	var multiplier uint64 = 1
+	numStr := text
+	switch text[len(text)-1] {
+	case 'T', 't':
+		multiplier = 1024 * 1024 * 1024 * 1024
+		numStr = text[:len(text)-1]
+	case 'G', 'g':
+		multiplier = 1024 * 1024 * 1024
+		numStr = text[:len(text)-1]
+	case 'M', 'm':
+		multiplier = 1024 * 1024
+		numStr = text[:len(text)-1]
+	case 'K', 'k':
+		multiplier = 1024
+		numStr = text[:len(text)-1]
+	}
+
+	num, err := strconv.ParseFloat(numStr, 64)
+	if err != nil || math.IsNaN(num) || math.IsInf(num, 0) {
+		return 0, fmt.Errorf("invalid number: %s", numStr)
+	}
+
+	if num <= 0 {
+		return 0, fmt.Errorf("size must be positive")
+	}
+
+	// Check the bound in floating point before converting, since an
+	// out-of-range float64 to uint64 conversion is undefined
+	size := num * float64(multiplier)
+	if size > float64(MaxParsedSize) {
+		return 0, fmt.Errorf("size %s is too large (maximum is %s)", text, FormatBytes(MaxParsedSize))
+	}
+
+	if size < 1 {
+		return 0, fmt.Errorf("size %s is smaller than one byte", text)
+	}
+
+	return uint64(size), nil
+}
@@ -0,0 +1,241 @@
+package partition
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseMountTable(t *testing.T) {
+	output := `/dev/ada0p2 on / (ufs, local, journaled soft-updates)
+devfs on /dev (devfs)
+/dev/ada0p10 on /var (ufs, local, soft-updates)
+/dev/ada1p1 on /mnt/My Files (ufs, local)
+/dev/gpt/data on /data (ufs, local)
+/dev/da0s1 on /mnt/usb (msdosfs, local)
+/dev/da0s1 on /mnt/again (msdosfs, local)
+tank/home on /home (zfs, local, nfsv4acls)
+`
+	want := map[string]string{
+		"ada0p2":    "/",
+		"devfs":     "/dev",
+		"ada0p10":   "/var",
+		"ada1p1":    "/mnt/My Files",
+		"gpt/data":  "/data",
+		"da0s1":     "/mnt/usb",
+		"tank/home": "/home",
+	}
+	mounts := parseMountTable(output)
+	if !reflect.DeepEqual(mounts, want) {
+		t.Errorf("parseMountTable() = %v, want %v", mounts, want)
+	}
+
+	// ada0p1 must not match ada0p10
+	if mountPoint, ok := mounts["ada0p1"]; ok {
+		t.Errorf("ada0p1 found mounted at %q", mountPoint)
+	}
+}
+
+func TestParseGlabelStatus(t *testing.T) {
+	output := `                                      Name  Status  Components
+                                  gpt/data     N/A  ada1p1
+gptid/5f3c0004-8d2e-11ee-b9d1-0242ac120006     N/A  ada1p1
+                              gpt/efiboot0     N/A  ada0p1
+`
+	want := map[string]string{
+		"gpt/data": "ada1p1",
+		"gptid/5f3c0004-8d2e-11ee-b9d1-0242ac120006": "ada1p1",
+		"gpt/efiboot0": "ada0p1",
+	}
+	if got := parseGlabelStatus(output); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseGlabelStatus() = %v, want %v", got, want)
+	}
+}
+
+func TestResolveLabelMounts(t *testing.T) {
+	mounts := map[string]string{
+		"gpt/data": "/data",
+		"gptid/5f3c0004-8d2e-11ee-b9d1-0242ac120006": "/backup",
+		"ada0p2":       "/",
+		"gpt/rootfs":   "/mnt/root",
+		"gpt/unlisted": "/mnt/x",
+	}
+	providers := map[string]string{
+		"gpt/data": "ada1p1",
+		"gptid/5f3c0004-8d2e-11ee-b9d1-0242ac120006": "ada1p3",
+		"gpt/rootfs": "ada0p2",
+	}
+	resolveLabelMounts(mounts, providers)
+
+	for device, want := range map[string]string{
+		"ada1p1": "/data",
+		"ada1p3": "/backup",
+		"ada0p2": "/", // mounted under its own name as well
+	} {
+		if got := mounts[device]; got != want {
+			t.Errorf("mounts[%q] = %q, want %q", device, got, want)
+		}
+	}
+}
+
+func TestGetMountPointFollowsLabels(t *testing.T) {
+	fake := useFakeRunner(t)
+	fake.Respond("mount", "/dev/ada0p2 on / (ufs, local, soft-updates)\n/dev/gpt/data on /data (ufs, local)\n", nil)
+	fake.Respond("glabel status -s", "gpt/data  N/A  ada1p1\n", nil)
+
+	for name, want := range map[string]string{"ada1p1": "/data", "/dev/ada0p2": "/", "ada1p2": ""} {
+		got, err := getMountPoint(name)
+		if err != nil {
+			t.Fatalf("getMountPoint(%q): %v", name, err)
+		}
+		if got != want {
+			t.Errorf("getMountPoint(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestParseGpartShow(t *testing.T) {
+	const header = "=>      40  2097072  ada3  GPT  (1.0G)\n"
+
+	tests := []struct {
+		name   string
+		output string
+		want   []Partition
+	}{
+		{
+			"sizes within the table",
+			header + "        40   409600  ada3p1  efi  (200M)\n    409640  1687472  ada3p2  freebsd-ufs  (824M)\n",
+			[]Partition{
+				{Name: "ada3p1", Type: "efi", Start: 40, Size: 409600, End: 409640},
+				{Name: "ada3p2", Type: "freebsd-ufs", Start: 409640, Size: 1687472, End: 2097112},
+			},
+		},
+		{
+			"zero size",
+			header + "        40        0  ada3p1  freebsd-ufs  (0B)\n",
+			[]Partition{{Name: "ada3p1", Type: "freebsd-ufs", Start: 40, Size: 0, End: 40, SizeUnknown: true}},
+		},
+		{
+			"past the end of the table",
+			header + "        40  4194304  ada3p1  freebsd-ufs  (2.0G)\n",
+			[]Partition{{Name: "ada3p1", Type: "freebsd-ufs", Start: 40, Size: 4194304, End: 4194344, SizeUnknown: true}},
+		},
+		{
+			"end overflows",
+			header + "        40  18446744073709551615  ada3p1  freebsd-ufs  (16E)\n",
+			[]Partition{{Name: "ada3p1", Type: "freebsd-ufs", Start: 40, Size: 18446744073709551615, End: 39, SizeUnknown: true}},
+		},
+		{
+			"no header to check against",
+			"        40  4194304  ada3p1  freebsd-ufs  (2.0G)\n",
+			[]Partition{{Name: "ada3p1", Type: "freebsd-ufs", Start: 40, Size: 4194304, End: 4194344}},
+		},
+		{
+			"malformed rows and free space",
+			header +
+				"        40   409600  ada3p1\n" +
+				"       abc   409600  ada3p2  efi  (200M)\n" +
+				"        40      xyz  ada3p3  efi  (200M)\n" +
+				"    409640  1687472        - free -  (824M)\n" +
+				"gpart: No such geom: ada9.\n",
+			nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseGpartShow(tt.output)
+			if err != nil {
+				t.Fatalf("parseGpartShow: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseGpartShow = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		text    string
+		want    uint64
+		wantErr bool
+	}{
+		{"10G", 10 << 30, false},
+		{"512M", 512 << 20, false},
+		{"1.5G", 3 << 29, false},
+		{"1.5g", 3 << 29, false},
+		{"4K", 4096, false},
+		{"2T", 2 << 40, false},
+		{"1024", 1024, false},
+		{"10.3G", 11059540787, false},
+		{"1", 1, false},
+		{"1048576T", MaxParsedSize, false},
+		{"1048577T", 0, true},
+		{"1e30", 0, true},
+		{"18446744073709551616", 0, true},
+		{"99999999999999999999G", 0, true},
+		{"NaN", 0, true},
+		{"NaNG", 0, true},
+		{"Inf", 0, true},
+		{"+InfM", 0, true},
+		{"-Inf", 0, true},
+		{"0.5", 0, true},
+		{"0.0001K", 0, true},
+		{"0", 0, true},
+		{"0G", 0, true},
+		{"-1G", 0, true},
+		{"", 0, true},
+		{"G", 0, true},
+		{"ten", 0, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseSize(tt.text)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseSize(%q) error = %v, wantErr %v", tt.text, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseSize(%q) = %d, want %d", tt.text, got, tt.want)
+		}
+	}
+}
+
+// slowFstypRunner is a FakeRunner whose fstyp takes latency to answer, as
+// it does on a real disk
+type slowFstypRunner struct {
+	*FakeRunner
+	latency time.Duration
+}
+
+func (r *slowFstypRunner) Run(name string, args ...string) ([]byte, error) {
+	if name == "fstyp" {
+		time.Sleep(r.latency)
+	}
+	return r.FakeRunner.Run(name, args...)
+}
+
+func BenchmarkDetectFilesystems(b *testing.B) {
+	runner := &slowFstypRunner{FakeRunner: NewFakeRunner(), latency: 5 * time.Millisecond}
+	parts := make([]Partition, 16)
+	for i := range parts {
+		parts[i].Name = fmt.Sprintf("ada0p%d", i+1)
+		runner.Respond("fstyp /dev/"+parts[i].Name, "ufs\n", nil)
+	}
+	savedRunner, savedWorkers := Runner, maxDetectWorkers
+	Runner = runner
+	b.Cleanup(func() { Runner, maxDetectWorkers = savedRunner, savedWorkers })
+
+	for _, workers := range []int{1, savedWorkers} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			maxDetectWorkers = workers
+			for i := 0; i < b.N; i++ {
+				if err := detectFilesystems(parts); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package partition
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// PartitionType is a GPT partition type known to gpart
+type PartitionType struct {
+	Name  string // friendly name, e.g. "FreeBSD UFS"
+	Alias string // gpart type alias, e.g. "freebsd-ufs"
+	GUID  string // GPT type GUID, lower case
+}
+
+// partitionTypes lists the types offered when creating partitions, most
+// common first
+var partitionTypes = []PartitionType{
+	{Name: "FreeBSD UFS", Alias: "freebsd-ufs", GUID: "516e7cb6-6ecf-11d6-8ff8-00022d09712b"},
+	{Name: "FreeBSD swap", Alias: "freebsd-swap", GUID: "516e7cb5-6ecf-11d6-8ff8-00022d09712b"},
+	{Name: "FreeBSD ZFS", Alias: "freebsd-zfs", GUID: "516e7cba-6ecf-11d6-8ff8-00022d09712b"},
+	{Name: "FreeBSD boot", Alias: "freebsd-boot", GUID: "83bd6b9d-7f41-11dc-be0b-001560b84f0f"},
+	{Name: "EFI system", Alias: "efi", GUID: "c12a7328-f81f-11d2-ba4b-00a0c93ec93b"},
+	{Name: "Microsoft basic data", Alias: "ms-basic-data", GUID: "ebd0a0a2-b9e5-4433-87c0-68b6b72699c7"},
+	{Name: "Microsoft reserved", Alias: "ms-reserved", GUID: "e3c9e316-0b5c-4db8-817d-f92df00215ae"},
+	{Name: "Linux data", Alias: "linux-data", GUID: "0fc63daf-8483-4772-8e79-3d69d8477de4"},
+	{Name: "Linux swap", Alias: "linux-swap", GUID: "0657fd6d-a4ab-43c4-84e5-0933c84b4f4f"},
+	{Name: "Linux LVM", Alias: "linux-lvm", GUID: "e6d6d379-f507-44c2-a23c-238f2a3df928"},
+	{Name: "Apple HFS+", Alias: "apple-hfs", GUID: "48465300-0000-11aa-aa11-00306543ecac"},
+	{Name: "Apple APFS", Alias: "apple-apfs", GUID: "7c3457ef-0000-11aa-aa11-00306543ecac"},
+	{Name: "BIOS boot", Alias: "bios-boot", GUID: "21686148-6449-6e6f-744e-656564454649"},
+}
+
+// GetPartitionTypes returns the known partition types, most common first
+func GetPartitionTypes() []PartitionType {
+	types := make([]PartitionType, len(partitionTypes))
+	copy(types, partitionTypes)
+	return types
+}
+
+// PartitionTypeAliases returns the gpart aliases of the known partition
+// types, in the order of GetPartitionTypes, for type dropdowns
+func PartitionTypeAliases() []string {
+	aliases := make([]string, len(partitionTypes))
+	for i, t := range partitionTypes {
+		aliases[i] = t.Alias
+	}
+	return aliases
+}
+
+// TypeGUIDForAlias returns the GPT type GUID of a gpart type alias, e.g.
+// 516e7cb6-6ecf-11d6-8ff8-00022d09712b for freebsd-ufs
+func TypeGUIDForAlias(alias string) (string, bool) {
+	for _, t := range partitionTypes {
+		if t.Alias == alias {
+			return t.GUID, true
+		}
+	}
+	return "", false
+}
+
+// TypeAliasForGUID returns the gpart alias of a GPT type GUID, so raw
+// GUIDs can be shown and passed to gpart by name where one exists
+func TypeAliasForGUID(guid string) (string, bool) {
+	if !IsTypeGUID(guid) {
+		return "", false
+	}
+	guid = strings.ToLower(strings.TrimPrefix(guid, "!"))
+	for _, t := range partitionTypes {
+		if t.GUID == guid {
+			return t.Alias, true
+		}
+	}
+	return "", false
+}
+
+// ValidatePartitionType checks that a type is one of the known aliases or a
+// raw type GUID, which is how types missing from the registry are given
+func ValidatePartitionType(partType string) error {
+	if IsTypeGUID(partType) {
+		return nil
+	}
+	if _, ok := TypeGUIDForAlias(partType); ok {
+		return nil
+	}
+	return fmt.Errorf("unknown partition type %q (use one of %s, or a type GUID)",
+		partType, strings.Join(PartitionTypeAliases(), ", "))
+}
+
+// ChangePartitionType changes the type of a partition in place with gpart
+// modify. The data is left alone, so this is the way to fix a partition
+// whose type doesn't match its filesystem without recreating it.
+func ChangePartitionType(partName, newType string) error {
+	if err := CheckPrivileges(); err != nil {
+		return err
+	}
+	defer markDisksChanged()
+
+	if err := ValidatePartitionType(newType); err != nil {
+		return err
+	}
+
+	disk, index, err := ParsePartitionName(partName)
+	if err != nil {
+		return err
+	}
+
+	if err := CheckNotInFlight(partName); err != nil {
+		return err
+	}
+
+	gptype, err := gpartType(newType)
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command("gpart", "modify", "-i", index, "-t", gptype, disk)
+	if dryRun(cmd) {
+		return nil
+	}
+
+	if fakeDisks != nil {
+		return fakeDisks.setPartitionType(partName, newType)
+	}
+
+	output, err := runCommand(cmd)
+	if err != nil {
+		return ExplainDiskGone(disk, fmt.Errorf("failed to change the type of %s to %s: %w (output: %s)",
+			partName, newType, err, strings.TrimSpace(string(output))))
+	}
+
+	return nil
+}
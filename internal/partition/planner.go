@@ -0,0 +1,167 @@
+package partition
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// gptFirstUsableSector is where gpart places the first partition on an
+// empty GPT disk with 512-byte sectors
+const gptFirstUsableSector = 40
+
+// gptBackupSectors is the space reserved for the backup GPT at the end of the disk
+const gptBackupSectors = 33
+
+// PlannedPartition is a proposed partition in a capacity plan. Either Size
+// (in bytes) or Percent (of the free space) is set.
+type PlannedPartition struct {
+	Type    string
+	Size    uint64
+	Percent float64
+}
+
+// PlanEntry is a planned partition placed on the disk
+type PlanEntry struct {
+	PlannedPartition
+	Start   uint64 // byte offset
+	Bytes   uint64 // resolved size
+	Padding uint64 // bytes skipped before Start to align it
+}
+
+// LayoutPlan is the result of placing planned partitions in a disk's free
+// space. Nothing is written to the disk.
+type LayoutPlan struct {
+	Disk      string
+	Alignment uint64
+	FreeStart uint64
+	FreeBytes uint64
+	Entries   []PlanEntry
+	Used      uint64
+	Remaining uint64
+	Overflow  bool
+	Warnings  []string
+}
+
+// ParsePlanSize parses a planned size: a size such as "32G" or "512M" as
+// ParseSize reads it, or a percentage such as "25%". It returns either a
+// size in bytes or a percentage.
+func ParsePlanSize(text string) (size uint64, percent float64, err error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return 0, 0, fmt.Errorf("empty size")
+	}
+
+	if strings.HasSuffix(text, "%") {
+		percent, err = strconv.ParseFloat(strings.TrimSuffix(text, "%"), 64)
+		if err != nil || percent <= 0 || percent > 100 {
+			return 0, 0, fmt.Errorf("invalid percentage: %s", text)
+		}
+		return 0, percent, nil
+	}
+
+	size, err = ParseSize(text)
+	if err != nil {
+		return 0, 0, err
+	}
+	return size, 0, nil
+}
+
+// freeSpaceAfterPartitions returns the byte range following the last
+// partition on a disk
+func freeSpaceAfterPartitions(disk *Disk) (start, length uint64) {
+	startSector := uint64(gptFirstUsableSector)
+	for _, part := range disk.Partitions {
+		if part.End > startSector {
+			startSector = part.End
+		}
+	}
+
+	start = startSector * 512
+	end := disk.Size
+	if end > gptBackupSectors*512 {
+		end -= gptBackupSectors * 512
+	}
+
+	if start >= end {
+		return start, 0
+	}
+	return start, end - start
+}
+
+// PlanLayout places the planned partitions, in order, in the free space
+// after the disk's last partition. Each start is rounded up to alignment and
+// each size down to whole MiB, or whole alignment units if those are
+// larger, as gpart add -a rounds it, so the partitions after it stay
+// aligned.
+func PlanLayout(disk *Disk, alignment uint64, planned []PlannedPartition) *LayoutPlan {
+	if alignment == 0 {
+		alignment = Align1M
+	}
+
+	plan := &LayoutPlan{
+		Disk:      disk.Name,
+		Alignment: alignment,
+	}
+	plan.FreeStart, plan.FreeBytes = freeSpaceAfterPartitions(disk)
+	freeEnd := plan.FreeStart + plan.FreeBytes
+
+	sizeUnit := uint64(1024 * 1024)
+	if alignment > sizeUnit && alignment%sizeUnit == 0 {
+		sizeUnit = alignment
+	}
+
+	cursor := plan.FreeStart
+	for i, p := range planned {
+		entry := PlanEntry{PlannedPartition: p}
+
+		entry.Bytes = p.Size
+		if p.Percent > 0 {
+			entry.Bytes = uint64(float64(plan.FreeBytes) * p.Percent / 100)
+		}
+		entry.Bytes = entry.Bytes / sizeUnit * sizeUnit
+
+		entry.Start = CalculateAlignedOffset(cursor, alignment)
+		entry.Padding = entry.Start - cursor
+		cursor = entry.Start + entry.Bytes
+
+		if entry.Bytes == 0 {
+			plan.Warnings = append(plan.Warnings, fmt.Sprintf("Partition %d (%s) is smaller than 1 MiB", i+1, p.Type))
+		} else if err := CheckMinimumSize(entry.Bytes, p.Type); err != nil {
+			plan.Warnings = append(plan.Warnings, fmt.Sprintf("Partition %d: %v", i+1, err))
+		}
+
+		plan.Entries = append(plan.Entries, entry)
+	}
+
+	plan.Used = cursor - plan.FreeStart
+	if cursor > freeEnd {
+		plan.Overflow = true
+		plan.Warnings = append(plan.Warnings, fmt.Sprintf("Plan exceeds the free space by %s", FormatBytes(cursor-freeEnd)))
+	} else {
+		plan.Remaining = freeEnd - cursor
+	}
+
+	return plan
+}
+
+// BatchOperations returns create operations that carry out the plan. Each
+// creates its partition at the planned start with the plan's alignment, so
+// the partitions land where the plan shows them rather than wherever gpart
+// finds room.
+func (p *LayoutPlan) BatchOperations() []*BatchOperation {
+	ops := make([]*BatchOperation, 0, len(p.Entries))
+	for _, entry := range p.Entries {
+		ops = append(ops, &BatchOperation{
+			Type:           OpCreate,
+			Disk:           p.Disk,
+			Size:           entry.Bytes,
+			Start:          entry.Start,
+			Alignment:      p.Alignment,
+			FilesystemType: entry.Type,
+			Description: fmt.Sprintf("Create %s %s partition on %s at %s",
+				FormatBytes(entry.Bytes), entry.Type, p.Disk, FormatBytes(entry.Start)),
+		})
+	}
+	return ops
+}
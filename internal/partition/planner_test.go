@@ -0,0 +1,79 @@
+package partition
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestParsePlanSize(t *testing.T) {
+	tests := []struct {
+		text        string
+		wantSize    uint64
+		wantPercent float64
+		wantErr     bool
+	}{
+		{"32G", 32 << 30, 0, false},
+		{"512M", 512 << 20, 0, false},
+		{"1.5G", 3 << 29, 0, false},
+		{"1024", 1024, 0, false}, // bytes, as everywhere else
+		{" 25% ", 0, 25, false},
+		{"0%", 0, 0, true},
+		{"101%", 0, 0, true},
+		{"", 0, 0, true},
+		{"big", 0, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			size, percent, err := ParsePlanSize(tt.text)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParsePlanSize(%q) error = %v, wantErr %v", tt.text, err, tt.wantErr)
+			}
+			if size != tt.wantSize || percent != tt.wantPercent {
+				t.Errorf("ParsePlanSize(%q) = %d, %v; want %d, %v", tt.text, size, percent, tt.wantSize, tt.wantPercent)
+			}
+		})
+	}
+}
+
+func TestPlanBatchOperationsCreateAtPlannedStarts(t *testing.T) {
+	disk := &Disk{
+		Name:       "ada3",
+		Size:       100 << 30,
+		Partitions: []Partition{{Name: "ada3p1", Start: 40, Size: 2048, End: 2088}},
+	}
+	plan := PlanLayout(disk, Align1M, []PlannedPartition{
+		{Type: "freebsd-ufs", Size: 10 << 30},
+		{Type: "freebsd-swap", Size: 2<<30 + 12345},
+	})
+
+	fake := useFakeRunner(t)
+	bq := NewBatchQueue()
+	for _, op := range plan.BatchOperations() {
+		if err := bq.executeOperation(context.Background(), op); err != nil {
+			t.Fatalf("%s: %v", op.Description, err)
+		}
+	}
+
+	var adds []string
+	for _, line := range fake.Lines() {
+		if strings.HasPrefix(line, "gpart add") {
+			adds = append(adds, line)
+		}
+	}
+	// The first partition ends at sector 2088, so the plan starts at the
+	// next MiB (sector 4096); the second right after the first's 10 GiB
+	want := []string{
+		"gpart add -t freebsd-ufs -b 4096 -s 20971520 -a 2048 ada3",
+		"gpart add -t freebsd-swap -b 20975616 -s 4194304 -a 2048 ada3",
+	}
+	if len(adds) != len(want) {
+		t.Fatalf("ran %q, want %q", adds, want)
+	}
+	for i := range want {
+		if adds[i] != want[i] {
+			t.Errorf("partition %d: ran %q, want %q", i+1, adds[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package partition
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// maxStandbyTimeout is the longest standby timer ATA drives accept (5.5 hours)
+const maxStandbyTimeout = 19800
+
+// PowerManagement describes the ATA power management features of a disk
+type PowerManagement struct {
+	Supported    bool // standby/idle commands
+	APMSupported bool
+	APMEnabled   bool
+	APMLevel     int
+}
+
+// parsePowerManagement reads the feature table of camcontrol identify:
+//
+//	Feature                      Support  Enabled   Value           Vendor
+//	power management               yes      yes
+//	advanced power management      yes      yes     128/0x80
+func parsePowerManagement(output string) PowerManagement {
+	var pm PowerManagement
+
+	for _, line := range strings.Split(output, "\n") {
+		lower := strings.ToLower(strings.TrimSpace(line))
+
+		var rest string
+		isAPM := false
+		switch {
+		case strings.HasPrefix(lower, "power management"):
+			rest = strings.TrimPrefix(lower, "power management")
+		case strings.HasPrefix(lower, "advanced power management"):
+			rest = strings.TrimPrefix(lower, "advanced power management")
+			isAPM = true
+		default:
+			continue
+		}
+
+		fields := strings.Fields(rest)
+		supported := len(fields) >= 1 && fields[0] == "yes"
+		enabled := len(fields) >= 2 && fields[1] == "yes"
+
+		if !isAPM {
+			pm.Supported = supported
+			continue
+		}
+
+		pm.APMSupported = supported
+		pm.APMEnabled = enabled
+		if enabled && len(fields) >= 3 {
+			level := strings.SplitN(fields[2], "/", 2)[0]
+			pm.APMLevel, _ = strconv.Atoi(level)
+		}
+	}
+
+	return pm
+}
+
+// GetPowerManagement returns the power management features of a disk.
+// Drives that camcontrol can't identify (e.g. NVMe) report no support.
+func GetPowerManagement(diskName string) PowerManagement {
+	if fakeDisks != nil {
+		if info, err := fakeDisks.diskInfo(diskName); err == nil {
+			return info.Power
+		}
+		return PowerManagement{}
+	}
+
+	cmd := exec.Command("camcontrol", "identify", diskName)
+	output, err := runCommand(cmd)
+	if err != nil {
+		return PowerManagement{}
+	}
+	return parsePowerManagement(string(output))
+}
+
+// SetDiskStandby sets the idle time after which the disk spins down.
+// A timeout of 0 disables the standby timer.
+func SetDiskStandby(diskName string, timeoutSec int) error {
+	if err := CheckPrivileges(); err != nil {
+		return err
+	}
+
+	if timeoutSec < 0 || timeoutSec > maxStandbyTimeout {
+		return fmt.Errorf("standby timeout must be between 0 and %d seconds", maxStandbyTimeout)
+	}
+
+	if !GetPowerManagement(diskName).Supported {
+		return fmt.Errorf("%s does not support power management", diskName)
+	}
+
+	// camcontrol idle sets the standby timer without spinning the disk down now
+	cmd := exec.Command("camcontrol", "idle", diskName, "-t", strconv.Itoa(timeoutSec))
+	output, err := runCommand(cmd)
+	if err != nil {
+		return fmt.Errorf("failed to set standby timer: %w (output: %s)", err, string(output))
+	}
+
+	return nil
+}
+
+// SpinDownDisk puts the disk into standby immediately
+func SpinDownDisk(diskName string) error {
+	if err := CheckPrivileges(); err != nil {
+		return err
+	}
+
+	if !GetPowerManagement(diskName).Supported {
+		return fmt.Errorf("%s does not support power management", diskName)
+	}
+
+	cmd := exec.Command("camcontrol", "standby", diskName)
+	output, err := runCommand(cmd)
+	if err != nil {
+		return fmt.Errorf("failed to spin down %s: %w (output: %s)", diskName, err, string(output))
+	}
+
+	return nil
+}
+
+// SetDiskAPM sets the advanced power management level (1-254, lower saves
+// more power). A level of 0 disables APM.
+func SetDiskAPM(diskName string, level int) error {
+	if err := CheckPrivileges(); err != nil {
+		return err
+	}
+
+	if level < 0 || level > 254 {
+		return fmt.Errorf("APM level must be between 1 and 254, or 0 to disable")
+	}
+
+	if !GetPowerManagement(diskName).APMSupported {
+		return fmt.Errorf("%s does not support advanced power management", diskName)
+	}
+
+	args := []string{"apm", diskName}
+	if level > 0 {
+		args = append(args, "-l", strconv.Itoa(level))
+	}
+
+	cmd := exec.Command("camcontrol", args...)
+	output, err := runCommand(cmd)
+	if err != nil {
+		return fmt.Errorf("failed to set APM level: %w (output: %s)", err, string(output))
+	}
+
+	return nil
+}
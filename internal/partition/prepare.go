@@ -0,0 +1,339 @@
+package partition
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// PrepareResult reports what PrepareDiskForModification released on a
+// disk and what is still in use
+type PrepareResult struct {
+	Disk          string
+	SwapDisabled  []string // swap devices turned off
+	Unmounted     []string // mount points unmounted
+	PoolsExported []string // ZFS pools exported
+	Remaining     []string // what couldn't be released, and why
+}
+
+// Ready reports whether everything on the disk was released
+func (r PrepareResult) Ready() bool {
+	return len(r.Remaining) == 0
+}
+
+// Summary describes the result for display
+func (r PrepareResult) Summary() string {
+	var b strings.Builder
+	list := func(title string, items []string) {
+		if len(items) == 0 {
+			return
+		}
+		fmt.Fprintf(&b, "%s:\n", title)
+		for _, item := range items {
+			fmt.Fprintf(&b, "  - %s\n", item)
+		}
+	}
+
+	list("Swap disabled", r.SwapDisabled)
+	list("Unmounted", r.Unmounted)
+	list("ZFS pools exported", r.PoolsExported)
+	list("Still in use", r.Remaining)
+
+	if b.Len() == 0 {
+		return fmt.Sprintf("Nothing on %s was in use.", r.Disk)
+	}
+	if r.Ready() {
+		fmt.Fprintf(&b, "\n%s is ready to be modified.", r.Disk)
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// PrepareDiskForModification releases everything on a disk so it can be
+// repartitioned: it turns off swap partitions and unmounts mounted
+// partitions. ZFS pools on the disk are reported in Remaining rather than
+// exported; use PrepareDisk to export them once the user has confirmed.
+func PrepareDiskForModification(disk string) (PrepareResult, error) {
+	return PrepareDisk(disk, false)
+}
+
+// PrepareDisk is PrepareDiskForModification that also exports the ZFS
+// pools lying wholly on the disk when exportPools is set. Pools that span
+// other disks are never exported. Anything that can't be released is
+// listed in the result's Remaining rather than returned as an error.
+func PrepareDisk(disk string, exportPools bool) (PrepareResult, error) {
+	if err := CheckPrivileges(); err != nil {
+		return PrepareResult{}, err
+	}
+	defer markDisksChanged()
+
+	if err := CheckDiskNotInFlight(disk); err != nil {
+		return PrepareResult{}, err
+	}
+
+	if fakeDisks != nil {
+		return fakeDisks.prepareDisk(disk, exportPools)
+	}
+
+	parts, _, err := getPartitionTable(disk)
+	if err != nil {
+		return PrepareResult{}, err
+	}
+	onDisk := deviceMatcher(disk, parts)
+	result := PrepareResult{Disk: disk}
+
+	// Swap first, so nothing is paged out to a partition about to change
+	swaps, err := activeSwapDevices()
+	if err != nil {
+		result.Remaining = append(result.Remaining, err.Error())
+	}
+	for _, dev := range swaps {
+		if !onDisk(dev) {
+			continue
+		}
+		if output, err := Runner.Run("swapoff", dev); err != nil {
+			result.Remaining = append(result.Remaining, fmt.Sprintf("swap on %s: swapoff failed: %v (output: %s)", dev, err, strings.TrimSpace(string(output))))
+			continue
+		}
+		result.SwapDisabled = append(result.SwapDisabled, dev)
+	}
+
+	// Nested mount points go first, e.g. /data/www before /data
+	mounts, err := diskMounts(onDisk)
+	if err != nil {
+		result.Remaining = append(result.Remaining, err.Error())
+	}
+	for _, m := range mounts {
+		if output, err := Runner.Run("umount", m.mountPoint); err != nil {
+			result.Remaining = append(result.Remaining, fmt.Sprintf("%s mounted at %s: %v (output: %s)",
+				m.device, m.mountPoint, err, strings.TrimSpace(string(output))))
+			continue
+		}
+		result.Unmounted = append(result.Unmounted, fmt.Sprintf("%s (%s)", m.mountPoint, m.device))
+	}
+
+	whole, partial, err := ZFSPoolsOnDisk(disk)
+	if err != nil {
+		// zpool isn't available or ZFS isn't loaded, so there are no pools
+		return result, nil
+	}
+	for _, pool := range partial {
+		result.Remaining = append(result.Remaining, fmt.Sprintf("ZFS pool %s also uses other disks; detach or replace this disk's vdevs instead", pool))
+	}
+	for _, pool := range whole {
+		if !exportPools {
+			result.Remaining = append(result.Remaining, fmt.Sprintf("ZFS pool %s is imported", pool))
+			continue
+		}
+		if output, err := Runner.Run("zpool", "export", pool); err != nil {
+			result.Remaining = append(result.Remaining, fmt.Sprintf("ZFS pool %s: export failed: %v (output: %s)", pool, err, strings.TrimSpace(string(output))))
+			continue
+		}
+		result.PoolsExported = append(result.PoolsExported, pool)
+	}
+
+	return result, nil
+}
+
+// ZFSPoolsOnDisk returns the imported ZFS pools with vdevs on a disk,
+// split into those lying wholly on it and those also using other disks
+func ZFSPoolsOnDisk(disk string) (whole []string, partial []string, err error) {
+	if fakeDisks != nil {
+		whole = fakeDisks.poolsOnDisk(disk)
+		return whole, nil, nil
+	}
+
+	parts, _, err := getPartitionTable(disk)
+	if err != nil {
+		return nil, nil, err
+	}
+	onDisk := deviceMatcher(disk, parts)
+
+	output, err := Runner.Run("zpool", "status", "-P")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to run zpool status: %w (output: %s)", err, string(output))
+	}
+
+	for pool, vdevs := range parsePoolVdevs(string(output)) {
+		here := 0
+		for _, vdev := range vdevs {
+			if onDisk(vdev) {
+				here++
+			}
+		}
+		switch {
+		case here == 0:
+		case here == len(vdevs):
+			whole = append(whole, pool)
+		default:
+			partial = append(partial, pool)
+		}
+	}
+
+	sort.Strings(whole)
+	sort.Strings(partial)
+	return whole, partial, nil
+}
+
+// parsePoolVdevs maps each pool in zpool status -P output to the device
+// paths of its leaf vdevs
+func parsePoolVdevs(output string) map[string][]string {
+	pools := make(map[string][]string)
+	pool := ""
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if fields[0] == "pool:" && len(fields) > 1 {
+			pool = fields[1]
+			pools[pool] = nil
+			continue
+		}
+		if pool != "" && strings.HasPrefix(fields[0], "/dev/") {
+			pools[pool] = append(pools[pool], fields[0])
+		}
+	}
+	return pools
+}
+
+// deviceMatcher returns a function reporting whether a device path, such
+// as /dev/ada0p2, /dev/gpt/swap0, /dev/gptid/<uuid> or /dev/ada0p4.eli,
+// lies on disk. disk may also be a slice, whose BSD label partitions such
+// as ada0s1a lie on it too.
+func deviceMatcher(disk string, parts []Partition) func(string) bool {
+	names := map[string]bool{disk: true}
+	for _, part := range parts {
+		names[part.Name] = true
+		if part.Label != "" {
+			names["gpt/"+part.Label] = true
+		}
+		if part.UUID != "" {
+			names["gptid/"+part.UUID] = true
+		}
+	}
+	// Partitions missing from parts, e.g. in the BSD label of a slice,
+	// are recognised by name
+	nested := regexp.MustCompile("^" + regexp.QuoteMeta(disk) + `(p\d+|s\d+)?[a-h]?$`)
+
+	return func(device string) bool {
+		name := strings.TrimPrefix(device, "/dev/")
+		name = strings.TrimSuffix(name, ".eli")
+		return names[name] || nested.MatchString(name)
+	}
+}
+
+// checkNotInUse returns an error if a disk or partition, or anything on
+// it, is in use: a filesystem mounted from it, swap, a vdev of an imported
+// ZFS pool or an attached GELI provider. Devices are recognised by name,
+// GPT label or GUID, and through their .eli providers, so a disk without a
+// partition table that is mounted or in a pool as a whole counts too.
+// parts are the partitions on a disk, or the partition itself, and may be
+// nil. action completes the error, e.g. "wiping ada1".
+func checkNotInUse(name string, parts []Partition, action string) error {
+	if fakeDisks != nil {
+		return fakeDisks.checkNotInUse(name, action)
+	}
+	onDevice := deviceMatcher(name, parts)
+
+	mounts, err := diskMounts(onDevice)
+	if err != nil {
+		return err
+	}
+	if len(mounts) > 0 {
+		m := mounts[len(mounts)-1]
+		return fmt.Errorf("%s is mounted at %s; unmount it before %s", strings.TrimPrefix(m.device, "/dev/"), m.mountPoint, action)
+	}
+
+	swaps, err := activeSwapDevices()
+	if err != nil {
+		return err
+	}
+	for _, dev := range swaps {
+		if onDevice(dev) {
+			return fmt.Errorf("%s is in use as swap; disable it before %s", strings.TrimPrefix(dev, "/dev/"), action)
+		}
+	}
+
+	// Without zpool or geli output ZFS or GELI isn't loaded, so nothing
+	// can be in use by them
+	if output, err := Runner.Run("zpool", "status", "-P"); err == nil {
+		pools := parsePoolVdevs(string(output))
+		poolNames := make([]string, 0, len(pools))
+		for pool := range pools {
+			poolNames = append(poolNames, pool)
+		}
+		sort.Strings(poolNames)
+		for _, pool := range poolNames {
+			for _, vdev := range pools[pool] {
+				if onDevice(vdev) {
+					return fmt.Errorf("%s is in ZFS pool %s; export the pool before %s", strings.TrimPrefix(vdev, "/dev/"), pool, action)
+				}
+			}
+		}
+	}
+	if output, err := Runner.Run("geli", "status", "-s"); err == nil {
+		for provider, component := range parseGELIStatus(string(output)) {
+			if onDevice(component) {
+				return fmt.Errorf("%s is attached as %s; detach it before %s", component, provider, action)
+			}
+		}
+	}
+
+	return nil
+}
+
+// parseGELIStatus maps each attached provider in geli status -s output to
+// the device it decrypts:
+//
+//	ada1p4.eli  ACTIVE  ada1p4
+func parseGELIStatus(output string) map[string]string {
+	providers := make(map[string]string)
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 || fields[0] == "Name" {
+			continue
+		}
+		providers[fields[0]] = fields[len(fields)-1]
+	}
+	return providers
+}
+
+// activeSwapDevices lists the swap devices in use from swapctl -l
+func activeSwapDevices() ([]string, error) {
+	output, err := Runner.Run("swapctl", "-l")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list swap devices: %w (output: %s)", err, string(output))
+	}
+
+	return parseSwapDevices(string(output)), nil
+}
+
+// diskMount is a filesystem mounted from a device
+type diskMount struct {
+	device     string
+	mountPoint string
+}
+
+// diskMounts lists the filesystems mounted from devices accepted by
+// onDisk, deepest mount points first
+func diskMounts(onDisk func(string) bool) ([]diskMount, error) {
+	output, err := Runner.Run("mount", "-p")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list mounts: %w (output: %s)", err, string(output))
+	}
+
+	// mount -p prints fstab lines: device mountpoint type options dump pass
+	var mounts []diskMount
+	for _, line := range strings.Split(string(output), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && onDisk(fields[0]) {
+			mounts = append(mounts, diskMount{device: fields[0], mountPoint: fields[1]})
+		}
+	}
+
+	sort.Slice(mounts, func(i, j int) bool {
+		return strings.Count(mounts[i].mountPoint, "/") > strings.Count(mounts[j].mountPoint, "/")
+	})
+	return mounts, nil
+}
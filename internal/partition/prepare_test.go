@@ -0,0 +1,55 @@
+package partition
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckNotInUse(t *testing.T) {
+	tests := []struct {
+		name      string
+		responses map[string]string
+		wantErr   string
+	}{
+		{"unused", nil, ""},
+		{"mounted without a partition table", map[string]string{
+			"mount -p": "/dev/ada0p2\t/\tufs\trw\t1\t1\n/dev/ada3\t/mnt\tufs\trw\t2\t2\n",
+		}, "ada3 is mounted at /mnt"},
+		{"mounted from a BSD label partition", map[string]string{
+			"mount -p": "/dev/ada3s1a\t/mnt\tufs\trw\t2\t2\n",
+		}, "ada3s1a is mounted at /mnt"},
+		{"similar disk name", map[string]string{
+			"mount -p": "/dev/ada30p1\t/mnt\tufs\trw\t2\t2\n",
+		}, ""},
+		{"swap by label", map[string]string{
+			"swapctl -l": "Device:       1024-blocks     Used:\n/dev/gpt/swap3     4194304         0\n",
+		}, "gpt/swap3 is in use as swap"},
+		{"whole-disk ZFS vdev", map[string]string{
+			"zpool status -P": "  pool: tank\n state: ONLINE\nconfig:\n\n\tNAME        STATE\n\ttank        ONLINE\n\t  /dev/ada3  ONLINE\n",
+		}, "ada3 is in ZFS pool tank"},
+		{"attached GELI provider", map[string]string{
+			"geli status -s": "ada3p1.eli  ACTIVE  ada3p1\n",
+		}, "ada3p1 is attached as ada3p1.eli"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := useFakeRunner(t)
+			for command, output := range tt.responses {
+				fake.Respond(command, output, nil)
+			}
+			parts := []Partition{{Name: "ada3p1"}, {Name: "ada3p2", Label: "swap3"}}
+
+			err := checkNotInUse("ada3", parts, "wiping ada3")
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("checkNotInUse() = %v, want no error", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("checkNotInUse() = %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
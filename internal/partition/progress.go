@@ -0,0 +1,89 @@
+package partition
+
+import (
+	"fmt"
+	"io"
+	"sync"
+)
+
+// ProgressReporter receives the progress of a long-running operation such
+// as a copy, a wipe, a batch or a SMART self-test. done and total are in
+// the operation's own unit: bytes for copies and wipes, operations for
+// batches and percent for self-tests. message describes the current stage
+// or speed and may be empty. Updates can arrive from any goroutine.
+type ProgressReporter interface {
+	Update(done, total uint64, message string)
+}
+
+// ProgressFunc adapts a function to ProgressReporter
+type ProgressFunc func(done, total uint64, message string)
+
+// Update calls f
+func (f ProgressFunc) Update(done, total uint64, message string) {
+	f(done, total, message)
+}
+
+// NoProgress is a ProgressReporter that discards every update
+var NoProgress ProgressReporter = ProgressFunc(func(uint64, uint64, string) {})
+
+// orNoProgress returns progress, or NoProgress if it is nil, so operations
+// can be called without a reporter
+func orNoProgress(progress ProgressReporter) ProgressReporter {
+	if progress == nil {
+		return NoProgress
+	}
+	return progress
+}
+
+// ProgressPercent returns done as a percentage of total, from 0 to 100
+func ProgressPercent(done, total uint64) float64 {
+	if total == 0 {
+		return 0
+	}
+	if done >= total {
+		return 100
+	}
+	return float64(done) / float64(total) * 100
+}
+
+// TextProgress is a ProgressReporter for terminals. It rewrites a single
+// line with the percentage done and the message, e.g.
+// "Progress: 42.0% (1.20 GB/s, ETA 00:45)".
+type TextProgress struct {
+	out     io.Writer
+	mu      sync.Mutex
+	lastLen int
+}
+
+// NewTextProgress creates a TextProgress writing to out, usually os.Stdout
+func NewTextProgress(out io.Writer) *TextProgress {
+	return &TextProgress{out: out}
+}
+
+// Update rewrites the progress line
+func (p *TextProgress) Update(done, total uint64, message string) {
+	line := fmt.Sprintf("Progress: %.1f%%", ProgressPercent(done, total))
+	if message != "" {
+		line += fmt.Sprintf(" (%s)", message)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	// Pad over the rest of a longer previous line
+	padding := p.lastLen - len(line)
+	if padding < 0 {
+		padding = 0
+	}
+	fmt.Fprintf(p.out, "\r%s%*s", line, padding, "")
+	p.lastLen = len(line)
+}
+
+// Done ends the progress line, so following output starts on a new one
+func (p *TextProgress) Done() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.lastLen > 0 {
+		fmt.Fprintln(p.out)
+		p.lastLen = 0
+	}
+}
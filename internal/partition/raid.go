@@ -0,0 +1,124 @@
+package partition
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// RAIDSet describes a software RAID device built by gmirror, gstripe or graid
+type RAIDSet struct {
+	Name       string // e.g. mirror/gm0
+	Type       string // mirror, stripe or raid
+	Status     string
+	Components []string
+}
+
+// raidClasses maps each geom RAID tool to the set type it reports
+var raidClasses = []struct {
+	tool     string
+	raidType string
+}{
+	{"gmirror", "mirror"},
+	{"gstripe", "stripe"},
+	{"graid", "raid"},
+}
+
+// GetRAIDSets returns all software RAID sets known to geom. Classes whose
+// kernel module isn't loaded are skipped.
+func GetRAIDSets() []RAIDSet {
+	var sets []RAIDSet
+	for _, class := range raidClasses {
+		cmd := exec.Command(class.tool, "status")
+		output, err := runCommand(cmd)
+		if err != nil {
+			continue
+		}
+		sets = append(sets, parseGeomRAIDStatus(string(output), class.raidType)...)
+	}
+	return sets
+}
+
+// parseGeomRAIDStatus parses the output of gmirror/gstripe/graid status:
+//
+//	      Name    Status  Components
+//	mirror/gm0  COMPLETE  ada0 (ACTIVE)
+//	                      ada1 (ACTIVE)
+func parseGeomRAIDStatus(output, raidType string) []RAIDSet {
+	var sets []RAIDSet
+	var current *RAIDSet
+
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || fields[0] == "Name" {
+			continue
+		}
+
+		if strings.Contains(fields[0], "/") {
+			if current != nil {
+				sets = append(sets, *current)
+			}
+			current = &RAIDSet{Name: fields[0], Type: raidType}
+			if len(fields) >= 2 {
+				current.Status = fields[1]
+			}
+			if len(fields) >= 3 {
+				current.Components = append(current.Components, fields[2])
+			}
+		} else if current != nil {
+			current.Components = append(current.Components, fields[0])
+		}
+	}
+
+	if current != nil {
+		sets = append(sets, *current)
+	}
+
+	return sets
+}
+
+// RAIDSetForDisk returns the RAID set that uses diskName as a whole-disk
+// component, or nil if the disk is not a member
+func RAIDSetForDisk(diskName string, sets []RAIDSet) *RAIDSet {
+	for i := range sets {
+		for _, comp := range sets[i].Components {
+			if comp == diskName {
+				return &sets[i]
+			}
+		}
+	}
+	return nil
+}
+
+// CheckNotRAIDMember returns an error if diskName is a component of a
+// software RAID set and must not be partitioned directly
+func CheckNotRAIDMember(diskName string) error {
+	if set := RAIDSetForDisk(diskName, GetRAIDSets()); set != nil {
+		return fmt.Errorf("%s is a member of the %s set %s; partition %s instead of its members", diskName, set.Type, set.Name, set.Name)
+	}
+	return nil
+}
+
+// raidDisk builds a Disk entry for a RAID set so it can be partitioned as a unit
+func raidDisk(set RAIDSet) Disk {
+	disk := Disk{
+		Name:     set.Name,
+		Model:    fmt.Sprintf("g%s %s (%s)", set.Type, set.Status, strings.Join(set.Components, ", ")),
+		Device:   "/dev/" + set.Name,
+		RAIDType: set.Type,
+	}
+
+	// diskinfo output: /dev/mirror/gm0	512	500107861504	976773167	...
+	cmd := exec.Command("diskinfo", disk.Device)
+	output, err := runCommand(cmd)
+	if err == nil {
+		fields := strings.Fields(string(output))
+		if len(fields) >= 3 {
+			disk.SectorSize, _ = strconv.ParseUint(fields[1], 10, 64)
+			disk.Size, _ = strconv.ParseUint(fields[2], 10, 64)
+		}
+	}
+
+	return disk
+}
@@ -0,0 +1,77 @@
+package partition
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+)
+
+// AttrRequired is the GPT "required partition" attribute (bit 0 of the
+// entry's attribute field). Firmware or the operating system depends on
+// such partitions, e.g. EFI system and recovery partitions. gpart can
+// neither show nor change it, so it is read from the partition entry
+// itself and can't be set or unset.
+const AttrRequired = "required"
+
+// gptRequiredBit is the attribute bit of AttrRequired
+const gptRequiredBit = 1 << 0
+
+// gptEntryAttributes reads the 64-bit attribute field of a GPT partition
+// entry straight from the disk. The header in the second sector gives the
+// location and size of the entry array; each entry holds its attributes
+// at byte 48.
+func gptEntryAttributes(disk string, index int) (uint64, error) {
+	if index < 1 {
+		return 0, fmt.Errorf("invalid partition index %d", index)
+	}
+
+	f, err := os.Open("/dev/" + disk)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open %s: %w", disk, err)
+	}
+	defer f.Close()
+
+	sectorSize := int64(deviceSectorSize(disk))
+	header := make([]byte, 92)
+	if _, err := f.ReadAt(header, sectorSize); err != nil {
+		return 0, fmt.Errorf("failed to read the GPT header of %s: %w", disk, err)
+	}
+	if !bytes.Equal(header[:8], []byte("EFI PART")) {
+		return 0, fmt.Errorf("%s has no GPT header", disk)
+	}
+
+	entriesLBA := int64(binary.LittleEndian.Uint64(header[72:80]))
+	entryCount := int(binary.LittleEndian.Uint32(header[80:84]))
+	entrySize := int64(binary.LittleEndian.Uint32(header[84:88]))
+	if index > entryCount || entrySize < 56 {
+		return 0, fmt.Errorf("partition %d is outside the GPT entry array of %s", index, disk)
+	}
+
+	attr := make([]byte, 8)
+	offset := entriesLBA*sectorSize + int64(index-1)*entrySize + 48
+	if _, err := f.ReadAt(attr, offset); err != nil {
+		return 0, fmt.Errorf("failed to read GPT entry %d of %s: %w", index, disk, err)
+	}
+	return binary.LittleEndian.Uint64(attr), nil
+}
+
+// IsPlatformRequired reports whether a partition carries the GPT required
+// attribute. Partitions whose attributes can't be read are reported as
+// not required.
+func IsPlatformRequired(partName string) bool {
+	info, err := GetPartitionAttributes(partName)
+	return err == nil && info.Attributes[AttrRequired]
+}
+
+// PlatformRequiredWarning returns the warning to show before deleting or
+// formatting a partition with the GPT required attribute, or an empty
+// string for any other partition. action is "delete" or "format".
+func PlatformRequiredWarning(partName, action string) string {
+	if !IsPlatformRequired(partName) {
+		return ""
+	}
+	return fmt.Sprintf("%s has the GPT \"required\" attribute: the firmware or the operating system depends on it, "+
+		"as with EFI system and recovery partitions. If you %s it the system may no longer boot or recover.",
+		partName, action)
+}
@@ -0,0 +1,181 @@
+package partition
+
+import (
+	"context"
+	"io"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// CommandRunner runs the system tools the partition operations are built
+// on, such as gpart, newfs and geom, and returns their combined stdout and
+// stderr. RunInput also feeds the command stdin, as gpart restore and
+// geli init need. RunContext, given a nil stdin if there is none, kills
+// the command once ctx is done, so a batch operation that runs out of time
+// is stopped rather than left running.
+type CommandRunner interface {
+	Run(name string, args ...string) ([]byte, error)
+	RunInput(stdin io.Reader, name string, args ...string) ([]byte, error)
+	RunContext(ctx context.Context, stdin io.Reader, name string, args ...string) ([]byte, error)
+}
+
+// ExecRunner is the CommandRunner that runs commands with os/exec
+type ExecRunner struct{}
+
+// Run runs the command and returns its combined output
+func (ExecRunner) Run(name string, args ...string) ([]byte, error) {
+	return exec.Command(name, args...).CombinedOutput()
+}
+
+// RunInput runs the command with stdin as its input and returns its
+// combined output
+func (r ExecRunner) RunInput(stdin io.Reader, name string, args ...string) ([]byte, error) {
+	return r.RunContext(context.Background(), stdin, name, args...)
+}
+
+// RunContext runs the command like RunInput, killing it once ctx is done
+func (ExecRunner) RunContext(ctx context.Context, stdin io.Reader, name string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, name, args...)
+	if stdin != nil {
+		cmd.Stdin = stdin
+	}
+	return cmd.CombinedOutput()
+}
+
+// Runner runs the commands of every operation that waits for a command
+// to finish. Copies, wipes and other commands whose output is read while
+// they run use os/exec directly. Tests can replace Runner with a
+// FakeRunner to check which commands an operation runs without root or
+// real disks. Unlike -fake-disks, which simulates whole disks for trying
+// out the UI and skips the commands altogether, a FakeRunner lets the
+// real code paths build and run their commands.
+var Runner CommandRunner = ExecRunner{}
+
+// usingFakeRunner reports whether Runner has been replaced, so commands
+// don't reach real disks
+func usingFakeRunner() bool {
+	_, real := Runner.(ExecRunner)
+	return !real
+}
+
+// runCommand runs cmd, as built for dryRun, through Runner and returns its
+// combined output. The command's stdin, if set, is passed on; cmd must not
+// depend on other settings such as Dir or Env.
+func runCommand(cmd *exec.Cmd) ([]byte, error) {
+	if cmd.Stdin != nil {
+		return Runner.RunInput(cmd.Stdin, cmd.Args[0], cmd.Args[1:]...)
+	}
+	return Runner.Run(cmd.Args[0], cmd.Args[1:]...)
+}
+
+// runCommandContext is runCommand killing the command once ctx is done
+func runCommandContext(ctx context.Context, cmd *exec.Cmd) ([]byte, error) {
+	return Runner.RunContext(ctx, cmd.Stdin, cmd.Args[0], cmd.Args[1:]...)
+}
+
+// commandContext returns cmd, as built for dryRun, as a command that is
+// killed once ctx is done, for commands whose output is read while they
+// run rather than through Runner
+func commandContext(ctx context.Context, cmd *exec.Cmd) *exec.Cmd {
+	withContext := exec.CommandContext(ctx, cmd.Path, cmd.Args[1:]...)
+	withContext.Args = cmd.Args
+	withContext.Stdin = cmd.Stdin
+	return withContext
+}
+
+// FakeCall is a command run through a FakeRunner
+type FakeCall struct {
+	Line  string // the command and its arguments joined by spaces
+	Stdin string // what the command was given on stdin, if anything
+}
+
+// FakeRunner is a CommandRunner that runs nothing. It records every
+// command and answers each one with the response set for it by Respond,
+// or with no output and no error.
+type FakeRunner struct {
+	mu        sync.Mutex
+	calls     []FakeCall
+	responses map[string][]fakeResponse
+}
+
+// fakeResponse is one answer of a FakeRunner
+type fakeResponse struct {
+	output []byte
+	err    error
+}
+
+// NewFakeRunner creates a FakeRunner without any responses
+func NewFakeRunner() *FakeRunner {
+	return &FakeRunner{responses: make(map[string][]fakeResponse)}
+}
+
+// Respond makes the command line, e.g. "gpart delete -i 2 ada0", answer
+// with output and err. Responses set for the same command line are given
+// in turn, the last one for every run after that, so a command can fail a
+// few times before it succeeds.
+func (f *FakeRunner) Respond(commandLine, output string, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.responses[commandLine] = append(f.responses[commandLine], fakeResponse{output: []byte(output), err: err})
+}
+
+// Run records the command and returns its next response
+func (f *FakeRunner) Run(name string, args ...string) ([]byte, error) {
+	return f.RunInput(nil, name, args...)
+}
+
+// RunInput records the command with all of stdin and returns its next
+// response
+func (f *FakeRunner) RunInput(stdin io.Reader, name string, args ...string) ([]byte, error) {
+	return f.RunContext(context.Background(), stdin, name, args...)
+}
+
+// RunContext records the command like RunInput and returns its next
+// response, or ctx's error if ctx is already done, as a killed command
+// would fail
+func (f *FakeRunner) RunContext(ctx context.Context, stdin io.Reader, name string, args ...string) ([]byte, error) {
+	call := FakeCall{Line: strings.Join(append([]string{name}, args...), " ")}
+	if stdin != nil {
+		input, err := io.ReadAll(stdin)
+		if err != nil {
+			return nil, err
+		}
+		call.Stdin = string(input)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, call)
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	queue := f.responses[call.Line]
+	if len(queue) == 0 {
+		return nil, nil
+	}
+	response := queue[0]
+	if len(queue) > 1 {
+		f.responses[call.Line] = queue[1:]
+	}
+	return response.output, response.err
+}
+
+// Calls returns the commands run so far, in order
+func (f *FakeRunner) Calls() []FakeCall {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]FakeCall(nil), f.calls...)
+}
+
+// Lines returns the command lines run so far, in order
+func (f *FakeRunner) Lines() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	lines := make([]string, len(f.calls))
+	for i, call := range f.calls {
+		lines[i] = call.Line
+	}
+	return lines
+}
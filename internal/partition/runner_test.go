@@ -0,0 +1,66 @@
+package partition
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// useFakeRunner replaces Runner with a FakeRunner for the rest of the test
+func useFakeRunner(t *testing.T) *FakeRunner {
+	t.Helper()
+	fake := NewFakeRunner()
+	saved := Runner
+	Runner = fake
+	t.Cleanup(func() { Runner = saved })
+	return fake
+}
+
+func TestFakeRunnerQueuesResponses(t *testing.T) {
+	fake := NewFakeRunner()
+	busy := errors.New("exit status 1")
+	fake.Respond("gpart delete -i 2 ada0", "gpart: Device busy", busy)
+	fake.Respond("gpart delete -i 2 ada0", "ada0p2 deleted", nil)
+
+	for i, want := range []string{"gpart: Device busy", "ada0p2 deleted", "ada0p2 deleted"} {
+		output, err := fake.Run("gpart", "delete", "-i", "2", "ada0")
+		if string(output) != want {
+			t.Errorf("run %d: output %q, want %q", i+1, output, want)
+		}
+		if (err != nil) != (i == 0) {
+			t.Errorf("run %d: error %v", i+1, err)
+		}
+	}
+
+	if output, err := fake.Run("gpart", "show"); output != nil || err != nil {
+		t.Errorf("command without a response: got %q, %v; want no output and no error", output, err)
+	}
+
+	want := []string{"gpart delete -i 2 ada0", "gpart delete -i 2 ada0", "gpart delete -i 2 ada0", "gpart show"}
+	if got := fake.Lines(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Lines() = %q, want %q", got, want)
+	}
+}
+
+func TestRestorePartitionTablePassesBackupOnStdin(t *testing.T) {
+	fake := useFakeRunner(t)
+	backup := "GPT 128\n1 efi 40 409600 efiboot0\n2 freebsd-ufs 409640 2097152 rootfs\n"
+
+	if err := RestorePartitionTable("ada9", []byte(backup), true); err != nil {
+		t.Fatalf("RestorePartitionTable: %v", err)
+	}
+
+	var restore *FakeCall
+	calls := fake.Calls()
+	for i := range calls {
+		if calls[i].Line == "gpart restore -F -l ada9" {
+			restore = &calls[i]
+		}
+	}
+	if restore == nil {
+		t.Fatalf("gpart restore was not run; commands: %q", fake.Lines())
+	}
+	if restore.Stdin != backup {
+		t.Errorf("gpart restore got %q on stdin, want the backup %q", restore.Stdin, backup)
+	}
+}
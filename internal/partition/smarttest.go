@@ -0,0 +1,213 @@
+package partition
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SMARTTestTypes lists the self-tests RunSMARTTest can start, shortest first
+var SMARTTestTypes = []string{"short", "long", "conveyance"}
+
+// SMARTTestInProgress is the status GetSMARTTestProgress reports while a
+// self-test is running
+const SMARTTestInProgress = "Self-test in progress"
+
+// SupportedSMARTTests returns the self-test types a disk supports, read
+// from the capabilities in smartctl -c. It is empty when the disk can't run
+// self-tests, e.g. USB bridges without SMART passthrough.
+func SupportedSMARTTests(diskName string) []string {
+	if fakeDisks != nil {
+		return fakeDisks.supportedSMARTTests(diskName)
+	}
+
+	if _, err := exec.LookPath("smartctl"); err != nil {
+		return nil
+	}
+
+	// smartctl sets status bits in its exit code even when the output is
+	// usable, so the output is parsed regardless
+	output, _ := Runner.Run("smartctl", "-c", "/dev/"+diskName)
+	return parseSupportedSMARTTests(string(output))
+}
+
+// parseSupportedSMARTTests reads the capability lines of smartctl -c, e.g.
+//
+//	Self-test supported.
+//	No Conveyance Self-test supported.
+//
+// NVMe drives instead list Self_Test among their optional admin commands
+// and support short and long (extended) tests.
+func parseSupportedSMARTTests(output string) []string {
+	var tests []string
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "Self-test supported.":
+			tests = append(tests, "short", "long")
+		case line == "Conveyance Self-test supported.":
+			tests = append(tests, "conveyance")
+		case strings.HasPrefix(line, "Optional Admin Commands") && strings.Contains(line, "Self_Test"):
+			tests = append(tests, "short", "long")
+		}
+	}
+	return tests
+}
+
+// RunSMARTTest starts a SMART self-test on a disk: "short" (a couple of
+// minutes), "long" (a full surface scan, hours on large disks) or
+// "conveyance" (checks for transport damage). The test runs inside the
+// drive in the background; GetSMARTTestProgress reports how far it got.
+func RunSMARTTest(diskName, testType string) error {
+	if err := CheckPrivileges(); err != nil {
+		return err
+	}
+
+	known := false
+	for _, t := range SMARTTestTypes {
+		if t == testType {
+			known = true
+		}
+	}
+	if !known {
+		return fmt.Errorf("unknown self-test type %q (use %s)", testType, strings.Join(SMARTTestTypes, ", "))
+	}
+
+	if fakeDisks == nil {
+		if _, err := exec.LookPath("smartctl"); err != nil {
+			return fmt.Errorf("smartctl not found - install smartmontools: pkg install smartmontools")
+		}
+	}
+
+	supported := SupportedSMARTTests(diskName)
+	if len(supported) == 0 {
+		return fmt.Errorf("%s does not support SMART self-tests", diskName)
+	}
+	isSupported := false
+	for _, t := range supported {
+		if t == testType {
+			isSupported = true
+		}
+	}
+	if !isSupported {
+		return fmt.Errorf("%s does not support %s self-tests (supported: %s)", diskName, testType, strings.Join(supported, ", "))
+	}
+
+	if fakeDisks != nil {
+		return fakeDisks.runSMARTTest(diskName, testType)
+	}
+
+	output, err := Runner.Run("smartctl", "-t", testType, "/dev/"+diskName)
+	// ATA drives answer "Testing has begun.", NVMe drives "Self-test has begun"
+	if !strings.Contains(string(output), "has begun") {
+		if err == nil {
+			err = fmt.Errorf("self-test did not start")
+		}
+		return ExplainDiskGone(diskName, fmt.Errorf("failed to start %s self-test on %s: %w (output: %s)",
+			testType, diskName, err, strings.TrimSpace(string(output))))
+	}
+
+	return nil
+}
+
+// GetSMARTTestProgress returns how much of a running self-test remains, in
+// percent, and a status: SMARTTestInProgress while a test runs, otherwise
+// the result of the most recent test from the self-test log, such as
+// "Completed without error", or "No self-tests have been logged".
+func GetSMARTTestProgress(diskName string) (percentRemaining int, status string, err error) {
+	if fakeDisks != nil {
+		return fakeDisks.smartTestProgress(diskName)
+	}
+
+	if _, err := exec.LookPath("smartctl"); err != nil {
+		return 0, "", fmt.Errorf("smartctl not found - install smartmontools: pkg install smartmontools")
+	}
+
+	output, cmdErr := Runner.Run("smartctl", "-c", "-l", "selftest", "/dev/"+diskName)
+	percentRemaining, status, ok := parseSMARTTestProgress(string(output))
+	if !ok {
+		if cmdErr == nil {
+			cmdErr = fmt.Errorf("no self-test status reported")
+		}
+		return 0, "", ExplainDiskGone(diskName, fmt.Errorf("failed to read self-test status of %s: %w (output: %s)",
+			diskName, cmdErr, strings.TrimSpace(string(output))))
+	}
+	return percentRemaining, status, nil
+}
+
+// WaitForSMARTTest checks a running self-test every interval until it
+// finishes and returns its result, such as "Completed without error". Its
+// progress is reported in percent, with the status and the part left as
+// the message. It returns ctx's error if ctx is cancelled first.
+func WaitForSMARTTest(ctx context.Context, diskName string, interval time.Duration, progress ProgressReporter) (string, error) {
+	progress = orNoProgress(progress)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		// The first check waits too, since a drive can take a moment to
+		// report a test that was just started
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-ticker.C:
+		}
+
+		left, status, err := GetSMARTTestProgress(diskName)
+		if err != nil {
+			return "", err
+		}
+		if status != SMARTTestInProgress {
+			return status, nil
+		}
+		progress.Update(uint64(100-left), 100, fmt.Sprintf("%s, %d%% remaining", status, left))
+	}
+}
+
+var (
+	// ataSelfTestStatus matches "Self-test execution status:      ( 249)"
+	ataSelfTestStatus = regexp.MustCompile(`Self-test execution status:\s*\(\s*(\d+)\)`)
+	// nvmeSelfTestStatus matches "Short self-test in progress (42% completed)"
+	nvmeSelfTestStatus = regexp.MustCompile(`self-test in progress \((\d+)% completed\)`)
+	// selfTestLogEntry matches the newest entry of the self-test log, e.g.
+	// "# 1  Short offline       Completed without error       00%     12345         -"
+	selfTestLogEntry = regexp.MustCompile(`^#\s*1\s+\S.*?\s{2,}(\S.*?)\s+\d+%`)
+	// nvmeSelfTestLogEntry matches the newest entry of an NVMe self-test
+	// log, e.g. " 0   Short             Completed without error     3441  -"
+	nvmeSelfTestLogEntry = regexp.MustCompile(`^0\s+(?:Short|Extended|Vendor specific)\s+(\S.*?)\s{2,}`)
+)
+
+// parseSMARTTestProgress reads the output of smartctl -c -l selftest. The
+// ATA execution status byte holds the state in its high nibble (15 while
+// a test runs) and the remaining work in tenths in its low nibble.
+func parseSMARTTestProgress(output string) (int, string, bool) {
+	if m := ataSelfTestStatus.FindStringSubmatch(output); m != nil {
+		value, _ := strconv.Atoi(m[1])
+		if value>>4 == 15 {
+			return (value & 0x0f) * 10, SMARTTestInProgress, true
+		}
+	} else if m := nvmeSelfTestStatus.FindStringSubmatch(output); m != nil {
+		done, _ := strconv.Atoi(m[1])
+		return 100 - done, SMARTTestInProgress, true
+	}
+
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if m := selfTestLogEntry.FindStringSubmatch(line); m != nil {
+			return 0, m[1], true
+		}
+		if m := nvmeSelfTestLogEntry.FindStringSubmatch(line); m != nil {
+			return 0, m[1], true
+		}
+	}
+
+	if strings.Contains(output, "No self-tests have been logged") || strings.Contains(output, "No Self-tests Logged") ||
+		ataSelfTestStatus.MatchString(output) {
+		return 0, "No self-tests have been logged", true
+	}
+	return 0, "", false
+}
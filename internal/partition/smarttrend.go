@@ -0,0 +1,193 @@
+package partition
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// trendAttributeIDs are the SMART attributes whose raw value counts errors
+// or remapped sectors; any increase in them is an early sign of failure
+var trendAttributeIDs = map[int]bool{
+	5:   true, // Reallocated_Sector_Ct
+	10:  true, // Spin_Retry_Count
+	184: true, // End-to-End_Error
+	187: true, // Reported_Uncorrect
+	188: true, // Command_Timeout
+	196: true, // Reallocated_Event_Count
+	197: true, // Current_Pending_Sector
+	198: true, // Offline_Uncorrectable
+	199: true, // UDMA_CRC_Error_Count
+}
+
+// SMARTSnapshot is a stored copy of a disk's SMART raw values, the
+// baseline its later values are compared with
+type SMARTSnapshot struct {
+	Serial    string         `json:"serial"`
+	Taken     time.Time      `json:"taken"`
+	RawValues map[int]uint64 `json:"raw_values"`
+}
+
+// SMARTSnapshotDir returns the directory SMART snapshots are stored in, the
+// smart directory in StateDir, creating it if needed. Serial numbers and
+// error counters are nobody else's business, so it is private like
+// StateDir.
+func SMARTSnapshotDir() (string, error) {
+	stateDir, err := StateDir()
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(stateDir, "smart")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create SMART snapshot directory: %w", err)
+	}
+	return dir, nil
+}
+
+// parseRawValue returns the leading integer of a SMART raw value such as
+// "34 (Min/Max 20/45)"
+func parseRawValue(raw string) (uint64, bool) {
+	fields := strings.Fields(raw)
+	if len(fields) == 0 {
+		return 0, false
+	}
+	value, err := strconv.ParseUint(fields[0], 10, 64)
+	return value, err == nil
+}
+
+// snapshotPath returns the snapshot file for a disk serial number
+func snapshotPath(dir, serial string) string {
+	safe := strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == ' ' {
+			return '_'
+		}
+		return r
+	}, serial)
+	return filepath.Join(dir, safe+".json")
+}
+
+// newSMARTSnapshot records the raw values of the trend attributes in info
+func newSMARTSnapshot(info *DiskInfo, taken time.Time) *SMARTSnapshot {
+	snap := &SMARTSnapshot{
+		Serial:    info.Serial,
+		Taken:     taken,
+		RawValues: make(map[int]uint64),
+	}
+	for _, attr := range info.Attributes {
+		if !trendAttributeIDs[attr.ID] {
+			continue
+		}
+		if value, ok := parseRawValue(attr.RawValue); ok {
+			snap.RawValues[attr.ID] = value
+		}
+	}
+	return snap
+}
+
+// compareSMARTSnapshot marks attributes in info whose raw value grew since prev
+func compareSMARTSnapshot(info *DiskInfo, prev *SMARTSnapshot) int {
+	increased := 0
+	for i := range info.Attributes {
+		attr := &info.Attributes[i]
+		if !trendAttributeIDs[attr.ID] {
+			continue
+		}
+		current, ok := parseRawValue(attr.RawValue)
+		previous, seen := prev.RawValues[attr.ID]
+		if ok && seen && current > previous {
+			attr.PreviousRawValue = previous
+			attr.IncreasedSince = prev.Taken
+			increased++
+		}
+	}
+	return increased
+}
+
+// TrackSMARTTrends compares info's SMART attributes with the snapshot stored
+// for the disk's serial number and flags attributes whose raw value
+// increased since then (see SMARTAttribute.IncreasedSince). It returns the
+// number of increased attributes. The first time a disk is seen its values
+// are stored as the snapshot; after that the snapshot is kept until
+// AcknowledgeSMARTTrends replaces it, so an increase stays flagged however
+// often the disk is looked at. Disks without SMART data or a serial number
+// are skipped.
+func TrackSMARTTrends(info *DiskInfo) (int, error) {
+	if !info.SMARTEnabled || info.Serial == "" || len(info.Attributes) == 0 {
+		return 0, nil
+	}
+
+	dir, err := SMARTSnapshotDir()
+	if err != nil {
+		return 0, err
+	}
+	path := snapshotPath(dir, info.Serial)
+
+	prev, err := readSMARTSnapshot(path)
+	if os.IsNotExist(err) {
+		return 0, saveSMARTSnapshot(path, newSMARTSnapshot(info, time.Now()))
+	}
+	if err != nil {
+		return 0, err
+	}
+	return compareSMARTSnapshot(info, prev), nil
+}
+
+// AcknowledgeSMARTTrends stores info's current SMART values as the
+// snapshot later ones are compared with, once the user has seen the
+// increases TrackSMARTTrends flagged, and clears those flags in info
+func AcknowledgeSMARTTrends(info *DiskInfo) error {
+	if info.Serial == "" {
+		return fmt.Errorf("the disk reports no serial number to keep SMART values under")
+	}
+
+	dir, err := SMARTSnapshotDir()
+	if err != nil {
+		return err
+	}
+	if err := saveSMARTSnapshot(snapshotPath(dir, info.Serial), newSMARTSnapshot(info, time.Now())); err != nil {
+		return err
+	}
+
+	for i := range info.Attributes {
+		info.Attributes[i].IncreasedSince = time.Time{}
+		info.Attributes[i].PreviousRawValue = 0
+	}
+	return nil
+}
+
+// readSMARTSnapshot reads a stored snapshot. A missing snapshot is
+// reported with an error satisfying os.IsNotExist.
+func readSMARTSnapshot(path string) (*SMARTSnapshot, error) {
+	if err := checkOwnFile(path); err != nil {
+		if os.IsNotExist(err) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to read SMART snapshot: %w", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read SMART snapshot: %w", err)
+	}
+
+	var snap SMARTSnapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return nil, fmt.Errorf("failed to parse SMART snapshot %s: %w", path, err)
+	}
+	return &snap, nil
+}
+
+// saveSMARTSnapshot stores a snapshot, readable by its owner only
+func saveSMARTSnapshot(path string, snap *SMARTSnapshot) error {
+	data, err := json.MarshalIndent(snap, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode SMART snapshot: %w", err)
+	}
+	if err := writeFileAtomic(path, data); err != nil {
+		return fmt.Errorf("failed to save SMART snapshot: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package partition
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// smartInfo returns disk information with a reallocated sector count
+func smartInfo(reallocated string) *DiskInfo {
+	return &DiskInfo{
+		Serial:       "WD-1234",
+		SMARTEnabled: true,
+		Attributes: []SMARTAttribute{
+			{ID: 5, Name: "Reallocated_Sector_Ct", RawValue: reallocated},
+			{ID: 9, Name: "Power_On_Hours", RawValue: "1000"},
+		},
+	}
+}
+
+func TestTrackSMARTTrendsKeepsBaseline(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "pgpart")
+	useStateDir(t, dir)
+
+	if n, err := TrackSMARTTrends(smartInfo("0")); n != 0 || err != nil {
+		t.Fatalf("first TrackSMARTTrends = %d, %v, want 0, nil", n, err)
+	}
+
+	// Looking at the disk again must not make the increase disappear
+	for i := 0; i < 2; i++ {
+		info := smartInfo("8")
+		n, err := TrackSMARTTrends(info)
+		if n != 1 || err != nil {
+			t.Fatalf("TrackSMARTTrends view %d = %d, %v, want 1, nil", i+1, n, err)
+		}
+		if info.Attributes[0].IncreasedSince.IsZero() || info.Attributes[0].PreviousRawValue != 0 {
+			t.Errorf("view %d: reallocated sectors not flagged as grown from 0: %+v", i+1, info.Attributes[0])
+		}
+	}
+
+	info := smartInfo("8")
+	TrackSMARTTrends(info)
+	if err := AcknowledgeSMARTTrends(info); err != nil {
+		t.Fatalf("AcknowledgeSMARTTrends: %v", err)
+	}
+	if !info.Attributes[0].IncreasedSince.IsZero() {
+		t.Errorf("acknowledged attribute still flagged: %+v", info.Attributes[0])
+	}
+	if n, _ := TrackSMARTTrends(smartInfo("8")); n != 0 {
+		t.Errorf("TrackSMARTTrends after acknowledging = %d, want 0", n)
+	}
+	if n, _ := TrackSMARTTrends(smartInfo("9")); n != 1 {
+		t.Errorf("TrackSMARTTrends after a further increase = %d, want 1", n)
+	}
+}
+
+func TestSMARTSnapshotIsPrivate(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "pgpart")
+	useStateDir(t, dir)
+
+	if _, err := TrackSMARTTrends(smartInfo("0")); err != nil {
+		t.Fatalf("TrackSMARTTrends: %v", err)
+	}
+
+	snapDir, err := SMARTSnapshotDir()
+	if err != nil {
+		t.Fatalf("SMARTSnapshotDir: %v", err)
+	}
+	dirInfo, err := os.Stat(snapDir)
+	if err != nil {
+		t.Fatalf("stat %s: %v", snapDir, err)
+	}
+	if perm := dirInfo.Mode().Perm(); perm != 0700 {
+		t.Errorf("snapshot directory mode = %o, want 700", perm)
+	}
+
+	fileInfo, err := os.Stat(snapshotPath(snapDir, "WD-1234"))
+	if err != nil {
+		t.Fatalf("snapshot not stored: %v", err)
+	}
+	if perm := fileInfo.Mode().Perm(); perm != 0600 {
+		t.Errorf("snapshot mode = %o, want 600", perm)
+	}
+}
@@ -0,0 +1,90 @@
+package partition
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// systemStateDir is the state directory when running as root. Tests point
+// it elsewhere.
+var systemStateDir = "/var/db/pgpart"
+
+// StateDir returns the directory pgpart keeps files in between operations
+// and sessions, such as the batch auto-save and partition header backups,
+// creating it if needed. As root, which changing disks requires, it is
+// /var/db/pgpart; otherwise the pgpart directory in the user's config
+// directory. Unlike a shared directory such as /tmp, nobody else can plant
+// or replace files in it: it is made accessible to its owner only, and an
+// existing one that is a symlink, belongs to someone else or is writable
+// by others is refused.
+func StateDir() (string, error) {
+	dir := systemStateDir
+	if os.Geteuid() != 0 {
+		configDir, err := os.UserConfigDir()
+		if err != nil {
+			return "", fmt.Errorf("failed to find config directory: %w", err)
+		}
+		dir = filepath.Join(configDir, "pgpart")
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create state directory: %w", err)
+	}
+	info, err := os.Lstat(dir)
+	if err != nil {
+		return "", fmt.Errorf("failed to check state directory: %w", err)
+	}
+	if !info.IsDir() || !ownedByCurrentUser(info) || info.Mode().Perm()&0022 != 0 {
+		return "", fmt.Errorf("state directory %s must be a directory owned by uid %d and not writable by others", dir, os.Geteuid())
+	}
+	return dir, nil
+}
+
+// ownedByCurrentUser reports whether a file belongs to the effective user
+func ownedByCurrentUser(info os.FileInfo) bool {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	return ok && int(stat.Uid) == os.Geteuid()
+}
+
+// checkOwnFile returns an error unless path is a regular file, not a
+// symlink, owned by the effective user, so a file someone else left in its
+// place isn't trusted
+func checkOwnFile(path string) error {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() || !ownedByCurrentUser(info) {
+		return fmt.Errorf("%s is not a regular file owned by uid %d; ignoring it", path, os.Geteuid())
+	}
+	return nil
+}
+
+// writeFileAtomic writes data to path with mode 0600 through a temporary
+// file in the same directory, so a crash mid-write never leaves a
+// truncated file and the name is never opened for writing where a symlink
+// could redirect it
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
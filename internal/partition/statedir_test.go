@@ -0,0 +1,120 @@
+package partition
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// useStateDir makes StateDir use dir for the rest of the test
+func useStateDir(t *testing.T, dir string) {
+	t.Helper()
+	saved := systemStateDir
+	systemStateDir = dir
+	t.Setenv("XDG_CONFIG_HOME", filepath.Dir(dir))
+	t.Setenv("HOME", filepath.Dir(dir))
+	t.Cleanup(func() { systemStateDir = saved })
+}
+
+func TestStateDirIsPrivate(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "pgpart")
+	useStateDir(t, dir)
+
+	got, err := StateDir()
+	if err != nil {
+		t.Fatalf("StateDir: %v", err)
+	}
+	if got != dir {
+		t.Fatalf("StateDir() = %q, want %q", got, dir)
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0700 {
+		t.Errorf("state directory mode %o, want 700", perm)
+	}
+
+	if err := os.Chmod(dir, 0777); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := StateDir(); err == nil {
+		t.Error("StateDir accepted a directory writable by others")
+	}
+}
+
+func TestStateDirRefusesSymlink(t *testing.T) {
+	base := t.TempDir()
+	dir := filepath.Join(base, "pgpart")
+	if err := os.Mkdir(filepath.Join(base, "elsewhere"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(base, "elsewhere"), dir); err != nil {
+		t.Fatal(err)
+	}
+	useStateDir(t, dir)
+
+	if _, err := StateDir(); err == nil {
+		t.Error("StateDir accepted a symlink")
+	}
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "queue.json")
+	target := filepath.Join(dir, "target")
+	if err := os.WriteFile(target, []byte("keep"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// A symlink in the file's place is replaced, not written through
+	if err := os.Symlink(target, path); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := writeFileAtomic(path, []byte("new")); err != nil {
+		t.Fatalf("writeFileAtomic: %v", err)
+	}
+	info, err := os.Lstat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.Mode().IsRegular() || info.Mode().Perm() != 0600 {
+		t.Errorf("file mode %v, want a regular file with mode 0600", info.Mode())
+	}
+	if data, _ := os.ReadFile(target); string(data) != "keep" {
+		t.Errorf("symlink target was overwritten with %q", data)
+	}
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 2 {
+		t.Errorf("temporary file left behind: %v", entries)
+	}
+}
+
+func TestCheckOwnFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "batch-autosave.json")
+	if err := os.WriteFile(path, []byte("{}"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkOwnFile(path); err != nil {
+		t.Errorf("checkOwnFile rejected our own file: %v", err)
+	}
+
+	link := filepath.Join(dir, "link.json")
+	if err := os.Symlink(path, link); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkOwnFile(link); err == nil {
+		t.Error("checkOwnFile accepted a symlink")
+	}
+
+	if os.Geteuid() == 0 {
+		if err := os.Chown(path, 1, 1); err != nil {
+			t.Fatal(err)
+		}
+		if err := checkOwnFile(path); err == nil {
+			t.Error("checkOwnFile accepted a file owned by another user")
+		}
+	}
+}
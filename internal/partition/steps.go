@@ -0,0 +1,70 @@
+package partition
+
+import (
+	"fmt"
+	"strings"
+)
+
+// OperationStep is one step of a composite operation such as a move,
+// listed in confirmations so users can see which steps can be undone
+type OperationStep struct {
+	Description string
+	// Reversible is false for steps that destroy data, such as
+	// overwriting or deleting a partition
+	Reversible bool
+}
+
+// CopySteps returns the steps of CopyPartition
+func CopySteps(source, dest string) []OperationStep {
+	return []OperationStep{
+		{Description: fmt.Sprintf("check that %s is at least as large as %s", dest, source), Reversible: true},
+		{Description: fmt.Sprintf("overwrite %s with a block copy of %s", dest, source), Reversible: false},
+	}
+}
+
+// CopyContentsSteps returns the steps of CopyFilesystem for a source
+// carrying fsType
+func CopyContentsSteps(source, dest, fsType string) []OperationStep {
+	return []OperationStep{
+		{Description: fmt.Sprintf("mount %s read-only and check that its files fit on %s", source, dest), Reversible: true},
+		{Description: fmt.Sprintf("format %s as %s, erasing its data", dest, fsType), Reversible: false},
+		{Description: fmt.Sprintf("copy the files of %s to %s", source, dest), Reversible: true},
+	}
+}
+
+// MoveSteps returns the steps of MovePartition
+func MoveSteps(source, dest string) []OperationStep {
+	return append(CopySteps(source, dest),
+		OperationStep{Description: fmt.Sprintf("delete source %s", source), Reversible: false})
+}
+
+// PointOfNoReturn returns the 1-based number of the first irreversible
+// step, or 0 if every step can be undone
+func PointOfNoReturn(steps []OperationStep) int {
+	for i, step := range steps {
+		if !step.Reversible {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// DescribeSteps lists steps one per line, marking the irreversible ones,
+// e.g. "Step 3: delete source ada0p1 — IRREVERSIBLE"
+func DescribeSteps(steps []OperationStep) string {
+	var b strings.Builder
+	for i, step := range steps {
+		fmt.Fprintf(&b, "Step %d: %s", i+1, step.Description)
+		if !step.Reversible {
+			b.WriteString(" — IRREVERSIBLE")
+		}
+		b.WriteString("\n")
+	}
+
+	if n := PointOfNoReturn(steps); n > 0 {
+		fmt.Fprintf(&b, "\nStep %d is the point of no return: once it starts, the operation can't be undone.", n)
+	} else {
+		b.WriteString("\nEvery step can be undone.")
+	}
+	return b.String()
+}
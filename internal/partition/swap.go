@@ -0,0 +1,137 @@
+package partition
+
+import (
+	"fmt"
+	"strings"
+)
+
+// IsSwapActive reports whether a partition is in use as swap, as listed
+// by swapinfo. Swap enabled through its GPT label (/dev/gpt/<label>) or
+// encrypted with a .eli provider counts as well.
+func IsSwapActive(partName string) (bool, error) {
+	device, err := activeSwapDevice(partName)
+	return device != "", err
+}
+
+// EnableSwap turns on swap on a freebsd-swap partition with swapon. Swap
+// that is already active is left as it is.
+func EnableSwap(partName string) error {
+	if err := CheckPrivileges(); err != nil {
+		return err
+	}
+	defer markDisksChanged()
+
+	if err := checkSwapPartition(partName); err != nil {
+		return err
+	}
+
+	if err := CheckNotInFlight(partName); err != nil {
+		return err
+	}
+
+	if fakeDisks != nil {
+		return fakeDisks.enableSwap(partName)
+	}
+
+	if device, err := activeSwapDevice(partName); err != nil {
+		return err
+	} else if device != "" {
+		return nil
+	}
+
+	output, err := Runner.Run("swapon", "/dev/"+partName)
+	if err != nil {
+		return ExplainDiskGone(partName, fmt.Errorf("failed to enable swap on %s: %w (output: %s)",
+			partName, err, strings.TrimSpace(string(output))))
+	}
+
+	return nil
+}
+
+// DisableSwap turns off swap on a partition with swapoff, using whichever
+// device it was enabled through. Pages swapped out to it are read back
+// into memory first, so this fails if there isn't enough memory for them.
+// Swap that is not active is left as it is.
+func DisableSwap(partName string) error {
+	if err := CheckPrivileges(); err != nil {
+		return err
+	}
+	defer markDisksChanged()
+
+	if fakeDisks != nil {
+		return fakeDisks.disableSwap(partName)
+	}
+
+	device, err := activeSwapDevice(partName)
+	if err != nil || device == "" {
+		return err
+	}
+
+	output, err := Runner.Run("swapoff", device)
+	if err != nil {
+		return ExplainDiskGone(partName, fmt.Errorf("failed to disable swap on %s: %w (output: %s)",
+			partName, err, strings.TrimSpace(string(output))))
+	}
+
+	return nil
+}
+
+// checkSwapPartition returns an error unless a partition has the
+// freebsd-swap type, so swapon can't page over a filesystem
+func checkSwapPartition(partName string) error {
+	disk, index, err := ParsePartitionName(partName)
+	if err != nil {
+		return err
+	}
+	part, err := LookupPartition(disk, index)
+	if err != nil {
+		return err
+	}
+	if part.Type != "freebsd-swap" {
+		return fmt.Errorf("%s has type %s; only freebsd-swap partitions can be used as swap", partName, part.Type)
+	}
+	return nil
+}
+
+// activeSwapDevice returns the swap device through which a partition is in
+// use as swap, such as /dev/ada0p2, or "" if it isn't
+func activeSwapDevice(partName string) (string, error) {
+	if fakeDisks != nil {
+		return fakeDisks.swapDevice(partName), nil
+	}
+
+	output, err := Runner.Run("swapinfo")
+	if err != nil {
+		return "", fmt.Errorf("failed to list swap devices: %w (output: %s)", err, strings.TrimSpace(string(output)))
+	}
+
+	names := map[string]bool{partName: true}
+	if disk, index, err := ParsePartitionName(partName); err == nil {
+		if part, err := LookupPartition(disk, index); err == nil && part.Label != "" {
+			names["gpt/"+part.Label] = true
+		}
+	}
+
+	for _, device := range parseSwapDevices(string(output)) {
+		name := strings.TrimSuffix(strings.TrimPrefix(device, "/dev/"), ".eli")
+		if names[name] {
+			return device, nil
+		}
+	}
+	return "", nil
+}
+
+// parseSwapDevices reads the devices from swapinfo or swapctl -l output,
+// a header followed by lines such as
+//
+//	/dev/ada0p2          4194304         0   4194304     0%
+func parseSwapDevices(output string) []string {
+	var devices []string
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) > 0 && strings.HasPrefix(fields[0], "/dev/") {
+			devices = append(devices, fields[0])
+		}
+	}
+	return devices
+}
@@ -0,0 +1,89 @@
+package partition
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// TableState describes pending or damaged state of a disk's partition table
+type TableState struct {
+	// Modified is true when gpart has staged changes that need gpart commit
+	Modified bool `json:"modified"`
+	// Corrupt is true when gpart show reports [CORRUPT], e.g. a damaged backup GPT
+	Corrupt bool `json:"corrupt"`
+}
+
+// parseGpartShowState reads the markers on the header line of gpart show:
+//
+//	=>       40  976773088  ada0  GPT  (466G) [CORRUPT]
+func parseGpartShowState(output string) TableState {
+	var state TableState
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "=>") {
+			continue
+		}
+		upper := strings.ToUpper(line)
+		if strings.Contains(upper, "[CORRUPT]") {
+			state.Corrupt = true
+		}
+		if strings.Contains(upper, "[MODIFIED]") {
+			state.Modified = true
+		}
+	}
+	return state
+}
+
+// parseGpartListModified reports whether gpart list shows "modified: true"
+func parseGpartListModified(output string) bool {
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && fields[0] == "modified:" && fields[1] == "true" {
+			return true
+		}
+	}
+	return false
+}
+
+// getTableModified checks gpart list for uncommitted changes
+func getTableModified(diskName string) bool {
+	cmd := exec.Command("gpart", "list", diskName)
+	output, err := runCommand(cmd)
+	if err != nil {
+		return false
+	}
+	return parseGpartListModified(string(output))
+}
+
+// runGpartTableCommand runs a gpart verb that takes only the geom name
+func runGpartTableCommand(verb, disk string) error {
+	if err := CheckPrivileges(); err != nil {
+		return err
+	}
+	defer markDisksChanged()
+
+	cmd := exec.Command("gpart", verb, disk)
+	output, err := runCommand(cmd)
+	if err != nil {
+		return fmt.Errorf("failed to %s partition table on %s: %w (output: %s)", verb, disk, err, string(output))
+	}
+
+	return nil
+}
+
+// CommitTable writes staged partition table changes to disk
+func CommitTable(disk string) error {
+	return runGpartTableCommand("commit", disk)
+}
+
+// UndoTable discards staged partition table changes
+func UndoTable(disk string) error {
+	return runGpartTableCommand("undo", disk)
+}
+
+// RecoverTable repairs a corrupt partition table, e.g. by rewriting a
+// damaged backup GPT header
+func RecoverTable(disk string) error {
+	return runGpartTableCommand("recover", disk)
+}
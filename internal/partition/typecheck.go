@@ -0,0 +1,69 @@
+package partition
+
+import (
+	"fmt"
+	"strings"
+)
+
+// typeFilesystems lists the filesystems each partition type is meant to
+// carry. Types missing from the map, such as freebsd-boot, aren't checked.
+var typeFilesystems = map[string][]string{
+	"freebsd-ufs":   {"UFS"},
+	"freebsd-zfs":   {"ZFS"},
+	"freebsd-swap":  {"swap"},
+	"efi":           {"FAT32"},
+	"ms-basic-data": {"FAT32", "exFAT", "NTFS"},
+	"linux-data":    {"ext2", "ext3", "ext4"},
+	"linux-swap":    {"swap"},
+	"fat32":         {"FAT32"},
+	"fat32lba":      {"FAT32"},
+	"fat16":         {"FAT32"},
+	"ntfs":          {"NTFS", "exFAT"},
+}
+
+// TypeMismatch describes a partition whose type doesn't match the
+// filesystem found on it, e.g. "type: freebsd-swap but contains UFS", as
+// left behind when a partition is repurposed without changing its type.
+// It returns an empty string when they agree or either can't be judged.
+func TypeMismatch(part *Partition) string {
+	expected, ok := typeFilesystems[part.Type]
+	if !ok {
+		return ""
+	}
+
+	// Without a recognisable signature there is nothing to compare, and
+	// GELI can hold any FreeBSD filesystem
+	switch part.FileSystem {
+	case "", "unknown", "GELI":
+		return ""
+	}
+
+	for _, fs := range expected {
+		if strings.EqualFold(fs, part.FileSystem) {
+			return ""
+		}
+	}
+	return fmt.Sprintf("type: %s but contains %s", part.Type, part.FileSystem)
+}
+
+// ValidateDiskLayout returns the problems found in a disk's layout: an
+// unreadable partition table, partitions whose type doesn't match their
+// filesystem and filesystems larger than their partition, which
+// GrowPartitionToFilesystem repairs.
+func ValidateDiskLayout(disk *Disk) []string {
+	var problems []string
+	if disk.LayoutProblem != "" {
+		problems = append(problems, disk.LayoutProblem)
+	}
+
+	for i := range disk.Partitions {
+		part := &disk.Partitions[i]
+		if mismatch := TypeMismatch(part); mismatch != "" {
+			problems = append(problems, fmt.Sprintf("%s: %s", part.Name, mismatch))
+		}
+		if fsSize, overrun := FilesystemOverrun(part); overrun {
+			problems = append(problems, fmt.Sprintf("%s: %s", part.Name, OverrunDescription(part, fsSize)))
+		}
+	}
+	return problems
+}
@@ -0,0 +1,176 @@
+package partition
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// UFSTuning holds the crash-recovery settings of a UFS filesystem
+type UFSTuning struct {
+	SoftUpdates bool
+	Journaling  bool // soft updates journaling (SU+J)
+}
+
+// String describes the settings as shown on partition cards
+func (t UFSTuning) String() string {
+	switch {
+	case t.Journaling:
+		return "soft updates with journaling (SU+J)"
+	case t.SoftUpdates:
+		return "soft updates, no journaling"
+	default:
+		return "soft updates disabled"
+	}
+}
+
+// IsUFS reports whether a partition carries a UFS filesystem
+func IsUFS(part *Partition) bool {
+	return strings.EqualFold(part.FileSystem, "ufs")
+}
+
+// GetUFSTuning reads the soft updates and journaling settings of a UFS
+// partition, from its mount flags when it is mounted and from tunefs -p
+// otherwise
+func GetUFSTuning(part *Partition) (*UFSTuning, error) {
+	if !IsUFS(part) {
+		return nil, fmt.Errorf("%s is not a UFS filesystem", part.Name)
+	}
+
+	if fakeDisks != nil {
+		return fakeDisks.ufsTuning(part.Name)
+	}
+
+	if part.MountPoint != "" {
+		output, err := Runner.Run("mount")
+		if err != nil {
+			return nil, fmt.Errorf("failed to read mount flags: %w (output: %s)", err, string(output))
+		}
+		if tuning, ok := parseMountTuning(string(output), part.Name); ok {
+			return tuning, nil
+		}
+	}
+
+	cmd := exec.Command("tunefs", "-p", "/dev/"+part.Name)
+	output, err := runCommand(cmd)
+	if err != nil {
+		return nil, fmt.Errorf("tunefs failed: %w (output: %s)", err, string(output))
+	}
+
+	return parseTunefsOutput(string(output)), nil
+}
+
+// parseMountTuning finds the mount line of a partition, e.g.
+// /dev/ada0p2 on / (ufs, local, journaled soft-updates)
+// and reads the soft updates flags from it
+func parseMountTuning(output, partName string) (*UFSTuning, bool) {
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 || fields[0] != "/dev/"+partName || fields[1] != "on" {
+			continue
+		}
+
+		start := strings.Index(line, "(")
+		end := strings.LastIndex(line, ")")
+		if start < 0 || end < start {
+			return nil, false
+		}
+
+		tuning := &UFSTuning{}
+		for _, flag := range strings.Split(line[start+1:end], ",") {
+			switch strings.TrimSpace(flag) {
+			case "journaled soft-updates":
+				tuning.SoftUpdates = true
+				tuning.Journaling = true
+			case "soft-updates":
+				tuning.SoftUpdates = true
+			}
+		}
+		return tuning, true
+	}
+	return nil, false
+}
+
+// parseTunefsOutput reads tunefs -p output, which has lines such as
+// tunefs: soft updates: (-n)                                 enabled
+// tunefs: soft update journaling: (-j)                       enabled
+func parseTunefsOutput(output string) *UFSTuning {
+	tuning := &UFSTuning{}
+	for _, line := range strings.Split(output, "\n") {
+		enabled := strings.HasSuffix(strings.TrimSpace(line), "enabled")
+		switch {
+		case strings.Contains(line, "(-n)"):
+			tuning.SoftUpdates = enabled
+		case strings.Contains(line, "(-j)"):
+			tuning.Journaling = enabled
+		}
+	}
+	return tuning
+}
+
+// SetUFSTuning enables or disables soft updates and journaling on an
+// unmounted UFS partition with tunefs -n and -j. Journaling requires soft
+// updates, so it is switched off before soft updates and on after them.
+func SetUFSTuning(part *Partition, tuning UFSTuning) error {
+	if err := CheckPrivileges(); err != nil {
+		return err
+	}
+
+	if !IsUFS(part) {
+		return fmt.Errorf("%s is not a UFS filesystem", part.Name)
+	}
+
+	if part.MountPoint != "" {
+		return fmt.Errorf("%s is mounted at %s; unmount it before changing its UFS settings", part.Name, part.MountPoint)
+	}
+
+	if tuning.Journaling && !tuning.SoftUpdates {
+		return fmt.Errorf("journaling requires soft updates")
+	}
+
+	if err := CheckNotInFlight(part.Name); err != nil {
+		return err
+	}
+
+	if fakeDisks != nil {
+		return fakeDisks.setUFSTuning(part.Name, tuning)
+	}
+
+	current, err := GetUFSTuning(part)
+	if err != nil {
+		return err
+	}
+
+	// Only change what differs; tunefs complains about settings that are
+	// already in effect
+	var steps [][]string
+	if tuning.SoftUpdates != current.SoftUpdates {
+		steps = append(steps, []string{"-n", enableFlag(tuning.SoftUpdates)})
+	}
+	if tuning.Journaling != current.Journaling {
+		step := []string{"-j", enableFlag(tuning.Journaling)}
+		if tuning.Journaling {
+			steps = append(steps, step)
+		} else {
+			steps = append([][]string{step}, steps...)
+		}
+	}
+
+	for _, step := range steps {
+		cmd := exec.Command("tunefs", step[0], step[1], "/dev/"+part.Name)
+		output, err := runCommand(cmd)
+		if err != nil {
+			return ExplainDiskGone(part.Name, fmt.Errorf("tunefs %s %s failed: %w (output: %s)", step[0], step[1], err, string(output)))
+		}
+	}
+
+	return nil
+}
+
+// enableFlag returns the tunefs argument for a setting
+func enableFlag(enabled bool) string {
+	if enabled {
+		return "enable"
+	}
+	return "disable"
+}
@@ -0,0 +1,98 @@
+package partition
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// GetUsage returns the space used on and the total size of the filesystem
+// mounted at mountPoint, in bytes, according to df. Unmounted partitions
+// and swap have no mount point and are reported as errors.
+func GetUsage(mountPoint string) (used, total uint64, err error) {
+	if mountPoint == "" {
+		return 0, 0, fmt.Errorf("no mount point given")
+	}
+
+	if fakeDisks != nil {
+		return fakeDisks.usage(mountPoint)
+	}
+
+	cmd := exec.Command("df", "-k", mountPoint)
+	output, err := runCommand(cmd)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to run df on %s: %w (output: %s)", mountPoint, err, strings.TrimSpace(string(output)))
+	}
+
+	used, total, mountedOn, err := parseDFOutput(string(output))
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// df reports the filesystem containing a path, so a directory that
+	// nothing is mounted on would show the usage of its parent's
+	if filepath.Clean(mountedOn) != filepath.Clean(mountPoint) {
+		return 0, 0, fmt.Errorf("%s is not a mount point (it is on %s)", mountPoint, mountedOn)
+	}
+
+	return used, total, nil
+}
+
+// parseDFOutput reads the used and total space and the mount point from
+// df -k output:
+//
+//	Filesystem  1024-blocks  Used  Avail Capacity  Mounted on
+//	/dev/ada0p2    20307196  8123  1234    40%     /
+//
+// Long device names can push the figures onto a line of their own, and
+// device names and mount points can contain spaces, so the figures are
+// found by the capacity column rather than by position.
+func parseDFOutput(output string) (used, total uint64, mountedOn string, err error) {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if len(lines) < 2 {
+		return 0, 0, "", fmt.Errorf("unexpected df output: %s", output)
+	}
+
+	fields := strings.Fields(strings.Join(lines[1:], " "))
+	capacity := -1
+	for i := 3; i < len(fields); i++ {
+		if strings.HasSuffix(fields[i], "%") {
+			capacity = i
+			break
+		}
+	}
+	if capacity < 0 || capacity == len(fields)-1 {
+		return 0, 0, "", fmt.Errorf("unexpected df output: %s", output)
+	}
+
+	totalKB, err := strconv.ParseUint(fields[capacity-3], 10, 64)
+	if err != nil {
+		return 0, 0, "", fmt.Errorf("unexpected df output: %s", output)
+	}
+	usedKB, err := strconv.ParseUint(fields[capacity-2], 10, 64)
+	if err != nil {
+		return 0, 0, "", fmt.Errorf("unexpected df output: %s", output)
+	}
+
+	return usedKB * 1024, totalKB * 1024, strings.Join(fields[capacity+1:], " "), nil
+}
+
+// UsageSummary describes the usage of a mounted filesystem, e.g.
+// "12.30 GB used, 37.70 GB free (25%)"
+func UsageSummary(used, total uint64) string {
+	var free uint64
+	if total > used {
+		free = total - used
+	}
+	return fmt.Sprintf("%s used, %s free (%d%%)", FormatBytes(used), FormatBytes(free), usagePercent(used, total))
+}
+
+// usagePercent returns used as a whole percentage of total
+func usagePercent(used, total uint64) int {
+	if total == 0 {
+		return 0
+	}
+	return int(float64(used) * 100 / float64(total))
+}
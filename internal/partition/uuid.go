@@ -0,0 +1,75 @@
+package partition
+
+import (
+	"fmt"
+	"strings"
+)
+
+// getPartitionUUIDs returns the GPT partition GUIDs of a disk's partitions
+// by name. Disks without GPT, or whose list can't be read, give an empty
+// map.
+func getPartitionUUIDs(diskName string) map[string]string {
+	output, err := Runner.Run("gpart", "list", diskName)
+	if err != nil {
+		return nil
+	}
+	return parseGpartListUUIDs(string(output))
+}
+
+// parseGpartListUUIDs reads the rawuuid of each provider from gpart list
+// output:
+//
+//	Providers:
+//	1. Name: ada0p1
+//	   Mediasize: 209715200 (200M)
+//	   ...
+//	   rawuuid: 1e5b1f0c-8d2e-11ee-b9d1-0242ac120002
+//	   ...
+//	Consumers:
+//	1. Name: ada0
+//
+// Consumers are the disk itself and are skipped.
+func parseGpartListUUIDs(output string) map[string]string {
+	uuids := make(map[string]string)
+	var name string
+	inProviders := false
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "Providers:":
+			inProviders = true
+		case line == "Consumers:":
+			inProviders = false
+		case inProviders && strings.Contains(line, ". Name: "):
+			name = strings.TrimSpace(line[strings.Index(line, ". Name: ")+len(". Name: "):])
+		case inProviders && strings.HasPrefix(line, "rawuuid:") && name != "":
+			uuids[name] = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(line, "rawuuid:")))
+		}
+	}
+	return uuids
+}
+
+// FindPartitionByUUID returns the partition with a GPT partition GUID, on
+// whichever disk it is now. Scripts can use it to find a partition after
+// its disk was renumbered, e.g. ada0 becoming ada1 between boots.
+func FindPartitionByUUID(uuid string) (*Partition, error) {
+	uuid = strings.ToLower(strings.TrimSpace(uuid))
+	if !IsTypeGUID(uuid) || strings.HasPrefix(uuid, "!") {
+		return nil, fmt.Errorf("invalid partition UUID %q", uuid)
+	}
+
+	disks, err := GetDisks()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, disk := range disks {
+		for i := range disk.Partitions {
+			if disk.Partitions[i].UUID == uuid {
+				return &disk.Partitions[i], nil
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("no partition with UUID %s", uuid)
+}
@@ -0,0 +1,72 @@
+package partition
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+)
+
+// DiskGoneError reports that an operation failed because its disk was
+// removed (e.g. a USB drive unplugged mid-operation)
+type DiskGoneError struct {
+	Disk string
+	Err  error
+}
+
+func (e *DiskGoneError) Error() string {
+	return fmt.Sprintf("disk %s is no longer present", e.Disk)
+}
+
+func (e *DiskGoneError) Unwrap() error {
+	return e.Err
+}
+
+// IsDiskGone reports whether err was caused by a disk disappearing
+func IsDiskGone(err error) bool {
+	var gone *DiskGoneError
+	return errors.As(err, &gone)
+}
+
+// DiskPresent reports whether the device node of a disk still exists
+func DiskPresent(diskName string) bool {
+	if fakeDisks != nil {
+		fakeDisks.mu.Lock()
+		defer fakeDisks.mu.Unlock()
+		_, err := fakeDisks.findDisk(diskName)
+		return err == nil
+	}
+
+	_, err := os.Stat("/dev/" + diskName)
+	return err == nil
+}
+
+// isDeviceMissingError reports whether a tool failed with ENXIO, which
+// FreeBSD reports as "Device not configured" once a device has detached
+func isDeviceMissingError(err error) bool {
+	if errors.Is(err, syscall.ENXIO) {
+		return true
+	}
+	return strings.Contains(strings.ToLower(err.Error()), "device not configured")
+}
+
+// ExplainDiskGone replaces an error caused by the disk vanishing with a
+// DiskGoneError. name may be a disk or a partition on it. Other errors are
+// returned unchanged.
+func ExplainDiskGone(name string, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	diskName := name
+	if disk, _, parseErr := ParsePartitionName(name); parseErr == nil {
+		diskName = disk
+	}
+
+	if !isDeviceMissingError(err) && DiskPresent(diskName) {
+		return err
+	}
+
+	return &DiskGoneError{Disk: diskName, Err: err}
+}
@@ -0,0 +1,197 @@
+package partition
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sync"
+)
+
+const (
+	// DefaultVerifyChunkSize is the size of the pieces VerifyPartitionCopy
+	// compares at a time
+	DefaultVerifyChunkSize = 4 * 1024 * 1024
+	// DefaultVerifyWorkers is the number of chunks compared concurrently
+	DefaultVerifyWorkers = 4
+)
+
+// VerifyOptions tunes VerifyPartitionCopyWithOptions. Zero values select
+// the defaults.
+type VerifyOptions struct {
+	// ChunkSize is the number of bytes compared at a time. It must be a
+	// multiple of the sector size of both devices.
+	ChunkSize int64
+	// Workers is the number of chunks read and compared concurrently
+	Workers int
+}
+
+// VerifyPartitionCopy checks that destPart holds an exact copy of
+// sourcePart. Only the first source-size bytes of the destination are
+// compared, since a copy may go to a larger partition.
+func VerifyPartitionCopy(sourcePart, destPart string) error {
+	return VerifyPartitionCopyWithOptions(sourcePart, destPart, VerifyOptions{}, nil)
+}
+
+// VerifyPartitionCopyWithOptions is VerifyPartitionCopy with a chosen
+// chunk size and worker count, reporting progress as a percentage. Both
+// devices are read chunk by chunk in parallel and compared directly, and
+// verification stops at the first difference, reporting its offset.
+func VerifyPartitionCopyWithOptions(sourcePart, destPart string, opts VerifyOptions, progressCallback func(float64)) error {
+	if err := CheckPrivileges(); err != nil {
+		return err
+	}
+
+	if opts.ChunkSize <= 0 {
+		opts.ChunkSize = DefaultVerifyChunkSize
+	}
+	if opts.Workers <= 0 {
+		opts.Workers = DefaultVerifyWorkers
+	}
+
+	if fakeDisks != nil {
+		return fakeDisks.verifyCopy(sourcePart, destPart, progressCallback)
+	}
+
+	for _, part := range []string{sourcePart, destPart} {
+		if disk, _, err := ParsePartitionName(part); err == nil {
+			if sectorSize := int64(deviceSectorSize(disk)); opts.ChunkSize%sectorSize != 0 {
+				return fmt.Errorf("chunk size %d is not a multiple of the %d-byte sectors of %s", opts.ChunkSize, sectorSize, part)
+			}
+		}
+	}
+
+	sourceSize, err := getPartitionSize(sourcePart)
+	if err != nil {
+		return fmt.Errorf("failed to get source partition size: %w", err)
+	}
+	destSize, err := getPartitionSize(destPart)
+	if err != nil {
+		return fmt.Errorf("failed to get destination partition size: %w", err)
+	}
+	if destSize < sourceSize {
+		return fmt.Errorf("verification failed: %s (%s) is smaller than %s (%s)",
+			destPart, FormatBytes(destSize), sourcePart, FormatBytes(sourceSize))
+	}
+
+	src, err := os.Open("/dev/" + sourcePart)
+	if err != nil {
+		return ExplainDiskGone(sourcePart, fmt.Errorf("failed to open %s: %w", sourcePart, err))
+	}
+	defer src.Close()
+
+	dst, err := os.Open("/dev/" + destPart)
+	if err != nil {
+		return ExplainDiskGone(destPart, fmt.Errorf("failed to open %s: %w", destPart, err))
+	}
+	defer dst.Close()
+
+	return compareDevices(src, dst, int64(sourceSize), opts, progressCallback)
+}
+
+// verifyResult is the outcome of comparing one chunk
+type verifyResult struct {
+	length   int64
+	mismatch int64 // offset of the first differing byte, or -1
+	err      error
+}
+
+// compareDevices compares the first size bytes of src and dst. Workers
+// take chunk offsets from a channel and read both devices with ReadAt,
+// which is safe to call concurrently. The first difference or read error
+// stops the dispatch of further chunks; of the differences found, the one
+// at the lowest offset is reported.
+func compareDevices(src, dst *os.File, size int64, opts VerifyOptions, progressCallback func(float64)) error {
+	offsets := make(chan int64)
+	results := make(chan verifyResult)
+	stop := make(chan struct{})
+
+	var wg sync.WaitGroup
+	for w := 0; w < opts.Workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			srcBuf := make([]byte, opts.ChunkSize)
+			dstBuf := make([]byte, opts.ChunkSize)
+			for offset := range offsets {
+				results <- compareChunk(src, dst, offset, size, srcBuf, dstBuf)
+			}
+		}()
+	}
+
+	go func() {
+		defer close(offsets)
+		for offset := int64(0); offset < size; offset += opts.ChunkSize {
+			select {
+			case offsets <- offset:
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	var verified int64
+	mismatch := int64(-1)
+	var readErr error
+	stopped := false
+	for result := range results {
+		switch {
+		case result.err != nil:
+			if readErr == nil {
+				readErr = result.err
+			}
+		case result.mismatch >= 0:
+			if mismatch < 0 || result.mismatch < mismatch {
+				mismatch = result.mismatch
+			}
+		default:
+			verified += result.length
+			if progressCallback != nil && !stopped {
+				progressCallback(float64(verified) / float64(size) * 100)
+			}
+			continue
+		}
+		if !stopped {
+			close(stop)
+			stopped = true
+		}
+	}
+
+	if mismatch >= 0 {
+		return fmt.Errorf("verification failed: %s and %s differ at byte offset %d (%s in)",
+			src.Name(), dst.Name(), mismatch, FormatBytes(uint64(mismatch)))
+	}
+	if readErr != nil {
+		return fmt.Errorf("verification failed: %w", readErr)
+	}
+	return nil
+}
+
+// compareChunk compares the chunk of both devices starting at offset
+func compareChunk(src, dst *os.File, offset, size int64, srcBuf, dstBuf []byte) verifyResult {
+	length := int64(len(srcBuf))
+	if offset+length > size {
+		length = size - offset
+	}
+
+	if _, err := src.ReadAt(srcBuf[:length], offset); err != nil {
+		return verifyResult{err: fmt.Errorf("failed to read the source at byte %d: %w", offset, err)}
+	}
+	if _, err := dst.ReadAt(dstBuf[:length], offset); err != nil {
+		return verifyResult{err: fmt.Errorf("failed to read the copy at byte %d: %w", offset, err)}
+	}
+
+	if bytes.Equal(srcBuf[:length], dstBuf[:length]) {
+		return verifyResult{length: length, mismatch: -1}
+	}
+	for i := int64(0); i < length; i++ {
+		if srcBuf[i] != dstBuf[i] {
+			return verifyResult{length: length, mismatch: offset + i}
+		}
+	}
+	return verifyResult{length: length, mismatch: -1}
+}
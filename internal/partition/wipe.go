@@ -0,0 +1,328 @@
+package partition
+
+import (
+	"bufio"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// Wipe methods accepted by SecureWipe
+const (
+	// WipeAuto uses an ATA secure erase for a whole disk that supports
+	// it and zero-fills anything else
+	WipeAuto = "auto"
+	// WipeZero overwrites with zeros from /dev/zero
+	WipeZero = "zero"
+	// WipeRandom overwrites with data from /dev/random
+	WipeRandom = "random"
+	// WipeATA has the drive erase itself with the ATA security erase
+	// command. It only works on whole disks and always makes one pass.
+	WipeATA = "ata"
+)
+
+// WipeMethods lists the methods SecureWipe accepts, in the order the
+// interfaces offer them
+var WipeMethods = []string{WipeAuto, WipeZero, WipeRandom, WipeATA}
+
+// maxWipePasses bounds the number of overwrite passes; more than a few
+// add nothing on modern drives but hours of writing
+const maxWipePasses = 35
+
+// ATASecurity describes the ATA security feature set of a disk as
+// camcontrol security reports it
+type ATASecurity struct {
+	Supported bool
+	Enabled   bool // a user password is set
+	Frozen    bool // the BIOS froze the feature set until the next power cycle
+}
+
+// CanErase reports whether an ATA secure erase can be started now
+func (s ATASecurity) CanErase() bool {
+	return s.Supported && !s.Enabled && !s.Frozen
+}
+
+// GetATASecurity returns the ATA security state of a disk. Drives that
+// camcontrol can't query, such as NVMe drives, report no support.
+func GetATASecurity(diskName string) ATASecurity {
+	if fakeDisks != nil {
+		return fakeDisks.ataSecurity(diskName)
+	}
+
+	output, err := Runner.Run("camcontrol", "security", diskName)
+	if err != nil {
+		return ATASecurity{}
+	}
+	return parseATASecurity(string(output))
+}
+
+// parseATASecurity reads camcontrol security output:
+//
+//	Security supported                    yes
+//	Security enabled                      no
+//	Security frozen                       no
+func parseATASecurity(output string) ATASecurity {
+	var sec ATASecurity
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(strings.ToLower(line))
+		if len(fields) != 3 || fields[0] != "security" {
+			continue
+		}
+		yes := fields[2] == "yes"
+		switch fields[1] {
+		case "supported":
+			sec.Supported = yes
+		case "enabled":
+			sec.Enabled = yes
+		case "frozen":
+			sec.Frozen = yes
+		}
+	}
+	return sec
+}
+
+// autoWipeMethod returns the method the auto method uses on disk and why:
+// an ATA secure erase for a whole non-rotating disk that can do one, as
+// only that reaches the spare blocks of an SSD, and zeros otherwise. On a
+// hard disk an erase is no more thorough than overwriting and may run for
+// hours without progress, so those are overwritten.
+func autoWipeMethod(disk string, wholeDisk bool) (string, string) {
+	switch {
+	case !wholeDisk:
+		return WipeZero, "an ATA secure erase only wipes whole disks"
+	case !GetATASecurity(disk).CanErase():
+		return WipeZero, fmt.Sprintf("%s can't run an ATA secure erase", disk)
+	case !diskNonRotating(disk):
+		return WipeZero, fmt.Sprintf("%s is a rotating disk, which overwriting wipes as thoroughly as an ATA secure erase", disk)
+	}
+	return WipeATA, fmt.Sprintf("%s is an SSD that supports ATA secure erase, which also reaches its spare blocks", disk)
+}
+
+// diskNonRotating reports whether diskinfo gives disk a rotation rate of
+// 0, i.e. it is an SSD. Disks whose rate is unknown count as rotating.
+func diskNonRotating(disk string) bool {
+	if fakeDisks != nil {
+		return fakeDisks.nonRotating(disk)
+	}
+	geom, err := GetDiskGeometry(disk)
+	return err == nil && geom.NonRotating
+}
+
+// SecureWipe overwrites a partition, or a whole disk when given a disk
+// name, so its data can't be read back. See SecureWipeWithLog.
+func SecureWipe(partName string, passes int, method string) error {
+	return SecureWipeWithLog(partName, passes, method, nil, nil)
+}
+
+// SecureWipeWithLog is SecureWipe reporting the bytes written over all
+// passes to progress and its steps and the output of dd to logger, either
+// of which may be nil. Each pass writes the whole device with zeros or random data.
+// Overwriting can't reach the spare blocks of an SSD; for those, wiping
+// the whole disk with an ATA secure erase is more thorough, which the
+// auto method picks when the drive supports it and is an SSD.
+func SecureWipeWithLog(partName string, passes int, method string, progress ProgressReporter, logger OperationLogger) error {
+	if err := CheckPrivileges(); err != nil {
+		return err
+	}
+	defer markDisksChanged()
+
+	if passes < 1 || passes > maxWipePasses {
+		return fmt.Errorf("the number of passes must be between 1 and %d", maxWipePasses)
+	}
+
+	disk, _, err := ParsePartitionName(partName)
+	wholeDisk := err != nil
+	if wholeDisk {
+		disk = partName
+		if !DiskPresent(disk) {
+			return fmt.Errorf("%s is neither a partition nor a disk", partName)
+		}
+	}
+
+	if err := checkWipeTarget(partName, disk, wholeDisk); err != nil {
+		return err
+	}
+
+	if method == "" || method == WipeAuto {
+		var reason string
+		method, reason = autoWipeMethod(disk, wholeDisk)
+		logLine(logger, "Wipe method %s: %s", method, reason)
+	}
+
+	var source string
+	switch method {
+	case WipeZero:
+		source = "/dev/zero"
+	case WipeRandom:
+		source = "/dev/random"
+	case WipeATA:
+		if !wholeDisk {
+			return fmt.Errorf("an ATA secure erase wipes the whole disk; wipe %s instead of %s", disk, partName)
+		}
+		sec := GetATASecurity(disk)
+		switch {
+		case !sec.Supported:
+			return fmt.Errorf("%s does not support the ATA security feature set", disk)
+		case sec.Frozen:
+			return fmt.Errorf("the ATA security feature set of %s is frozen; suspend and resume the machine or replug the drive, then try again", disk)
+		case sec.Enabled:
+			return fmt.Errorf("%s already has an ATA user password; remove it with camcontrol security first", disk)
+		}
+	default:
+		return fmt.Errorf("unknown wipe method %q (use %s)", method, strings.Join(WipeMethods, ", "))
+	}
+
+	release, err := beginInFlight(fmt.Sprintf("wiping %s", partName), partName)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	if method == WipeATA {
+		return ataSecureErase(disk, logger)
+	}
+
+	size, err := getPartitionSize(partName)
+	if err != nil {
+		return fmt.Errorf("failed to get the size of %s: %w", partName, err)
+	}
+	sectorSize := deviceSectorSize(disk)
+
+	if DryRun {
+		for pass := 1; pass <= passes; pass++ {
+			for _, cmd := range wipeCommands(partName, source, size, sectorSize) {
+				dryRun(cmd)
+			}
+		}
+		return nil
+	}
+
+	if fakeDisks != nil {
+		return fakeDisks.wipe(partName, passes, progress, logger)
+	}
+
+	progress = orNoProgress(progress)
+	for pass := 1; pass <= passes; pass++ {
+		logStep(logger, "Pass %d of %d: overwriting %s with %s", pass, passes, partName, source)
+		passProgress := func(written uint64) {
+			progress.Update(uint64(pass-1)*size+written, uint64(passes)*size, "")
+		}
+		for _, cmd := range wipeCommands(partName, source, size, sectorSize) {
+			if err := runWipeCommand(cmd, passProgress, logger); err != nil {
+				return ExplainDiskGone(disk, fmt.Errorf("pass %d of %d failed: %w", pass, passes, err))
+			}
+		}
+	}
+
+	logLine(logger, "Wiped %s", partName)
+	return nil
+}
+
+// checkWipeTarget refuses to wipe a partition or disk while it, or
+// anything on it, is in use (see checkNotInUse), and a disk in use by a
+// copy. A disk without a partition table is checked as a device of its
+// own, e.g. for a whole-disk ZFS vdev.
+func checkWipeTarget(partName, disk string, wholeDisk bool) error {
+	if wholeDisk {
+		if err := CheckDiskNotInFlight(disk); err != nil {
+			return err
+		}
+		// Without a partition table only the disk itself can be in use
+		parts, _ := getPartitions(disk)
+		return checkNotInUse(disk, parts, "wiping "+disk)
+	}
+
+	_, index, _ := ParsePartitionName(partName)
+	part, err := LookupPartition(disk, index)
+	if err != nil {
+		return err
+	}
+	return checkNotInUse(part.Name, []Partition{*part}, "wiping "+part.Name)
+}
+
+// wipeCommands returns the dd commands that overwrite the first size
+// bytes of a device from source: whole 1MB blocks, then the remaining
+// sectors, so dd doesn't fail writing past the end of the device
+func wipeCommands(partName, source string, size, sectorSize uint64) []*exec.Cmd {
+	blocks := size / CopyBlockSize
+	var cmds []*exec.Cmd
+	if blocks > 0 {
+		cmds = append(cmds, exec.Command("dd",
+			"if="+source,
+			"of=/dev/"+partName,
+			fmt.Sprintf("bs=%d", CopyBlockSize),
+			fmt.Sprintf("count=%d", blocks),
+			"status=progress",
+		))
+	}
+	if rest := size - blocks*CopyBlockSize; rest >= sectorSize {
+		cmds = append(cmds, exec.Command("dd",
+			"if="+source,
+			"of=/dev/"+partName,
+			fmt.Sprintf("bs=%d", sectorSize),
+			fmt.Sprintf("seek=%d", blocks*CopyBlockSize/sectorSize),
+			fmt.Sprintf("count=%d", rest/sectorSize),
+		))
+	}
+	return cmds
+}
+
+// runWipeCommand runs one dd of a wipe pass, reporting the bytes dd says
+// it has written
+func runWipeCommand(cmd *exec.Cmd, progressCallback func(uint64), logger OperationLogger) error {
+	logLine(logger, "%s", strings.Join(cmd.Args, " "))
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return fmt.Errorf("failed to create stderr pipe: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start dd: %w", err)
+	}
+
+	scanner := bufio.NewScanner(stderr)
+	scanner.Split(scanDDLines)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if written, ok := parseDDBytes(line); ok {
+			progressCallback(written)
+		}
+		logLine(logger, "%s", line)
+	}
+
+	if err := cmd.Wait(); err != nil {
+		return fmt.Errorf("dd failed: %w", err)
+	}
+	return nil
+}
+
+// ataSecurePassword is the temporary user password an ATA secure erase
+// needs; the drive clears it when the erase completes
+const ataSecurePassword = "pgpart"
+
+// ataSecureErase has a disk erase all of its blocks, including those not
+// visible to the host, with camcontrol security. The drive reports no
+// progress, and erasing can take hours on large disks.
+func ataSecureErase(disk string, logger OperationLogger) error {
+	cmd := exec.Command("camcontrol", "security", disk,
+		"-U", "user", "-s", ataSecurePassword, "-e", ataSecurePassword, "-y")
+	if dryRun(cmd) {
+		return nil
+	}
+
+	if fakeDisks != nil {
+		return fakeDisks.wipe(disk, 1, nil, logger)
+	}
+
+	logStep(logger, "Running an ATA secure erase on %s", disk)
+	logLine(logger, "%s", strings.Join(cmd.Args, " "))
+	output, err := runCommand(cmd)
+	logLine(logger, "%s", strings.TrimSpace(string(output)))
+	if err != nil {
+		return ExplainDiskGone(disk, fmt.Errorf("ATA secure erase of %s failed: %w (output: %s)",
+			disk, err, strings.TrimSpace(string(output))))
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package partition
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckWipeTargetWholeDiskVdev(t *testing.T) {
+	fake := useFakeRunner(t)
+	fake.Respond("zpool status -P", "  pool: tank\nconfig:\n\n\tNAME        STATE\n\ttank        ONLINE\n\t  /dev/ada3  ONLINE\n", nil)
+
+	// gpart knows no table on ada3, which must not make it count as unused
+	err := checkWipeTarget("ada3", "ada3", true)
+	if err == nil || !strings.Contains(err.Error(), "ada3 is in ZFS pool tank") {
+		t.Errorf("checkWipeTarget(ada3) = %v, want it refused as a vdev of tank", err)
+	}
+}
+
+func TestCheckWipeTargetPartitions(t *testing.T) {
+	useFakeDisks(t)
+
+	tests := []struct {
+		partName string
+		disk     string
+		wantErr  string
+	}{
+		{"ada1p1", "ada1", "mounted at /data"},
+		{"ada0p3", "ada0", "in ZFS pool zroot"},
+		{"ada1p2", "ada1", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.partName, func(t *testing.T) {
+			err := checkWipeTarget(tt.partName, tt.disk, false)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("checkWipeTarget(%s) = %v, want no error", tt.partName, err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("checkWipeTarget(%s) = %v, want an error containing %q", tt.partName, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAutoWipeMethod(t *testing.T) {
+	const canErase = "Security supported                    yes\nSecurity enabled                      no\nSecurity frozen                       no\n"
+	const frozen = "Security supported                    yes\nSecurity enabled                      no\nSecurity frozen                       yes\n"
+	const hddDiskinfo = "/dev/ada3\n\t512\t# sectorsize\n\t7200\t# Rotation rate in RPM\n"
+
+	tests := []struct {
+		name       string
+		wholeDisk  bool
+		security   string
+		diskinfo   string
+		wantMethod string
+		wantReason string
+	}{
+		{"SSD", true, canErase, ssdDiskinfo, WipeATA, "is an SSD"},
+		{"hard disk", true, canErase, hddDiskinfo, WipeZero, "is a rotating disk"},
+		{"unknown rotation", true, canErase, "/dev/ada3\n\t512\t# sectorsize\n", WipeZero, "is a rotating disk"},
+		{"frozen SSD", true, frozen, ssdDiskinfo, WipeZero, "can't run an ATA secure erase"},
+		{"partition of an SSD", false, canErase, ssdDiskinfo, WipeZero, "only wipes whole disks"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := useFakeRunner(t)
+			fake.Respond("camcontrol security ada3", tt.security, nil)
+			fake.Respond("diskinfo -v ada3", tt.diskinfo, nil)
+
+			method, reason := autoWipeMethod("ada3", tt.wholeDisk)
+			if method != tt.wantMethod || !strings.Contains(reason, tt.wantReason) {
+				t.Errorf("autoWipeMethod = %s, %q; want %s for a reason containing %q", method, reason, tt.wantMethod, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestSecureWipeLogsAutoMethod(t *testing.T) {
+	useFakeDisks(t)
+	logger := &recordingLogger{}
+
+	if err := SecureWipeWithLog("ada2", 1, WipeAuto, nil, logger); err != nil {
+		t.Fatalf("SecureWipeWithLog(ada2): %v", err)
+	}
+	if len(logger.lines) == 0 || !strings.HasPrefix(logger.lines[0], "Wipe method zero: ") {
+		t.Errorf("logged lines %q, want the auto method's choice of zero first", logger.lines)
+	}
+}
@@ -0,0 +1,129 @@
+package partition
+
+import (
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+// ZFSPoolLayouts lists the vdev layouts CreateZFSPool accepts, from least
+// to most redundant
+var ZFSPoolLayouts = []string{"stripe", "mirror", "raidz", "raidz2"}
+
+// MinZFSPoolDevices returns the number of partitions a pool layout needs.
+// zpool itself accepts smaller raidz vdevs, but requiring two data devices
+// besides the parity ones keeps them from being a slower mirror.
+func MinZFSPoolDevices(layout string) int {
+	switch layout {
+	case "mirror":
+		return 2
+	case "raidz":
+		return 3
+	case "raidz2":
+		return 4
+	default:
+		return 1
+	}
+}
+
+// zfsPoolNamePattern matches the pool names zpool accepts: a letter
+// followed by letters, digits, underscores, hyphens, colons and periods
+var zfsPoolNamePattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_.:-]*$`)
+
+// ValidateZFSPoolName checks a pool name against the rules of zpool create
+func ValidateZFSPoolName(name string) error {
+	if name == "" {
+		return fmt.Errorf("pool name is empty")
+	}
+	if !zfsPoolNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid pool name %q: it must start with a letter and contain only letters, digits and _ - : .", name)
+	}
+	for _, reserved := range []string{"mirror", "raidz", "draid", "spare", "log", "cache"} {
+		if strings.HasPrefix(name, reserved) {
+			return fmt.Errorf("invalid pool name %q: names beginning with %q are reserved", name, reserved)
+		}
+	}
+	// c0, c1... are reserved because they look like Solaris disk names
+	if len(name) > 1 && name[0] == 'c' && name[1] >= '0' && name[1] <= '9' {
+		return fmt.Errorf("invalid pool name %q: names like c0 are reserved for disk names", name)
+	}
+	return nil
+}
+
+// CanCreateZFSPool reports whether zpool is available to create pools
+func CanCreateZFSPool() bool {
+	if fakeDisks != nil {
+		return true
+	}
+	_, err := exec.LookPath("zpool")
+	return err == nil
+}
+
+// CreateZFSPool creates a ZFS pool named poolName from partitions with
+// zpool create, laid out as layout: "stripe" (no redundancy), "mirror",
+// "raidz" or "raidz2". Everything on the partitions is destroyed.
+func CreateZFSPool(poolName string, partNames []string, layout string) error {
+	if err := CheckPrivileges(); err != nil {
+		return err
+	}
+	defer markDisksChanged()
+
+	if err := ValidateZFSPoolName(poolName); err != nil {
+		return err
+	}
+
+	knownLayout := false
+	for _, l := range ZFSPoolLayouts {
+		if l == layout {
+			knownLayout = true
+		}
+	}
+	if !knownLayout {
+		return fmt.Errorf("unsupported pool layout %q (use %s)", layout, strings.Join(ZFSPoolLayouts, ", "))
+	}
+
+	if min := MinZFSPoolDevices(layout); len(partNames) < min {
+		return fmt.Errorf("a %s pool needs at least %d partitions, %d selected", layout, min, len(partNames))
+	}
+
+	seen := make(map[string]bool)
+	for _, name := range partNames {
+		if seen[name] {
+			return fmt.Errorf("%s is listed more than once", name)
+		}
+		seen[name] = true
+
+		if err := CheckNotInFlight(name); err != nil {
+			return err
+		}
+	}
+
+	if fakeDisks != nil {
+		return fakeDisks.createZFSPool(poolName, partNames)
+	}
+
+	args := []string{"create", poolName}
+	if layout != "stripe" {
+		args = append(args, layout)
+	}
+	for _, name := range partNames {
+		if mp, _ := getMountPoint(name); mp != "" {
+			return fmt.Errorf("%s is mounted at %s; unmount it first", name, mp)
+		}
+		args = append(args, "/dev/"+name)
+	}
+
+	output, err := Runner.Run("zpool", args...)
+	if err != nil {
+		err = fmt.Errorf("failed to create ZFS pool %s: %w (output: %s)", poolName, err, strings.TrimSpace(string(output)))
+		for _, name := range partNames {
+			if gone := ExplainDiskGone(name, err); IsDiskGone(gone) {
+				return gone
+			}
+		}
+		return err
+	}
+
+	return nil
+}
@@ -80,6 +80,14 @@ func (ad *AttributesDialog) Show() {
 		attrWidgets = append(attrWidgets, attrContainer)
 	}
 
+	// The required attribute can't be changed with gpart, so it is only shown
+	if attrInfo.Attributes[partition.AttrRequired] {
+		requiredLabel := widget.NewLabel("✓ required (read-only): firmware or the operating system depends on this partition; deleting or formatting it asks for extra confirmation")
+		requiredLabel.Wrapping = fyne.TextWrapWord
+		requiredLabel.Importance = widget.WarningImportance
+		attrWidgets = append(attrWidgets, requiredLabel, widget.NewSeparator())
+	}
+
 	// Info label
 	infoLabel := widget.NewLabel("Note: Changes will be applied immediately when you click 'Apply'")
 	infoLabel.Wrapping = fyne.TextWrapWord
@@ -174,7 +182,7 @@ func (ad *AttributesDialog) applyAttributes(checkboxes map[string]*widget.Check,
 		for _, c := range changes {
 			successMsg += "• " + c + "\n"
 		}
-		dialog.ShowInformation("Success", successMsg, ad.window)
+		showSuccess(ad.window, successMsg)
 
 		// Update current info for subsequent changes
 		newInfo, err := partition.GetPartitionAttributes(ad.partition.Name)
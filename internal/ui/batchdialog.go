@@ -3,6 +3,7 @@ package ui
 import (
 	"fmt"
 	"strconv"
+	"time"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/container"
@@ -21,17 +22,23 @@ type BatchDialog struct {
 	statusLabel   *widget.Label
 	progressBar   *widget.ProgressBar
 	executeBtn    *widget.Button
+	retryBtn      *widget.Button
 	stopOnError   *widget.Check
+	timeoutEntry  *widget.Entry
 	selectedOp    int
+	onChange      func()
 }
 
-// NewBatchDialog creates a new batch operations dialog
-func NewBatchDialog(window fyne.Window, disks []partition.Disk) *BatchDialog {
+// NewBatchDialog creates a new batch operations dialog for queue. The queue
+// outlives the dialog so that queued operations survive closing it.
+// onChange is called as operations complete so the disk view can follow.
+func NewBatchDialog(window fyne.Window, disks []partition.Disk, queue *partition.BatchQueue, onChange func()) *BatchDialog {
 	return &BatchDialog{
 		window:     window,
 		disks:      disks,
-		queue:      partition.NewBatchQueue(),
+		queue:      queue,
 		selectedOp: -1,
+		onChange:   onChange,
 	}
 }
 
@@ -65,6 +72,9 @@ func (bd *BatchDialog) Show() {
 					status = "▶ "
 				case "completed":
 					status = "✓ "
+					if op.Warning != "" {
+						status = "⚠ "
+					}
 				case "failed":
 					status = "✗ "
 				}
@@ -81,6 +91,13 @@ func (bd *BatchDialog) Show() {
 	bd.stopOnError = widget.NewCheck("Stop on error", nil)
 	bd.stopOnError.SetChecked(true)
 
+	// Default timeout, in minutes, for operations without their own
+	bd.timeoutEntry = widget.NewEntry()
+	bd.timeoutEntry.SetPlaceHolder("no limit")
+	if timeout := bd.queue.DefaultTimeout(); timeout > 0 {
+		bd.timeoutEntry.SetText(strconv.Itoa(int(timeout.Minutes())))
+	}
+
 	// Add operation buttons
 	addFormatBtn := widget.NewButton("Add Format", bd.showAddFormatDialog)
 	addDeleteBtn := widget.NewButton("Add Delete", bd.showAddDeleteDialog)
@@ -141,6 +158,7 @@ func (bd *BatchDialog) Show() {
 
 	// Execute button
 	bd.executeBtn = widget.NewButton("Execute All", bd.executeAll)
+	bd.retryBtn = widget.NewButton("Retry Failed", bd.retryFailed)
 
 	// Close button
 	closeBtn := widget.NewButton("Close", func() {
@@ -164,14 +182,17 @@ func (bd *BatchDialog) Show() {
 			widget.NewLabel("Manage Queue:"),
 			controlButtons,
 			widget.NewSeparator(),
-			bd.stopOnError,
-			container.NewGridWithColumns(2, bd.executeBtn, closeBtn),
+			container.NewBorder(nil, nil, bd.stopOnError, nil,
+				widget.NewForm(widget.NewFormItem("Timeout per operation (minutes)", bd.timeoutEntry))),
+			container.NewGridWithColumns(3, bd.executeBtn, bd.retryBtn, closeBtn),
 		),
 		nil,
 		nil,
 		bd.operationList,
 	)
 
+	bd.updateStatus()
+
 	// Create and show dialog
 	d := dialog.NewCustom("Batch Operations", "Close", content, bd.window)
 	d.Resize(fyne.NewSize(600, 500))
@@ -194,9 +215,9 @@ func (bd *BatchDialog) showAddFormatDialog() {
 	}
 
 	// Filesystem type selector
-	fsTypes := []string{"UFS", "FAT32", "ext2", "ext3", "ext4", "NTFS"}
-	fsSelect := widget.NewSelect(fsTypes, nil)
-	fsSelect.SetSelected("UFS")
+	fsNames := partition.FormatterNames()
+	fsSelect := widget.NewSelect(fsNames, nil)
+	fsSelect.SetSelected(rememberedChoice(lastFilesystemKey, fsNames, "UFS"))
 
 	form := &widget.Form{
 		Items: []*widget.FormItem{
@@ -214,6 +235,7 @@ func (bd *BatchDialog) showAddFormatDialog() {
 				Description:    fmt.Sprintf("Format %s as %s", partSelect.Selected, fsSelect.Selected),
 			}
 			bd.queue.AddOperation(op)
+			rememberChoice(lastFilesystemKey, fsSelect.Selected)
 			bd.updateStatus()
 			bd.operationList.Refresh()
 		}
@@ -275,10 +297,14 @@ func (bd *BatchDialog) showAddResizeDialog() {
 	sizeEntry := widget.NewEntry()
 	sizeEntry.SetPlaceHolder("Size in GB")
 
+	// Mounted filesystems are grown online, others offline
+	growFSCheck := widget.NewCheck("Also grow filesystem", nil)
+
 	form := &widget.Form{
 		Items: []*widget.FormItem{
 			{Text: "Partition", Widget: partSelect},
 			{Text: "New Size (GB)", Widget: sizeEntry},
+			{Text: "", Widget: growFSCheck},
 		},
 	}
 
@@ -295,12 +321,17 @@ func (bd *BatchDialog) showAddResizeDialog() {
 				return
 			}
 			sizeBytes := uint64(sizeGB * 1024 * 1024 * 1024)
+			description := fmt.Sprintf("Resize %s to %.2f GB", partSelect.Selected, sizeGB)
+			if growFSCheck.Checked {
+				description += " with its filesystem"
+			}
 			op := &partition.BatchOperation{
-				Type:        partition.OpResize,
-				Disk:        disk,
-				Index:       index,
-				Size:        sizeBytes,
-				Description: fmt.Sprintf("Resize %s to %.2f GB", partSelect.Selected, sizeGB),
+				Type:         partition.OpResize,
+				Disk:         disk,
+				Index:        index,
+				Size:         sizeBytes,
+				OnlineResize: growFSCheck.Checked,
+				Description:  description,
 			}
 			bd.queue.AddOperation(op)
 			bd.updateStatus()
@@ -375,6 +406,12 @@ func (bd *BatchDialog) updateStatus() {
 		bd.statusLabel.SetText(fmt.Sprintf("Total: %d | Completed: %d | Failed: %d | Pending: %d",
 			count, completed, failed, count-completed-failed))
 	}
+
+	if failed > 0 {
+		bd.retryBtn.Enable()
+	} else {
+		bd.retryBtn.Disable()
+	}
 }
 
 // executeAll executes all operations in the queue
@@ -384,6 +421,13 @@ func (bd *BatchDialog) executeAll() {
 		return
 	}
 
+	timeout, err := bd.parseTimeout()
+	if err != nil {
+		dialog.ShowError(err, bd.window)
+		return
+	}
+	bd.queue.SetDefaultTimeout(timeout)
+
 	// Confirm execution
 	dialog.ShowConfirm("Execute Batch Operations",
 		fmt.Sprintf("Execute %d operations?\n\nThis will modify your disk partitions!", bd.queue.Count()),
@@ -394,20 +438,68 @@ func (bd *BatchDialog) executeAll() {
 		}, bd.window)
 }
 
+// retryFailed resets the failed operations to pending and runs the queue
+// again. Completed operations are skipped, so after fixing whatever made
+// operations fail only those are repeated.
+func (bd *BatchDialog) retryFailed() {
+	failed := bd.queue.GetFailedCount()
+	if failed == 0 {
+		return
+	}
+
+	timeout, err := bd.parseTimeout()
+	if err != nil {
+		dialog.ShowError(err, bd.window)
+		return
+	}
+	bd.queue.SetDefaultTimeout(timeout)
+
+	dialog.ShowConfirm("Retry Failed Operations",
+		fmt.Sprintf("Retry %d failed operations?\n\nCompleted operations will not be run again.", failed),
+		func(ok bool) {
+			if !ok {
+				return
+			}
+			bd.queue.ResetFailed()
+			bd.updateStatus()
+			bd.operationList.Refresh()
+			bd.performExecution()
+		}, bd.window)
+}
+
+// parseTimeout reads the default timeout entry; empty or 0 means no limit
+func (bd *BatchDialog) parseTimeout() (time.Duration, error) {
+	if bd.timeoutEntry.Text == "" {
+		return 0, nil
+	}
+	minutes, err := strconv.Atoi(bd.timeoutEntry.Text)
+	if err != nil || minutes < 0 {
+		return 0, fmt.Errorf("invalid timeout: %s (enter a number of minutes)", bd.timeoutEntry.Text)
+	}
+	return time.Duration(minutes) * time.Minute, nil
+}
+
 // performExecution executes the batch operations
 func (bd *BatchDialog) performExecution() {
 	bd.executeBtn.Disable()
+	bd.retryBtn.Disable()
 	bd.progressBar.Show()
 	bd.progressBar.SetValue(0)
 
 	go func() {
-		err := bd.queue.ExecuteAll(bd.stopOnError.Checked, func(current, total int, desc string) {
-			bd.statusLabel.SetText(fmt.Sprintf("Executing %d/%d: %s", current, total, desc))
-			bd.progressBar.SetValue(float64(current) / float64(total))
+		err := bd.queue.ExecuteAll(bd.stopOnError.Checked, partition.ProgressFunc(func(done, total uint64, desc string) {
+			bd.statusLabel.SetText(fmt.Sprintf("Executing %d/%d: %s", done+1, total, desc))
+			bd.progressBar.SetValue(float64(done+1) / float64(total))
 			bd.operationList.Refresh()
-		})
+			if done > 0 && bd.onChange != nil {
+				bd.onChange()
+			}
+		}))
 
 		// Update UI on main thread
+		if bd.onChange != nil {
+			bd.onChange()
+		}
 		bd.progressBar.SetValue(1.0)
 		bd.executeBtn.Enable()
 		bd.updateStatus()
@@ -419,6 +511,11 @@ func (bd *BatchDialog) performExecution() {
 			completed := bd.queue.GetCompletedCount()
 			failed := bd.queue.GetFailedCount()
 			msg := fmt.Sprintf("Batch execution complete!\n\nCompleted: %d\nFailed: %d", completed, failed)
+			for _, op := range bd.queue.GetOperations() {
+				if op.Status == "completed" && op.Warning != "" {
+					msg += fmt.Sprintf("\n\nWarning: %s", op.Warning)
+				}
+			}
 			dialog.ShowInformation("Execution Complete", msg, bd.window)
 		}
 	}()
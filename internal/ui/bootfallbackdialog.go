@@ -0,0 +1,166 @@
+package ui
+
+import (
+	"fmt"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+	"github.com/pgsdf/pgpart/internal/partition"
+)
+
+// BootFallbackDialog shows the bootme/bootonce/bootfailed state of a disk's
+// partitions and sets up one-shot boots
+type BootFallbackDialog struct {
+	window   fyne.Window
+	disk     *partition.Disk
+	history  *partition.OperationHistory
+	onUpdate func()
+}
+
+// NewBootFallbackDialog creates a new boot fallback dialog
+func NewBootFallbackDialog(window fyne.Window, disk *partition.Disk, history *partition.OperationHistory, onUpdate func()) *BootFallbackDialog {
+	return &BootFallbackDialog{
+		window:   window,
+		disk:     disk,
+		history:  history,
+		onUpdate: onUpdate,
+	}
+}
+
+// Show displays the boot fallback dialog
+func (bd *BootFallbackDialog) Show() {
+	if len(bd.disk.Partitions) == 0 {
+		dialog.ShowInformation("No Partitions", "This disk has no partitions", bd.window)
+		return
+	}
+
+	if err := partition.ValidatePartitionForAttributes(bd.disk.Partitions[0].Name); err != nil {
+		dialog.ShowError(fmt.Errorf("This disk does not support GPT attributes.\n%v", err), bd.window)
+		return
+	}
+
+	states, err := partition.GetBootFallbackStates(bd.disk)
+	if err != nil {
+		dialog.ShowError(fmt.Errorf("Failed to get partition attributes: %v", err), bd.window)
+		return
+	}
+
+	header := widget.NewLabel(fmt.Sprintf("Boot Fallback State for %s", bd.disk.Name))
+	header.TextStyle = fyne.TextStyle{Bold: true}
+
+	stateForm := widget.NewForm()
+	partNames := make([]string, len(states))
+	for i, state := range states {
+		partNames[i] = state.Partition
+		roleLabel := widget.NewLabel(state.Role())
+		if state.Bootfailed || state.Bootonce {
+			roleLabel.TextStyle = fyne.TextStyle{Bold: true}
+		}
+		stateForm.Append(state.Partition, roleLabel)
+	}
+
+	helpLabel := widget.NewLabel("A one-shot boot tries the selected partition on the next boot only. " +
+		"If it fails to boot, the loader marks it 'bootfailed' and returns to the primary (bootme) partition on the following boot.")
+	helpLabel.Wrapping = fyne.TextWrapWord
+	helpLabel.TextStyle = fyne.TextStyle{Italic: true}
+
+	partSelect := widget.NewSelect(partNames, nil)
+
+	var customDialog dialog.Dialog
+
+	clearBtn := widget.NewButton("Clear Boot-Failed Flags", func() {
+		customDialog.Hide()
+		bd.clearBootFailed(states)
+	})
+	hasFailed := false
+	for _, state := range states {
+		if state.Bootfailed {
+			hasFailed = true
+			break
+		}
+	}
+	if !hasFailed {
+		clearBtn.Disable()
+	}
+
+	content := container.NewVBox(
+		header,
+		widget.NewSeparator(),
+		stateForm,
+		clearBtn,
+		widget.NewSeparator(),
+		widget.NewForm(
+			widget.NewFormItem("Boot once into", partSelect),
+		),
+		helpLabel,
+	)
+
+	customDialog = dialog.NewCustomConfirm("Boot Fallback", "Set Up One-Shot Boot", "Close", content,
+		func(ok bool) {
+			if !ok {
+				return
+			}
+
+			if partSelect.Selected == "" {
+				dialog.ShowError(fmt.Errorf("Please select a partition"), bd.window)
+				return
+			}
+
+			bd.setupBootOnce(partSelect.Selected, states)
+		}, bd.window)
+
+	customDialog.Resize(fyne.NewSize(500, 400))
+	customDialog.Show()
+}
+
+// setupBootOnce marks partName for a one-shot boot and records the change
+func (bd *BootFallbackDialog) setupBootOnce(partName string, states []partition.BootFallbackState) {
+	wasSet := false
+	for _, state := range states {
+		if state.Partition == partName {
+			wasSet = state.Bootonce
+			break
+		}
+	}
+
+	if err := partition.SetupBootOnce(bd.disk, partName); err != nil {
+		dialog.ShowError(fmt.Errorf("Failed to set up one-shot boot: %v", err), bd.window)
+		return
+	}
+
+	if bd.history != nil && !wasSet {
+		bd.history.RecordAttributeChange(partName, partition.AttrBootonce, wasSet, true)
+	}
+
+	showSuccess(bd.window, fmt.Sprintf("%s will be tried once on the next boot", partName))
+
+	if bd.onUpdate != nil {
+		bd.onUpdate()
+	}
+}
+
+// clearBootFailed removes the bootfailed flag from every partition of the disk
+func (bd *BootFallbackDialog) clearBootFailed(states []partition.BootFallbackState) {
+	if err := partition.ClearBootFailed(bd.disk.Name); err != nil {
+		dialog.ShowError(fmt.Errorf("Failed to clear boot-failed flags: %v", err), bd.window)
+		return
+	}
+
+	cleared := 0
+	for _, state := range states {
+		if state.Bootfailed {
+			cleared++
+			if bd.history != nil {
+				bd.history.RecordAttributeChange(state.Partition, partition.AttrBootfailed, true, false)
+			}
+		}
+	}
+
+	showSuccess(bd.window, fmt.Sprintf("Cleared the bootfailed flag on %d partition(s)", cleared))
+
+	if bd.onUpdate != nil {
+		bd.onUpdate()
+	}
+}
@@ -0,0 +1,199 @@
+package ui
+
+import (
+	"fmt"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+	"github.com/pgsdf/pgpart/internal/partition"
+)
+
+// CompareDisksDialog shows the partition tables of two disks side by side
+type CompareDisksDialog struct {
+	window  fyne.Window
+	disks   []partition.Disk
+	selectA *widget.Select
+	selectB *widget.Select
+	table   *fyne.Container
+	summary *widget.Label
+}
+
+// NewCompareDisksDialog creates a new disk comparison dialog
+func NewCompareDisksDialog(window fyne.Window, disks []partition.Disk) *CompareDisksDialog {
+	return &CompareDisksDialog{
+		window: window,
+		disks:  disks,
+	}
+}
+
+// Show displays the comparison dialog
+func (cd *CompareDisksDialog) Show() {
+	if len(cd.disks) < 2 {
+		dialog.ShowInformation("Compare Disks", "You need at least 2 disks to compare", cd.window)
+		return
+	}
+
+	names := make([]string, len(cd.disks))
+	for i, disk := range cd.disks {
+		names[i] = disk.Name
+	}
+
+	cd.table = container.NewVBox()
+	cd.summary = widget.NewLabel("")
+	cd.summary.Wrapping = fyne.TextWrapWord
+
+	cd.selectA = widget.NewSelect(names, func(string) { cd.update() })
+	cd.selectB = widget.NewSelect(names, func(string) { cd.update() })
+	cd.selectA.SetSelected(names[0])
+	cd.selectB.SetSelected(names[1])
+
+	selectors := container.NewGridWithColumns(2,
+		container.NewBorder(nil, nil, widget.NewLabel("Disk A:"), nil, cd.selectA),
+		container.NewBorder(nil, nil, widget.NewLabel("Disk B:"), nil, cd.selectB),
+	)
+
+	content := container.NewBorder(
+		container.NewVBox(selectors, widget.NewSeparator()),
+		container.NewVBox(widget.NewSeparator(), cd.summary),
+		nil, nil,
+		container.NewVScroll(cd.table),
+	)
+
+	customDialog := dialog.NewCustom("Compare Disks", "Close", content, cd.window)
+	customDialog.Resize(fyne.NewSize(750, 500))
+	customDialog.Show()
+}
+
+// findDisk returns the disk with the given name
+func (cd *CompareDisksDialog) findDisk(name string) (partition.Disk, bool) {
+	for _, disk := range cd.disks {
+		if disk.Name == name {
+			return disk, true
+		}
+	}
+	return partition.Disk{}, false
+}
+
+// update rebuilds the side-by-side table for the selected disks
+func (cd *CompareDisksDialog) update() {
+	if cd.selectA == nil || cd.selectB == nil || cd.table == nil {
+		return
+	}
+
+	a, okA := cd.findDisk(cd.selectA.Selected)
+	b, okB := cd.findDisk(cd.selectB.Selected)
+	if !okA || !okB {
+		return
+	}
+
+	cd.table.Objects = nil
+	cd.table.Add(container.NewGridWithColumns(3,
+		boldLabel("Index"),
+		boldLabel(fmt.Sprintf("%s (%s, %s)", a.Name, partition.FormatBytes(a.Size), schemeName(a.Scheme))),
+		boldLabel(fmt.Sprintf("%s (%s, %s)", b.Name, partition.FormatBytes(b.Size), schemeName(b.Scheme))),
+	))
+
+	diffs := partition.CompareLayouts(a, b)
+	differing := make(map[int][]string)
+	for _, diff := range diffs {
+		differing[diff.Index] = diff.Fields
+	}
+
+	partsA, indexesA := partition.IndexPartitions(a)
+	partsB, indexesB := partition.IndexPartitions(b)
+	seen := make(map[int]bool)
+	for _, indexes := range [][]int{indexesA, indexesB} {
+		for _, n := range indexes {
+			seen[n] = true
+		}
+	}
+
+	for n := 1; len(seen) > 0; n++ {
+		if !seen[n] {
+			continue
+		}
+		delete(seen, n)
+
+		fields, changed := differing[n]
+		indexLabel := widget.NewLabel(fmt.Sprintf("%d", n))
+		if changed {
+			indexLabel.SetText(fmt.Sprintf("%d ≠", n))
+			indexLabel.TextStyle = fyne.TextStyle{Bold: true}
+		}
+
+		cd.table.Add(container.NewGridWithColumns(3,
+			indexLabel,
+			comparePartitionLabel(partsA[n], fields),
+			comparePartitionLabel(partsB[n], fields),
+		))
+	}
+
+	text := fmt.Sprintf("%d difference(s)", len(diffs))
+	if len(diffs) == 0 {
+		text = "Layouts are identical"
+	}
+	if a.Scheme != b.Scheme {
+		text += fmt.Sprintf("; schemes differ (%s vs %s)", schemeName(a.Scheme), schemeName(b.Scheme))
+	}
+
+	ok, reason := partition.CanHoldLayout(a, b)
+	if ok {
+		text += "\n✓ Clone A → B: " + reason
+	} else {
+		text += "\n✗ Clone A → B: " + reason
+	}
+	cd.summary.SetText(text)
+
+	cd.table.Refresh()
+}
+
+// comparePartitionLabel describes a partition in a comparison row, marking
+// the fields that differ from the other disk
+func comparePartitionLabel(part *partition.Partition, fields []string) *widget.Label {
+	if part == nil {
+		label := widget.NewLabel("—")
+		label.TextStyle = fyne.TextStyle{Italic: true}
+		return label
+	}
+
+	mark := func(field, text string) string {
+		for _, f := range fields {
+			if f == field {
+				return "*" + text + "*"
+			}
+		}
+		return text
+	}
+
+	fs := part.FileSystem
+	if fs == "" {
+		fs = "none"
+	}
+
+	label := widget.NewLabel(fmt.Sprintf("%s  %s  %s  %s",
+		part.Name,
+		mark("size", partition.FormatBytes(part.Size*512)),
+		mark("type", part.Type),
+		mark("filesystem", fs)))
+	if len(fields) > 0 {
+		label.TextStyle = fyne.TextStyle{Bold: true}
+	}
+	return label
+}
+
+// boldLabel creates a label with bold text
+func boldLabel(text string) *widget.Label {
+	label := widget.NewLabel(text)
+	label.TextStyle = fyne.TextStyle{Bold: true}
+	return label
+}
+
+// schemeName returns the scheme or "no table" if the disk is unpartitioned
+func schemeName(scheme string) string {
+	if scheme == "" {
+		return "no table"
+	}
+	return scheme
+}
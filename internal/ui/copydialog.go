@@ -1,7 +1,10 @@
 package ui
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"sync"
 	"time"
 
 	"fyne.io/fyne/v2"
@@ -11,13 +14,18 @@ import (
 	"github.com/pgsdf/pgpart/internal/partition"
 )
 
+// interruptedCopies remembers where cancelled copies stopped, keyed by
+// source and destination, so copying the same pair again can resume
+var (
+	interruptedCopies   = make(map[[2]string]uint64)
+	interruptedCopiesMu sync.Mutex
+)
+
 type CopyDialog struct {
-	window      fyne.Window
-	disks       []partition.Disk
-	onComplete  func()
-	operation   string // "copy" or "move"
-	progressBar *widget.ProgressBar
-	statusLabel *widget.Label
+	window     fyne.Window
+	disks      []partition.Disk
+	onComplete func()
+	operation  string // "copy" or "move"
 }
 
 func NewCopyDialog(window fyne.Window, disks []partition.Disk, operation string, onComplete func()) *CopyDialog {
@@ -83,12 +91,33 @@ func (cd *CopyDialog) Show() {
 	infoLabel.Wrapping = fyne.TextWrapWord
 	infoLabel.TextStyle = fyne.TextStyle{Italic: true}
 
+	// A raw copy can be compared byte for byte with its source afterwards;
+	// a contents copy reformats the destination, so it never matches
+	verifyCheck := widget.NewCheck("Verify after copy", nil)
+
+	contentsCheck := widget.NewCheck("Copy contents (resize to fit)", func(checked bool) {
+		if checked {
+			infoLabel.SetText("The destination is reformatted with the source's filesystem and the files are copied over.\nIt may be smaller than the source as long as the files fit. Supported for UFS, FAT32 and ext2/3/4.")
+			verifyCheck.SetChecked(false)
+			verifyCheck.Disable()
+		} else {
+			infoLabel.SetText("Select the source partition to copy from and the destination partition to copy to.\nThe destination must be equal or larger in size.")
+			verifyCheck.Enable()
+		}
+	})
+	if cd.operation == "move" {
+		contentsCheck.Hide()
+		verifyCheck.Hide()
+	}
+
 	formContent := container.NewVBox(
 		warningLabel,
 		widget.NewSeparator(),
 		widget.NewForm(
 			widget.NewFormItem("Source Partition", sourceSelect),
 			widget.NewFormItem("Destination Partition", destSelect),
+			widget.NewFormItem("", contentsCheck),
+			widget.NewFormItem("", verifyCheck),
 		),
 		widget.NewSeparator(),
 		infoLabel,
@@ -121,35 +150,41 @@ func (cd *CopyDialog) Show() {
 				}
 			}
 
-			// Check size compatibility
-			if destPart.Size < sourcePart.Size {
+			// Check size compatibility; a contents copy only needs room for the files
+			if contentsCheck.Checked {
+				if !partition.CanCopyFilesystem(sourcePart.FS) {
+					dialog.ShowError(fmt.Errorf("copying contents is not supported for %s filesystems", sourcePart.FS), cd.window)
+					return
+				}
+			} else if destPart.Size < sourcePart.Size {
 				dialog.ShowError(fmt.Errorf("destination partition is too small\nSource: %s, Destination: %s",
 					partition.FormatBytes(sourcePart.Size),
 					partition.FormatBytes(destPart.Size)), cd.window)
 				return
 			}
 
-			// Show confirmation
-			var confirmMsg string
-			if cd.operation == "move" {
-				confirmMsg = fmt.Sprintf("Move partition %s to %s?\n\nThis will:\n- Copy all data from %s to %s\n- Delete the source partition %s\n- DESTROY all existing data on %s\n\nThis operation cannot be undone!",
-					sourcePart.PartName, destPart.PartName,
-					sourcePart.PartName, destPart.PartName,
-					sourcePart.PartName, destPart.PartName)
-			} else {
-				confirmMsg = fmt.Sprintf("Copy partition %s to %s?\n\nThis will DESTROY all existing data on %s!\n\nSource: %s (%s)\nDestination: %s (%s)",
-					sourcePart.PartName, destPart.PartName,
-					destPart.PartName,
-					sourcePart.PartName, partition.FormatBytes(sourcePart.Size),
-					destPart.PartName, partition.FormatBytes(destPart.Size))
+			// Show confirmation, spelling out which steps can't be undone
+			var steps []partition.OperationStep
+			switch {
+			case cd.operation == "move":
+				steps = partition.MoveSteps(sourcePart.PartName, destPart.PartName)
+			case contentsCheck.Checked:
+				steps = partition.CopyContentsSteps(sourcePart.PartName, destPart.PartName, sourcePart.FS)
+			default:
+				steps = partition.CopySteps(sourcePart.PartName, destPart.PartName)
 			}
+			confirmMsg := fmt.Sprintf("%s %s to %s?\n\nSource: %s (%s)\nDestination: %s (%s)\n\n%s",
+				titleText, sourcePart.PartName, destPart.PartName,
+				sourcePart.PartName, partition.FormatBytes(sourcePart.Size),
+				destPart.PartName, partition.FormatBytes(destPart.Size),
+				partition.DescribeSteps(steps))
 
 			dialog.ShowConfirm("Confirm "+titleText, confirmMsg,
 				func(confirmed bool) {
 					if !confirmed {
 						return
 					}
-					cd.performOperation(sourcePart.PartName, destPart.PartName)
+					cd.startOperation(sourcePart.PartName, destPart.PartName, contentsCheck.Checked, verifyCheck.Checked)
 				}, cd.window)
 		}, cd.window)
 
@@ -157,17 +192,31 @@ func (cd *CopyDialog) Show() {
 	customDialog.Show()
 }
 
-func (cd *CopyDialog) performOperation(source, dest string) {
-	// Create progress dialog
-	cd.progressBar = widget.NewProgressBar()
-	cd.statusLabel = widget.NewLabel("Preparing to copy...")
+// startOperation runs the confirmed operation, first offering to resume
+// a raw copy of the same partitions that was cancelled earlier
+func (cd *CopyDialog) startOperation(source, dest string, contentsOnly, verify bool) {
+	interruptedCopiesMu.Lock()
+	offset, interrupted := interruptedCopies[[2]string{source, dest}]
+	interruptedCopiesMu.Unlock()
 
-	progressContent := container.NewVBox(
-		cd.statusLabel,
-		cd.progressBar,
-		widget.NewLabel("\nPlease wait, this may take several minutes..."),
-	)
+	if cd.operation == "move" || contentsOnly || !interrupted {
+		cd.performOperation(source, dest, contentsOnly, verify, 0)
+		return
+	}
 
+	dialog.ShowCustomConfirm("Resume Copy", "Resume", "Start Over",
+		widget.NewLabel(fmt.Sprintf("An earlier copy of %s to %s was cancelled after %s.\n\n"+
+			"Resume it from there? Only do so if neither partition has been changed since.",
+			source, dest, partition.FormatBytes(offset))),
+		func(resume bool) {
+			if !resume {
+				offset = 0
+			}
+			cd.performOperation(source, dest, contentsOnly, verify, offset)
+		}, cd.window)
+}
+
+func (cd *CopyDialog) performOperation(source, dest string, contentsOnly, verify bool, offset uint64) {
 	var titleText string
 	if cd.operation == "move" {
 		titleText = "Moving Partition"
@@ -175,49 +224,71 @@ func (cd *CopyDialog) performOperation(source, dest string) {
 		titleText = "Copying Partition"
 	}
 
-	progressDialog := dialog.NewCustom(titleText, "Cancel", progressContent, cd.window)
-	progressDialog.Resize(fyne.NewSize(450, 150))
-	progressDialog.Show()
+	progress := NewOperationProgressDialog(cd.window, titleText)
+	progress.Show()
 
 	// Perform the operation in a goroutine
 	go func() {
 		var err error
-		startTime := time.Now()
-
-		progressCallback := func(progress float64) {
-			cd.progressBar.SetValue(progress / 100.0)
-			elapsed := time.Since(startTime)
-			cd.statusLabel.SetText(fmt.Sprintf("Progress: %.1f%% (Elapsed: %s)", progress, elapsed.Round(time.Second)))
-		}
-
 		if cd.operation == "move" {
-			// Extract disk and index from partition name
-			// This is simplified - you may need to adjust based on your partition naming
-			cd.statusLabel.SetText("Moving partition...")
-			err = partition.CopyPartition(source, dest, progressCallback)
-			if err == nil {
-				cd.statusLabel.SetText("Move completed successfully!")
-			}
+			err = movePartition(source, dest, progress, progress)
+		} else if contentsOnly {
+			err = partition.CopyFilesystemWithLog(source, dest, progress.SetProgress, progress)
 		} else {
-			cd.statusLabel.SetText("Copying partition...")
-			err = partition.CopyPartition(source, dest, progressCallback)
+			ctx, cancel := context.WithCancel(context.Background())
+			progress.SetCancel(cancel)
+			err = partition.CopyPartitionContext(ctx, source, dest, offset, progress, progress)
+			progress.SetCancel(nil)
+			cancel()
+
+			var stopped *partition.CopyInterruptedError
+			if errors.As(err, &stopped) {
+				interruptedCopiesMu.Lock()
+				interruptedCopies[[2]string{source, dest}] = stopped.Offset
+				interruptedCopiesMu.Unlock()
+				progress.Finish(nil)
+				dialog.ShowInformation("Copy Cancelled",
+					fmt.Sprintf("%v\n\nCopy %s to %s again to resume.", stopped, source, dest), cd.window)
+				return
+			}
 			if err == nil {
-				cd.statusLabel.SetText("Copy completed successfully!")
+				interruptedCopiesMu.Lock()
+				delete(interruptedCopies, [2]string{source, dest})
+				interruptedCopiesMu.Unlock()
 			}
-		}
 
-		progressDialog.Hide()
+			if err == nil && verify {
+				progress.Step(fmt.Sprintf("Verifying %s against %s", dest, source))
+				progress.ResetProgress()
+				err = partition.VerifyPartitionCopyWithOptions(source, dest, partition.VerifyOptions{}, progress.SetProgress)
+			}
+		}
 
 		if err != nil {
-			dialog.ShowError(fmt.Errorf("%s failed: %w", cd.operation, err), cd.window)
-		} else {
-			duration := time.Since(startTime).Round(time.Second)
-			dialog.ShowInformation("Success",
-				fmt.Sprintf("Partition %s completed successfully!\n\nTime taken: %s",
-					cd.operation, duration), cd.window)
-			if cd.onComplete != nil {
-				cd.onComplete()
-			}
+			progress.Finish(fmt.Errorf("%s failed: %w", cd.operation, err))
+			return
+		}
+
+		progress.Finish(nil)
+		duration := progress.Elapsed().Round(time.Second)
+		showSuccess(cd.window, fmt.Sprintf("Partition %s completed successfully!\n\nTime taken: %s",
+			cd.operation, duration))
+		if cd.onComplete != nil {
+			cd.onComplete()
 		}
 	}()
 }
+
+// movePartition copies source over dest and then deletes source, as listed
+// by partition.MoveSteps
+func movePartition(source, dest string, progress partition.ProgressReporter, logger partition.OperationLogger) error {
+	sourceDisk, sourceIndex, err := partition.ParsePartitionName(source)
+	if err != nil {
+		return err
+	}
+	destDisk, destIndex, err := partition.ParsePartitionName(dest)
+	if err != nil {
+		return err
+	}
+	return partition.MovePartitionWithLog(sourceDisk, sourceIndex, destDisk, destIndex, progress, logger)
+}
@@ -1,8 +1,11 @@
 package ui
 
 import (
+	"context"
 	"fmt"
 	"image/color"
+	"strconv"
+	"time"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/canvas"
@@ -12,15 +15,25 @@ import (
 	"github.com/pgsdf/pgpart/internal/partition"
 )
 
+// selfTestPollInterval is how often a running SMART self-test is checked
+const selfTestPollInterval = 5 * time.Second
+
 type DiskInfoDialog struct {
 	window   fyne.Window
 	diskName string
+
+	selfTests  []string      // supported SMART self-test types
+	testStatus string        // self-test status when the dialog opened
+	testLeft   int           // percent of a running self-test remaining
+	closed     chan struct{} // closed with the dialog to stop polling
+	attrList   *widget.List  // SMART attributes, redrawn when trends are acknowledged
 }
 
 func NewDiskInfoDialog(window fyne.Window, diskName string) *DiskInfoDialog {
 	return &DiskInfoDialog{
 		window:   window,
 		diskName: diskName,
+		closed:   make(chan struct{}),
 	}
 }
 
@@ -44,6 +57,16 @@ func (d *DiskInfoDialog) Show() {
 			return
 		}
 
+		// Trend tracking is best-effort; the snapshot store may be unwritable
+		partition.TrackSMARTTrends(info)
+
+		if info.SMARTEnabled {
+			d.selfTests = partition.SupportedSMARTTests(d.diskName)
+			if len(d.selfTests) > 0 {
+				d.testLeft, d.testStatus, _ = partition.GetSMARTTestProgress(d.diskName)
+			}
+		}
+
 		d.showDiskInfo(info)
 	}()
 }
@@ -77,8 +100,13 @@ func (d *DiskInfoDialog) showDiskInfo(info *partition.DiskInfo) {
 	capsTab := d.createCapabilitiesTab(info)
 	tabs.Append(container.NewTabItem("Capabilities", capsTab))
 
+	// Power management tab
+	powerTab := d.createPowerTab(info)
+	tabs.Append(container.NewTabItem("Power", powerTab))
+
 	// Create dialog
 	customDialog := dialog.NewCustom("Disk Information - "+info.Device, "Close", tabs, d.window)
+	customDialog.SetOnClosed(func() { close(d.closed) })
 	customDialog.Resize(fyne.NewSize(700, 500))
 	customDialog.Show()
 }
@@ -87,9 +115,9 @@ func (d *DiskInfoDialog) createGeneralTab(info *partition.DiskInfo) *fyne.Contai
 	// Create info grid
 	form := widget.NewForm()
 
-	form.Append("Device", widget.NewLabel(info.Device))
-	form.Append("Model", widget.NewLabel(info.Model))
-	form.Append("Serial Number", widget.NewLabel(info.Serial))
+	form.Append("Device", newTruncatedLabel(info.Device))
+	form.Append("Model", newTruncatedLabel(info.Model))
+	form.Append("Serial Number", newTruncatedLabel(info.Serial))
 	form.Append("Capacity", widget.NewLabel(partition.FormatBytes(info.Size)))
 	form.Append("Sector Size", widget.NewLabel(fmt.Sprintf("%d bytes", info.SectorSize)))
 
@@ -169,7 +197,11 @@ func (d *DiskInfoDialog) createSMARTTab(info *partition.DiskInfo) *fyne.Containe
 	// Warning about critical attributes
 	criticalCount := 0
 	warningCount := 0
+	increasedCount := 0
 	for _, attr := range info.Attributes {
+		if !attr.IncreasedSince.IsZero() {
+			increasedCount++
+		}
 		if attr.Status == "FAILING" {
 			criticalCount++
 		} else if attr.Status == "WARNING" {
@@ -186,6 +218,26 @@ func (d *DiskInfoDialog) createSMARTTab(info *partition.DiskInfo) *fyne.Containe
 		summaryForm.Append("Attribute Status", widget.NewLabel("✓ All attributes OK"))
 	}
 
+	if increasedCount > 0 {
+		trendLabel := widget.NewLabel(fmt.Sprintf("↑ %d error counters increased since last acknowledged", increasedCount))
+		trendLabel.TextStyle = fyne.TextStyle{Bold: true}
+		var ackButton *widget.Button
+		ackButton = widget.NewButton("Acknowledge", func() {
+			if err := partition.AcknowledgeSMARTTrends(info); err != nil {
+				dialog.ShowError(err, d.window)
+				return
+			}
+			trendLabel.SetText("Acknowledged; later increases are compared with the current values")
+			trendLabel.TextStyle = fyne.TextStyle{}
+			trendLabel.Refresh()
+			ackButton.Disable()
+			if d.attrList != nil {
+				d.attrList.Refresh()
+			}
+		})
+		summaryForm.Append("Trend", container.NewHBox(trendLabel, ackButton))
+	}
+
 	infoLabel := widget.NewLabel("SMART (Self-Monitoring, Analysis and Reporting Technology) monitors disk health and predicts failures.")
 	infoLabel.Wrapping = fyne.TextWrapWord
 	infoLabel.TextStyle = fyne.TextStyle{Italic: true}
@@ -195,10 +247,97 @@ func (d *DiskInfoDialog) createSMARTTab(info *partition.DiskInfo) *fyne.Containe
 		widget.NewSeparator(),
 		summaryForm,
 		widget.NewSeparator(),
+		d.createSelfTestSection(),
+		widget.NewSeparator(),
 		infoLabel,
 	)
 }
 
+// createSelfTestSection builds the controls that start a SMART self-test
+// and follow its progress until the drive reports a result
+func (d *DiskInfoDialog) createSelfTestSection() fyne.CanvasObject {
+	if len(d.selfTests) == 0 {
+		unsupported := widget.NewLabel("This disk does not support SMART self-tests.")
+		unsupported.TextStyle = fyne.TextStyle{Italic: true}
+		return unsupported
+	}
+
+	typeSelect := widget.NewSelect(d.selfTests, nil)
+	typeSelect.SetSelected(d.selfTests[0])
+
+	statusLabel := widget.NewLabel(d.testStatus)
+	statusLabel.Wrapping = fyne.TextWrapWord
+	progressBar := widget.NewProgressBar()
+	progressBar.Hide()
+
+	var runBtn *widget.Button
+
+	// poll follows a running test until it finishes or the dialog closes
+	poll := func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go func() {
+			select {
+			case <-d.closed:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+
+		status, err := partition.WaitForSMARTTest(ctx, d.diskName, selfTestPollInterval,
+			partition.ProgressFunc(func(done, total uint64, message string) {
+				progressBar.SetValue(partition.ProgressPercent(done, total) / 100)
+				statusLabel.SetText(message)
+			}))
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			statusLabel.SetText(fmt.Sprintf("Could not read self-test status: %v", err))
+		} else {
+			statusLabel.SetText("Last result: " + status)
+		}
+		progressBar.Hide()
+		runBtn.Enable()
+	}
+
+	showRunning := func(left int) {
+		runBtn.Disable()
+		progressBar.SetValue(float64(100-left) / 100)
+		progressBar.Show()
+		statusLabel.SetText(fmt.Sprintf("%s, %d%% remaining", partition.SMARTTestInProgress, left))
+		go poll()
+	}
+
+	runBtn = widget.NewButton("Run Self-Test", func() {
+		testType := typeSelect.Selected
+		if err := partition.RunSMARTTest(d.diskName, testType); err != nil {
+			dialog.ShowError(err, d.window)
+			return
+		}
+		showRunning(100)
+	})
+
+	if d.testStatus == partition.SMARTTestInProgress {
+		// A test started earlier is still running
+		showRunning(d.testLeft)
+	} else if d.testStatus != "" {
+		statusLabel.SetText("Last result: " + d.testStatus)
+	}
+
+	helpLabel := widget.NewLabel("Self-tests run inside the drive and the disk stays usable meanwhile. A short test takes a few minutes, a long test reads the whole surface and can take hours.")
+	helpLabel.Wrapping = fyne.TextWrapWord
+	helpLabel.TextStyle = fyne.TextStyle{Italic: true}
+
+	return container.NewVBox(
+		widget.NewLabel("Self-Test:"),
+		container.NewBorder(nil, nil, typeSelect, runBtn),
+		progressBar,
+		statusLabel,
+		helpLabel,
+	)
+}
+
 func (d *DiskInfoDialog) createAttributesTab(info *partition.DiskInfo) *fyne.Container {
 	if len(info.Attributes) == 0 {
 		return container.NewVBox(
@@ -224,6 +363,7 @@ func (d *DiskInfoDialog) createAttributesTab(info *partition.DiskInfo) *fyne.Con
 
 			// Attribute name and status
 			nameLabel := cont.Objects[0].(*widget.Label)
+			nameLabel.TextStyle = fyne.TextStyle{}
 			nameText := fmt.Sprintf("%d: %s", attr.ID, attr.Name)
 			if attr.Status == "FAILING" {
 				nameText += " ⚠️ FAILING"
@@ -231,6 +371,10 @@ func (d *DiskInfoDialog) createAttributesTab(info *partition.DiskInfo) *fyne.Con
 			} else if attr.Status == "WARNING" {
 				nameText += " ⚠️ WARNING"
 			}
+			if !attr.IncreasedSince.IsZero() {
+				nameText += fmt.Sprintf(" ↑ increased since %s (was %d)", attr.IncreasedSince.Format("2006-01-02"), attr.PreviousRawValue)
+				nameLabel.TextStyle = fyne.TextStyle{Bold: true}
+			}
 			nameLabel.SetText(nameText)
 
 			// Values
@@ -244,6 +388,8 @@ func (d *DiskInfoDialog) createAttributesTab(info *partition.DiskInfo) *fyne.Con
 		},
 	)
 
+	d.attrList = attrList
+
 	legendLabel := widget.NewLabel("Legend: Value should stay above Threshold. Worst is the lowest recorded value.")
 	legendLabel.Wrapping = fyne.TextWrapWord
 	legendLabel.TextStyle = fyne.TextStyle{Italic: true}
@@ -274,3 +420,98 @@ func (d *DiskInfoDialog) createCapabilitiesTab(info *partition.DiskInfo) *fyne.C
 		capsList,
 	)
 }
+
+func (d *DiskInfoDialog) createPowerTab(info *partition.DiskInfo) *fyne.Container {
+	if !info.Power.Supported && !info.Power.APMSupported {
+		return container.NewVBox(
+			widget.NewLabel("This disk does not support power management."),
+			widget.NewSeparator(),
+			widget.NewLabel("Standby and APM controls are only available for ATA drives."),
+		)
+	}
+
+	timeoutEntry := widget.NewEntry()
+	timeoutEntry.SetPlaceHolder("Seconds (0 disables)")
+
+	setTimerBtn := widget.NewButton("Set Standby Timer", func() {
+		timeout, err := strconv.Atoi(timeoutEntry.Text)
+		if err != nil {
+			dialog.ShowError(fmt.Errorf("invalid timeout: %s", timeoutEntry.Text), d.window)
+			return
+		}
+
+		if err := partition.SetDiskStandby(d.diskName, timeout); err != nil {
+			dialog.ShowError(err, d.window)
+			return
+		}
+
+		showSuccess(d.window, fmt.Sprintf("Standby timer for %s set to %d seconds", d.diskName, timeout))
+	})
+
+	spinDownBtn := widget.NewButton("Spin Down Now", func() {
+		dialog.ShowConfirm("Spin Down Disk",
+			fmt.Sprintf("Put %s into standby now? It will spin up again on the next access.", d.diskName),
+			func(ok bool) {
+				if !ok {
+					return
+				}
+				if err := partition.SpinDownDisk(d.diskName); err != nil {
+					dialog.ShowError(err, d.window)
+					return
+				}
+				showSuccess(d.window, fmt.Sprintf("%s is in standby", d.diskName))
+			}, d.window)
+	})
+
+	if !info.Power.Supported {
+		timeoutEntry.Disable()
+		setTimerBtn.Disable()
+		spinDownBtn.Disable()
+	}
+
+	apmEntry := widget.NewEntry()
+	apmEntry.SetPlaceHolder("1-254 (0 disables)")
+	apmStatus := "Disabled"
+	if info.Power.APMEnabled {
+		apmStatus = fmt.Sprintf("Level %d", info.Power.APMLevel)
+		apmEntry.SetText(strconv.Itoa(info.Power.APMLevel))
+	}
+
+	setAPMBtn := widget.NewButton("Set APM Level", func() {
+		level, err := strconv.Atoi(apmEntry.Text)
+		if err != nil {
+			dialog.ShowError(fmt.Errorf("invalid APM level: %s", apmEntry.Text), d.window)
+			return
+		}
+
+		if err := partition.SetDiskAPM(d.diskName, level); err != nil {
+			dialog.ShowError(err, d.window)
+			return
+		}
+
+		showSuccess(d.window, fmt.Sprintf("APM level for %s set to %d", d.diskName, level))
+	})
+
+	if !info.Power.APMSupported {
+		apmStatus = "Not supported"
+		apmEntry.Disable()
+		setAPMBtn.Disable()
+	}
+
+	form := widget.NewForm()
+	form.Append("Standby Timeout", timeoutEntry)
+	form.Append("Current APM", widget.NewLabel(apmStatus))
+	form.Append("APM Level", apmEntry)
+
+	helpLabel := widget.NewLabel("Lower APM levels save more power; levels below 128 allow the drive to spin down on its own.")
+	helpLabel.Wrapping = fyne.TextWrapWord
+	helpLabel.TextStyle = fyne.TextStyle{Italic: true}
+
+	return container.NewVBox(
+		widget.NewLabel("Power Management:"),
+		widget.NewSeparator(),
+		form,
+		container.NewGridWithColumns(3, setTimerBtn, spinDownBtn, setAPMBtn),
+		helpLabel,
+	)
+}
@@ -0,0 +1,127 @@
+package ui
+
+import (
+	"fmt"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+	"github.com/pgsdf/pgpart/internal/partition"
+)
+
+// EncryptDialog encrypts a partition with GELI
+type EncryptDialog struct {
+	window     fyne.Window
+	disk       *partition.Disk
+	onComplete func()
+}
+
+// NewEncryptDialog creates a dialog for encrypting one of disk's partitions
+func NewEncryptDialog(window fyne.Window, disk *partition.Disk, onComplete func()) *EncryptDialog {
+	return &EncryptDialog{
+		window:     window,
+		disk:       disk,
+		onComplete: onComplete,
+	}
+}
+
+// Show displays the encryption options. Mounted and already encrypted
+// partitions aren't offered.
+func (ed *EncryptDialog) Show() {
+	var candidates []string
+	for i := range ed.disk.Partitions {
+		part := &ed.disk.Partitions[i]
+		if part.MountPoint == "" && !partition.IsGELIProvider(part) {
+			candidates = append(candidates, part.Name)
+		}
+	}
+	if len(candidates) == 0 {
+		dialog.ShowInformation("Encrypt Partition",
+			fmt.Sprintf("%s has no unmounted, unencrypted partitions.", ed.disk.Name), ed.window)
+		return
+	}
+
+	partSelect := widget.NewSelect(candidates, nil)
+	partSelect.SetSelected(candidates[0])
+
+	// The passphrase only ever lives in these entries and the stdin of geli
+	passEntry := widget.NewPasswordEntry()
+	passEntry.SetPlaceHolder("At least 8 characters")
+	passEntry.Validator = func(text string) error {
+		if len(text) < 8 {
+			return fmt.Errorf("use at least 8 characters")
+		}
+		return nil
+	}
+	confirmEntry := widget.NewPasswordEntry()
+	confirmEntry.Validator = func(text string) error {
+		if text != passEntry.Text {
+			return fmt.Errorf("the passphrases don't match")
+		}
+		return nil
+	}
+
+	attachCheck := widget.NewCheck("Attach after encrypting", nil)
+	attachCheck.SetChecked(true)
+
+	note := widget.NewLabel("The partition is encrypted with GELI and everything on it is lost. " +
+		"Once attached, create a filesystem on its .eli provider. There is no way to recover the data without the passphrase.")
+	note.Wrapping = fyne.TextWrapWord
+
+	form := dialog.NewForm("Encrypt Partition", "Encrypt", "Cancel",
+		[]*widget.FormItem{
+			widget.NewFormItem("Partition", partSelect),
+			widget.NewFormItem("Passphrase", passEntry),
+			widget.NewFormItem("Confirm", confirmEntry),
+			widget.NewFormItem("", attachCheck),
+			widget.NewFormItem("", note),
+		},
+		func(ok bool) {
+			if !ok {
+				return
+			}
+			if passEntry.Text != confirmEntry.Text {
+				dialog.ShowError(fmt.Errorf("the passphrases don't match"), ed.window)
+				return
+			}
+			ed.confirm(partSelect.Selected, passEntry.Text, attachCheck.Checked)
+		}, ed.window)
+	form.Resize(fyne.NewSize(480, 360))
+	form.Show()
+}
+
+// confirm asks before destroying the partition's contents
+func (ed *EncryptDialog) confirm(partName, passphrase string, attach bool) {
+	dialog.ShowConfirm("Confirm Encryption",
+		fmt.Sprintf("Encrypt %s with GELI?\n\nThis will DESTROY all data on it!", partName),
+		func(confirmed bool) {
+			if !confirmed {
+				return
+			}
+			ed.perform(partName, passphrase, attach)
+		}, ed.window)
+}
+
+// perform initializes GELI on the partition and optionally attaches it
+func (ed *EncryptDialog) perform(partName, passphrase string, attach bool) {
+	if err := partition.InitGELI(partName, passphrase); err != nil {
+		dialog.ShowError(fmt.Errorf("encryption failed: %w", err), ed.window)
+		return
+	}
+	if ed.onComplete != nil {
+		defer ed.onComplete()
+	}
+
+	if !attach {
+		showSuccess(ed.window, fmt.Sprintf("%s encrypted. Attach it from its card to use it.", partName))
+		return
+	}
+
+	provider, err := partition.AttachGELI(partName, passphrase)
+	if err != nil {
+		dialog.ShowError(fmt.Errorf("%s was encrypted, but attaching it failed: %w", partName, err), ed.window)
+		return
+	}
+	showSuccess(ed.window, fmt.Sprintf("%s encrypted and attached as %s.\n\nCreate a filesystem on /dev/%s to use it, e.g. newfs -U /dev/%s",
+		partName, provider, provider, provider))
+}
@@ -0,0 +1,121 @@
+package ui
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+	"github.com/pgsdf/pgpart/internal/partition"
+)
+
+// GapCreateDialog creates a partition in one free region of a disk. It is
+// opened by clicking the region in the partition view, so the partition
+// lands in that gap rather than wherever gpart finds room.
+type GapCreateDialog struct {
+	window     fyne.Window
+	disk       *partition.Disk
+	region     partition.FreeRegion
+	onComplete func()
+}
+
+// NewGapCreateDialog creates a dialog for creating a partition in region
+func NewGapCreateDialog(window fyne.Window, disk *partition.Disk, region partition.FreeRegion, onComplete func()) *GapCreateDialog {
+	return &GapCreateDialog{
+		window:     window,
+		disk:       disk,
+		region:     region,
+		onComplete: onComplete,
+	}
+}
+
+// Show displays the dialog with the size set to the whole region
+func (gd *GapCreateDialog) Show() {
+	maxMB := gd.region.Bytes() / (1024 * 1024)
+	if maxMB == 0 {
+		dialog.ShowInformation("Free Space Too Small",
+			fmt.Sprintf("The free space at sector %d is only %s", gd.region.Start, partition.FormatBytes(gd.region.Bytes())), gd.window)
+		return
+	}
+
+	regionLabel := widget.NewLabel(fmt.Sprintf("%s free at sector %d (%s into the disk)",
+		partition.FormatBytes(gd.region.Bytes()), gd.region.Start, partition.FormatBytes(gd.region.Start*512)))
+	regionLabel.Wrapping = fyne.TextWrapWord
+
+	sizeEntry := widget.NewEntry()
+	sizeEntry.SetText(strconv.FormatUint(maxMB, 10))
+	sizeEntry.Validator = func(text string) error {
+		size, err := strconv.ParseUint(strings.TrimSpace(text), 10, 64)
+		if err != nil || size == 0 {
+			return fmt.Errorf("size must be a positive number of MB")
+		}
+		if size > maxMB {
+			return fmt.Errorf("at most %d MB fit in this free space", maxMB)
+		}
+		return nil
+	}
+
+	partTypes := partition.PartitionTypeAliases()
+	typeSelect := widget.NewSelect(partTypes, nil)
+	typeSelect.SetSelected(rememberedChoice(lastPartitionTypeKey, partTypes, "freebsd-ufs"))
+
+	labelEntry := widget.NewEntry()
+	labelEntry.SetPlaceHolder("optional, e.g. data0")
+	labelEntry.Validator = func(text string) error {
+		if text == "" {
+			return nil
+		}
+		return partition.ValidateGPTLabel(text)
+	}
+	if gd.disk.Scheme != "GPT" {
+		labelEntry.SetPlaceHolder("labels need a GPT partition table")
+		labelEntry.Disable()
+	}
+
+	dialog.ShowForm("Create Partition in Free Space", "Create", "Cancel",
+		[]*widget.FormItem{
+			widget.NewFormItem("Free Space", regionLabel),
+			widget.NewFormItem("Size (MB)", sizeEntry),
+			widget.NewFormItem("Type", typeSelect),
+			widget.NewFormItem("Label", labelEntry),
+		},
+		func(ok bool) {
+			if !ok {
+				return
+			}
+
+			sizeMB, err := strconv.ParseUint(strings.TrimSpace(sizeEntry.Text), 10, 64)
+			if err != nil || sizeMB == 0 || sizeMB > maxMB {
+				dialog.ShowError(fmt.Errorf("invalid size: enter 1 to %d MB", maxMB), gd.window)
+				return
+			}
+
+			// The whole gap is usually not a whole number of MB; filling it
+			// avoids leaving a sliver behind
+			size := sizeMB * 1024 * 1024
+			if sizeMB == maxMB {
+				size = 0
+			}
+
+			label := strings.TrimSpace(labelEntry.Text)
+			if label != "" {
+				if err := partition.ValidateGPTLabel(label); err != nil {
+					dialog.ShowError(err, gd.window)
+					return
+				}
+			}
+
+			if err := partition.CreatePartitionInRegion(gd.disk.Name, gd.region, size, typeSelect.Selected, label); err != nil {
+				dialog.ShowError(err, gd.window)
+				return
+			}
+
+			rememberChoice(lastPartitionTypeKey, typeSelect.Selected)
+			showSuccess(gd.window, "Partition created successfully")
+			if gd.onComplete != nil {
+				gd.onComplete()
+			}
+		}, gd.window)
+}
@@ -0,0 +1,250 @@
+package ui
+
+import (
+	"fmt"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+
+	"github.com/pgsdf/pgpart/internal/partition"
+)
+
+// HistoryDialog lists the operation history and undoes or redoes the
+// operations up to a chosen entry, one confirmed step at a time
+type HistoryDialog struct {
+	window      fyne.Window
+	history     *partition.OperationHistory
+	undo        func(*partition.HistoryEntry) error
+	redo        func(*partition.HistoryEntry) error
+	onChange    func()
+	list        *widget.List
+	statusLabel *widget.Label
+	selected    int
+}
+
+// NewHistoryDialog creates a history dialog. undo and redo run the
+// operations that reverse and repeat an entry; onChange is called after
+// steps were taken so the disk view can follow.
+func NewHistoryDialog(window fyne.Window, history *partition.OperationHistory, undo, redo func(*partition.HistoryEntry) error, onChange func()) *HistoryDialog {
+	return &HistoryDialog{
+		window:   window,
+		history:  history,
+		undo:     undo,
+		redo:     redo,
+		onChange: onChange,
+		selected: -1,
+	}
+}
+
+// Show displays the history dialog
+func (hd *HistoryDialog) Show() {
+	hd.statusLabel = widget.NewLabel("")
+
+	hd.list = widget.NewList(
+		func() int {
+			return len(hd.history.GetHistory())
+		},
+		func() fyne.CanvasObject {
+			return container.NewBorder(nil, nil,
+				widget.NewLabel("▶ 00:00:00"), widget.NewLabel("Reversible"), widget.NewLabel("Template"))
+		},
+		func(id widget.ListItemID, obj fyne.CanvasObject) {
+			entries := hd.history.GetHistory()
+			if id >= len(entries) {
+				return
+			}
+			entry := entries[id]
+
+			// Border puts the center object first
+			row := obj.(*fyne.Container)
+			descLabel := row.Objects[0].(*widget.Label)
+			timeLabel := row.Objects[1].(*widget.Label)
+			stateLabel := row.Objects[2].(*widget.Label)
+
+			marker := "   "
+			if id == hd.history.GetCurrentPosition() {
+				marker = "▶ "
+			}
+			timeLabel.SetText(marker + entry.Timestamp.Format("15:04:05"))
+			descLabel.SetText(entry.Description)
+			stateLabel.SetText(historyEntryState(entry))
+		},
+	)
+	hd.list.OnSelected = func(id widget.ListItemID) {
+		hd.selected = id
+	}
+
+	goToBtn := widget.NewButton("Go to Selected", func() {
+		if hd.selected < 0 {
+			dialog.ShowInformation("No Entry Selected", "Select the entry to undo or redo up to", hd.window)
+			return
+		}
+		hd.goTo(hd.selected)
+	})
+	startBtn := widget.NewButton("Undo All", func() {
+		hd.goTo(-1)
+	})
+
+	content := container.NewBorder(
+		container.NewVBox(
+			widget.NewLabel("Operations of this session, oldest first. ▶ marks the current state."),
+			hd.statusLabel,
+			widget.NewSeparator(),
+		),
+		container.NewVBox(
+			widget.NewSeparator(),
+			container.NewGridWithColumns(2, goToBtn, startBtn),
+		),
+		nil,
+		nil,
+		hd.list,
+	)
+
+	hd.updateStatus()
+
+	d := dialog.NewCustom("Operation History", "Close", content, hd.window)
+	d.Resize(fyne.NewSize(700, 450))
+	d.Show()
+}
+
+// historyEntryState describes whether an entry can be undone and whether
+// it has been
+func historyEntryState(entry *partition.HistoryEntry) string {
+	switch {
+	case entry.Reversed:
+		return "Undone"
+	case entry.Reversible:
+		return "Reversible"
+	default:
+		return "Permanent"
+	}
+}
+
+// updateStatus refreshes the list and the summary above it
+func (hd *HistoryDialog) updateStatus() {
+	entries := hd.history.GetHistory()
+	pos := hd.history.GetCurrentPosition()
+
+	undone := 0
+	for _, entry := range entries {
+		if entry.Reversed {
+			undone++
+		}
+	}
+
+	switch {
+	case len(entries) == 0:
+		hd.statusLabel.SetText("No operations yet")
+	case undone > 0:
+		hd.statusLabel.SetText(fmt.Sprintf("%d operations, %d undone; at step %d", len(entries), undone, pos+1))
+	default:
+		hd.statusLabel.SetText(fmt.Sprintf("%d operations", len(entries)))
+	}
+	hd.list.Refresh()
+}
+
+// goTo undoes or redoes operations until target is the current entry; a
+// target of -1 undoes all of them. Every operation on the way back must be
+// reversible, or nothing is done.
+func (hd *HistoryDialog) goTo(target int) {
+	entries := hd.history.GetHistory()
+	pos := hd.history.GetCurrentPosition()
+
+	switch {
+	case target == pos:
+		dialog.ShowInformation("Nothing to Do", "The disks are already at this point in the history", hd.window)
+	case target < pos:
+		for i := pos; i > target; i-- {
+			if !entries[i].Reversible {
+				dialog.ShowInformation("Cannot Undo",
+					fmt.Sprintf("\"%s\" can't be undone, so the history can't go back past it", entries[i].Description), hd.window)
+				return
+			}
+		}
+		hd.step(target, true, 0, pos-target)
+	default:
+		hd.step(target, false, 0, target-pos)
+	}
+}
+
+// step confirms and runs the next undo or redo on the way to target, then
+// continues with the one after it. done of total steps were taken so far.
+// Cancelling or a failure stops at the entry reached.
+func (hd *HistoryDialog) step(target int, undo bool, done, total int) {
+	pos := hd.history.GetCurrentPosition()
+	if pos == target {
+		hd.finish(done, undo)
+		return
+	}
+
+	var entry *partition.HistoryEntry
+	var err error
+	if undo {
+		entry, err = hd.history.GetUndoOperation()
+	} else {
+		entry, err = hd.history.GetRedoOperation()
+	}
+	if err != nil {
+		dialog.ShowError(err, hd.window)
+		hd.finish(done, undo)
+		return
+	}
+
+	// Put the entry back as it was if the step doesn't happen
+	entryID := entry.ID
+	restore := func() {
+		hd.history.RestoreReversedState(entryID, !undo)
+		hd.history.RestorePosition(pos)
+	}
+
+	title := fmt.Sprintf("Redo Step %d of %d", done+1, total)
+	message := redoConfirmMessage(entry)
+	apply := hd.redo
+	if undo {
+		title = fmt.Sprintf("Undo Step %d of %d", done+1, total)
+		message = undoConfirmMessage(entry)
+		apply = hd.undo
+	}
+
+	dialog.ShowConfirm(title, message, func(ok bool) {
+		if !ok {
+			restore()
+			hd.finish(done, undo)
+			return
+		}
+
+		if err := apply(entry); err != nil {
+			restore()
+			action := "redo"
+			if undo {
+				action = "undo"
+			}
+			dialog.ShowError(fmt.Errorf("%s failed: %w", action, err), hd.window)
+			hd.finish(done, undo)
+			return
+		}
+
+		hd.updateStatus()
+		hd.step(target, undo, done+1, total)
+	}, hd.window)
+}
+
+// finish updates the dialog after done steps through the history and tells
+// the main window if anything changed
+func (hd *HistoryDialog) finish(done int, undo bool) {
+	hd.updateStatus()
+	if done == 0 {
+		return
+	}
+
+	if hd.onChange != nil {
+		hd.onChange()
+	}
+	action := "Redid"
+	if undo {
+		action = "Undid"
+	}
+	showSuccess(hd.window, fmt.Sprintf("%s %d operation(s)", action, done))
+}
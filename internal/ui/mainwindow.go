@@ -3,7 +3,10 @@ package ui
 import (
 	"fmt"
 	"image/color"
+	"reflect"
+	"strconv"
 	"strings"
+	"time"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/canvas"
@@ -19,27 +22,86 @@ type MainWindow struct {
 	diskList      *widget.List
 	disks         []partition.Disk
 	selectedDisk  int
+	selectedName  string
 	partitionView *fyne.Container
-	infoLabel     *widget.Label
+	partScroll    *container.Scroll
+	infoLabel     *truncatedLabel
 	history       *partition.OperationHistory
+	batchQueue    *partition.BatchQueue
 	undoBtn       *widget.Button
 	redoBtn       *widget.Button
+
+	// pendingResizes holds resizes staged in the interactive view, by
+	// partition name, until they are applied or discarded
+	pendingResizes map[string]uint64
+
+	refreshDebounce refreshDebouncer
+
+	// diskCache spares routine refreshes a full rescan; the toolbar's
+	// Refresh button bypasses it
+	diskCache *partition.DiskCache
 }
 
+// diskCacheTTL is how long a disk scan is reused when no operation of
+// pgpart changed the disks meanwhile
+const diskCacheTTL = 30 * time.Second
+
 func NewMainWindow(app fyne.App) *MainWindow {
 	mw := &MainWindow{
-		window:       app.NewWindow("PGPart - Partition Manager"),
-		selectedDisk: -1,
-		history:      partition.NewOperationHistory(),
+		window:         app.NewWindow("PGPart - Partition Manager"),
+		selectedDisk:   -1,
+		history:        partition.NewOperationHistory(),
+		pendingResizes: make(map[string]uint64),
+		diskCache:      partition.NewDiskCache(diskCacheTTL),
 	}
 
+	mw.refreshDebounce = refreshDebouncer{delay: defaultRefreshDebounce, run: mw.refreshDisks}
+
 	mw.window.Resize(fyne.NewSize(900, 600))
+	partition.SetPreferLabels(app.Preferences().BoolWithFallback(preferLabelsKey, true))
+	setModalNotifications(app.Preferences().Bool(modalNotificationsKey))
+	mw.setupMenu()
 	mw.setupUI()
 	mw.refreshDisks()
+	mw.setupBatchQueue()
+
+	// Show or clear the busy state of partitions as copies start and finish
+	partition.OnInFlightChange(mw.updatePartitionView)
 
 	return mw
 }
 
+// preferLabelsKey is the preference storing whether device paths use GPT labels
+const preferLabelsKey = "preferLabels"
+
+// setupMenu creates the main menu with application options
+func (mw *MainWindow) setupMenu() {
+	labelsItem := fyne.NewMenuItem("Prefer Labels for Device Paths", nil)
+	labelsItem.Checked = partition.PreferLabels()
+
+	modalItem := fyne.NewMenuItem("Show Success Messages as Dialogs", nil)
+	modalItem.Checked = fyne.CurrentApp().Preferences().Bool(modalNotificationsKey)
+
+	optionsMenu := fyne.NewMenu("Options", labelsItem, modalItem)
+	labelsItem.Action = func() {
+		prefer := !partition.PreferLabels()
+		partition.SetPreferLabels(prefer)
+		fyne.CurrentApp().Preferences().SetBool(preferLabelsKey, prefer)
+		labelsItem.Checked = prefer
+		optionsMenu.Refresh()
+		mw.updatePartitionView()
+	}
+	modalItem.Action = func() {
+		modal := !modalItem.Checked
+		setModalNotifications(modal)
+		fyne.CurrentApp().Preferences().SetBool(modalNotificationsKey, modal)
+		modalItem.Checked = modal
+		optionsMenu.Refresh()
+	}
+
+	mw.window.SetMainMenu(fyne.NewMainMenu(optionsMenu))
+}
+
 // createToolbarButton creates a toolbar button with an icon and text
 func (mw *MainWindow) createToolbarButton(icon fyne.Resource, text string, tapped func()) *widget.Button {
 	btn := widget.NewButtonWithIcon(text, icon, tapped)
@@ -48,34 +110,45 @@ func (mw *MainWindow) createToolbarButton(icon fyne.Resource, text string, tappe
 }
 
 func (mw *MainWindow) setupUI() {
-	mw.infoLabel = widget.NewLabel("Select a disk to view partitions")
+	mw.infoLabel = newTruncatedLabel("Select a disk to view partitions")
 
 	// Create toolbar buttons with labels
 	undoBtn := mw.createToolbarButton(theme.NavigateBackIcon(), "Undo", mw.performUndo)
 	redoBtn := mw.createToolbarButton(theme.NavigateNextIcon(), "Redo", mw.performRedo)
-	refreshBtn := mw.createToolbarButton(theme.ViewRefreshIcon(), "Refresh", mw.refreshDisks)
+	historyBtn := mw.createToolbarButton(theme.HistoryIcon(), "History", mw.showHistoryDialog)
+	refreshBtn := mw.createToolbarButton(theme.ViewRefreshIcon(), "Refresh", mw.forceRefreshDisks)
 	infoBtn := mw.createToolbarButton(theme.InfoIcon(), "Disk Info", mw.showDiskInfo)
+	compareBtn := mw.createToolbarButton(theme.ViewRestoreIcon(), "Compare", mw.showCompareDialog)
 	newTableBtn := mw.createToolbarButton(theme.StorageIcon(), "New Table", mw.showNewPartitionTableDialog)
 	newPartBtn := mw.createToolbarButton(theme.ContentAddIcon(), "New Partition", mw.showNewPartitionDialog)
 	copyBtn := mw.createToolbarButton(theme.ContentCopyIcon(), "Copy", mw.showCopyDialog)
 	moveBtn := mw.createToolbarButton(theme.NavigateNextIcon(), "Move", mw.showMoveDialog)
 	resizeBtn := mw.createToolbarButton(theme.ZoomInIcon(), "Resize", mw.showResizeDialog)
 	deleteBtn := mw.createToolbarButton(theme.DeleteIcon(), "Delete", mw.showDeletePartitionDialog)
+	prepareBtn := mw.createToolbarButton(theme.LogoutIcon(), "Prepare Disk", mw.showPrepareDiskDialog)
 	formatBtn := mw.createToolbarButton(theme.DocumentCreateIcon(), "Format", mw.showFormatDialog)
 	bootableBtn := mw.createToolbarButton(theme.ConfirmIcon(), "Toggle Boot", mw.toggleBootableDialog)
 	attrBtn := mw.createToolbarButton(theme.SettingsIcon(), "Attributes", mw.showAttributesDialog)
+	bootFallbackBtn := mw.createToolbarButton(theme.MediaReplayIcon(), "Boot Fallback", mw.showBootFallbackDialog)
+	tuneUFSBtn := mw.createToolbarButton(theme.SettingsIcon(), "Tune UFS", mw.showTuneUFSDialog)
+	wipeBtn := mw.createToolbarButton(theme.WarningIcon(), "Secure Erase", mw.showWipeDialog)
+	encryptBtn := mw.createToolbarButton(theme.VisibilityOffIcon(), "Encrypt", mw.showEncryptDialog)
 	batchBtn := mw.createToolbarButton(theme.ListIcon(), "Batch", mw.showBatchDialog)
+	planBtn := mw.createToolbarButton(theme.GridIcon(), "Plan", mw.showCapacityPlanner)
 
 	// Create toolbar with buttons
 	toolbar := container.NewHBox(
 		undoBtn,
 		redoBtn,
+		historyBtn,
 		widget.NewSeparator(),
 		refreshBtn,
 		infoBtn,
+		compareBtn,
 		widget.NewSeparator(),
 		newTableBtn,
 		newPartBtn,
+		prepareBtn,
 		widget.NewSeparator(),
 		copyBtn,
 		moveBtn,
@@ -83,11 +156,16 @@ func (mw *MainWindow) setupUI() {
 		resizeBtn,
 		deleteBtn,
 		formatBtn,
+		wipeBtn,
+		encryptBtn,
 		widget.NewSeparator(),
 		bootableBtn,
 		attrBtn,
+		bootFallbackBtn,
+		tuneUFSBtn,
 		widget.NewSeparator(),
 		batchBtn,
+		planBtn,
 	)
 
 	mw.diskList = widget.NewList(
@@ -95,25 +173,31 @@ func (mw *MainWindow) setupUI() {
 			return len(mw.disks)
 		},
 		func() fyne.CanvasObject {
+			// Model strings of enterprise drives can be very long
 			return container.NewVBox(
-				widget.NewLabel(""),
-				widget.NewLabel(""),
+				newTruncatedLabel(""),
+				newTruncatedLabel(""),
 			)
 		},
 		func(id widget.ListItemID, item fyne.CanvasObject) {
 			cont := item.(*fyne.Container)
 			disk := mw.disks[id]
 
-			nameLabel := cont.Objects[0].(*widget.Label)
-			sizeLabel := cont.Objects[1].(*widget.Label)
+			nameLabel := cont.Objects[0].(*truncatedLabel)
+			sizeLabel := cont.Objects[1].(*truncatedLabel)
 
 			nameLabel.SetText(fmt.Sprintf("%s - %s", disk.Name, disk.Model))
-			sizeLabel.SetText(fmt.Sprintf("Size: %s, Scheme: %s", partition.FormatBytes(disk.Size), disk.Scheme))
+			if disk.RAIDMemberOf != "" {
+				sizeLabel.SetText(fmt.Sprintf("Size: %s, RAID member of %s", partition.FormatBytes(disk.Size), disk.RAIDMemberOf))
+			} else {
+				sizeLabel.SetText(fmt.Sprintf("Size: %s, Scheme: %s", partition.FormatBytes(disk.Size), disk.Scheme))
+			}
 		},
 	)
 
 	mw.diskList.OnSelected = func(id widget.ListItemID) {
 		mw.selectedDisk = id
+		mw.selectedName = mw.disks[id].Name
 		mw.updatePartitionView()
 	}
 
@@ -125,10 +209,12 @@ func (mw *MainWindow) setupUI() {
 		mw.diskList,
 	)
 
+	mw.partScroll = container.NewScroll(mw.partitionView)
+
 	rightPanel := container.NewBorder(
 		mw.infoLabel,
 		nil, nil, nil,
-		container.NewScroll(mw.partitionView),
+		mw.partScroll,
 	)
 
 	split := container.NewHSplit(leftPanel, rightPanel)
@@ -143,45 +229,165 @@ func (mw *MainWindow) setupUI() {
 	mw.window.SetContent(content)
 }
 
+// refreshDisks updates the view from the disk cache, which rescans only
+// when its result expired or an operation changed the disks
 func (mw *MainWindow) refreshDisks() {
-	disks, err := partition.GetDisks()
+	mw.mergeDisks(mw.diskCache.Disks())
+}
+
+// forceRefreshDisks rescans the disks bypassing the cache, to pick up
+// changes made outside pgpart such as a newly plugged-in disk
+func (mw *MainWindow) forceRefreshDisks() {
+	mw.mergeDisks(mw.diskCache.Refresh())
+}
+
+// mergeDisks merges a disk scan into the current view. When the set of
+// disks is unchanged only the entries that differ are refreshed, so the
+// list selection and scroll positions are kept. Otherwise the list is
+// rebuilt and the previously selected disk is reselected by name.
+func (mw *MainWindow) mergeDisks(disks []partition.Disk, err error) {
 	if err != nil {
 		dialog.ShowError(fmt.Errorf("failed to get disks: %w", err), mw.window)
 		return
 	}
 
+	selectedName := ""
+	if mw.selectedDisk >= 0 && mw.selectedDisk < len(mw.disks) {
+		selectedName = mw.disks[mw.selectedDisk].Name
+	}
+	scrollOffset := mw.partScroll.Offset
+
+	if sameDiskSet(mw.disks, disks) {
+		selectedChanged := false
+		for i := range disks {
+			if reflect.DeepEqual(mw.disks[i], disks[i]) {
+				continue
+			}
+			mw.disks[i] = disks[i]
+			mw.diskList.RefreshItem(i)
+			if i == mw.selectedDisk {
+				selectedChanged = true
+			}
+		}
+
+		if selectedChanged {
+			mw.updatePartitionView()
+			mw.partScroll.Offset = scrollOffset
+			mw.partScroll.Refresh()
+		}
+		return
+	}
+
+	// The set of disks changed, rebuild the list
 	mw.disks = disks
 	mw.diskList.Refresh()
 
-	if mw.selectedDisk >= 0 && mw.selectedDisk < len(mw.disks) {
-		mw.updatePartitionView()
+	for i, disk := range mw.disks {
+		if selectedName != "" && disk.Name == selectedName {
+			if i == mw.selectedDisk {
+				mw.updatePartitionView()
+			} else {
+				mw.diskList.Select(i)
+			}
+			mw.partScroll.Offset = scrollOffset
+			mw.partScroll.Refresh()
+			return
+		}
+	}
+
+	// Previously selected disk is gone
+	mw.clearSelection()
+}
+
+// clearSelection deselects the current disk and empties the partition view
+func (mw *MainWindow) clearSelection() {
+	mw.selectedDisk = -1
+	mw.selectedName = ""
+	mw.diskList.UnselectAll()
+	mw.partitionView.Objects = nil
+	mw.partitionView.Refresh()
+	mw.infoLabel.SetText("Select a disk to view partitions")
+}
+
+// showOperationError shows an operation's error. If the error was caused
+// by the disk disappearing, the disk list is refreshed so the vanished disk
+// is removed and any selection pointing at it is cleared.
+func (mw *MainWindow) showOperationError(err error) {
+	dialog.ShowError(err, mw.window)
+	if partition.IsDiskGone(err) {
+		mw.forceRefreshDisks()
 	}
 }
 
+// sameDiskSet reports whether two disk lists contain the same disks in the same order
+func sameDiskSet(a, b []partition.Disk) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Name != b[i].Name {
+			return false
+		}
+	}
+	return true
+}
+
 func (mw *MainWindow) updatePartitionView() {
 	if mw.selectedDisk < 0 || mw.selectedDisk >= len(mw.disks) {
 		return
 	}
 
+	// The index may point at a different disk after the list changed
+	if mw.disks[mw.selectedDisk].Name != mw.selectedName {
+		mw.clearSelection()
+		return
+	}
+
 	disk := mw.disks[mw.selectedDisk]
-	mw.infoLabel.SetText(fmt.Sprintf("Disk: %s (%s) - %s", disk.Name, disk.Model, partition.FormatBytes(disk.Size)))
+	if disk.RAIDMemberOf != "" {
+		mw.infoLabel.SetText(fmt.Sprintf("Disk: %s (%s) - %s - member of %s, do not partition directly", disk.Name, disk.Model, partition.FormatBytes(disk.Size), disk.RAIDMemberOf))
+	} else {
+		mw.infoLabel.SetText(fmt.Sprintf("Disk: %s (%s) - %s", disk.Name, disk.Model, partition.FormatBytes(disk.Size)))
+	}
 
 	mw.partitionView.Objects = nil
 
-	interactiveView := NewInteractivePartitionView(&disk, mw.window, mw.refreshDisks)
+	if banner := mw.createTableStateBanner(disk); banner != nil {
+		mw.partitionView.Add(banner)
+	}
+
+	if banner := mw.createEncryptionBanner(disk); banner != nil {
+		mw.partitionView.Add(banner)
+	}
+
+	interactiveView := NewInteractivePartitionView(&disk, mw.window, mw.history, mw.pendingResizes, mw.DebouncedRefresh)
+	copyLayoutBtn := widget.NewButtonWithIcon("Copy Layout", theme.ContentCopyIcon(), func() {
+		mw.window.Clipboard().SetContent(partition.RenderLayoutASCII(disk))
+		showSuccess(mw.window, "Layout copied to clipboard")
+	})
+	saveLayoutBtn := widget.NewButtonWithIcon("Save Layout...", theme.DocumentSaveIcon(), func() {
+		mw.saveLayout(disk)
+	})
 	mw.partitionView.Add(container.NewVBox(
-		widget.NewLabel("Partition Layout (drag edges to resize):"),
+		container.NewBorder(nil, nil,
+			widget.NewLabel("Partition Layout (drag edges to stage resizes, then Apply Changes; click free space to create a partition):"),
+			container.NewHBox(copyLayoutBtn, saveLayoutBtn)),
 		interactiveView,
 	))
 
 	if len(disk.Partitions) == 0 {
-		mw.partitionView.Add(widget.NewLabel("No partitions found"))
+		reasonLabel := widget.NewLabel("No partitions found. " + disk.NoPartitionsReason())
+		reasonLabel.Wrapping = fyne.TextWrapWord
+		if disk.LayoutProblem != "" {
+			reasonLabel.Importance = widget.WarningImportance
+		}
+		mw.partitionView.Add(reasonLabel)
 	} else {
 		legend := mw.createColorLegend()
 		mw.partitionView.Add(legend)
 
 		for _, part := range disk.Partitions {
-			partCard := mw.createPartitionCard(part)
+			partCard := mw.createPartitionCard(disk, part)
 			mw.partitionView.Add(partCard)
 		}
 	}
@@ -189,6 +395,168 @@ func (mw *MainWindow) updatePartitionView() {
 	mw.partitionView.Refresh()
 }
 
+// createEncryptionBanner returns a banner offering to attach the disk's
+// detached GELI providers, or nil if there are none
+func (mw *MainWindow) createEncryptionBanner(disk partition.Disk) fyne.CanvasObject {
+	detached := 0
+	for i := range disk.Partitions {
+		if partition.GELIStatus(&disk.Partitions[i]) == partition.GELIDetached {
+			detached++
+		}
+	}
+	if detached == 0 {
+		return nil
+	}
+
+	label := widget.NewLabel(fmt.Sprintf("🔒 %d encrypted partition(s) on %s are not attached", detached, disk.Name))
+	label.TextStyle = fyne.TextStyle{Bold: true}
+	attachBtn := widget.NewButton("Attach All Encrypted...", func() {
+		mw.showAttachAllGELIDialog(disk.Name)
+	})
+
+	return container.NewVBox(
+		container.NewBorder(nil, nil, nil, attachBtn, label),
+		widget.NewSeparator(),
+	)
+}
+
+// showAttachAllGELIDialog asks for a passphrase and attaches every GELI
+// provider on the disk with it
+func (mw *MainWindow) showAttachAllGELIDialog(diskName string) {
+	passEntry := widget.NewPasswordEntry()
+	passEntry.SetPlaceHolder("Passphrase shared by the providers")
+
+	dialog.ShowForm("Attach All Encrypted Partitions", "Attach", "Cancel",
+		[]*widget.FormItem{
+			widget.NewFormItem("Passphrase", passEntry),
+		},
+		func(ok bool) {
+			if !ok {
+				return
+			}
+
+			providers, err := partition.AttachAllGELI(diskName, passEntry.Text)
+			mw.updatePartitionView()
+			if err != nil {
+				if len(providers) > 0 {
+					err = fmt.Errorf("%w\n\nAttached: %s", err, strings.Join(providers, ", "))
+				}
+				mw.showOperationError(err)
+				return
+			}
+
+			showSuccess(mw.window, fmt.Sprintf("Attached %s", strings.Join(providers, ", ")))
+		}, mw.window)
+}
+
+// showAttachGELIDialog asks for the passphrase of an encrypted partition
+// and attaches it
+func (mw *MainWindow) showAttachGELIDialog(part partition.Partition) {
+	passEntry := widget.NewPasswordEntry()
+
+	dialog.ShowForm(fmt.Sprintf("Attach %s", part.Name), "Attach", "Cancel",
+		[]*widget.FormItem{
+			widget.NewFormItem("Passphrase", passEntry),
+		},
+		func(ok bool) {
+			if !ok {
+				return
+			}
+
+			provider, err := partition.AttachGELI(part.Name, passEntry.Text)
+			if err != nil {
+				mw.showOperationError(err)
+				return
+			}
+
+			mw.updatePartitionView()
+			showSuccess(mw.window, fmt.Sprintf("Attached %s", provider))
+		}, mw.window)
+}
+
+// detachGELI locks an attached encrypted partition again
+func (mw *MainWindow) detachGELI(part partition.Partition) {
+	if err := partition.DetachGELI(part.Name); err != nil {
+		mw.showOperationError(err)
+		return
+	}
+
+	mw.updatePartitionView()
+	showSuccess(mw.window, fmt.Sprintf("Detached %s.eli", part.Name))
+}
+
+// createTableStateBanner returns a banner for a partition table with
+// uncommitted changes or corruption, or nil if the table is clean
+func (mw *MainWindow) createTableStateBanner(disk partition.Disk) fyne.CanvasObject {
+	state := disk.TableState
+	if !state.Modified && !state.Corrupt {
+		return nil
+	}
+
+	run := func(action string, fn func(string) error) {
+		if err := fn(disk.Name); err != nil {
+			mw.showOperationError(err)
+			return
+		}
+		showSuccess(mw.window, fmt.Sprintf("%s completed on %s", action, disk.Name))
+		mw.refreshDisks()
+	}
+
+	var message string
+	var buttons []fyne.CanvasObject
+	if state.Corrupt {
+		message = fmt.Sprintf("⚠ The partition table on %s is CORRUPT (for example a damaged backup GPT header).", disk.Name)
+		buttons = append(buttons, widget.NewButton("Recover", func() {
+			dialog.ShowConfirm("Recover Partition Table",
+				fmt.Sprintf("Run gpart recover on %s? This rewrites the damaged parts of the partition table from the intact copy.", disk.Name),
+				func(ok bool) {
+					if ok {
+						run("Recover", partition.RecoverTable)
+					}
+				}, mw.window)
+		}))
+	}
+	if state.Modified {
+		if message != "" {
+			message += "\n"
+		}
+		message += fmt.Sprintf("⚠ Uncommitted changes: the partition table on %s has staged changes that will be lost on reboot unless committed.", disk.Name)
+		buttons = append(buttons,
+			widget.NewButton("Commit", func() {
+				run("Commit", partition.CommitTable)
+			}),
+			widget.NewButton("Undo", func() {
+				dialog.ShowConfirm("Undo Changes",
+					fmt.Sprintf("Discard all uncommitted changes to the partition table on %s?", disk.Name),
+					func(ok bool) {
+						if ok {
+							run("Undo", partition.UndoTable)
+						}
+					}, mw.window)
+			}))
+	}
+
+	label := widget.NewLabel(message)
+	label.Wrapping = fyne.TextWrapWord
+	label.TextStyle = fyne.TextStyle{Bold: true}
+
+	background := canvas.NewRectangle(color.RGBA{R: 255, G: 235, B: 180, A: 255})
+	return container.NewStack(background, container.NewBorder(nil, nil, nil, container.NewHBox(buttons...), label))
+}
+
+// checkRAIDMember explains and returns true if the disk is a software RAID
+// member that must not be partitioned directly
+func (mw *MainWindow) checkRAIDMember(disk partition.Disk) bool {
+	if disk.RAIDMemberOf == "" {
+		return false
+	}
+
+	dialog.ShowInformation("RAID Member",
+		fmt.Sprintf("%s is a member of the software RAID set %s.\n\nModifying a member directly would corrupt the set. Select %s in the disk list to partition the RAID device instead.",
+			disk.Name, disk.RAIDMemberOf, disk.RAIDMemberOf), mw.window)
+	return true
+}
+
 func (mw *MainWindow) createPartitionVisual(disk partition.Disk) *fyne.Container {
 	visual := container.NewHBox()
 
@@ -206,8 +574,8 @@ func (mw *MainWindow) createPartitionVisual(disk partition.Disk) *fyne.Container
 		partColor := getPartitionColor(part.FileSystem)
 		rect := canvas.NewRectangle(partColor)
 
-		width := float32(600) * float32(part.Size) / float32(disk.Size)
-		if width < 20 {
+		width := blockWidth(&disk, part.Size, 600, 20)
+		if part.SizeUnknown {
 			width = 20
 		}
 		rect.SetMinSize(fyne.NewSize(width, 40))
@@ -229,6 +597,8 @@ func getPartitionColor(fsType string) color.Color {
 		return color.RGBA{R: 50, G: 205, B: 50, A: 255} // Lime Green
 	case "FAT32":
 		return color.RGBA{R: 255, G: 165, B: 0, A: 255} // Orange
+	case "exFAT":
+		return color.RGBA{R: 255, G: 215, B: 0, A: 255} // Gold
 	case "swap":
 		return color.RGBA{R: 220, G: 20, B: 60, A: 255} // Crimson Red
 	case "ext2", "ext3", "ext4":
@@ -243,21 +613,138 @@ func getPartitionColor(fsType string) color.Color {
 	}
 }
 
-func (mw *MainWindow) createPartitionCard(part partition.Partition) *fyne.Container {
+func (mw *MainWindow) createPartitionCard(disk partition.Disk, part partition.Partition) *fyne.Container {
 	nameLabel := widget.NewLabelWithStyle(part.Name, fyne.TextAlignLeading, fyne.TextStyle{Bold: true})
 	typeLabel := widget.NewLabel(fmt.Sprintf("Type: %s", part.Type))
-	sizeLabel := widget.NewLabel(fmt.Sprintf("Size: %s", partition.FormatBytes(part.Size*512)))
+	sizeLabel := widget.NewLabel(fmt.Sprintf("Size: %s", part.DisplaySize()))
+	if part.SizeUnknown {
+		sizeLabel.SetText("Size: unknown (gpart reported an implausible size)")
+		sizeLabel.TextStyle = fyne.TextStyle{Italic: true}
+	}
 	fsLabel := widget.NewLabel(fmt.Sprintf("Filesystem: %s", part.FileSystem))
+	if partition.IsGELIProvider(&part) {
+		fsLabel.SetText("Filesystem: GELI-encrypted")
+	}
+	deviceLabel := widget.NewLabel(fmt.Sprintf("Device: %s", partition.DevicePath(&part)))
+
+	// A type that disagrees with the filesystem breaks booting and
+	// mounting by type, e.g. a swap-typed partition reused for UFS
+	var mismatchLabel *widget.Label
+	if mismatch := partition.TypeMismatch(&part); mismatch != "" {
+		mismatchLabel = widget.NewLabel("⚠ " + mismatch)
+		mismatchLabel.Importance = widget.WarningImportance
+	}
+
+	// A filesystem larger than its partition is left by a botched resize;
+	// growing the entry to match repairs it without touching the data
+	var overrunItems []fyne.CanvasObject
+	if fsSize, overrun := partition.FilesystemOverrun(&part); overrun {
+		overrunLabel := widget.NewLabel("⚠ " + partition.OverrunDescription(&part, fsSize))
+		overrunLabel.Wrapping = fyne.TextWrapWord
+		overrunLabel.Importance = widget.DangerImportance
+		growBtn := widget.NewButton("Grow Partition to Filesystem", func() {
+			mw.growPartitionToFilesystem(part, fsSize)
+		})
+		overrunItems = []fyne.CanvasObject{overrunLabel, container.NewHBox(growBtn)}
+	}
+
+	// GPT labels are renamed in place from the card; other schemes
+	// rarely carry labels, so theirs are only shown when present
+	var labelItems []fyne.CanvasObject
+	switch {
+	case disk.Scheme == "GPT":
+		labelLabel := widget.NewLabel(fmt.Sprintf("Label: %s", part.Label))
+		if part.Label == "" {
+			labelLabel.SetText("Label: (none)")
+			labelLabel.TextStyle = fyne.TextStyle{Italic: true}
+		}
+		renameBtn := widget.NewButton("Rename", func() {
+			mw.showRenameLabelDialog(part)
+		})
+		labelItems = []fyne.CanvasObject{container.NewHBox(labelLabel, renameBtn)}
+	case part.Label != "":
+		labelItems = []fyne.CanvasObject{widget.NewLabel(fmt.Sprintf("Label: %s", part.Label))}
+	}
+
+	// The GPT partition GUID survives device renumbering, so scripts and
+	// fstab entries can refer to it
+	if part.UUID != "" {
+		uuidLabel := widget.NewLabel(fmt.Sprintf("UUID: %s", part.UUID))
+		copyBtn := widget.NewButton("Copy", func() {
+			mw.window.Clipboard().SetContent(part.UUID)
+			showSuccess(mw.window, "Copied to clipboard")
+		})
+		labelItems = append(labelItems, container.NewHBox(uuidLabel, copyBtn))
+	}
+
+	// Swap partitions are turned on and off from their card
+	var swapItems []fyne.CanvasObject
+	if part.Type == "freebsd-swap" {
+		if active, err := partition.IsSwapActive(part.Name); err == nil {
+			swapLabel := widget.NewLabel("Swap: inactive")
+			swapLabel.TextStyle = fyne.TextStyle{Italic: true}
+			swapBtn := widget.NewButton("Enable Swap", func() {
+				mw.setSwapActive(part, true)
+			})
+			if active {
+				swapLabel = widget.NewLabel("Swap: active")
+				swapLabel.TextStyle = fyne.TextStyle{Bold: true}
+				swapBtn.SetText("Disable Swap")
+				swapBtn.OnTapped = func() {
+					mw.setSwapActive(part, false)
+				}
+			}
+			swapItems = []fyne.CanvasObject{swapLabel, container.NewHBox(swapBtn)}
+		}
+	}
 
 	var mountLabel *widget.Label
+	var usageBar *widget.ProgressBar
 	if part.MountPoint != "" {
 		mountLabel = widget.NewLabel(fmt.Sprintf("Mount: %s", part.MountPoint))
 		mountLabel.TextStyle = fyne.TextStyle{Bold: true}
+
+		// Filesystems df can't report get no bar
+		if used, total, err := partition.GetUsage(part.MountPoint); err == nil && total > 0 {
+			usageBar = widget.NewProgressBar()
+			usageBar.SetValue(float64(used) / float64(total))
+			usageBar.TextFormatter = func() string {
+				return partition.UsageSummary(used, total)
+			}
+		}
 	} else {
 		mountLabel = widget.NewLabel("Mount: (not mounted)")
 		mountLabel.TextStyle = fyne.TextStyle{Italic: true}
 	}
 
+	// Encrypted partitions are attached and detached from their card
+	var encryptionItems []fyne.CanvasObject
+	switch partition.GELIStatus(&part) {
+	case partition.GELIAttached:
+		encryptionLabel := widget.NewLabel(fmt.Sprintf("🔓 Encryption: GELI, attached as %s.eli", part.Name))
+		detachBtn := widget.NewButton("Detach", func() {
+			mw.detachGELI(part)
+		})
+		encryptionItems = []fyne.CanvasObject{container.NewHBox(encryptionLabel, detachBtn)}
+	case partition.GELIDetached:
+		encryptionLabel := widget.NewLabel("🔒 Encryption: GELI, detached (locked)")
+		encryptionLabel.TextStyle = fyne.TextStyle{Italic: true}
+		attachBtn := widget.NewButton("Attach", func() {
+			mw.showAttachGELIDialog(part)
+		})
+		encryptionItems = []fyne.CanvasObject{container.NewHBox(encryptionLabel, attachBtn)}
+	}
+
+	var ufsLabel *widget.Label
+	if partition.IsUFS(&part) {
+		if tuning, err := partition.GetUFSTuning(&part); err == nil {
+			ufsLabel = widget.NewLabel(fmt.Sprintf("UFS: %s", tuning))
+			if !tuning.SoftUpdates {
+				ufsLabel.Importance = widget.WarningImportance
+			}
+		}
+	}
+
 	// Check for GPT attributes
 	attrSummary := partition.GetAttributeSummary(part.Name)
 	var attrLabel *widget.Label
@@ -270,12 +757,41 @@ func (mw *MainWindow) createPartitionCard(part partition.Partition) *fyne.Contai
 		}
 	}
 
+	changeTypeBtn := widget.NewButton("Change Type", func() {
+		mw.showChangeTypeDialog(part)
+	})
+
 	cardItems := []fyne.CanvasObject{
 		nameLabel,
-		typeLabel,
+		container.NewHBox(typeLabel, changeTypeBtn),
 		sizeLabel,
 		fsLabel,
-		mountLabel,
+	}
+	cardItems = append(cardItems, labelItems...)
+
+	if mismatchLabel != nil {
+		cardItems = append(cardItems, mismatchLabel)
+	}
+	cardItems = append(cardItems, overrunItems...)
+
+	cardItems = append(cardItems, deviceLabel, mountLabel)
+	if usageBar != nil {
+		cardItems = append(cardItems, usageBar)
+	}
+	cardItems = append(cardItems, swapItems...)
+
+	cardItems = append(cardItems, encryptionItems...)
+
+	if ufsLabel != nil {
+		cardItems = append(cardItems, ufsLabel)
+	}
+
+	// Partitions held by a copy or move can't be modified until it finishes
+	if op, busy := partition.InFlightOperationFor(part.Name); busy {
+		busyLabel := widget.NewLabel(fmt.Sprintf("⏳ Busy: %s", op.Description))
+		busyLabel.TextStyle = fyne.TextStyle{Bold: true}
+		busyLabel.Importance = widget.WarningImportance
+		cardItems = append(cardItems, busyLabel)
 	}
 
 	// Add attribute label if present
@@ -297,6 +813,9 @@ func (mw *MainWindow) showNewPartitionTableDialog() {
 	}
 
 	disk := mw.disks[mw.selectedDisk]
+	if mw.checkRAIDMember(disk) {
+		return
+	}
 
 	schemeSelect := widget.NewSelect([]string{"GPT", "MBR", "BSD"}, nil)
 	schemeSelect.SetSelected("GPT")
@@ -312,15 +831,30 @@ func (mw *MainWindow) showNewPartitionTableDialog() {
 
 			err := partition.CreatePartitionTable(disk.Name, strings.ToLower(schemeSelect.Selected))
 			if err != nil {
-				dialog.ShowError(err, mw.window)
+				mw.showOperationError(err)
 				return
 			}
 
-			dialog.ShowInformation("Success", "Partition table created successfully", mw.window)
+			showSuccess(mw.window, "Partition table created successfully")
 			mw.refreshDisks()
 		}, mw.window)
 }
 
+// otherTypeGUID is the partition type choice for entering a raw type GUID
+const otherTypeGUID = "Other (GUID)..."
+
+// partitionAlignments are the fixed alignments offered when creating a
+// partition, besides the automatic choice
+var partitionAlignments = []struct {
+	name  string
+	bytes uint64
+}{
+	{"4K", partition.Align4K},
+	{"128K", partition.Align128K},
+	{"1M", partition.Align1M},
+	{"4M", partition.Align4M},
+}
+
 func (mw *MainWindow) showNewPartitionDialog() {
 	if mw.selectedDisk < 0 {
 		dialog.ShowInformation("No Disk Selected", "Please select a disk first", mw.window)
@@ -328,39 +862,174 @@ func (mw *MainWindow) showNewPartitionDialog() {
 	}
 
 	disk := mw.disks[mw.selectedDisk]
+	if mw.checkRAIDMember(disk) {
+		return
+	}
 
 	sizeEntry := widget.NewEntry()
-	sizeEntry.SetPlaceHolder("1024")
+	sizeEntry.SetPlaceHolder("rest of disk")
+
+	guidEntry := widget.NewEntry()
+	guidEntry.SetPlaceHolder("xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx")
+	guidEntry.Validator = func(text string) error {
+		if guidEntry.Disabled() || partition.IsTypeGUID(text) {
+			return nil
+		}
+		return fmt.Errorf("not a valid GUID")
+	}
+	guidEntry.Disable()
+
+	partTypes := append(partition.PartitionTypeAliases(), otherTypeGUID)
+	typeSelect := widget.NewSelect(partTypes, func(selected string) {
+		if selected == otherTypeGUID {
+			guidEntry.Enable()
+		} else {
+			guidEntry.Disable()
+		}
+		guidEntry.Validate()
+	})
+	typeSelect.SetSelected(rememberedChoice(lastPartitionTypeKey, partTypes[:len(partTypes)-1], "freebsd-ufs"))
+
+	indexEntry := widget.NewEntry()
+	indexEntry.SetPlaceHolder("auto")
+	indexEntry.Validator = func(text string) error {
+		if text == "" {
+			return nil
+		}
+		if n, err := strconv.Atoi(text); err != nil || n < 1 {
+			return fmt.Errorf("index must be a positive number")
+		}
+		return nil
+	}
+
+	labelEntry := widget.NewEntry()
+	labelEntry.SetPlaceHolder("optional, e.g. data0")
+	labelEntry.Validator = func(text string) error {
+		if text == "" {
+			return nil
+		}
+		return partition.ValidateGPTLabel(text)
+	}
+
+	// The size is capped at the largest free region less what aligning the
+	// start costs, so it depends on the chosen alignment. maxMB stays 0 if
+	// the free space can't be read and gpart has the last word.
+	var maxMB uint64
+	sizeEntry.Validator = func(text string) error {
+		text = strings.TrimSpace(text)
+		if text == "" {
+			return nil
+		}
+		size, err := strconv.ParseUint(text, 10, 64)
+		if err != nil || size == 0 {
+			return fmt.Errorf("size must be a positive number of MB")
+		}
+		if maxMB > 0 && size > maxMB {
+			return fmt.Errorf("at most %d MB is free", maxMB)
+		}
+		return nil
+	}
+
+	// Auto lets CreateAlignedPartitionAt pick the disk's optimal alignment
+	optimalAlignment := partition.GetOptimalAlignment(disk.Name)
+	autoAlignment := fmt.Sprintf("Auto (%s)", partition.FormatBytes(optimalAlignment))
+	alignOptions := []string{autoAlignment}
+	for _, a := range partitionAlignments {
+		alignOptions = append(alignOptions, a.name)
+	}
+	alignSelect := widget.NewSelect(alignOptions, func(selected string) {
+		alignment := optimalAlignment
+		for _, a := range partitionAlignments {
+			if a.name == selected {
+				alignment = a.bytes
+			}
+		}
+		maxMB = 0
+		if largest, err := partition.MaxPartitionSize(disk.Name, alignment); err == nil {
+			maxMB = largest / (1024 * 1024)
+			sizeEntry.SetPlaceHolder(fmt.Sprintf("rest of disk (at most %d MB)", maxMB))
+		}
+		sizeEntry.Validate()
+	})
+	alignSelect.SetSelected(autoAlignment)
 
-	typeSelect := widget.NewSelect([]string{"freebsd-ufs", "freebsd-swap", "freebsd-zfs", "ms-basic-data"}, nil)
-	typeSelect.SetSelected("freebsd-ufs")
+	var formDialog dialog.Dialog
+	multiBtn := widget.NewButtonWithIcon("Create Multiple Partitions...", theme.ListIcon(), func() {
+		formDialog.Hide()
+		NewMultiCreateDialog(mw.window, &disk, mw.DebouncedRefresh).Show()
+	})
 
-	dialog.ShowForm("Create New Partition", "Create", "Cancel",
+	formDialog = dialog.NewForm("Create New Partition", "Create", "Cancel",
 		[]*widget.FormItem{
 			widget.NewFormItem("Size (MB)", sizeEntry),
 			widget.NewFormItem("Type", typeSelect),
+			widget.NewFormItem("Type GUID", guidEntry),
+			widget.NewFormItem("Index", indexEntry),
+			widget.NewFormItem("Label", labelEntry),
+			widget.NewFormItem("Alignment", alignSelect),
+			widget.NewFormItem("", multiBtn),
 		},
 		func(ok bool) {
 			if !ok {
 				return
 			}
 
+			// An empty size fills the largest free region
 			var size uint64
-			fmt.Sscanf(sizeEntry.Text, "%d", &size)
-			if size == 0 {
-				dialog.ShowError(fmt.Errorf("invalid size"), mw.window)
-				return
+			if strings.TrimSpace(sizeEntry.Text) != "" {
+				fmt.Sscanf(sizeEntry.Text, "%d", &size)
+				if size == 0 {
+					dialog.ShowError(fmt.Errorf("invalid size"), mw.window)
+					return
+				}
+				if maxMB > 0 && size > maxMB {
+					dialog.ShowError(fmt.Errorf("requested %d MB but only %d MB free", size, maxMB), mw.window)
+					return
+				}
+			}
+
+			partType := typeSelect.Selected
+			if partType == otherTypeGUID {
+				if !partition.IsTypeGUID(guidEntry.Text) {
+					dialog.ShowError(fmt.Errorf("invalid partition type GUID: %s", guidEntry.Text), mw.window)
+					return
+				}
+				partType = guidEntry.Text
 			}
 
-			err := partition.CreatePartition(disk.Name, size*1024*1024, typeSelect.Selected)
+			index := 0
+			if indexEntry.Text != "" {
+				index, _ = strconv.Atoi(indexEntry.Text)
+			}
+
+			label := strings.TrimSpace(labelEntry.Text)
+			if label != "" {
+				if err := partition.ValidateGPTLabel(label); err != nil {
+					dialog.ShowError(err, mw.window)
+					return
+				}
+			}
+
+			var alignment uint64
+			for _, a := range partitionAlignments {
+				if a.name == alignSelect.Selected {
+					alignment = a.bytes
+				}
+			}
+
+			err := partition.CreateAlignedPartitionAt(disk.Name, size*1024*1024, partType, index, label, alignment)
 			if err != nil {
-				dialog.ShowError(err, mw.window)
+				mw.showOperationError(err)
 				return
 			}
 
-			dialog.ShowInformation("Success", "Partition created successfully", mw.window)
+			if typeSelect.Selected != otherTypeGUID {
+				rememberChoice(lastPartitionTypeKey, typeSelect.Selected)
+			}
+			showSuccess(mw.window, "Partition created successfully")
 			mw.refreshDisks()
 		}, mw.window)
+	formDialog.Show()
 }
 
 func (mw *MainWindow) showDeletePartitionDialog() {
@@ -370,6 +1039,9 @@ func (mw *MainWindow) showDeletePartitionDialog() {
 	}
 
 	disk := mw.disks[mw.selectedDisk]
+	if mw.checkRAIDMember(disk) {
+		return
+	}
 
 	if len(disk.Partitions) == 0 {
 		dialog.ShowInformation("No Partitions", "This disk has no partitions", mw.window)
@@ -378,7 +1050,7 @@ func (mw *MainWindow) showDeletePartitionDialog() {
 
 	partNames := make([]string, len(disk.Partitions))
 	for i, part := range disk.Partitions {
-		partNames[i] = fmt.Sprintf("%s (%s)", part.Name, partition.FormatBytes(part.Size*512))
+		partNames[i] = fmt.Sprintf("%s (%s)", part.Name, part.DisplaySize())
 	}
 
 	partSelect := widget.NewSelect(partNames, nil)
@@ -404,30 +1076,74 @@ func (mw *MainWindow) showDeletePartitionDialog() {
 				return
 			}
 
-			parts := strings.Split(disk.Partitions[selectedIdx].Name, "p")
-			if len(parts) < 2 {
-				dialog.ShowError(fmt.Errorf("invalid partition name"), mw.window)
+			if err := partition.CheckNotInFlight(disk.Partitions[selectedIdx].Name); err != nil {
+				dialog.ShowError(err, mw.window)
 				return
 			}
-			index := parts[len(parts)-1]
 
-			dialog.ShowConfirm("Confirm Delete",
-				fmt.Sprintf("Are you sure you want to delete partition %s?", disk.Partitions[selectedIdx].Name),
-				func(confirmed bool) {
-					if !confirmed {
-						return
-					}
+			// The index may be a slice and letter, e.g. 1a for ada0s1a
+			_, index, err := partition.ParsePartitionName(disk.Partitions[selectedIdx].Name)
+			if err != nil {
+				dialog.ShowError(err, mw.window)
+				return
+			}
 
-					err := partition.DeletePartition(disk.Name, index)
-					if err != nil {
-						dialog.ShowError(err, mw.window)
-						return
-					}
+			mw.confirmRequiredPartition(disk.Partitions[selectedIdx].Name, "delete", func() {
+				dialog.ShowConfirm("Confirm Delete",
+					fmt.Sprintf("Are you sure you want to delete partition %s?", disk.Partitions[selectedIdx].Name),
+					func(confirmed bool) {
+						if !confirmed {
+							return
+						}
+
+						err := partition.DeletePartition(disk.Name, index, false)
+						if err != nil {
+							mw.showOperationError(partition.ExplainBusyError(disk.Partitions[selectedIdx].Name, err))
+							return
+						}
+
+						showSuccess(mw.window, "Partition deleted successfully")
+						mw.refreshDisks()
+					}, mw.window)
+			})
+		}, mw.window)
+}
 
-					dialog.ShowInformation("Success", "Partition deleted successfully", mw.window)
-					mw.refreshDisks()
-				}, mw.window)
+// confirmRequiredPartition runs action straight away unless the partition
+// has the GPT required attribute. For those it first explains what depends
+// on the partition and asks for its name to be typed, so a firmware-critical
+// partition can't be deleted or formatted by clicking through dialogs.
+func (mw *MainWindow) confirmRequiredPartition(partName, verb string, action func()) {
+	warning := partition.PlatformRequiredWarning(partName, verb)
+	if warning == "" {
+		action()
+		return
+	}
+
+	warningLabel := widget.NewLabel(warning)
+	warningLabel.Wrapping = fyne.TextWrapWord
+	warningLabel.Importance = widget.DangerImportance
+	nameEntry := widget.NewEntry()
+	nameEntry.SetPlaceHolder(partName)
+
+	content := container.NewVBox(
+		warningLabel,
+		widget.NewLabel(fmt.Sprintf("Type %s to %s it anyway:", partName, verb)),
+		nameEntry,
+	)
+	confirm := dialog.NewCustomConfirm("Platform-Required Partition", strings.ToUpper(verb[:1])+verb[1:]+" Anyway", "Cancel", content,
+		func(confirmed bool) {
+			if !confirmed {
+				return
+			}
+			if nameEntry.Text != partName {
+				dialog.ShowError(fmt.Errorf("the name typed does not match %s; nothing was changed", partName), mw.window)
+				return
+			}
+			action()
 		}, mw.window)
+	confirm.Resize(fyne.NewSize(450, 250))
+	confirm.Show()
 }
 
 func (mw *MainWindow) showFormatDialog() {
@@ -436,7 +1152,11 @@ func (mw *MainWindow) showFormatDialog() {
 		return
 	}
 
-	disk := mw.disks[mw.selectedDisk]
+	diskIndex := mw.selectedDisk
+	disk := mw.disks[diskIndex]
+	if mw.checkRAIDMember(disk) {
+		return
+	}
 
 	if len(disk.Partitions) == 0 {
 		dialog.ShowInformation("No Partitions", "This disk has no partitions", mw.window)
@@ -449,21 +1169,92 @@ func (mw *MainWindow) showFormatDialog() {
 	}
 
 	partSelect := widget.NewSelect(partNames, nil)
-	fsSelect := widget.NewSelect([]string{"UFS", "FAT32", "ext2", "ext3", "ext4", "NTFS"}, nil)
-	fsSelect.SetSelected("UFS")
 
-	infoLabel := widget.NewLabel("Note: ext2/3/4 requires e2fsprogs package\nNTFS requires fusefs-ntfs package")
-	infoLabel.Wrapping = fyne.TextWrapWord
-	infoLabel.TextStyle = fyne.TextStyle{Italic: true}
+	// Only filesystems whose tools are installed can be picked; the rest
+	// are listed greyed out with how to install them
+	var fsNames []string
+	unavailable := container.NewVBox()
+	for _, support := range partition.SupportedFilesystems() {
+		if support.Available {
+			fsNames = append(fsNames, support.Name)
+			continue
+		}
+		hint := support.InstallHint
+		if hint == "" {
+			hint = support.Tool + " is missing from the base system"
+		}
+		label := widget.NewLabel(fmt.Sprintf("%s: %s", support.Name, hint))
+		label.Wrapping = fyne.TextWrapWord
+		label.Importance = widget.LowImportance
+		unavailable.Add(label)
+	}
+	if partition.CanCreateZFSPool() {
+		fsNames = append(fsNames, zfsPoolChoice)
+	}
+
+	// ZFS isn't formatted onto one partition but built as a pool from one
+	// or more, so choosing it swaps the partition picker for a pool form
+	poolNameEntry := widget.NewEntry()
+	poolNameEntry.SetPlaceHolder("e.g. tank")
+	poolNameEntry.Validator = func(text string) error {
+		if text == "" {
+			return nil
+		}
+		return partition.ValidateZFSPoolName(text)
+	}
+	layoutSelect := widget.NewSelect(partition.ZFSPoolLayouts, nil)
+	layoutSelect.SetSelected("mirror")
+	var poolCandidates []string
+	for _, d := range mw.disks {
+		for _, part := range d.Partitions {
+			if part.MountPoint == "" {
+				poolCandidates = append(poolCandidates, part.Name)
+			}
+		}
+	}
+	poolParts := widget.NewCheckGroup(poolCandidates, nil)
+	poolForm := widget.NewForm(
+		widget.NewFormItem("Pool name", poolNameEntry),
+		widget.NewFormItem("Redundancy", layoutSelect),
+		widget.NewFormItem("Partitions", container.NewVScroll(poolParts)),
+	)
+	poolForm.Hide()
+
+	volumeLabelEntry := widget.NewEntry()
+	volumeLabelEntry.SetPlaceHolder("Optional")
+	blockSizeSelect := widget.NewSelect(formatBlockSizes, nil)
+	blockSizeSelect.SetSelected(formatBlockSizes[0])
+	headerBackupCheck := widget.NewCheck(fmt.Sprintf("Save the first %d MB so the format can be undone", partition.DefaultHeaderBackupMB), nil)
+	headerBackupCheck.SetChecked(true)
+	partForm := widget.NewForm(
+		widget.NewFormItem("Partition", partSelect),
+		widget.NewFormItem("Volume label", volumeLabelEntry),
+		widget.NewFormItem("Block size", blockSizeSelect),
+		widget.NewFormItem("", headerBackupCheck),
+	)
+	fsSelect := widget.NewSelect(fsNames, func(selected string) {
+		if selected == zfsPoolChoice {
+			partForm.Hide()
+			poolForm.Show()
+		} else {
+			poolForm.Hide()
+			partForm.Show()
+		}
+	})
+	fsSelect.SetSelected(rememberedChoice(lastFilesystemKey, fsNames, "UFS"))
 
 	formContent := container.NewVBox(
-		widget.NewForm(
-			widget.NewFormItem("Partition", partSelect),
-			widget.NewFormItem("Filesystem", fsSelect),
-		),
-		widget.NewSeparator(),
-		infoLabel,
+		widget.NewForm(widget.NewFormItem("Filesystem", fsSelect)),
+		partForm,
+		poolForm,
 	)
+	if len(unavailable.Objects) > 0 {
+		infoLabel := widget.NewLabel("Not available on this system:")
+		infoLabel.TextStyle = fyne.TextStyle{Italic: true}
+		formContent.Add(widget.NewSeparator())
+		formContent.Add(infoLabel)
+		formContent.Add(unavailable)
+	}
 
 	customDialog := dialog.NewCustomConfirm("Format Partition", "Format", "Cancel", formContent,
 		func(ok bool) {
@@ -471,33 +1262,294 @@ func (mw *MainWindow) showFormatDialog() {
 				return
 			}
 
+			if fsSelect.Selected == zfsPoolChoice {
+				mw.createZFSPool(poolNameEntry.Text, poolParts.Selected, layoutSelect.Selected)
+				return
+			}
+
 			if partSelect.Selected == "" {
 				dialog.ShowError(fmt.Errorf("please select a partition"), mw.window)
 				return
 			}
 
-			dialog.ShowConfirm("Confirm Format",
-				fmt.Sprintf("Are you sure you want to format %s as %s?\n\nThis will DESTROY all data!", partSelect.Selected, fsSelect.Selected),
-				func(confirmed bool) {
-					if !confirmed {
-						return
-					}
+			if fsSelect.Selected == "" {
+				dialog.ShowError(fmt.Errorf("please select a filesystem"), mw.window)
+				return
+			}
 
-					err := partition.FormatPartition(partSelect.Selected, fsSelect.Selected)
-					if err != nil {
-						dialog.ShowError(err, mw.window)
-						return
-					}
+			if err := partition.CheckNotInFlight(partSelect.Selected); err != nil {
+				dialog.ShowError(err, mw.window)
+				return
+			}
 
-					dialog.ShowInformation("Success", fmt.Sprintf("Partition formatted successfully as %s", fsSelect.Selected), mw.window)
-					mw.refreshDisks()
-				}, mw.window)
+			opts := partition.FormatOptions{
+				Label:     strings.TrimSpace(volumeLabelEntry.Text),
+				BlockSize: formatBlockSizeBytes(blockSizeSelect.Selected),
+			}
+			if err := partition.CheckFormatOptions(fsSelect.Selected, opts); err != nil {
+				dialog.ShowError(err, mw.window)
+				return
+			}
+
+			mw.confirmRequiredPartition(partSelect.Selected, "format", func() {
+				dialog.ShowConfirm("Confirm Format",
+					fmt.Sprintf("Are you sure you want to format %s as %s?\n\nThis will DESTROY all data!", partSelect.Selected, fsSelect.Selected),
+					func(confirmed bool) {
+						if !confirmed {
+							return
+						}
+
+						target, fsType := partSelect.Selected, fsSelect.Selected
+						oldFSType := ""
+						for _, part := range disk.Partitions {
+							if part.Name == target {
+								oldFSType = part.FileSystem
+							}
+						}
+
+						progress := NewOperationProgressDialog(mw.window, fmt.Sprintf("Formatting %s", target))
+						progress.Show()
+
+						go func() {
+							var headerBackup string
+							var err error
+							if headerBackupCheck.Checked {
+								headerBackup, err = partition.FormatPartitionWithHeaderBackup(target, fsType, opts, partition.DefaultHeaderBackupMB, progress, progress)
+							} else {
+								err = partition.FormatPartitionWithLog(target, fsType, opts, false, progress, progress)
+							}
+							if err != nil {
+								err = partition.ExplainBusyError(target, err)
+								progress.Finish(err)
+								if partition.IsDiskGone(err) {
+									mw.forceRefreshDisks()
+								}
+								return
+							}
+
+							progress.Finish(nil)
+							mw.history.RecordFormat(target, oldFSType, fsType, opts, headerBackup)
+							rememberChoice(lastFilesystemKey, fsType)
+							showSuccess(mw.window, fmt.Sprintf("Partition formatted successfully as %s", fsType))
+							mw.refreshFilesystems(diskIndex, disk.Name)
+						}()
+					}, mw.window)
+			})
 		}, mw.window)
 
-	customDialog.Resize(fyne.NewSize(450, 250))
+	customDialog.Resize(fyne.NewSize(450, 350))
 	customDialog.Show()
 }
 
+// zfsPoolChoice is the format dialog's filesystem entry for ZFS pools
+const zfsPoolChoice = "ZFS (pool)"
+
+// formatBlockSizes are the block sizes offered by the format dialog, the
+// formatting tool's default first
+var formatBlockSizes = []string{"Default", "4 KB", "8 KB", "16 KB", "32 KB", "64 KB"}
+
+// formatBlockSizeBytes converts a choice from formatBlockSizes to bytes, 0
+// for the default
+func formatBlockSizeBytes(choice string) uint64 {
+	var kb uint64
+	if _, err := fmt.Sscanf(choice, "%d KB", &kb); err != nil {
+		return 0
+	}
+	return kb * 1024
+}
+
+// createZFSPool confirms and creates a ZFS pool from the format dialog
+func (mw *MainWindow) createZFSPool(poolName string, partNames []string, layout string) {
+	if err := partition.ValidateZFSPoolName(poolName); err != nil {
+		dialog.ShowError(err, mw.window)
+		return
+	}
+	if min := partition.MinZFSPoolDevices(layout); len(partNames) < min {
+		dialog.ShowError(fmt.Errorf("a %s pool needs at least %d partitions, %d selected", layout, min, len(partNames)), mw.window)
+		return
+	}
+
+	dialog.ShowConfirm("Confirm ZFS Pool",
+		fmt.Sprintf("Create the %s pool %s from %s?\n\nThis will DESTROY all data on these partitions!",
+			layout, poolName, strings.Join(partNames, ", ")),
+		func(confirmed bool) {
+			if !confirmed {
+				return
+			}
+
+			if err := partition.CreateZFSPool(poolName, partNames, layout); err != nil {
+				mw.showOperationError(err)
+				return
+			}
+
+			rememberChoice(lastFilesystemKey, zfsPoolChoice)
+			showSuccess(mw.window, fmt.Sprintf("ZFS pool %s created", poolName))
+			mw.refreshDisks()
+		}, mw.window)
+}
+
+// saveLayout writes the text rendering of a disk's layout to a file the
+// user picks
+func (mw *MainWindow) saveLayout(disk partition.Disk) {
+	saveDialog := dialog.NewFileSave(func(writer fyne.URIWriteCloser, err error) {
+		if err != nil {
+			dialog.ShowError(err, mw.window)
+			return
+		}
+		if writer == nil {
+			return
+		}
+		defer writer.Close()
+
+		if _, err := writer.Write([]byte(partition.RenderLayoutASCII(disk))); err != nil {
+			dialog.ShowError(fmt.Errorf("failed to save layout: %w", err), mw.window)
+			return
+		}
+		showSuccess(mw.window, fmt.Sprintf("Layout saved to %s", writer.URI().Path()))
+	}, mw.window)
+	saveDialog.SetFileName(disk.Name + "-layout.txt")
+	saveDialog.Show()
+}
+
+// growPartitionToFilesystem offers to grow a partition entry that is
+// smaller than the filesystem of fsSize bytes inside it
+func (mw *MainWindow) growPartitionToFilesystem(part partition.Partition, fsSize uint64) {
+	disk, index, err := partition.ParsePartitionName(part.Name)
+	if err != nil {
+		dialog.ShowError(err, mw.window)
+		return
+	}
+
+	dialog.ShowConfirm("Grow Partition to Filesystem",
+		fmt.Sprintf("The filesystem on %s is %s, but its partition entry is only %s.\n\n"+
+			"Grow the partition entry to cover the whole filesystem? Only the partition table changes; the filesystem and its data are not touched. "+
+			"The space after %s must be free.", part.Name, partition.FormatBytes(fsSize), partition.FormatBytes(part.Size*512), part.Name),
+		func(ok bool) {
+			if !ok {
+				return
+			}
+			if err := partition.GrowPartitionToFilesystem(disk, index); err != nil {
+				mw.showOperationError(err)
+				return
+			}
+			showSuccess(mw.window, fmt.Sprintf("%s now covers its filesystem", part.Name))
+			mw.refreshDisks()
+		}, mw.window)
+}
+
+// showRenameLabelDialog asks for a new GPT label for a partition and sets
+// it. Only the partition table entry changes.
+func (mw *MainWindow) showRenameLabelDialog(part partition.Partition) {
+	labelEntry := widget.NewEntry()
+	labelEntry.SetText(part.Label)
+	labelEntry.SetPlaceHolder("e.g. data0")
+	labelEntry.Validator = partition.ValidateGPTLabel
+
+	note := widget.NewLabel("The partition and its data are not changed. Entries in /etc/fstab that use the old /dev/gpt/ path must be updated.")
+	note.Wrapping = fyne.TextWrapWord
+
+	dialog.ShowForm(fmt.Sprintf("Rename %s", part.Name), "Rename", "Cancel",
+		[]*widget.FormItem{
+			widget.NewFormItem("Label", labelEntry),
+			widget.NewFormItem("", note),
+		},
+		func(ok bool) {
+			if !ok {
+				return
+			}
+
+			label := strings.TrimSpace(labelEntry.Text)
+			if label == part.Label {
+				return
+			}
+			if err := partition.SetPartitionLabel(part.Name, label); err != nil {
+				mw.showOperationError(err)
+				return
+			}
+			showSuccess(mw.window, fmt.Sprintf("%s is now labeled %s", part.Name, label))
+			mw.refreshDisks()
+		}, mw.window)
+}
+
+// showChangeTypeDialog changes the type of a partition in place and records
+// the change so it can be undone
+func (mw *MainWindow) showChangeTypeDialog(part partition.Partition) {
+	types := partition.PartitionTypeAliases()
+	typeSelect := widget.NewSelect(types, nil)
+	typeSelect.SetSelected(part.Type)
+
+	note := widget.NewLabel("The partition and its data are not changed, but booting and mounting by type follow the new type.")
+	note.Wrapping = fyne.TextWrapWord
+
+	dialog.ShowForm(fmt.Sprintf("Change Type of %s", part.Name), "Change", "Cancel",
+		[]*widget.FormItem{
+			widget.NewFormItem("Current type", widget.NewLabel(part.Type)),
+			widget.NewFormItem("New type", typeSelect),
+			widget.NewFormItem("", note),
+		},
+		func(ok bool) {
+			if !ok || typeSelect.Selected == "" || typeSelect.Selected == part.Type {
+				return
+			}
+
+			newType := typeSelect.Selected
+			if err := partition.ChangePartitionType(part.Name, newType); err != nil {
+				mw.showOperationError(err)
+				return
+			}
+			mw.history.RecordTypeChange(part.Name, part.Type, newType)
+			showSuccess(mw.window, fmt.Sprintf("%s now has type %s", part.Name, newType))
+			mw.refreshDisks()
+		}, mw.window)
+}
+
+// setSwapActive turns swap on a partition on or off. Turning it off reads
+// the pages swapped out to it back into memory, so that is confirmed first.
+func (mw *MainWindow) setSwapActive(part partition.Partition, enable bool) {
+	if enable {
+		if err := partition.EnableSwap(part.Name); err != nil {
+			mw.showOperationError(err)
+			return
+		}
+		showSuccess(mw.window, fmt.Sprintf("Swap enabled on %s", part.Name))
+		mw.refreshDisks()
+		return
+	}
+
+	dialog.ShowConfirm("Disable Swap",
+		fmt.Sprintf("Turn off swap on %s?\n\nEverything paged out to it is read back into memory first; this fails if there isn't enough free memory.", part.Name),
+		func(ok bool) {
+			if !ok {
+				return
+			}
+			if err := partition.DisableSwap(part.Name); err != nil {
+				mw.showOperationError(err)
+				return
+			}
+			showSuccess(mw.window, fmt.Sprintf("Swap disabled on %s", part.Name))
+			mw.refreshDisks()
+		}, mw.window)
+}
+
+// refreshFilesystems re-detects filesystems on one disk after a format,
+// falling back to a full refresh if the disk list changed meanwhile
+func (mw *MainWindow) refreshFilesystems(diskIndex int, diskName string) {
+	if diskIndex >= len(mw.disks) || mw.disks[diskIndex].Name != diskName {
+		mw.refreshDisks()
+		return
+	}
+
+	if err := partition.RefreshPartitionFilesystems(&mw.disks[diskIndex]); err != nil {
+		mw.refreshDisks()
+		return
+	}
+
+	mw.diskList.RefreshItem(diskIndex)
+	if mw.selectedDisk == diskIndex {
+		mw.updatePartitionView()
+	}
+}
+
 func (mw *MainWindow) showResizeDialog() {
 	if mw.selectedDisk < 0 {
 		dialog.ShowInformation("No Disk Selected", "Please select a disk first", mw.window)
@@ -505,6 +1557,9 @@ func (mw *MainWindow) showResizeDialog() {
 	}
 
 	disk := mw.disks[mw.selectedDisk]
+	if mw.checkRAIDMember(disk) {
+		return
+	}
 
 	if len(disk.Partitions) == 0 {
 		dialog.ShowInformation("No Partitions", "This disk has no partitions", mw.window)
@@ -513,7 +1568,7 @@ func (mw *MainWindow) showResizeDialog() {
 
 	partNames := make([]string, len(disk.Partitions))
 	for i, part := range disk.Partitions {
-		partNames[i] = fmt.Sprintf("%s (%s)", part.Name, partition.FormatBytes(part.Size*512))
+		partNames[i] = fmt.Sprintf("%s (%s)", part.Name, part.DisplaySize())
 	}
 
 	partSelect := widget.NewSelect(partNames, nil)
@@ -539,7 +1594,12 @@ func (mw *MainWindow) showResizeDialog() {
 				return
 			}
 
-			resizeDialog := NewResizeDialog(mw.window, &disk, &disk.Partitions[selectedIdx], mw.refreshDisks)
+			if err := partition.CheckNotInFlight(disk.Partitions[selectedIdx].Name); err != nil {
+				dialog.ShowError(err, mw.window)
+				return
+			}
+
+			resizeDialog := NewResizeDialog(mw.window, &disk, &disk.Partitions[selectedIdx], mw.history, mw.refreshDisks)
 			resizeDialog.Show()
 		}, mw.window)
 }
@@ -562,6 +1622,7 @@ func (mw *MainWindow) createColorLegend() *fyne.Container {
 		createLegendItem("UFS", "UFS"),
 		createLegendItem("ZFS", "ZFS"),
 		createLegendItem("FAT32", "FAT32"),
+		createLegendItem("exFAT", "exFAT"),
 		createLegendItem("swap", "swap"),
 		createLegendItem("ext2/3/4", "ext4"),
 		createLegendItem("NTFS", "NTFS"),
@@ -596,11 +1657,73 @@ func (mw *MainWindow) showDiskInfo() {
 	infoDialog.Show()
 }
 
+// showCompareDialog opens the side-by-side disk comparison
+func (mw *MainWindow) showCompareDialog() {
+	compareDialog := NewCompareDisksDialog(mw.window, mw.disks)
+	compareDialog.Show()
+}
+
 func (mw *MainWindow) showBatchDialog() {
-	batchDialog := NewBatchDialog(mw.window, mw.disks)
+	batchDialog := NewBatchDialog(mw.window, mw.disks, mw.batchQueue, mw.DebouncedRefresh)
 	batchDialog.Show()
 }
 
+func (mw *MainWindow) showCapacityPlanner() {
+	if mw.selectedDisk < 0 {
+		dialog.ShowInformation("No Disk Selected", "Please select a disk first", mw.window)
+		return
+	}
+
+	disk := mw.disks[mw.selectedDisk]
+	if mw.checkRAIDMember(disk) {
+		return
+	}
+
+	plannerDialog := NewCapacityPlannerDialog(mw.window, &disk, mw.batchQueue, mw.showBatchDialog)
+	plannerDialog.Show()
+}
+
+// setupBatchQueue creates the batch queue with auto-save enabled and offers
+// to recover a queue left behind by a session that didn't exit cleanly
+func (mw *MainWindow) setupBatchQueue() {
+	path, err := partition.DefaultAutoSavePath()
+	if err != nil {
+		// Without a safe place for it the queue isn't auto-saved
+		mw.batchQueue = partition.NewBatchQueue()
+		return
+	}
+
+	recovered, err := partition.RecoverBatchQueue(path)
+	if err != nil || recovered.Count() == 0 {
+		mw.batchQueue = partition.NewBatchQueue()
+		mw.batchQueue.SetAutoSavePath(path)
+		return
+	}
+
+	// Keep the saved file until the user decides
+	mw.batchQueue = recovered
+	message := fmt.Sprintf("Recover unsaved batch from last session?\n\n%d operation(s) were queued:\n", recovered.Count())
+	for _, op := range recovered.GetOperations() {
+		message += fmt.Sprintf("  • %s [%s]\n", op.Description, op.Status)
+	}
+
+	dialog.ShowConfirm("Recover Batch", message, func(ok bool) {
+		if !ok {
+			mw.batchQueue = partition.NewBatchQueue()
+		}
+		mw.batchQueue.SetAutoSavePath(path)
+		if ok {
+			mw.showBatchDialog()
+		}
+	}, mw.window)
+}
+
+// showHistoryDialog lists the operation history and lets the user undo or
+// redo up to any entry
+func (mw *MainWindow) showHistoryDialog() {
+	NewHistoryDialog(mw.window, mw.history, mw.applyUndo, mw.applyRedo, mw.refreshDisks).Show()
+}
+
 func (mw *MainWindow) performUndo() {
 	if !mw.history.CanUndo() {
 		dialog.ShowInformation("Cannot Undo", "No reversible operations to undo", mw.window)
@@ -616,8 +1739,7 @@ func (mw *MainWindow) performUndo() {
 	// Confirm undo
 	entryID := entry.ID
 	oldPos := mw.history.GetCurrentPosition()
-	dialog.ShowConfirm("Undo Operation",
-		fmt.Sprintf("Undo: %s\n\nThis will reverse the operation.", entry.Description),
+	dialog.ShowConfirm("Undo Operation", undoConfirmMessage(entry),
 		func(ok bool) {
 			if ok {
 				mw.executeUndo(entry)
@@ -629,17 +1751,49 @@ func (mw *MainWindow) performUndo() {
 		}, mw.window)
 }
 
+// undoConfirmMessage is the question asked before undoing entry
+func undoConfirmMessage(entry *partition.HistoryEntry) string {
+	if entry.UndoOperation == "restoreheader" {
+		return fmt.Sprintf("Undo: %s\n\nThis writes the saved first %d MB back to %s.\n"+
+			"Only the old filesystem's metadata at the start of the partition is restored;\n"+
+			"anything the format overwrote further in is not, so the filesystem may need\n"+
+			"fsck or recovery tools afterwards.",
+			entry.Description, partition.DefaultHeaderBackupMB, entry.Disk)
+	}
+	return fmt.Sprintf("Undo: %s\n\nThis will reverse the operation.", entry.Description)
+}
+
+// redoConfirmMessage is the question asked before redoing entry
+func redoConfirmMessage(entry *partition.HistoryEntry) string {
+	return fmt.Sprintf("Redo: %s\n\nThis will re-apply the operation.", entry.Description)
+}
+
 func (mw *MainWindow) executeUndo(entry *partition.HistoryEntry) {
+	if err := mw.applyUndo(entry); err != nil {
+		mw.showOperationError(fmt.Errorf("undo failed: %w", err))
+		// Restore the operation state
+		mw.history.RestoreReversedState(entry.ID, false)
+		mw.history.RestorePosition(mw.history.GetCurrentPosition() + 1)
+	} else {
+		showSuccess(mw.window, fmt.Sprintf("Successfully undid: %s", entry.Description))
+		mw.refreshDisks()
+	}
+}
+
+// applyUndo runs the operation that reverses entry
+func (mw *MainWindow) applyUndo(entry *partition.HistoryEntry) error {
 	var err error
 
 	switch entry.UndoOperation {
 	case "delete":
 		// Undo create by deleting the partition
-		err = partition.DeletePartition(entry.UndoDisk, entry.UndoIndex)
+		err = partition.DeletePartition(entry.UndoDisk, entry.UndoIndex, false)
 
 	case "resize":
-		// Undo resize by resizing back
-		err = partition.ResizePartition(entry.UndoDisk, entry.UndoIndex, entry.UndoSize)
+		// Undo resize by resizing back, unless the filesystem was grown with it
+		if err = entry.CheckResizeReplay(true); err == nil {
+			err = partition.ResizePartition(entry.UndoDisk, entry.UndoIndex, entry.UndoSize, false)
+		}
 
 	case "attribute":
 		// Undo attribute change by toggling back
@@ -649,19 +1803,19 @@ func (mw *MainWindow) executeUndo(entry *partition.HistoryEntry) {
 			err = partition.SetPartitionAttribute(entry.Partition, entry.AttributeName)
 		}
 
+	case "settype":
+		// Undo type change by restoring the previous type
+		err = partition.ChangePartitionType(entry.Partition, entry.OldType)
+
+	case "restoreheader":
+		// Undo format by writing back the saved start of the partition
+		err = partition.RestorePartitionHeader(entry.Disk, entry.HeaderBackup)
+
 	default:
 		err = fmt.Errorf("unknown undo operation: %s", entry.UndoOperation)
 	}
 
-	if err != nil {
-		dialog.ShowError(fmt.Errorf("undo failed: %v", err), mw.window)
-		// Restore the operation state
-		mw.history.RestoreReversedState(entry.ID, false)
-		mw.history.RestorePosition(mw.history.GetCurrentPosition() + 1)
-	} else {
-		dialog.ShowInformation("Undo Complete", fmt.Sprintf("Successfully undid: %s", entry.Description), mw.window)
-		mw.refreshDisks()
-	}
+	return err
 }
 
 func (mw *MainWindow) performRedo() {
@@ -679,8 +1833,7 @@ func (mw *MainWindow) performRedo() {
 	// Confirm redo
 	entryID := entry.ID
 	oldPos := mw.history.GetCurrentPosition()
-	dialog.ShowConfirm("Redo Operation",
-		fmt.Sprintf("Redo: %s\n\nThis will re-apply the operation.", entry.Description),
+	dialog.ShowConfirm("Redo Operation", redoConfirmMessage(entry),
 		func(ok bool) {
 			if ok {
 				mw.executeRedo(entry)
@@ -693,6 +1846,19 @@ func (mw *MainWindow) performRedo() {
 }
 
 func (mw *MainWindow) executeRedo(entry *partition.HistoryEntry) {
+	if err := mw.applyRedo(entry); err != nil {
+		mw.showOperationError(fmt.Errorf("redo failed: %w", err))
+		// Restore the operation state
+		mw.history.RestoreReversedState(entry.ID, true)
+		mw.history.RestorePosition(mw.history.GetCurrentPosition() - 1)
+	} else {
+		showSuccess(mw.window, fmt.Sprintf("Successfully redid: %s", entry.Description))
+		mw.refreshDisks()
+	}
+}
+
+// applyRedo runs entry's operation again
+func (mw *MainWindow) applyRedo(entry *partition.HistoryEntry) error {
 	var err error
 
 	switch entry.Operation {
@@ -701,8 +1867,10 @@ func (mw *MainWindow) executeRedo(entry *partition.HistoryEntry) {
 		err = partition.CreatePartition(entry.Disk, entry.Size, entry.FSType)
 
 	case "resize":
-		// Redo resize
-		err = partition.ResizePartition(entry.Disk, entry.Index, entry.Size)
+		// Redo resize, unless the filesystem was shrunk with it
+		if err = entry.CheckResizeReplay(false); err == nil {
+			err = partition.ResizePartition(entry.Disk, entry.Index, entry.Size, false)
+		}
 
 	case "attribute":
 		// Redo attribute change
@@ -712,19 +1880,20 @@ func (mw *MainWindow) executeRedo(entry *partition.HistoryEntry) {
 			err = partition.UnsetPartitionAttribute(entry.Partition, entry.AttributeName)
 		}
 
+	case "settype":
+		// Redo type change
+		err = partition.ChangePartitionType(entry.Partition, entry.NewType)
+
+	case "format":
+		// Redo format with the same options; the header backup taken the
+		// first time still holds the old filesystem's metadata
+		err = partition.FormatPartitionWithOptions(entry.Disk, entry.FSType, entry.FormatOptions, false)
+
 	default:
 		err = fmt.Errorf("unknown redo operation: %s", entry.Operation)
 	}
 
-	if err != nil {
-		dialog.ShowError(fmt.Errorf("redo failed: %v", err), mw.window)
-		// Restore the operation state
-		mw.history.RestoreReversedState(entry.ID, true)
-		mw.history.RestorePosition(mw.history.GetCurrentPosition() - 1)
-	} else {
-		dialog.ShowInformation("Redo Complete", fmt.Sprintf("Successfully redid: %s", entry.Description), mw.window)
-		mw.refreshDisks()
-	}
+	return err
 }
 
 func (mw *MainWindow) toggleBootableDialog() {
@@ -817,9 +1986,9 @@ func (mw *MainWindow) toggleBootableDialog() {
 			mw.history.RecordAttributeChange(selectedPart.Name, partition.AttrBootme, wasBootable, isBootable)
 
 			if isBootable {
-				dialog.ShowInformation("Success", fmt.Sprintf("Partition %s is now marked as BOOTABLE", selectedPart.Name), mw.window)
+				showSuccess(mw.window, fmt.Sprintf("Partition %s is now marked as BOOTABLE", selectedPart.Name))
 			} else {
-				dialog.ShowInformation("Success", fmt.Sprintf("Removed bootable flag from partition %s", selectedPart.Name), mw.window)
+				showSuccess(mw.window, fmt.Sprintf("Removed bootable flag from partition %s", selectedPart.Name))
 			}
 
 			mw.refreshDisks()
@@ -886,6 +2055,90 @@ func (mw *MainWindow) showAttributesDialog() {
 	customDialog.Show()
 }
 
+func (mw *MainWindow) showBootFallbackDialog() {
+	if mw.selectedDisk < 0 {
+		dialog.ShowInformation("No Disk Selected", "Please select a disk first", mw.window)
+		return
+	}
+
+	disk := mw.disks[mw.selectedDisk]
+	bootDialog := NewBootFallbackDialog(mw.window, &disk, mw.history, mw.refreshDisks)
+	bootDialog.Show()
+}
+
+// showPrepareDiskDialog releases everything on the selected disk after
+// confirmation, asking separately before exporting ZFS pools
+func (mw *MainWindow) showPrepareDiskDialog() {
+	if mw.selectedDisk < 0 {
+		dialog.ShowInformation("No Disk Selected", "Please select a disk first", mw.window)
+		return
+	}
+
+	diskName := mw.disks[mw.selectedDisk].Name
+
+	run := func(exportPools bool) {
+		result, err := partition.PrepareDisk(diskName, exportPools)
+		if err != nil {
+			mw.showOperationError(err)
+			return
+		}
+		mw.refreshDisks()
+		dialog.ShowInformation("Prepare Disk", result.Summary(), mw.window)
+	}
+
+	message := fmt.Sprintf("Release everything on %s so it can be modified?\n\nSwap partitions on it are turned off and mounted partitions are unmounted.", diskName)
+	dialog.ShowConfirm("Prepare Disk", message, func(ok bool) {
+		if !ok {
+			return
+		}
+
+		pools, _, err := partition.ZFSPoolsOnDisk(diskName)
+		if err != nil || len(pools) == 0 {
+			run(false)
+			return
+		}
+
+		exportMsg := fmt.Sprintf("%s holds the ZFS pool(s) %s.\n\nExport them too? Their datasets become unavailable until the pools are imported again.",
+			diskName, strings.Join(pools, ", "))
+		dialog.ShowConfirm("Export ZFS Pools", exportMsg, run, mw.window)
+	}, mw.window)
+}
+
+func (mw *MainWindow) showTuneUFSDialog() {
+	if mw.selectedDisk < 0 {
+		dialog.ShowInformation("No Disk Selected", "Please select a disk first", mw.window)
+		return
+	}
+
+	disk := mw.disks[mw.selectedDisk]
+	tuneDialog := NewTuneUFSDialog(mw.window, &disk, mw.refreshDisks)
+	tuneDialog.Show()
+}
+
+func (mw *MainWindow) showWipeDialog() {
+	if mw.selectedDisk < 0 {
+		dialog.ShowInformation("No Disk Selected", "Please select a disk first", mw.window)
+		return
+	}
+
+	disk := mw.disks[mw.selectedDisk]
+	wipeDialog := NewWipeDialog(mw.window, &disk, mw.refreshDisks)
+	wipeDialog.Show()
+}
+
+func (mw *MainWindow) showEncryptDialog() {
+	if mw.selectedDisk < 0 {
+		dialog.ShowInformation("No Disk Selected", "Please select a disk first", mw.window)
+		return
+	}
+
+	disk := mw.disks[mw.selectedDisk]
+	encryptDialog := NewEncryptDialog(mw.window, &disk, mw.refreshDisks)
+	encryptDialog.Show()
+}
+
 func (mw *MainWindow) Show() {
 	mw.window.ShowAndRun()
+	// Header backups can only be restored through this session's history
+	mw.history.Clear()
 }
@@ -0,0 +1,35 @@
+package ui
+
+import (
+	"fmt"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+	"github.com/pgsdf/pgpart/internal/partition"
+)
+
+// mountWithMkdir mounts part at mountPoint. If the mount point directory
+// doesn't exist, it asks whether to create it and mounts once it has been
+// created. done receives the outcome, including the original error when
+// the user declines.
+func mountWithMkdir(window fyne.Window, part *partition.Partition, mountPoint string, done func(error)) {
+	err := partition.MountPartition(part, mountPoint)
+	if !partition.IsMissingMountPoint(err) {
+		done(err)
+		return
+	}
+
+	dialog.ShowConfirm("Create Mount Point",
+		fmt.Sprintf("The mount point %s does not exist.\n\nCreate it and mount %s there?", mountPoint, part.Name),
+		func(confirmed bool) {
+			if !confirmed {
+				done(err)
+				return
+			}
+			if err := partition.CreateMountPoint(mountPoint); err != nil {
+				done(err)
+				return
+			}
+			done(partition.MountPartition(part, mountPoint))
+		}, window)
+}
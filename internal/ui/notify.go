@@ -0,0 +1,89 @@
+package ui
+
+import (
+	"sync"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+)
+
+// modalNotificationsKey is the preference storing whether success messages
+// use modal dialogs instead of toasts
+const modalNotificationsKey = "modalNotifications"
+
+// toastDuration is how long a toast stays on screen
+const toastDuration = 3 * time.Second
+
+var (
+	modalNotifications bool
+
+	// toastMu guards currentToast, the toast on screen, if any
+	toastMu      sync.Mutex
+	currentToast *widget.PopUp
+)
+
+// setModalNotifications chooses between modal dialogs and toasts for
+// success messages
+func setModalNotifications(modal bool) {
+	toastMu.Lock()
+	defer toastMu.Unlock()
+	modalNotifications = modal
+}
+
+// showSuccess reports a routine success. Unless the user prefers modal
+// dialogs, the message is shown as a toast that disappears on its own.
+// Errors and confirmations should keep using modal dialogs.
+func showSuccess(window fyne.Window, message string) {
+	toastMu.Lock()
+	modal := modalNotifications
+	toastMu.Unlock()
+
+	if modal {
+		dialog.ShowInformation("Success", message, window)
+		return
+	}
+	showToast(window, message)
+}
+
+// showToast shows message in the bottom-right corner of window for
+// toastDuration. A new toast replaces the one on screen.
+func showToast(window fyne.Window, message string) {
+	content := container.NewHBox(
+		widget.NewIcon(theme.ConfirmIcon()),
+		widget.NewLabel(message),
+	)
+	toast := widget.NewPopUp(content, window.Canvas())
+
+	canvasSize := window.Canvas().Size()
+	toastSize := toast.MinSize()
+	pad := theme.Padding() * 4
+	pos := fyne.NewPos(canvasSize.Width-toastSize.Width-pad, canvasSize.Height-toastSize.Height-pad)
+	if pos.X < 0 {
+		pos.X = 0
+	}
+	if pos.Y < 0 {
+		pos.Y = 0
+	}
+
+	toastMu.Lock()
+	if currentToast != nil {
+		currentToast.Hide()
+	}
+	currentToast = toast
+	toastMu.Unlock()
+
+	toast.ShowAtPosition(pos)
+
+	time.AfterFunc(toastDuration, func() {
+		toastMu.Lock()
+		defer toastMu.Unlock()
+		toast.Hide()
+		if currentToast == toast {
+			currentToast = nil
+		}
+	})
+}
@@ -3,12 +3,15 @@ package ui
 import (
 	"fmt"
 	"image/color"
+	"sort"
+	"strings"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/canvas"
 	"fyne.io/fyne/v2/container"
 	"fyne.io/fyne/v2/dialog"
 	"fyne.io/fyne/v2/driver/desktop"
+	"fyne.io/fyne/v2/layout"
 	"fyne.io/fyne/v2/widget"
 	"github.com/pgsdf/pgpart/internal/partition"
 )
@@ -24,6 +27,24 @@ type PartitionBlock struct {
 	width       float32
 	onResize    func(part *partition.Partition, newSize uint64)
 	partIndex   int
+
+	// Drag state: the size the drag currently targets and the tooltip
+	// showing it next to the handle
+	targetSize   uint64
+	overlaps     bool
+	tooltip      *widget.PopUp
+	tooltipLabel *widget.Label
+}
+
+// FreeSpaceBlock is an unpartitioned gap in the partition view. Clicking it
+// opens a dialog to create a partition in that gap.
+type FreeSpaceBlock struct {
+	widget.BaseWidget
+	region partition.FreeRegion
+	hatch  *canvas.Raster
+	rect   *canvas.Rectangle
+	label  *canvas.Text
+	onTap  func(region partition.FreeRegion)
 }
 
 type ResizeHandle struct {
@@ -32,13 +53,15 @@ type ResizeHandle struct {
 	dragging  bool
 	startX    float32
 	onDrag    func(deltaX float32)
+	onDragEnd func()
 	direction string
 }
 
-func NewResizeHandle(direction string, onDrag func(deltaX float32)) *ResizeHandle {
+func NewResizeHandle(direction string, onDrag func(deltaX float32), onDragEnd func()) *ResizeHandle {
 	h := &ResizeHandle{
 		direction: direction,
 		onDrag:    onDrag,
+		onDragEnd: onDragEnd,
 	}
 	h.ExtendBaseWidget(h)
 	return h
@@ -68,6 +91,9 @@ func (h *ResizeHandle) Dragged(e *fyne.DragEvent) {
 
 func (h *ResizeHandle) DragEnd() {
 	h.dragging = false
+	if h.onDragEnd != nil {
+		h.onDragEnd()
+	}
 }
 
 func (h *ResizeHandle) Cursor() desktop.Cursor {
@@ -84,7 +110,7 @@ func (r *resizeHandleRenderer) Layout(size fyne.Size) {
 }
 
 func (r *resizeHandleRenderer) MinSize() fyne.Size {
-	return fyne.NewSize(8, 40)
+	return fyne.NewSize(handleWidth, 40)
 }
 
 func (r *resizeHandleRenderer) Refresh() {
@@ -101,15 +127,53 @@ type InteractivePartitionView struct {
 	widget.BaseWidget
 	disk      *partition.Disk
 	blocks    []*PartitionBlock
+	gaps      []*FreeSpaceBlock
 	container *fyne.Container
 	window    fyne.Window
+	history   *partition.OperationHistory
 	onRefresh func()
+
+	// pending maps partition names to staged sizes in sectors. It is owned
+	// by the caller so staged resizes survive the view being rebuilt.
+	pending      map[string]uint64
+	pendingLabel *widget.Label
+	pendingBar   *fyne.Container
+
+	// sectorWidth is the width in pixels of one sector in the last layout,
+	// used to follow a drag at the same scale
+	sectorWidth float32
 }
 
-func NewInteractivePartitionView(disk *partition.Disk, window fyne.Window, onRefresh func()) *InteractivePartitionView {
+// pendingStrokeColor outlines partitions with a staged resize
+var pendingStrokeColor = color.RGBA{R: 255, G: 165, B: 0, A: 255}
+
+// freeSpaceColor fills the blocks of unpartitioned gaps
+var freeSpaceColor = color.RGBA{R: 200, G: 200, B: 200, A: 255}
+
+// freeSpaceHatchColor draws the diagonal hatching over free space
+var freeSpaceHatchColor = color.RGBA{R: 170, G: 170, B: 170, A: 255}
+
+// viewWidth is the width in pixels of the whole disk in the view
+const viewWidth float32 = 600
+
+// minBlockWidth is the narrowest a partition or gap is drawn, so small
+// ones stay visible and clickable
+const minBlockWidth float32 = 40
+
+// handleWidth is the width of the resize handles on either side of a
+// partition block
+const handleWidth float32 = 8
+
+// minFreeBlockSectors is the smallest gap the view shows, in 512-byte
+// units; smaller gaps are alignment padding
+const minFreeBlockSectors = 2048
+
+func NewInteractivePartitionView(disk *partition.Disk, window fyne.Window, history *partition.OperationHistory, pending map[string]uint64, onRefresh func()) *InteractivePartitionView {
 	view := &InteractivePartitionView{
 		disk:      disk,
 		window:    window,
+		history:   history,
+		pending:   pending,
 		onRefresh: onRefresh,
 	}
 	view.ExtendBaseWidget(view)
@@ -119,8 +183,9 @@ func NewInteractivePartitionView(disk *partition.Disk, window fyne.Window, onRef
 
 func (v *InteractivePartitionView) buildBlocks() {
 	v.blocks = []*PartitionBlock{}
+	v.gaps = nil
 
-	if v.disk == nil || len(v.disk.Partitions) == 0 {
+	if v.disk == nil {
 		return
 	}
 
@@ -128,6 +193,55 @@ func (v *InteractivePartitionView) buildBlocks() {
 		block := v.createPartitionBlock(&v.disk.Partitions[i], i)
 		v.blocks = append(v.blocks, block)
 	}
+
+	// Without a partition table there is no free space to create in
+	if v.disk.Scheme == "" {
+		return
+	}
+	regions, err := partition.GetFreeSpace(v.disk.Name)
+	if err != nil {
+		return
+	}
+	for _, region := range regions {
+		if region.Size >= minFreeBlockSectors {
+			v.gaps = append(v.gaps, v.createFreeSpaceBlock(region))
+		}
+	}
+}
+
+// createFreeSpaceBlock creates the block of a free region
+func (v *InteractivePartitionView) createFreeSpaceBlock(region partition.FreeRegion) *FreeSpaceBlock {
+	block := &FreeSpaceBlock{
+		region: region,
+		onTap:  v.createInGap,
+	}
+
+	block.hatch = canvas.NewRasterWithPixels(func(x, y, w, h int) color.Color {
+		if (x+y)%8 < 2 {
+			return freeSpaceHatchColor
+		}
+		return freeSpaceColor
+	})
+	block.rect = canvas.NewRectangle(color.Transparent)
+	block.rect.StrokeColor = color.RGBA{R: 150, G: 150, B: 150, A: 255}
+	block.rect.StrokeWidth = 1
+
+	block.label = canvas.NewText(partition.FormatBytes(region.Bytes())+" free", color.RGBA{R: 60, G: 60, B: 60, A: 255})
+	block.label.TextSize = 10
+	block.label.Alignment = fyne.TextAlignCenter
+
+	block.ExtendBaseWidget(block)
+	return block
+}
+
+// createInGap opens the dialog for creating a partition in a clicked gap
+func (v *InteractivePartitionView) createInGap(region partition.FreeRegion) {
+	if len(v.pendingPartitions()) > 0 {
+		dialog.ShowInformation("Pending Changes",
+			"Apply or discard the pending resizes before creating a partition; they may need this free space.", v.window)
+		return
+	}
+	NewGapCreateDialog(v.window, v.disk, region, v.onRefresh).Show()
 }
 
 func (v *InteractivePartitionView) createPartitionBlock(part *partition.Partition, index int) *PartitionBlock {
@@ -143,69 +257,304 @@ func (v *InteractivePartitionView) createPartitionBlock(part *partition.Partitio
 	block.rect.StrokeColor = color.RGBA{R: 50, G: 50, B: 50, A: 255}
 	block.rect.StrokeWidth = 1
 
-	sizeStr := partition.FormatBytes(part.Size * 512)
-	block.label = canvas.NewText(sizeStr, color.White)
+	block.label = canvas.NewText(lockMark(part)+part.DisplaySize(), color.White)
 	block.label.TextSize = 10
 	block.label.Alignment = fyne.TextAlignCenter
 
 	return block
 }
 
+// lockMark returns a lock to put in front of the size of a GELI-encrypted
+// partition's block, and "" for other partitions
+func lockMark(part *partition.Partition) string {
+	if partition.IsGELIProvider(part) {
+		return "🔒 "
+	}
+	return ""
+}
+
+// handleResize stages a resize made by dragging. Nothing is written to the
+// disk until the pending changes are applied.
 func (v *InteractivePartitionView) handleResize(part *partition.Partition, newSize uint64) {
-	sizeStr := partition.FormatBytes(newSize * 512)
+	if err := partition.CheckZFSShrink(part, newSize*512); err != nil {
+		dialog.ShowError(err, v.window)
+		v.refreshBlocks()
+		return
+	}
+
+	if newSize == part.Size {
+		delete(v.pending, part.Name)
+	} else {
+		v.pending[part.Name] = newSize
+	}
+	v.refreshBlocks()
+}
+
+// currentSize returns the staged size of a partition in sectors, or its
+// size on disk if no resize is pending
+func (v *InteractivePartitionView) currentSize(part *partition.Partition) uint64 {
+	if size, ok := v.pending[part.Name]; ok {
+		return size
+	}
+	return part.Size
+}
+
+// pendingPartitions returns the partitions of this disk with a staged
+// resize, in the order they are safe to apply: shrinks before grows, each
+// by position on disk
+func (v *InteractivePartitionView) pendingPartitions() []*partition.Partition {
+	var shrinks, grows []*partition.Partition
+	for i := range v.disk.Partitions {
+		part := &v.disk.Partitions[i]
+		size, ok := v.pending[part.Name]
+		if !ok {
+			continue
+		}
+		if size == part.Size {
+			// Already applied, e.g. by another tool before a refresh
+			delete(v.pending, part.Name)
+			continue
+		}
+		if size < part.Size {
+			shrinks = append(shrinks, part)
+		} else {
+			grows = append(grows, part)
+		}
+	}
+
+	byStart := func(parts []*partition.Partition) {
+		sort.Slice(parts, func(i, j int) bool { return parts[i].Start < parts[j].Start })
+	}
+	byStart(shrinks)
+	byStart(grows)
+	return append(shrinks, grows...)
+}
+
+// describePending returns one line per staged resize
+func (v *InteractivePartitionView) describePending(parts []*partition.Partition) string {
+	lines := make([]string, len(parts))
+	for i, part := range parts {
+		lines[i] = fmt.Sprintf("%s: %s → %s", part.Name,
+			partition.FormatBytes(part.Size*512), partition.FormatBytes(v.pending[part.Name]*512))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// refreshBlocks redraws every block at its staged size and shows the
+// Apply/Discard bar while resizes are pending
+func (v *InteractivePartitionView) refreshBlocks() {
+	v.layoutWidths()
+
+	for _, block := range v.blocks {
+		part := block.partition
+		size := v.currentSize(part)
+		width := block.width
+
+		block.rect.FillColor = getPartitionColor(part.FileSystem)
+		if _, staged := v.pending[part.Name]; staged {
+			block.rect.StrokeColor = pendingStrokeColor
+			block.rect.StrokeWidth = 3
+			block.label.Text = fmt.Sprintf("%s%s → %s", lockMark(part), part.DisplaySize(), partition.FormatBytes(size*512))
+		} else {
+			block.rect.StrokeColor = color.RGBA{R: 50, G: 50, B: 50, A: 255}
+			block.rect.StrokeWidth = 1
+			block.label.Text = lockMark(part) + part.DisplaySize()
+		}
+		block.rect.SetMinSize(fyne.NewSize(width, 60))
+		block.rect.Refresh()
+		block.label.Refresh()
+	}
+
+	if v.pendingBar == nil {
+		return
+	}
+
+	parts := v.pendingPartitions()
+	if len(parts) == 0 {
+		v.pendingBar.Hide()
+		return
+	}
+	v.pendingLabel.SetText(fmt.Sprintf("%d pending change(s) - not yet written to disk", len(parts)))
+	v.pendingBar.Show()
+}
+
+// layoutWidths sizes the partitions, at their staged sizes, and the gaps
+// in proportion to the sectors they cover so that together they span the
+// view, as they span the disk
+func (v *InteractivePartitionView) layoutWidths() {
+	sizes := make([]uint64, 0, len(v.blocks)+len(v.gaps))
+	for _, block := range v.blocks {
+		if block.partition.SizeUnknown {
+			sizes = append(sizes, 0)
+		} else {
+			sizes = append(sizes, v.currentSize(block.partition))
+		}
+	}
+	for _, gap := range v.gaps {
+		sizes = append(sizes, gap.region.Size)
+	}
+
+	widths, sectorWidth := fitBlockWidths(sizes, viewWidth, minBlockWidth)
+	v.sectorWidth = sectorWidth
+	for i, block := range v.blocks {
+		// The handles take their share of the block's width
+		block.width = widths[i] - 2*handleWidth
+	}
+	for i, gap := range v.gaps {
+		gap.rect.SetMinSize(fyne.NewSize(widths[len(v.blocks)+i], 60))
+	}
+}
+
+// fitBlockWidths divides totalWidth among blocks of the given sizes in
+// sectors, in proportion to their sizes but no narrower than minWidth.
+// Sizes of 0, for unknown sizes, get minWidth. The widths add up to
+// totalWidth unless there are too many blocks to fit at minWidth. It also
+// returns the width of one sector among the blocks that aren't held at
+// the minimum.
+func fitBlockWidths(sizes []uint64, totalWidth, minWidth float32) ([]float32, float32) {
+	widths := make([]float32, len(sizes))
+	atMinimum := make([]bool, len(sizes))
+
+	// Blocks too small for their share are held at the minimum, which
+	// shrinks everyone else's share; repeat until no more fall below it
+	var sectorWidth float32
+	for {
+		var sectors uint64
+		available := totalWidth
+		for i, size := range sizes {
+			if atMinimum[i] || size == 0 {
+				atMinimum[i] = true
+				available -= minWidth
+			} else {
+				sectors += size
+			}
+		}
+		if sectors == 0 || available <= 0 {
+			sectorWidth = 0
+			break
+		}
 
-	dialog.ShowConfirm("Resize Partition",
-		fmt.Sprintf("Resize partition %s to %s?\n\nWARNING: This operation may result in data loss!\nMake sure you have backups before proceeding.", part.Name, sizeStr),
+		sectorWidth = available / float32(sectors)
+		changed := false
+		for i, size := range sizes {
+			if !atMinimum[i] && float32(size)*sectorWidth < minWidth {
+				atMinimum[i] = true
+				changed = true
+			}
+		}
+		if !changed {
+			break
+		}
+	}
+
+	for i, size := range sizes {
+		if atMinimum[i] {
+			widths[i] = minWidth
+		} else {
+			widths[i] = float32(size) * sectorWidth
+		}
+	}
+	return widths, sectorWidth
+}
+
+// applyChanges writes the staged resizes to disk after confirmation,
+// stopping at the first failure. Changes that were not applied stay pending.
+func (v *InteractivePartitionView) applyChanges() {
+	parts := v.pendingPartitions()
+	if len(parts) == 0 {
+		return
+	}
+
+	dialog.ShowConfirm("Apply Changes",
+		fmt.Sprintf("Apply %d pending resize(s) to %s?\n\n%s\n\nWARNING: This operation may result in data loss!\nMake sure you have backups before proceeding.",
+			len(parts), v.disk.Name, v.describePending(parts)),
 		func(confirmed bool) {
 			if !confirmed {
-				v.onRefresh()
 				return
 			}
 
-			parts := []string{}
-			for _, p := range part.Name {
-				if p >= '0' && p <= '9' {
-					parts = append(parts, string(p))
+			for applied, part := range parts {
+				newSize := v.pending[part.Name]
+				_, index, err := partition.ParsePartitionName(part.Name)
+				fsResized := false
+				if err == nil {
+					fsResized, err = partition.ResizeWithFilesystem(v.disk.Name, index, newSize*512, part)
+				}
+				if err != nil {
+					dialog.ShowError(fmt.Errorf("resize of %s failed: %w\n\n%d earlier change(s) were applied; the remaining changes are still pending", part.Name, err, applied), v.window)
+					v.onRefresh()
+					return
 				}
-			}
-
-			index := ""
-			if len(parts) > 0 {
-				index = parts[len(parts)-1]
-			}
 
-			err := partition.ResizePartition(v.disk.Name, index, newSize*512)
-			if err != nil {
-				dialog.ShowError(fmt.Errorf("resize failed: %w", err), v.window)
-			} else {
-				dialog.ShowInformation("Success", "Partition resized successfully", v.window)
+				if v.history != nil {
+					v.history.RecordResize(v.disk.Name, index, part.Size*512, newSize*512, fsResized)
+				}
+				delete(v.pending, part.Name)
 			}
 
+			showSuccess(v.window, fmt.Sprintf("%d partition(s) resized successfully", len(parts)))
 			v.onRefresh()
 		}, v.window)
 }
 
-func (v *InteractivePartitionView) CreateRenderer() fyne.WidgetRenderer {
-	v.container = container.NewHBox()
+// discardChanges drops the staged resizes of this disk
+func (v *InteractivePartitionView) discardChanges() {
+	for _, part := range v.pendingPartitions() {
+		delete(v.pending, part.Name)
+	}
+	v.refreshBlocks()
+}
 
-	if len(v.blocks) == 0 {
-		emptyRect := canvas.NewRectangle(color.RGBA{R: 200, G: 200, B: 200, A: 255})
-		emptyRect.SetMinSize(fyne.NewSize(600, 60))
+func (v *InteractivePartitionView) CreateRenderer() fyne.WidgetRenderer {
+	v.container = container.New(&blockRowLayout{})
+
+	v.pendingLabel = widget.NewLabel("")
+	discardBtn := widget.NewButton("Discard", v.discardChanges)
+	applyBtn := widget.NewButton("Apply Changes", v.applyChanges)
+	applyBtn.Importance = widget.HighImportance
+	v.pendingBar = container.NewHBox(v.pendingLabel, layout.NewSpacer(), discardBtn, applyBtn)
+	v.refreshBlocks()
+
+	if len(v.blocks) == 0 && len(v.gaps) == 0 {
+		emptyRect := canvas.NewRectangle(freeSpaceColor)
+		emptyRect.SetMinSize(fyne.NewSize(viewWidth, 60))
 		v.container.Add(emptyRect)
 	} else {
+		// Partitions and gaps are laid out in disk order
+		type item struct {
+			start  uint64
+			object fyne.CanvasObject
+		}
+		var items []item
 		for _, block := range v.blocks {
-			width := float32(600) * float32(block.partition.Size) / float32(v.disk.Size)
-			if width < 40 {
-				width = 40
-			}
-			block.width = width
-
-			blockContainer := v.createBlockWithHandles(block, width)
-			v.container.Add(blockContainer)
+			items = append(items, item{block.partition.Start, v.createBlockWithHandles(block, block.width)})
+		}
+		for _, gap := range v.gaps {
+			items = append(items, item{gap.region.Start, gap})
+		}
+		sort.SliceStable(items, func(i, j int) bool { return items[i].start < items[j].start })
+		for _, it := range items {
+			v.container.Add(it.object)
 		}
 	}
 
-	return widget.NewSimpleRenderer(v.container)
+	return widget.NewSimpleRenderer(container.NewVBox(v.container, v.pendingBar))
+}
+
+func (b *FreeSpaceBlock) CreateRenderer() fyne.WidgetRenderer {
+	return widget.NewSimpleRenderer(container.NewStack(b.hatch, b.rect, container.NewCenter(b.label)))
+}
+
+// Tapped opens the create dialog for the gap
+func (b *FreeSpaceBlock) Tapped(*fyne.PointEvent) {
+	if b.onTap != nil {
+		b.onTap(b.region)
+	}
+}
+
+// Cursor shows that the gap can be clicked
+func (b *FreeSpaceBlock) Cursor() desktop.Cursor {
+	return desktop.PointerCursor
 }
 
 func (v *InteractivePartitionView) createBlockWithHandles(block *PartitionBlock, width float32) *fyne.Container {
@@ -213,59 +562,186 @@ func (v *InteractivePartitionView) createBlockWithHandles(block *PartitionBlock,
 
 	partContainer := container.NewStack(block.rect, container.NewCenter(block.label))
 
-	leftHandle := NewResizeHandle("left", func(deltaX float32) {
-		v.handleDrag(block, deltaX, true)
+	var leftHandle, rightHandle *ResizeHandle
+	leftHandle = NewResizeHandle("left", func(deltaX float32) {
+		v.handleDrag(block, leftHandle, deltaX, true)
+	}, func() {
+		v.handleDragEnd(block)
 	})
 
-	rightHandle := NewResizeHandle("right", func(deltaX float32) {
-		v.handleDrag(block, deltaX, false)
+	rightHandle = NewResizeHandle("right", func(deltaX float32) {
+		v.handleDrag(block, rightHandle, deltaX, false)
+	}, func() {
+		v.handleDragEnd(block)
 	})
 
 	block.leftHandle = leftHandle
 	block.rightHandle = rightHandle
 
-	return container.NewBorder(nil, nil, leftHandle, rightHandle, partContainer)
+	return container.New(&blockRowLayout{}, leftHandle, partContainer, rightHandle)
 }
 
-func (v *InteractivePartitionView) handleDrag(block *PartitionBlock, deltaX float32, isLeft bool) {
-	pixelsPerSector := float32(600) / float32(v.disk.Size)
-	sectorDelta := uint64(deltaX / pixelsPerSector)
+// blockRowLayout places objects side by side at their minimum widths with
+// no padding between them, so the blocks of a disk line up with the
+// sectors they cover
+type blockRowLayout struct{}
+
+// Layout places the objects left to right at the full height
+func (l *blockRowLayout) Layout(objects []fyne.CanvasObject, size fyne.Size) {
+	x := float32(0)
+	for _, obj := range objects {
+		if !obj.Visible() {
+			continue
+		}
+		width := obj.MinSize().Width
+		obj.Move(fyne.NewPos(x, 0))
+		obj.Resize(fyne.NewSize(width, size.Height))
+		x += width
+	}
+}
 
-	var newSize uint64
-	if isLeft {
-		if sectorDelta > block.partition.Size {
-			newSize = block.partition.Size / 2
-		} else {
-			newSize = block.partition.Size - sectorDelta
+// MinSize is the sum of the minimum widths by the tallest minimum height
+func (l *blockRowLayout) MinSize(objects []fyne.CanvasObject) fyne.Size {
+	var size fyne.Size
+	for _, obj := range objects {
+		if !obj.Visible() {
+			continue
+		}
+		min := obj.MinSize()
+		size.Width += min.Width
+		if min.Height > size.Height {
+			size.Height = min.Height
 		}
-	} else {
-		newSize = block.partition.Size + sectorDelta
 	}
+	return size
+}
 
-	minSize := uint64(1024 * 1024 * 10 / 512)
-	if newSize < minSize {
-		newSize = minSize
+// blockWidth returns the width in pixels of a block of sectors on disk in a
+// view totalWidth wide, never less than minWidth. Zero sizes, including an
+// unknown disk size, get the minimum width.
+func blockWidth(disk *partition.Disk, sectors uint64, totalWidth, minWidth float32) float32 {
+	diskSectors := disk.Size / 512
+	if sectors == 0 || diskSectors == 0 {
+		return minWidth
+	}
+	if sectors > diskSectors {
+		sectors = diskSectors
+	}
+
+	width := totalWidth * float32(sectors) / float32(diskSectors)
+	if width < minWidth {
+		width = minWidth
+	}
+	return width
+}
+
+func (v *InteractivePartitionView) handleDrag(block *PartitionBlock, handle *ResizeHandle, deltaX float32, isLeft bool) {
+	// Without a trustworthy size there is nothing to resize from
+	diskSectors := v.disk.Size / 512
+	if block.partition.SizeUnknown || block.partition.Size == 0 || diskSectors == 0 {
+		return
 	}
 
+	// Partitions held by a copy or move can't be resized until it finishes
+	if _, busy := partition.InFlightOperationFor(block.partition.Name); busy {
+		return
+	}
+
+	pixelsPerSector := v.sectorWidth
+	if pixelsPerSector == 0 {
+		pixelsPerSector = viewWidth / float32(diskSectors)
+	}
+	sectorDelta := int64(deltaX / pixelsPerSector)
+	if isLeft {
+		// Dragging the left edge to the right shrinks the partition
+		sectorDelta = -sectorDelta
+	}
+
+	minSize := partition.MinimumSizeForPartition(block.partition) / 512
 	maxSize := v.calculateMaxSize(block)
-	if newSize > maxSize {
-		newSize = maxSize
+
+	newSize := minSize
+	if target := int64(v.currentSize(block.partition)) + sectorDelta; target > int64(minSize) {
+		newSize = uint64(target)
 	}
 
-	newWidth := float32(600) * float32(newSize) / float32(v.disk.Size)
-	if newWidth < 40 {
-		newWidth = 40
+	// Past the maximum the partition would overlap its neighbor; the size
+	// is still shown so the user can see how far over they are
+	block.overlaps = newSize > maxSize
+	block.targetSize = newSize
+
+	newWidth := float32(newSize)*pixelsPerSector - 2*handleWidth
+	if newWidth < minBlockWidth-2*handleWidth {
+		newWidth = minBlockWidth - 2*handleWidth
 	}
 
+	if block.overlaps {
+		block.rect.FillColor = color.RGBA{R: 220, G: 50, B: 50, A: 255}
+	} else {
+		block.rect.FillColor = getPartitionColor(block.partition.FileSystem)
+	}
 	block.rect.SetMinSize(fyne.NewSize(newWidth, 60))
-	block.label.Text = partition.FormatBytes(newSize * 512)
+	block.rect.Refresh()
+	block.label.Text = lockMark(block.partition) + partition.FormatBytes(newSize*512)
 	block.label.Refresh()
 
-	block.partition.Size = newSize
+	v.showDragTooltip(block, handle, newSize, minSize, maxSize)
+}
+
+// showDragTooltip shows the target size and limits next to the dragged handle
+func (v *InteractivePartitionView) showDragTooltip(block *PartitionBlock, handle *ResizeHandle, newSize, minSize, maxSize uint64) {
+	text := fmt.Sprintf("Target: %s\nMin: %s  Max: %s",
+		partition.FormatBytes(newSize*512),
+		partition.FormatBytes(minSize*512),
+		partition.FormatBytes(maxSize*512))
+	if block.overlaps {
+		text += "\nOverlaps the next partition"
+	}
+
+	if block.tooltip == nil {
+		block.tooltipLabel = widget.NewLabel(text)
+		block.tooltip = widget.NewPopUp(block.tooltipLabel, v.window.Canvas())
+	} else {
+		block.tooltipLabel.SetText(text)
+	}
+
+	pos := fyne.CurrentApp().Driver().AbsolutePositionForObject(handle)
+	block.tooltip.ShowAtPosition(pos.Add(fyne.NewPos(handle.Size().Width+4, handle.Size().Height)))
+}
+
+// handleDragEnd hides the tooltip and asks to apply the resize, unless the
+// new size would overlap a neighbor
+func (v *InteractivePartitionView) handleDragEnd(block *PartitionBlock) {
+	if block.tooltip != nil {
+		block.tooltip.Hide()
+	}
+
+	newSize := block.targetSize
+	overlaps := block.overlaps
+	block.targetSize = 0
+	block.overlaps = false
+
+	if newSize == 0 || newSize == v.currentSize(block.partition) {
+		return
+	}
+
+	if overlaps {
+		dialog.ShowError(fmt.Errorf("%s cannot grow to %s without overlapping the next partition", block.partition.Name, partition.FormatBytes(newSize*512)), v.window)
+		v.refreshBlocks()
+		return
+	}
+
+	if block.onResize != nil {
+		block.onResize(block.partition, newSize)
+	}
 }
 
 func (v *InteractivePartitionView) calculateMaxSize(block *PartitionBlock) uint64 {
-	maxSize := v.disk.Size - block.partition.Start
+	diskSectors := v.disk.Size / 512
+	if block.partition.Start >= diskSectors {
+		return block.partition.Size
+	}
+	maxSize := diskSectors - block.partition.Start
 
 	for _, p := range v.disk.Partitions {
 		if p.Start > block.partition.Start && p.Start < block.partition.Start+maxSize {
@@ -0,0 +1,252 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+	"github.com/pgsdf/pgpart/internal/partition"
+)
+
+// plannerRow is one proposed partition in the planner
+type plannerRow struct {
+	typeSelect *widget.Select
+	sizeEntry  *widget.Entry
+}
+
+// CapacityPlannerDialog lets the user lay out proposed partitions against a
+// disk's free space without touching the disk, then queue them as a batch.
+// In multi-create mode the planned partitions are created immediately instead.
+type CapacityPlannerDialog struct {
+	window    fyne.Window
+	disk      *partition.Disk
+	queue     *partition.BatchQueue
+	onAccept  func()
+	createNow bool
+	alignment uint64
+	rows      []*plannerRow
+	rowBox    *fyne.Container
+	summary   *widget.Label
+	plan      *partition.LayoutPlan
+}
+
+// NewCapacityPlannerDialog creates a new capacity planner for disk. Accepted
+// plans are added to queue and onAccept is called.
+func NewCapacityPlannerDialog(window fyne.Window, disk *partition.Disk, queue *partition.BatchQueue, onAccept func()) *CapacityPlannerDialog {
+	return &CapacityPlannerDialog{
+		window:   window,
+		disk:     disk,
+		queue:    queue,
+		onAccept: onAccept,
+	}
+}
+
+// NewMultiCreateDialog creates a planner that creates all planned partitions
+// on disk in order as soon as it is accepted. onCreated is called afterwards,
+// even if some partitions failed, so the caller can rescan the disk.
+func NewMultiCreateDialog(window fyne.Window, disk *partition.Disk, onCreated func()) *CapacityPlannerDialog {
+	return &CapacityPlannerDialog{
+		window:    window,
+		disk:      disk,
+		queue:     partition.NewBatchQueue(),
+		onAccept:  onCreated,
+		createNow: true,
+	}
+}
+
+// Show displays the capacity planner dialog
+func (pd *CapacityPlannerDialog) Show() {
+	pd.alignment = partition.GetOptimalAlignment(pd.disk.Name)
+
+	header := widget.NewLabel(fmt.Sprintf("Plan partitions on %s (%s)", pd.disk.Name, partition.FormatBytes(pd.disk.Size)))
+	header.TextStyle = fyne.TextStyle{Bold: true}
+
+	helpLabel := widget.NewLabel("Sizes accept K/M/G/T suffixes (plain numbers are MB) or a percentage of the free space, e.g. 32G or 25%.")
+	helpLabel.Wrapping = fyne.TextWrapWord
+	helpLabel.TextStyle = fyne.TextStyle{Italic: true}
+
+	pd.rowBox = container.NewVBox()
+	pd.summary = widget.NewLabel("")
+	pd.summary.Wrapping = fyne.TextWrapWord
+
+	addBtn := widget.NewButtonWithIcon("Add Partition", theme.ContentAddIcon(), func() {
+		pd.addRow("freebsd-ufs", "")
+	})
+
+	pd.addRow("freebsd-ufs", "")
+
+	content := container.NewBorder(
+		container.NewVBox(header, helpLabel, widget.NewSeparator()),
+		container.NewVBox(addBtn, widget.NewSeparator(), pd.summary),
+		nil,
+		nil,
+		container.NewVScroll(pd.rowBox),
+	)
+
+	title, confirm := "Capacity Planner", "Add to Batch Queue"
+	if pd.createNow {
+		title, confirm = "Create Multiple Partitions", "Create All"
+	}
+
+	customDialog := dialog.NewCustomConfirm(title, confirm, "Close", content,
+		func(ok bool) {
+			if ok {
+				pd.accept()
+			}
+		}, pd.window)
+
+	customDialog.Resize(fyne.NewSize(600, 500))
+	customDialog.Show()
+}
+
+// addRow appends a proposed partition row
+func (pd *CapacityPlannerDialog) addRow(partType, size string) {
+	row := &plannerRow{}
+	row.typeSelect = widget.NewSelect(partition.PartitionTypeAliases(), func(string) { pd.update() })
+	row.sizeEntry = widget.NewEntry()
+	row.sizeEntry.SetPlaceHolder("32G or 25%")
+	row.sizeEntry.SetText(size)
+	row.sizeEntry.OnChanged = func(string) { pd.update() }
+
+	var rowContainer *fyne.Container
+	removeBtn := widget.NewButtonWithIcon("", theme.DeleteIcon(), func() {
+		for i, r := range pd.rows {
+			if r == row {
+				pd.rows = append(pd.rows[:i], pd.rows[i+1:]...)
+				break
+			}
+		}
+		pd.rowBox.Remove(rowContainer)
+		pd.update()
+	})
+
+	rowContainer = container.NewBorder(nil, nil, nil, removeBtn,
+		container.NewGridWithColumns(2, row.typeSelect, row.sizeEntry))
+
+	pd.rows = append(pd.rows, row)
+	pd.rowBox.Add(rowContainer)
+	row.typeSelect.SetSelected(partType)
+	pd.update()
+}
+
+// update recalculates the plan and refreshes the summary
+func (pd *CapacityPlannerDialog) update() {
+	pd.plan = nil
+
+	var planned []partition.PlannedPartition
+	var problems []string
+	for i, row := range pd.rows {
+		if row.typeSelect == nil || row.sizeEntry == nil {
+			return
+		}
+		if strings.TrimSpace(row.sizeEntry.Text) == "" {
+			problems = append(problems, fmt.Sprintf("Partition %d: enter a size", i+1))
+			continue
+		}
+
+		size, percent, err := partition.ParsePlanSize(row.sizeEntry.Text)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("Partition %d: %v", i+1, err))
+			continue
+		}
+
+		planned = append(planned, partition.PlannedPartition{
+			Type:    row.typeSelect.Selected,
+			Size:    size,
+			Percent: percent,
+		})
+	}
+
+	if len(problems) > 0 || len(planned) == 0 {
+		if len(planned) == 0 && len(problems) == 0 {
+			problems = append(problems, "Add at least one partition")
+		}
+		pd.summary.SetText(strings.Join(problems, "\n"))
+		return
+	}
+
+	plan := partition.PlanLayout(pd.disk, pd.alignment, planned)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Free space: %s starting at %s (alignment %s)\n",
+		partition.FormatBytes(plan.FreeBytes), partition.FormatBytes(plan.FreeStart), partition.FormatBytes(plan.Alignment))
+
+	var total uint64
+	for i, entry := range plan.Entries {
+		total += entry.Bytes
+		fmt.Fprintf(&b, "%d. %s %s at offset %s", i+1, partition.FormatBytes(entry.Bytes), entry.Type, partition.FormatBytes(entry.Start))
+		if entry.Padding > 0 {
+			fmt.Fprintf(&b, " (aligned, %s skipped)", partition.FormatBytes(entry.Padding))
+		} else {
+			b.WriteString(" (aligned)")
+		}
+		fmt.Fprintf(&b, " - running total %s\n", partition.FormatBytes(total))
+	}
+
+	fmt.Fprintf(&b, "Remaining: %s", partition.FormatBytes(plan.Remaining))
+	for _, warning := range plan.Warnings {
+		fmt.Fprintf(&b, "\n⚠ %s", warning)
+	}
+
+	pd.summary.SetText(b.String())
+	pd.plan = plan
+}
+
+// accept adds the plan to the batch queue
+func (pd *CapacityPlannerDialog) accept() {
+	if pd.plan == nil {
+		dialog.ShowError(fmt.Errorf("the plan is incomplete:\n%s", pd.summary.Text), pd.window)
+		return
+	}
+
+	if pd.plan.Overflow {
+		dialog.ShowError(fmt.Errorf("the plan does not fit in the free space on %s", pd.disk.Name), pd.window)
+		return
+	}
+
+	for _, op := range pd.plan.BatchOperations() {
+		pd.queue.AddOperation(op)
+	}
+
+	if pd.createNow {
+		pd.createAll()
+		return
+	}
+
+	if pd.onAccept != nil {
+		pd.onAccept()
+	}
+}
+
+// createAll runs the queued create operations in order with a progress
+// dialog, stopping at the first failure
+func (pd *CapacityPlannerDialog) createAll() {
+	progressBar := widget.NewProgressBar()
+	statusLabel := widget.NewLabel("Starting...")
+	progressDialog := dialog.NewCustomWithoutButtons("Creating Partitions",
+		container.NewVBox(statusLabel, progressBar), pd.window)
+	progressDialog.Show()
+
+	go func() {
+		err := pd.queue.ExecuteAll(true, partition.ProgressFunc(func(done, total uint64, description string) {
+			statusLabel.SetText(fmt.Sprintf("Step %d of %d: %s", done+1, total, description))
+			progressBar.SetValue(partition.ProgressPercent(done, total) / 100)
+		}))
+		progressDialog.Hide()
+
+		created := pd.queue.GetCompletedCount()
+		if err != nil {
+			dialog.ShowError(fmt.Errorf("created %d of %d partitions: %w", created, pd.queue.Count(), err), pd.window)
+		} else {
+			showSuccess(pd.window, fmt.Sprintf("Created %d partitions on %s", created, pd.disk.Name))
+		}
+
+		if pd.onAccept != nil {
+			pd.onAccept()
+		}
+	}()
+}
@@ -0,0 +1,188 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+	"github.com/pgsdf/pgpart/internal/partition"
+)
+
+// maxLogLines bounds the log pane; dd reports progress every second, so a
+// long copy would otherwise grow it without limit
+const maxLogLines = 500
+
+// OperationProgressDialog shows a long operation such as a copy: a progress
+// bar, the current step, an ETA and an expandable log of what it is doing.
+// It implements partition.OperationLogger and partition.ProgressReporter,
+// so it can be passed straight to the WithLog variants of the operations.
+type OperationProgressDialog struct {
+	window      fyne.Window
+	dialog      *dialog.CustomDialog
+	stepLabel   *widget.Label
+	etaLabel    *widget.Label
+	progressBar *widget.ProgressBar
+	logLabel    *widget.Label
+	logScroll   *container.Scroll
+	logPane     *widget.Accordion
+
+	mu         sync.Mutex
+	lines      []string
+	start      time.Time
+	phaseStart time.Time // start of the part SetProgress reports on
+}
+
+// NewOperationProgressDialog creates a progress dialog titled title
+func NewOperationProgressDialog(window fyne.Window, title string) *OperationProgressDialog {
+	pd := &OperationProgressDialog{
+		window:      window,
+		stepLabel:   widget.NewLabel("Preparing..."),
+		etaLabel:    widget.NewLabel(""),
+		progressBar: widget.NewProgressBar(),
+		logLabel:    widget.NewLabel(""),
+	}
+	pd.stepLabel.Wrapping = fyne.TextWrapWord
+	pd.logLabel.TextStyle = fyne.TextStyle{Monospace: true}
+	pd.logScroll = container.NewVScroll(pd.logLabel)
+	pd.logScroll.SetMinSize(fyne.NewSize(0, 160))
+	pd.logPane = widget.NewAccordion(widget.NewAccordionItem("Log", pd.logScroll))
+
+	content := container.NewVBox(
+		pd.stepLabel,
+		pd.progressBar,
+		pd.etaLabel,
+		pd.logPane,
+	)
+
+	pd.dialog = dialog.NewCustomWithoutButtons(title, content, window)
+	pd.dialog.SetButtons([]fyne.CanvasObject{
+		widget.NewButton("Hide", pd.dialog.Hide),
+	})
+	pd.dialog.Resize(fyne.NewSize(560, 200))
+	return pd
+}
+
+// Show displays the dialog and starts the clock used for the ETA
+func (pd *OperationProgressDialog) Show() {
+	pd.mu.Lock()
+	pd.start = time.Now()
+	pd.phaseStart = pd.start
+	pd.mu.Unlock()
+	pd.dialog.Show()
+}
+
+// ResetProgress empties the progress bar and restarts the ETA clock for an
+// operation that reports progress for several phases, such as a copy
+// followed by its verification. Elapsed still counts from Show.
+func (pd *OperationProgressDialog) ResetProgress() {
+	pd.mu.Lock()
+	pd.phaseStart = time.Now()
+	pd.mu.Unlock()
+	pd.progressBar.SetValue(0)
+	pd.etaLabel.SetText("")
+}
+
+// SetCancel adds a Cancel button that calls cancel, for operations that
+// can be stopped partway. A nil cancel removes the button again, e.g. once
+// the part that can be stopped is over.
+func (pd *OperationProgressDialog) SetCancel(cancel func()) {
+	buttons := []fyne.CanvasObject{widget.NewButton("Hide", pd.dialog.Hide)}
+	if cancel != nil {
+		var cancelBtn *widget.Button
+		cancelBtn = widget.NewButton("Cancel", func() {
+			cancelBtn.Disable()
+			pd.stepLabel.SetText("Cancelling...")
+			cancel()
+		})
+		buttons = append(buttons, cancelBtn)
+	}
+	pd.dialog.SetButtons(buttons)
+}
+
+// Step shows the step the operation has moved on to and logs it
+func (pd *OperationProgressDialog) Step(description string) {
+	pd.stepLabel.SetText(description)
+	pd.Log("▶ " + description)
+}
+
+// Log appends a timestamped line to the log pane
+func (pd *OperationProgressDialog) Log(line string) {
+	pd.mu.Lock()
+	pd.lines = append(pd.lines, fmt.Sprintf("%s  %s", time.Now().Format("15:04:05"), line))
+	if len(pd.lines) > maxLogLines {
+		pd.lines = pd.lines[len(pd.lines)-maxLogLines:]
+	}
+	text := strings.Join(pd.lines, "\n")
+	pd.mu.Unlock()
+
+	pd.logLabel.SetText(text)
+	pd.logScroll.ScrollToBottom()
+}
+
+// SetProgress updates the progress bar and the estimate of the time left
+// from a percentage
+func (pd *OperationProgressDialog) SetProgress(percent float64) {
+	pd.progressBar.SetValue(percent / 100.0)
+
+	pd.mu.Lock()
+	elapsed := time.Since(pd.phaseStart)
+	pd.mu.Unlock()
+
+	text := fmt.Sprintf("%.1f%% - elapsed %s", percent, elapsed.Round(time.Second))
+	if percent > 0 && percent < 100 {
+		remaining := time.Duration(float64(elapsed) * (100 - percent) / percent)
+		text += fmt.Sprintf(", about %s left", remaining.Round(time.Second))
+	}
+	pd.etaLabel.SetText(text)
+}
+
+// Update implements partition.ProgressReporter. Operations that report
+// their own speed and time left, such as copies, pass them as the message,
+// which is shown in place of the dialog's estimate.
+func (pd *OperationProgressDialog) Update(done, total uint64, message string) {
+	percent := partition.ProgressPercent(done, total)
+	if message == "" {
+		pd.SetProgress(percent)
+		return
+	}
+	pd.progressBar.SetValue(percent / 100.0)
+
+	pd.mu.Lock()
+	elapsed := time.Since(pd.phaseStart)
+	pd.mu.Unlock()
+
+	pd.etaLabel.SetText(fmt.Sprintf("%.1f%% - elapsed %s, %s", percent, elapsed.Round(time.Second), message))
+}
+
+// Elapsed returns the time since the dialog was shown
+func (pd *OperationProgressDialog) Elapsed() time.Duration {
+	pd.mu.Lock()
+	defer pd.mu.Unlock()
+	return time.Since(pd.start)
+}
+
+// Finish ends the operation. On success the dialog closes; on failure it
+// stays open with the log expanded so the user can see what went wrong.
+func (pd *OperationProgressDialog) Finish(err error) {
+	if err == nil {
+		pd.dialog.Hide()
+		return
+	}
+
+	pd.stepLabel.SetText(fmt.Sprintf("Failed: %v", err))
+	pd.stepLabel.Importance = widget.DangerImportance
+	pd.stepLabel.Refresh()
+	pd.Log(fmt.Sprintf("Error: %v", err))
+	pd.etaLabel.SetText("")
+	pd.logPane.Open(0)
+	pd.dialog.SetButtons([]fyne.CanvasObject{
+		widget.NewButton("Close", pd.dialog.Hide),
+	})
+	pd.dialog.Resize(fyne.NewSize(560, 380))
+	pd.dialog.Show()
+}
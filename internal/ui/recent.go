@@ -0,0 +1,30 @@
+package ui
+
+import "fyne.io/fyne/v2"
+
+// Preferences storing the last choices made in the create and format
+// dialogs, which become their defaults
+const (
+	lastFilesystemKey    = "lastFilesystem"
+	lastPartitionTypeKey = "lastPartitionType"
+)
+
+// rememberedChoice returns the choice stored under key if it is still one
+// of options, and fallback otherwise
+func rememberedChoice(key string, options []string, fallback string) string {
+	last := fyne.CurrentApp().Preferences().String(key)
+	for _, option := range options {
+		if option == last {
+			return last
+		}
+	}
+	return fallback
+}
+
+// rememberChoice stores choice under key for rememberedChoice
+func rememberChoice(key, choice string) {
+	if choice == "" {
+		return
+	}
+	fyne.CurrentApp().Preferences().SetString(key, choice)
+}
@@ -0,0 +1,65 @@
+package ui
+
+import (
+	"sync"
+	"time"
+)
+
+// defaultRefreshDebounce is how long DebouncedRefresh waits for further
+// requests before rescanning
+const defaultRefreshDebounce = 500 * time.Millisecond
+
+// refreshDebouncer coalesces refresh requests that arrive within a short
+// window into a single call
+type refreshDebouncer struct {
+	mu    sync.Mutex
+	delay time.Duration
+	timer *time.Timer
+	run   func()
+}
+
+// request schedules run after the debounce delay, pushing back a run that
+// is already scheduled. The last request of a burst is always followed by
+// a run, so the view is never left stale.
+func (d *refreshDebouncer) request() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.timer != nil {
+		d.timer.Stop()
+	}
+
+	var timer *time.Timer
+	timer = time.AfterFunc(d.delay, func() {
+		d.mu.Lock()
+		if d.timer != timer {
+			// Superseded by a later request
+			d.mu.Unlock()
+			return
+		}
+		d.timer = nil
+		d.mu.Unlock()
+
+		d.run()
+	})
+	d.timer = timer
+}
+
+// DebouncedRefresh requests a rescan of the disks. Requests made within
+// the debounce window of each other, such as those from the steps of a
+// batch, are coalesced into one rescan after the last of them.
+func (mw *MainWindow) DebouncedRefresh() {
+	mw.refreshDebounce.request()
+}
+
+// SetRefreshDebounce changes the debounce window of DebouncedRefresh. A
+// zero or negative delay restores the default.
+func (mw *MainWindow) SetRefreshDebounce(delay time.Duration) {
+	if delay <= 0 {
+		delay = defaultRefreshDebounce
+	}
+
+	mw.refreshDebounce.mu.Lock()
+	defer mw.refreshDebounce.mu.Unlock()
+	mw.refreshDebounce.delay = delay
+}
@@ -3,7 +3,6 @@ package ui
 import (
 	"fmt"
 	"strconv"
-	"strings"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/container"
@@ -16,14 +15,16 @@ type ResizeDialog struct {
 	window    fyne.Window
 	disk      *partition.Disk
 	partition *partition.Partition
+	history   *partition.OperationHistory
 	onResize  func()
 }
 
-func NewResizeDialog(window fyne.Window, disk *partition.Disk, part *partition.Partition, onResize func()) *ResizeDialog {
+func NewResizeDialog(window fyne.Window, disk *partition.Disk, part *partition.Partition, history *partition.OperationHistory, onResize func()) *ResizeDialog {
 	return &ResizeDialog{
 		window:    window,
 		disk:      disk,
 		partition: part,
+		history:   history,
 		onResize:  onResize,
 	}
 }
@@ -34,7 +35,7 @@ func (rd *ResizeDialog) Show() {
 
 	maxSize := rd.calculateMaxSize()
 	maxSizeMB := maxSize * 512 / (1024 * 1024)
-	minSizeMB := uint64(10)
+	minSizeMB := (partition.MinimumSizeForPartition(rd.partition) + 1024*1024 - 1) / (1024 * 1024)
 
 	currentLabel := widget.NewLabel(fmt.Sprintf("Current Size: %s (%d MB)", currentSizeStr, currentSizeMB))
 	currentLabel.Wrapping = fyne.TextWrapWord
@@ -167,11 +168,24 @@ func (rd *ResizeDialog) Show() {
 				return
 			}
 
-			if sizeMB < minSizeMB || sizeMB > maxSizeMB {
+			if sizeMB < minSizeMB {
+				fsLabel := rd.partition.FileSystem
+				if fsLabel == "" || fsLabel == "unknown" {
+					fsLabel = rd.partition.Type
+				}
+				dialog.ShowError(fmt.Errorf("size must be at least %d MB to hold %s", minSizeMB, fsLabel), rd.window)
+				return
+			}
+			if sizeMB > maxSizeMB {
 				dialog.ShowError(fmt.Errorf("size must be between %d MB and %d MB", minSizeMB, maxSizeMB), rd.window)
 				return
 			}
 
+			if err := partition.CheckZFSShrink(rd.partition, sizeMB*1024*1024); err != nil {
+				dialog.ShowError(err, rd.window)
+				return
+			}
+
 			if sizeMB == currentSizeMB {
 				dialog.ShowInformation("No Changes", "Partition size unchanged", rd.window)
 				return
@@ -198,15 +212,13 @@ func (rd *ResizeDialog) calculateMaxSize() uint64 {
 }
 
 func (rd *ResizeDialog) performResize(newSizeBytes uint64, useOnlineResize bool) {
-	parts := strings.Split(rd.partition.Name, "p")
-	if len(parts) < 2 {
-		dialog.ShowError(fmt.Errorf("invalid partition name format"), rd.window)
+	// The index may be a slice and letter, e.g. 1a for ada0s1a
+	_, index, err := partition.ParsePartitionName(rd.partition.Name)
+	if err != nil {
+		dialog.ShowError(err, rd.window)
 		return
 	}
 
-	index := parts[len(parts)-1]
-
-	var err error
 	if useOnlineResize {
 		// Perform online resize (partition + filesystem together)
 		err = partition.PerformOnlineResize(rd.disk.Name, index, newSizeBytes, rd.partition)
@@ -214,18 +226,104 @@ func (rd *ResizeDialog) performResize(newSizeBytes uint64, useOnlineResize bool)
 			dialog.ShowError(fmt.Errorf("online resize failed: %w", err), rd.window)
 			return
 		}
-		dialog.ShowInformation("Success", "Partition and filesystem resized online successfully!\nThe filesystem remained mounted during the operation.", rd.window)
+		rd.recordResize(index, newSizeBytes, true)
+		showSuccess(rd.window, "Partition and filesystem resized online successfully!\nThe filesystem remained mounted during the operation.")
 	} else {
-		// Perform offline resize (partition only)
-		err = partition.ResizePartition(rd.disk.Name, index, newSizeBytes)
+		// An offline resize must not touch a mounted filesystem
+		if rd.partition.MountPoint != "" {
+			rd.confirmUnmountedResize(index, newSizeBytes)
+			return
+		}
+
+		// Perform offline resize, shrinking the filesystem before the
+		// partition or growing it after
+		fsResized, err := partition.ResizeWithFilesystem(rd.disk.Name, index, newSizeBytes, rd.partition)
 		if err != nil {
 			dialog.ShowError(fmt.Errorf("resize failed: %w", err), rd.window)
 			return
 		}
-		dialog.ShowInformation("Success", "Partition resized successfully.\nYou may need to resize the filesystem separately if it exists.", rd.window)
+		rd.recordResize(index, newSizeBytes, fsResized)
+		showSuccess(rd.window, resizeSuccessMessage(fsResized, ""))
 	}
 
 	if rd.onResize != nil {
 		rd.onResize()
 	}
 }
+
+// confirmUnmountedResize offers to unmount a mounted partition, resize it
+// offline and mount it again afterwards
+func (rd *ResizeDialog) confirmUnmountedResize(index string, newSizeBytes uint64) {
+	mountPoint := rd.partition.MountPoint
+
+	dialog.ShowConfirm("Partition Is Mounted",
+		fmt.Sprintf("%s is mounted at %s.\n\nAn offline resize requires the filesystem to be unmounted.\nUnmount %s, resize the partition and mount it again?",
+			rd.partition.Name, mountPoint, mountPoint),
+		func(confirmed bool) {
+			if !confirmed {
+				dialog.ShowInformation("Resize Cancelled", fmt.Sprintf("Unmount %s first, then retry the resize.", mountPoint), rd.window)
+				return
+			}
+
+			if err := partition.UnmountPartition(rd.partition.Name); err != nil {
+				dialog.ShowError(err, rd.window)
+				return
+			}
+			// Don't resize unless the filesystem is really gone, e.g. it
+			// wasn't also mounted through its label somewhere else
+			if still, err := partition.CurrentMountPoint(rd.partition.Name); err != nil || still != "" {
+				if err == nil {
+					err = fmt.Errorf("%s is still mounted at %s; unmount it and retry the resize", rd.partition.Name, still)
+				}
+				dialog.ShowError(err, rd.window)
+				return
+			}
+
+			unmounted := *rd.partition
+			unmounted.MountPoint = ""
+			fsResized, resizeErr := partition.ResizeWithFilesystem(rd.disk.Name, index, newSizeBytes, &unmounted)
+			if resizeErr == nil {
+				rd.recordResize(index, newSizeBytes, fsResized)
+			}
+			mountWithMkdir(rd.window, rd.partition, mountPoint, func(mountErr error) {
+				switch {
+				case resizeErr != nil && mountErr != nil:
+					dialog.ShowError(fmt.Errorf("resize failed: %v\n\nRemounting %s also failed: %v", resizeErr, mountPoint, mountErr), rd.window)
+				case resizeErr != nil:
+					dialog.ShowError(fmt.Errorf("resize failed: %w", resizeErr), rd.window)
+				case mountErr != nil:
+					dialog.ShowError(fmt.Errorf("partition resized, but remounting %s failed: %w", mountPoint, mountErr), rd.window)
+				default:
+					showSuccess(rd.window, resizeSuccessMessage(fsResized, mountPoint))
+				}
+
+				if rd.onResize != nil {
+					rd.onResize()
+				}
+			})
+		}, rd.window)
+}
+
+// resizeSuccessMessage describes a completed offline resize. mountPoint is
+// set when the partition was remounted afterwards.
+func resizeSuccessMessage(fsResized bool, mountPoint string) string {
+	msg := "Partition resized successfully"
+	if fsResized {
+		msg = "Partition and filesystem resized successfully"
+	}
+	if mountPoint != "" {
+		msg += fmt.Sprintf(" and remounted at %s", mountPoint)
+	}
+	msg += "."
+	if !fsResized {
+		msg += "\nYou may need to resize the filesystem separately if it exists."
+	}
+	return msg
+}
+
+// recordResize adds a completed resize to the operation history
+func (rd *ResizeDialog) recordResize(index string, newSizeBytes uint64, filesystemResized bool) {
+	if rd.history != nil {
+		rd.history.RecordResize(rd.disk.Name, index, rd.partition.Size*512, newSizeBytes, filesystemResized)
+	}
+}
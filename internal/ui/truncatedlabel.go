@@ -0,0 +1,92 @@
+package ui
+
+import (
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/driver/desktop"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+)
+
+// truncatedLabel is a single-line label for values of unbounded length,
+// such as the model strings of enterprise drives. Text that doesn't fit is
+// ellipsized instead of widening the layout; hovering shows the full value
+// and a right-click copies it to the clipboard.
+type truncatedLabel struct {
+	widget.Label
+	popUp *widget.PopUp
+}
+
+// newTruncatedLabel creates a truncatedLabel showing text
+func newTruncatedLabel(text string) *truncatedLabel {
+	l := &truncatedLabel{}
+	l.ExtendBaseWidget(l)
+	l.Truncation = fyne.TextTruncateEllipsis
+	l.SetText(text)
+	return l
+}
+
+// truncated reports whether the text is wider than the label
+func (l *truncatedLabel) truncated() bool {
+	textWidth := fyne.MeasureText(l.Text, theme.TextSize(), l.TextStyle).Width
+	return textWidth+2*theme.InnerPadding() > l.Size().Width
+}
+
+// MouseIn shows the full text below the label when it is truncated
+func (l *truncatedLabel) MouseIn(*desktop.MouseEvent) {
+	if l.Text == "" || !l.truncated() {
+		return
+	}
+
+	c := fyne.CurrentApp().Driver().CanvasForObject(l)
+	if c == nil {
+		return
+	}
+
+	full := widget.NewLabel(l.Text)
+	full.Wrapping = fyne.TextWrapBreak
+	l.popUp = widget.NewPopUp(full, c)
+
+	// Never wider than the window; long values wrap instead
+	width := fyne.Min(full.MinSize().Width, c.Size().Width)
+	l.popUp.Resize(fyne.NewSize(width, full.MinSize().Height))
+
+	pos := fyne.CurrentApp().Driver().AbsolutePositionForObject(l)
+	pos = pos.AddXY(0, l.Size().Height)
+	if pos.X+width > c.Size().Width {
+		pos.X = c.Size().Width - width
+	}
+	l.popUp.ShowAtPosition(pos)
+}
+
+// MouseMoved is required by desktop.Hoverable
+func (l *truncatedLabel) MouseMoved(*desktop.MouseEvent) {}
+
+// MouseOut hides the full text
+func (l *truncatedLabel) MouseOut() {
+	if l.popUp != nil {
+		l.popUp.Hide()
+		l.popUp = nil
+	}
+}
+
+// TappedSecondary copies the full text to the clipboard
+func (l *truncatedLabel) TappedSecondary(*fyne.PointEvent) {
+	if l.Text == "" {
+		return
+	}
+	if w := windowForObject(l); w != nil {
+		w.Clipboard().SetContent(l.Text)
+		showSuccess(w, "Copied to clipboard")
+	}
+}
+
+// windowForObject returns the window showing obj, if any
+func windowForObject(obj fyne.CanvasObject) fyne.Window {
+	c := fyne.CurrentApp().Driver().CanvasForObject(obj)
+	for _, w := range fyne.CurrentApp().Driver().AllWindows() {
+		if w.Canvas() == c {
+			return w
+		}
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package ui
+
+import (
+	"fmt"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+	"github.com/pgsdf/pgpart/internal/partition"
+)
+
+// TuneUFSDialog manages the dialog for toggling soft updates and
+// journaling on UFS partitions
+type TuneUFSDialog struct {
+	window   fyne.Window
+	disk     *partition.Disk
+	onUpdate func()
+}
+
+// NewTuneUFSDialog creates a new UFS tuning dialog for the partitions of disk
+func NewTuneUFSDialog(window fyne.Window, disk *partition.Disk, onUpdate func()) *TuneUFSDialog {
+	return &TuneUFSDialog{
+		window:   window,
+		disk:     disk,
+		onUpdate: onUpdate,
+	}
+}
+
+// Show displays the UFS tuning dialog
+func (td *TuneUFSDialog) Show() {
+	var ufsParts []*partition.Partition
+	var partNames []string
+	for i := range td.disk.Partitions {
+		part := &td.disk.Partitions[i]
+		if partition.IsUFS(part) {
+			ufsParts = append(ufsParts, part)
+			partNames = append(partNames, part.Name)
+		}
+	}
+
+	if len(ufsParts) == 0 {
+		dialog.ShowInformation("No UFS Partitions", "This disk has no UFS partitions", td.window)
+		return
+	}
+
+	statusLabel := widget.NewLabel("")
+	statusLabel.Wrapping = fyne.TextWrapWord
+	softUpdatesCheck := widget.NewCheck("Soft updates (tunefs -n)", nil)
+	journalingCheck := widget.NewCheck("Soft updates journaling (tunefs -j)", nil)
+
+	var selected *partition.Partition
+	softUpdatesCheck.OnChanged = func(checked bool) {
+		// Journaling only exists on top of soft updates
+		if checked {
+			journalingCheck.Enable()
+		} else {
+			journalingCheck.SetChecked(false)
+			journalingCheck.Disable()
+		}
+	}
+
+	partSelect := widget.NewSelect(partNames, func(name string) {
+		for _, part := range ufsParts {
+			if part.Name == name {
+				selected = part
+			}
+		}
+
+		tuning, err := partition.GetUFSTuning(selected)
+		if err != nil {
+			statusLabel.SetText(fmt.Sprintf("Failed to read settings: %v", err))
+			return
+		}
+
+		softUpdatesCheck.SetChecked(tuning.SoftUpdates)
+		journalingCheck.SetChecked(tuning.Journaling)
+		if selected.MountPoint != "" {
+			statusLabel.SetText(fmt.Sprintf("Current: %s\nMounted at %s - unmount it to change these settings.", tuning, selected.MountPoint))
+			softUpdatesCheck.Disable()
+			journalingCheck.Disable()
+		} else {
+			statusLabel.SetText(fmt.Sprintf("Current: %s", tuning))
+			softUpdatesCheck.Enable()
+			softUpdatesCheck.OnChanged(tuning.SoftUpdates)
+		}
+	})
+	softUpdatesCheck.Disable()
+	journalingCheck.Disable()
+
+	infoLabel := widget.NewLabel("Soft updates order metadata writes so the filesystem stays consistent after a crash. Journaling (SU+J) additionally lets fsck recover in seconds instead of scanning the whole filesystem.")
+	infoLabel.Wrapping = fyne.TextWrapWord
+	infoLabel.TextStyle = fyne.TextStyle{Italic: true}
+
+	content := container.NewVBox(
+		widget.NewForm(widget.NewFormItem("Partition", partSelect)),
+		statusLabel,
+		softUpdatesCheck,
+		journalingCheck,
+		widget.NewSeparator(),
+		infoLabel,
+	)
+
+	customDialog := dialog.NewCustomConfirm("Tune UFS", "Apply", "Cancel", content,
+		func(ok bool) {
+			if !ok {
+				return
+			}
+
+			if selected == nil {
+				dialog.ShowError(fmt.Errorf("please select a partition"), td.window)
+				return
+			}
+
+			tuning := partition.UFSTuning{
+				SoftUpdates: softUpdatesCheck.Checked,
+				Journaling:  journalingCheck.Checked,
+			}
+			if err := partition.SetUFSTuning(selected, tuning); err != nil {
+				dialog.ShowError(fmt.Errorf("failed to tune %s: %w", selected.Name, err), td.window)
+				return
+			}
+
+			showSuccess(td.window, fmt.Sprintf("%s now uses %s", selected.Name, tuning))
+			if td.onUpdate != nil {
+				td.onUpdate()
+			}
+		}, td.window)
+
+	customDialog.Resize(fyne.NewSize(480, 340))
+	customDialog.Show()
+}
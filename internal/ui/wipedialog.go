@@ -0,0 +1,145 @@
+package ui
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+	"github.com/pgsdf/pgpart/internal/partition"
+)
+
+// WipeDialog securely erases a partition or a whole disk before it is
+// disposed of or handed on
+type WipeDialog struct {
+	window     fyne.Window
+	disk       *partition.Disk
+	onComplete func()
+}
+
+// NewWipeDialog creates a dialog for wiping disk or one of its partitions
+func NewWipeDialog(window fyne.Window, disk *partition.Disk, onComplete func()) *WipeDialog {
+	return &WipeDialog{
+		window:     window,
+		disk:       disk,
+		onComplete: onComplete,
+	}
+}
+
+// Show displays the wipe options
+func (wd *WipeDialog) Show() {
+	wholeDisk := fmt.Sprintf("%s (whole disk)", wd.disk.Name)
+	targets := []string{wholeDisk}
+	for _, part := range wd.disk.Partitions {
+		targets = append(targets, part.Name)
+	}
+
+	targetSelect := widget.NewSelect(targets, nil)
+	targetSelect.SetSelected(targets[len(targets)-1])
+
+	methodSelect := widget.NewSelect(partition.WipeMethods, nil)
+	methodSelect.SetSelected(partition.WipeAuto)
+
+	passesEntry := widget.NewEntry()
+	passesEntry.SetText("1")
+	passesEntry.Validator = func(text string) error {
+		if n, err := strconv.Atoi(strings.TrimSpace(text)); err != nil || n < 1 {
+			return fmt.Errorf("enter a number of passes of at least 1")
+		}
+		return nil
+	}
+
+	ataNote := "This drive does not support ATA secure erase; the whole disk is overwritten instead."
+	if sec := partition.GetATASecurity(wd.disk.Name); sec.CanErase() {
+		ataNote = "This drive supports ATA secure erase, which \"auto\" uses when the whole disk is wiped and the drive is an SSD; hard disks are overwritten with zeros."
+	} else if sec.Frozen {
+		ataNote = "This drive supports ATA secure erase, but it is frozen until the machine is suspended and resumed or the drive is replugged."
+	}
+	note := widget.NewLabel("zero and random overwrite every block the given number of times. " +
+		"On SSDs, overwriting can miss blocks the drive has remapped; wipe the whole disk with an ATA secure erase for those. " + ataNote)
+	note.Wrapping = fyne.TextWrapWord
+
+	dialog.ShowForm("Secure Erase", "Next", "Cancel",
+		[]*widget.FormItem{
+			widget.NewFormItem("Wipe", targetSelect),
+			widget.NewFormItem("Method", methodSelect),
+			widget.NewFormItem("Passes", passesEntry),
+			widget.NewFormItem("", note),
+		},
+		func(ok bool) {
+			if !ok {
+				return
+			}
+
+			passes, err := strconv.Atoi(strings.TrimSpace(passesEntry.Text))
+			if err != nil || passes < 1 {
+				dialog.ShowError(fmt.Errorf("invalid number of passes: %s", passesEntry.Text), wd.window)
+				return
+			}
+
+			target := targetSelect.Selected
+			if target == wholeDisk {
+				target = wd.disk.Name
+			}
+			wd.confirm(target, methodSelect.Selected, passes)
+		}, wd.window)
+}
+
+// confirm asks for the name of the target to be typed before wiping it
+func (wd *WipeDialog) confirm(target, method string, passes int) {
+	nameEntry := widget.NewEntry()
+	nameEntry.SetPlaceHolder(target)
+
+	warning := widget.NewLabel(fmt.Sprintf("Every byte of %s will be overwritten. Nothing on it can be recovered afterwards, not even with recovery tools.\n\nType %s to confirm.", target, target))
+	warning.Wrapping = fyne.TextWrapWord
+	warning.Importance = widget.DangerImportance
+
+	var confirmDialog *dialog.CustomDialog
+	eraseBtn := widget.NewButton("Erase", func() {
+		confirmDialog.Hide()
+		wd.perform(target, method, passes)
+	})
+	eraseBtn.Importance = widget.DangerImportance
+	eraseBtn.Disable()
+	nameEntry.OnChanged = func(text string) {
+		if text == target {
+			eraseBtn.Enable()
+		} else {
+			eraseBtn.Disable()
+		}
+	}
+
+	content := container.NewVBox(warning, nameEntry)
+	confirmDialog = dialog.NewCustomWithoutButtons("Confirm Secure Erase", content, wd.window)
+	confirmDialog.SetButtons([]fyne.CanvasObject{
+		widget.NewButton("Cancel", func() { confirmDialog.Hide() }),
+		eraseBtn,
+	})
+	confirmDialog.Resize(fyne.NewSize(480, 220))
+	confirmDialog.Show()
+}
+
+// perform wipes target in the background behind a progress dialog
+func (wd *WipeDialog) perform(target, method string, passes int) {
+	progress := NewOperationProgressDialog(wd.window, fmt.Sprintf("Erasing %s", target))
+	progress.Show()
+
+	go func() {
+		err := partition.SecureWipeWithLog(target, passes, method, progress, progress)
+		if err != nil {
+			progress.Finish(fmt.Errorf("secure erase failed: %w", err))
+			return
+		}
+
+		progress.Finish(nil)
+		showSuccess(wd.window, fmt.Sprintf("%s erased successfully\n\nTime taken: %s",
+			target, progress.Elapsed().Round(time.Second)))
+		if wd.onComplete != nil {
+			wd.onComplete()
+		}
+	}()
+}
@@ -11,10 +11,18 @@ import (
 )
 
 func main() {
+	args := os.Args
+
+	// -fake-disks swaps in canned in-memory disks for UI testing
+	if len(args) > 1 && args[1] == "-fake-disks" {
+		partition.EnableFakeDisks()
+		args = append([]string{args[0]}, args[2:]...)
+	}
+
 	// Check if CLI mode (has command-line arguments)
-	if len(os.Args) > 1 && os.Args[1] != "-gui" {
+	if len(args) > 1 && args[1] != "-gui" {
 		// CLI mode
-		c := cli.NewCLI(os.Args)
+		c := cli.NewCLI(args)
 		os.Exit(c.Run())
 	}
 
@@ -22,12 +30,16 @@ func main() {
 	fmt.Println("PGPart - Partition Manager for FreeBSD/GhostBSD")
 	fmt.Println("================================================")
 
+	if partition.FakeDisksEnabled() {
+		fmt.Println("Using fake disks - no changes will be made to real devices.")
+	}
+
 	if err := partition.CheckPrivileges(); err != nil {
 		fmt.Fprintf(os.Stderr, "WARNING: %v\n", err)
 		fmt.Println("Some operations may be restricted. Run with sudo for full functionality.")
 	}
 
-	application := app.New()
+	application := app.NewWithID("org.pgsdf.pgpart")
 	application.Settings().SetTheme(&CustomTheme{})
 
 	mainWindow := ui.NewMainWindow(application)